@@ -2,17 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
 	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/idempotency"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/webhook"
 
 	"github.com/IgnacioBO/gomicro_enrollment/pkg/bootstrap"
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/grpchandler"
 	"github.com/IgnacioBO/gomicro_enrollment/pkg/handler" //Manejar ruteo facilmente (paths y metodos)
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/migrations"
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/pb"
 	"github.com/joho/godotenv"
+	"google.golang.org/grpc"
 
 	courseSdk "github.com/IgnacioBO/go_micro_sdk/course"
 	userSdk "github.com/IgnacioBO/go_micro_sdk/user"
@@ -31,16 +41,26 @@ func main() {
 		log.Fatal(err)
 	}
 
+	//Subcomando para correr las migraciones a mano en vez de levantar el server: go run cmd/main.go migrate up|down [steps]|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(os.Args[2:]); err != nil {
+			l.Fatal(err)
+		}
+		return
+	}
+
 	//Creamos un config que tenga la cant max de pagina por defecto
 	pageLimDef := os.Getenv("PAGINATOR_LIMIT_DEFAULT")
 	if pageLimDef == "" {
 		l.Fatal("paginator limit default is required")
 	}
-	enrollmentConfig := enrollment.Config{LimitPageDefault: pageLimDef}
+	//Maximo de items que acepta POST /enrollments/bulk (0 = sin limite)
+	bulkMaxItems, _ := strconv.Atoi(os.Getenv("BULK_MAX_ITEMS"))
+	enrollmentConfig := enrollment.Config{LimitPageDefault: pageLimDef, BulkMaxItems: bulkMaxItems}
 
-	//DSN (Data Source Name) es una cadena de conexion de BBDD (tipo, servidor, nombre bbdd, user, pass)
-	//Creamos un script bootsrap.go que INICIALIZA la conexion usando gorm y varaibles de entoero
-	db, err := bootstrap.DBConnection()
+	//Generaremos un objeto repo (que recibe la bbdd y logger) que luego le pasaremos a la capa servicio
+	//bootstrap.Repositories conecta la bbdd (con gorm y varaibles de entoero) o usa los repos en memoria si DB_DRIVER=memory
+	enrollmentRepo, webhookRepo, idempotencyRepo, err := bootstrap.Repositories(l)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -53,21 +73,203 @@ func main() {
 	courseTrans := courseSdk.NewHttpClient(os.Getenv("API_COURSE_URL"), courseToken)
 	userTrans := userSdk.NewHttpClient(os.Getenv("API_USER_URL"), courseUser)
 
+	//Circuit breakers para no esperar a que cada request falle cuando users o courses estan caidos
+	breakerCfg := enrollment.DefaultBreakerConfig
+	if threshold, err := strconv.Atoi(os.Getenv("BREAKER_FAILURE_THRESHOLD")); err == nil {
+		breakerCfg.FailureThreshold = threshold
+	}
+	if openTimeout, err := time.ParseDuration(os.Getenv("BREAKER_OPEN_TIMEOUT")); err == nil {
+		breakerCfg.OpenTimeout = openTimeout
+	}
+	if halfOpenCalls, err := strconv.Atoi(os.Getenv("BREAKER_HALF_OPEN_MAX_CALLS")); err == nil {
+		breakerCfg.HalfOpenMaxCalls = halfOpenCalls
+	}
+	userBreaker := enrollment.NewCircuitBreaker("user", breakerCfg)
+	courseBreaker := enrollment.NewCircuitBreaker("course", breakerCfg)
+	userTrans = enrollment.NewUserBreaker(userTrans, userBreaker)
+	courseTrans = enrollment.NewCourseBreaker(courseTrans, courseBreaker)
+	enrollmentConfig.Breakers = []*enrollment.CircuitBreaker{userBreaker, courseBreaker}
+
+	//Cache de users y courses (van por fuera del breaker, asi un hit no pasa por el circuito). Con CACHE_TTL=0 se desactiva
+	cacheCfg := enrollment.DefaultCacheConfig
+	if ttl, err := time.ParseDuration(os.Getenv("CACHE_TTL")); err == nil {
+		cacheCfg.TTL = ttl
+	}
+	if notFoundTTL, err := time.ParseDuration(os.Getenv("CACHE_NOT_FOUND_TTL")); err == nil {
+		cacheCfg.NotFoundTTL = notFoundTTL
+	}
+	if maxEntries, err := strconv.Atoi(os.Getenv("CACHE_MAX_ENTRIES")); err == nil {
+		cacheCfg.MaxEntries = maxEntries
+	}
+	if cacheCfg.TTL > 0 {
+		userCache := enrollment.NewUserCache(userTrans, cacheCfg)
+		courseCache := enrollment.NewCourseCache(courseTrans, cacheCfg)
+		userTrans = userCache
+		courseTrans = courseCache
+		enrollmentConfig.Caches = []enrollment.CacheReporter{userCache, courseCache}
+	}
+
+	//Las transiciones de status permitidas se pueden sobreescribir por deploy, ej: ENROLLMENT_TRANSITIONS=P:A,A:S,S:I,A:I
+	var serviceOpts []enrollment.ServiceOption
+	if transitionsEnv := os.Getenv("ENROLLMENT_TRANSITIONS"); transitionsEnv != "" {
+		transitions, err := enrollment.ParseTransitions(transitionsEnv)
+		if err != nil {
+			l.Fatal(err)
+		}
+		serviceOpts = append(serviceOpts, enrollment.WithTransitions(transitions))
+	}
+	//Cuantos usuarios se validan en paralelo en el bulk
+	if bulkConcurrency, err := strconv.Atoi(os.Getenv("BULK_CONCURRENCY")); err == nil {
+		serviceOpts = append(serviceOpts, enrollment.WithBulkConcurrency(bulkConcurrency))
+	}
+	//Timeout por intento y reintentos de las llamadas a los microservicios de users y courses
+	upstreamCfg := enrollment.DefaultUpstreamConfig
+	if timeout, err := time.ParseDuration(os.Getenv("UPSTREAM_TIMEOUT")); err == nil {
+		upstreamCfg.Timeout = timeout
+	}
+	if retries, err := strconv.Atoi(os.Getenv("UPSTREAM_MAX_RETRIES")); err == nil {
+		upstreamCfg.MaxRetries = retries
+	}
+	if budget, err := time.ParseDuration(os.Getenv("UPSTREAM_BUDGET")); err == nil {
+		upstreamCfg.Budget = budget
+	}
+	serviceOpts = append(serviceOpts, enrollment.WithUpstreamConfig(upstreamCfg))
+	//Con ENROLLMENT_REACTIVATE=true, inscribir de nuevo a alguien Inactive lo vuelve a Pending en vez de dar 409
+	if os.Getenv("ENROLLMENT_REACTIVATE") == "true" {
+		serviceOpts = append(serviceOpts, enrollment.WithReactivate(true))
+	}
+
 	//Antes de repo, servicio, endpont, generamos un contexto
 	ctx := context.Background()
-	//Generaremos un objeto repo (que recibe la bbdd y logger) que luego le pasaremos a la capa servicio
-	enrollmentRepo := enrollment.NewRepo(l, db)
+
+	//Relay de la outbox: publica los eventos que el repo guarda en la tabla outbox (OUTBOX_PUBLISHER=stdout|file)
+	//con WEBHOOKS_ENABLED=true tambien los encola para los webhooks
+	//y con STREAM_ENABLED=true los manda al stream SSE de GET /enrollments/stream
+	//Sin ninguno de los tres no se publica nada y los eventos quedan pendientes en la tabla
+	var publishers []enrollment.Publisher
+	publisher, err := outboxPublisher()
+	if err != nil {
+		l.Fatal(err)
+	}
+	if publisher != nil {
+		publishers = append(publishers, publisher)
+	}
+	if os.Getenv("WEBHOOKS_ENABLED") == "true" {
+		publishers = append(publishers, webhook.NewDispatcher(l, webhookRepo))
+
+		//El Deliverer envia las entregas de los webhooks con reintentos (WEBHOOK_MAX_ATTEMPTS, WEBHOOK_BASE_BACKOFF, etc)
+		delivererCfg := webhook.DefaultDelivererConfig
+		if timeout, err := time.ParseDuration(os.Getenv("WEBHOOK_TIMEOUT")); err == nil {
+			delivererCfg.Timeout = timeout
+		}
+		if maxAttempts, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil {
+			delivererCfg.MaxAttempts = maxAttempts
+		}
+		if baseBackoff, err := time.ParseDuration(os.Getenv("WEBHOOK_BASE_BACKOFF")); err == nil {
+			delivererCfg.BaseBackoff = baseBackoff
+		}
+		if maxBackoff, err := time.ParseDuration(os.Getenv("WEBHOOK_MAX_BACKOFF")); err == nil {
+			delivererCfg.MaxBackoff = maxBackoff
+		}
+		delivererCfg.AllowPrivateNetworks = os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"
+		go webhook.NewDeliverer(l, webhookRepo, nil, delivererCfg).Run(ctx)
+	}
+	//El stream guarda los ultimos STREAM_BUFFER_SIZE eventos para que el cliente retome con Last-Event-ID
+	var streamBroker *enrollment.StreamBroker
+	if os.Getenv("STREAM_ENABLED") == "true" {
+		streamCfg := enrollment.DefaultStreamConfig
+		if bufferSize, err := strconv.Atoi(os.Getenv("STREAM_BUFFER_SIZE")); err == nil {
+			streamCfg.BufferSize = bufferSize
+		}
+		if heartbeat, err := time.ParseDuration(os.Getenv("STREAM_HEARTBEAT_INTERVAL")); err == nil {
+			streamCfg.HeartbeatInterval = heartbeat
+		}
+		streamBroker = enrollment.NewStreamBroker(streamCfg)
+		publishers = append(publishers, streamBroker)
+	}
+	if len(publishers) > 0 {
+		store, ok := enrollmentRepo.(enrollment.OutboxStore)
+		if !ok {
+			l.Fatal("the repository does not support the outbox")
+		}
+		relayCfg := enrollment.DefaultRelayConfig
+		if pollInterval, err := time.ParseDuration(os.Getenv("OUTBOX_POLL_INTERVAL")); err == nil {
+			relayCfg.PollInterval = pollInterval
+		}
+		if batchSize, err := strconv.Atoi(os.Getenv("OUTBOX_BATCH_SIZE")); err == nil {
+			relayCfg.BatchSize = batchSize
+		}
+		if maxAttempts, err := strconv.Atoi(os.Getenv("OUTBOX_MAX_ATTEMPTS")); err == nil {
+			relayCfg.MaxAttempts = maxAttempts
+		}
+		go enrollment.NewRelay(l, store, enrollment.NewMultiPublisher(publishers...), relayCfg).Run(ctx)
+	}
+
+	//Auth con JWT (HS256 y/o RS256), sin token valido se responde 401. Esta activo por defecto y sin llaves no arranca,
+	//AUTH_ENABLED=false lo desactiva (ej: local)
+	var verifier *auth.Verifier
+	var grpcOpts []grpc.ServerOption
+	if os.Getenv("AUTH_ENABLED") != "false" {
+		verifier, err = authVerifier()
+		if errors.Is(err, auth.ErrNoKeys) {
+			l.Fatal(fmt.Errorf("%w: auth is enabled by default, set JWT_JWKS_FILE, JWT_HS256_SECRET or JWT_RS256_PUBLIC_KEY(_FILE), or AUTH_ENABLED=false to run without auth", err))
+		}
+		if err != nil {
+			l.Fatal(err)
+		}
+		grpcOpts = append(grpcOpts, grpc.UnaryInterceptor(grpchandler.AuthInterceptor(verifier)))
+	} else {
+		l.Println("WARNING: AUTH_ENABLED=false, every request is accepted without a token and without the role policy")
+	}
+
 	//Crearemos un objeto de tipo servicio pasandole un objeto Repository (y logger) para luego pasarselo a la capa enpdoint
-	enrollmentService := enrollment.NewService(l, userTrans, courseTrans, enrollmentRepo)
+	enrollmentService := enrollment.NewService(l, userTrans, courseTrans, enrollmentRepo, serviceOpts...)
+	if verifier != nil {
+		//Con auth, la politica de roles (student, instructor, admin) va entre los endpoints y el service
+		enrollmentService = enrollment.NewPolicyService(enrollmentService)
+	}
 	//Crearemo un objeto de tipo endpoint y le pasamos el objeto creado (Service). Ademas le pasamos un user.Config
 	enrollmentEndpoint := enrollment.MakeEndpoints(enrollmentService, enrollmentConfig)
 	h := handler.NewUserHTTPServer(ctx, enrollmentEndpoint)
 
+	//El servidor gRPC usa los mismos endpoints, solo cambia el transporte
+	grpcServer := grpc.NewServer(grpcOpts...)
+	pb.RegisterEnrollmentServiceServer(grpcServer, grpchandler.NewEnrollmentGRPCServer(ctx, enrollmentEndpoint))
+
+	//Los POST de create y bulk con Idempotency-Key guardan la respuesta por IDEMPOTENCY_TTL y la repiten en los reintentos
+	idempotencyCfg := idempotency.DefaultConfig
+	if ttl, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL")); err == nil {
+		idempotencyCfg.TTL = ttl
+	}
+	idempotencyStore := idempotency.NewStore(l, idempotencyRepo, idempotencyCfg)
+	go idempotencyStore.Run(ctx)
+
+	//Los webhooks tienen su propio router, todo lo que empieza con /webhooks va para alla
+	webhookEndpoints := webhook.MakeEndpoints(webhook.NewService(l, webhookRepo), webhook.Config{LimitPageDefault: pageLimDef})
+	webhookHandler := handler.NewWebhookHTTPServer(ctx, webhookEndpoints)
+	if verifier != nil {
+		//Los webhooks reciben los eventos de todos los cursos, asi que solo los administra el admin
+		webhookHandler = handler.RequireRole(auth.RoleAdmin, webhookHandler)
+	}
+	rutas := http.NewServeMux()
+	rutas.Handle("/webhooks", webhookHandler)
+	rutas.Handle("/webhooks/", webhookHandler)
+	if streamBroker != nil {
+		//Va antes que el router de enrollments, si no /enrollments/stream caeria en /enrollments/{id}
+		rutas.Handle("GET /enrollments/stream", handler.NewStreamHandler(streamBroker))
+	}
+	rutas.Handle("/", handler.Idempotent(l, idempotencyStore, h, "/enrollments", "/enrollments/bulk"))
+	var api http.Handler = rutas
+	if verifier != nil {
+		//El health queda publico para los chequeos del orquestador
+		api = handler.Authenticate(verifier, rutas, "/health")
+	}
+
 	port := os.Getenv("PORT")
 	address := fmt.Sprintf("127.0.0.1:%s", port)
 
 	srv := &http.Server{
-		Handler:      accessControl(h), //Aquie le ponemos el acces control para deifnior op permitdas + el handler que definimos
+		Handler:      accessControl(api), //Aquie le ponemos el acces control para deifnior op permitdas + el handler que definimos
 		Addr:         address,
 		ReadTimeout:  5 * time.Second, //Con estos SETEAMOS TIMEOUT DE ESCRITURA Y DE LECTURA (cuanto timepo maximo la api permite)
 		WriteTimeout: 5 * time.Second, // Read es REQUEST, WRITE es RESPONE
@@ -83,6 +285,20 @@ func main() {
 		errCh <- srv.ListenAndServe() //Aqui ejecutamos el ListenAndServe y VAMOS A DEVOLVER UN ERROR al CANAL
 	}()
 
+	//gRPC escucha al lado del HTTP en GRPC_PORT (sin GRPC_PORT no se levanta), cualquiera de los dos que falle termina el proceso
+	if grpcPort := os.Getenv("GRPC_PORT"); grpcPort != "" {
+		go func() {
+			grpcAddress := fmt.Sprintf("127.0.0.1:%s", grpcPort)
+			listener, err := net.Listen("tcp", grpcAddress)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			l.Println("grpc listen in", grpcAddress)
+			errCh <- grpcServer.Serve(listener)
+		}()
+	}
+
 	//Aqui canal espera hasta recibir algo
 	err = <-errCh //Recibimos  el error el channel
 	if err != nil {
@@ -90,14 +306,71 @@ func main() {
 	}
 }
 
+// migrate conecta la bbdd (sin DB_MIGRATE, para que no aplique nada sola) y ejecuta el subcomando de migraciones
+func migrate(args []string) error {
+	dbConfig := bootstrap.DBConfigFromEnv()
+	dbConfig.Migrate = false
+	db, err := bootstrap.Open(dbConfig)
+	if err != nil {
+		return err
+	}
+	m, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	return migrations.Run(context.Background(), m, args, os.Stdout)
+}
+
+// authVerifier arma el validador de JWT con las llaves de JWT_JWKS_FILE, JWT_HS256_SECRET y JWT_RS256_PUBLIC_KEY(_FILE)
+// JWT_ISSUER y JWT_AUDIENCE se validan solo si vienen
+func authVerifier() (*auth.Verifier, error) {
+	keys, err := auth.LoadKeys(auth.KeyConfig{
+		JWKSFile:           os.Getenv("JWT_JWKS_FILE"),
+		HS256Secret:        os.Getenv("JWT_HS256_SECRET"),
+		RS256PublicKey:     os.Getenv("JWT_RS256_PUBLIC_KEY"),
+		RS256PublicKeyFile: os.Getenv("JWT_RS256_PUBLIC_KEY_FILE"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	cfg := auth.VerifierConfig{Issuer: os.Getenv("JWT_ISSUER"), Audience: os.Getenv("JWT_AUDIENCE")}
+	if leeway, err := time.ParseDuration(os.Getenv("JWT_LEEWAY")); err == nil {
+		cfg.Leeway = leeway
+	}
+	return auth.NewVerifier(keys, cfg)
+}
+
+// outboxPublisher arma el Publisher de OUTBOX_PUBLISHER: stdout, file (append en OUTBOX_FILE) o nil si viene vacio
+func outboxPublisher() (enrollment.Publisher, error) {
+	switch os.Getenv("OUTBOX_PUBLISHER") {
+	case "":
+		return nil, nil
+	case "stdout":
+		return enrollment.NewNDJSONPublisher(os.Stdout), nil
+	case "file":
+		path := os.Getenv("OUTBOX_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("OUTBOX_FILE is required with OUTBOX_PUBLISHER=file")
+		}
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		return enrollment.NewNDJSONPublisher(f), nil
+	default:
+		return nil, fmt.Errorf("invalid OUTBOX_PUBLISHER '%s', expected stdout or file", os.Getenv("OUTBOX_PUBLISHER"))
+	}
+}
+
 // Aqui definimo operaciones que PERMITIREMOS y ademas recibimso un Handler original (que sera el que creamo en el main)
 func accessControl(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		//Aqui definimos operacione spermitidas, origin con * para que puedan venir DEDE CUALQUIER CLIENTE O LADO
-		w.Header().Set("Access-Control-Allow-Origin", "*")                                //origin con * para que puedan venir DEDE CUALQUIER CLIENTE O LADO
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, OPTIONS, HEAD") //Metodos permitidos
+		w.Header().Set("Access-Control-Allow-Origin", "*")                                             //origin con * para que puedan venir DEDE CUALQUIER CLIENTE O LADO
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS, HEAD") //Metodos permitidos
 		w.Header().Set("Access-Control-Allow-Headers",
-			"Accept,Authorization,Cache-Control,Content-Type,DNT,If-Modified-Since,Keep-Alive,Origin,User-Agent,X-Requested-With") //Header permitidos
+			"Accept,Authorization,Cache-Control,Content-Type,DNT,If-Modified-Since,Keep-Alive,Origin,User-Agent,X-Requested-With,X-Actor,If-Match,Last-Event-ID,Idempotency-Key") //Header permitidos
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed") //Header que el browser deja leer al cliente
 
 		if r.Method == "OPTIONS" {
 			return
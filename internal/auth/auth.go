@@ -0,0 +1,45 @@
+// Package auth valida los JWT (HS256 y RS256) con los que se llama a la api y guarda sus claims en el contexto
+package auth
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Roles que entiende la politica de acceso de enrollments
+const (
+	RoleStudent    = "student"
+	RoleInstructor = "instructor"
+	RoleAdmin      = "admin"
+)
+
+// Claims son los claims del token, el Subject es el id del usuario que hace el request
+// Courses son los cursos que dicta (solo tiene sentido con el rol instructor)
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles   []string `json:"roles,omitempty"`
+	Courses []string `json:"courses,omitempty"`
+}
+
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type claimsKey struct{}
+
+// WithClaims guarda los claims del token validado en el contexto
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext devuelve los claims del request, ok es false si no paso por el middleware (ej: auth desactivado)
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
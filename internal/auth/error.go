@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrMissingToken = errors.New("bearer token required")
+var ErrNoKeys = errors.New("no keys configured to validate tokens")
+
+type ErrInvalidToken struct {
+	Cause error
+}
+
+func (e ErrInvalidToken) Error() string {
+	return fmt.Sprintf("invalid token: %v", e.Cause)
+}
+
+func (e ErrInvalidToken) Unwrap() error {
+	return e.Cause
+}
+
+type ErrUnknownKey struct {
+	Algorithm string
+	KeyID     string
+}
+
+func (e ErrUnknownKey) Error() string {
+	if e.KeyID == "" {
+		return fmt.Sprintf("no single key for '%s', the token must have a kid", e.Algorithm)
+	}
+	return fmt.Sprintf("key '%s' for '%s' not found", e.KeyID, e.Algorithm)
+}
+
+type ErrInvalidKey struct {
+	KeyID string
+	Cause error
+}
+
+func (e ErrInvalidKey) Error() string {
+	return fmt.Sprintf("invalid key '%s': %v", e.KeyID, e.Cause)
+}
+
+func (e ErrInvalidKey) Unwrap() error {
+	return e.Cause
+}
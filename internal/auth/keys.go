@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+// Key es una llave para validar firmas: Secret para HS256 o PublicKey para RS256
+// ID es el kid del header del token, puede ir vacio si es la unica llave de su algoritmo
+type Key struct {
+	ID        string
+	Algorithm string
+	Secret    []byte
+	PublicKey *rsa.PublicKey
+}
+
+type KeySet []Key
+
+// KeyConfig dice de donde se cargan las llaves, se pueden combinar (ej: JWKS con las RS256 y un secret HS256 en el env)
+type KeyConfig struct {
+	JWKSFile           string //Archivo JWKS con llaves RSA (kty RSA) y/o secrets (kty oct)
+	HS256Secret        string
+	RS256PublicKey     string //PEM de la llave publica
+	RS256PublicKeyFile string
+}
+
+// LoadKeys arma el KeySet con todo lo que venga en la config, sin ninguna llave devuelve ErrNoKeys
+func LoadKeys(cfg KeyConfig) (KeySet, error) {
+	var keys KeySet
+	if cfg.JWKSFile != "" {
+		data, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		jwks, err := ParseJWKS(data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, jwks...)
+	}
+	if cfg.HS256Secret != "" {
+		keys = append(keys, Key{Algorithm: AlgHS256, Secret: []byte(cfg.HS256Secret)})
+	}
+	publicPEM := []byte(cfg.RS256PublicKey)
+	if len(publicPEM) == 0 && cfg.RS256PublicKeyFile != "" {
+		var err error
+		if publicPEM, err = os.ReadFile(cfg.RS256PublicKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(publicPEM) > 0 {
+		publicKey, err := ParseRSAPublicKeyPEM(publicPEM)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, Key{Algorithm: AlgRS256, PublicKey: publicKey})
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	return keys, nil
+}
+
+// ParseRSAPublicKeyPEM acepta "PUBLIC KEY" (PKIX) y "RSA PUBLIC KEY" (PKCS1)
+func ParseRSAPublicKeyPEM(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey{Cause: errors.New("no PEM block found")}
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, ErrInvalidKey{Cause: err}
+		}
+		return publicKey, nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidKey{Cause: err}
+	}
+	publicKey, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrInvalidKey{Cause: fmt.Errorf("expected an RSA public key, got %T", parsed)}
+	}
+	return publicKey, nil
+}
+
+// jwk es una llave del JWKS (RFC 7517), solo los campos que usamos
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS lee un JWKS ({"keys": [...]}), las llaves con use distinto de sig (ej: enc) se ignoran
+func ParseJWKS(data []byte) (KeySet, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	var keys KeySet
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			if k.Alg != "" && k.Alg != AlgRS256 {
+				continue
+			}
+			publicKey, err := rsaDesdeJWK(k)
+			if err != nil {
+				return nil, ErrInvalidKey{KeyID: k.Kid, Cause: err}
+			}
+			keys = append(keys, Key{ID: k.Kid, Algorithm: AlgRS256, PublicKey: publicKey})
+		case "oct":
+			if k.Alg != "" && k.Alg != AlgHS256 {
+				continue
+			}
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) == 0 {
+				return nil, ErrInvalidKey{KeyID: k.Kid, Cause: errors.New("invalid k")}
+			}
+			keys = append(keys, Key{ID: k.Kid, Algorithm: AlgHS256, Secret: secret})
+		}
+	}
+	return keys, nil
+}
+
+func rsaDesdeJWK(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, errors.New("invalid n")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid e")
+	}
+	exponente := 0
+	for _, b := range e {
+		exponente = exponente<<8 | int(b)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponente}, nil
+}
+
+// lookup busca la llave del algoritmo con ese kid. Sin kid (o si el kid no esta) sirve la unica llave sin ID del algoritmo
+// Las llaves van separadas por algoritmo, asi una publica RSA nunca se usa como secret HS256
+func (ks KeySet) lookup(alg, kid string) (interface{}, error) {
+	var sinID []Key
+	for _, k := range ks {
+		if k.Algorithm != alg {
+			continue
+		}
+		if kid != "" && k.ID == kid {
+			return k.material(), nil
+		}
+		if k.ID == "" {
+			sinID = append(sinID, k)
+		}
+	}
+	if len(sinID) == 1 {
+		return sinID[0].material(), nil
+	}
+	return nil, ErrUnknownKey{Algorithm: alg, KeyID: kid}
+}
+
+func (k Key) material() interface{} {
+	if k.Algorithm == AlgHS256 {
+		return k.Secret
+	}
+	return k.PublicKey
+}
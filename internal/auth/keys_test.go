@@ -0,0 +1,82 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
+)
+
+func TestLoadKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	t.Run("should load the keys of a JWKS file", func(t *testing.T) {
+		jwks := fmt.Sprintf(`{"keys":[
+			{"kty":"RSA","kid":"rsa1","alg":"RS256","use":"sig","n":"%s","e":"%s"},
+			{"kty":"oct","kid":"hs1","k":"%s"},
+			{"kty":"RSA","kid":"enc1","use":"enc","n":"%s","e":"%s"}
+		]}`, b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()), b64([]byte("s3cr3t")), b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()))
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		assert.NoError(t, os.WriteFile(path, []byte(jwks), 0o600))
+
+		keys, err := auth.LoadKeys(auth.KeyConfig{JWKSFile: path})
+		assert.NoError(t, err)
+		if !assert.Len(t, keys, 2, "should skip the encryption keys") {
+			return
+		}
+		assert.True(t, rsaKey.PublicKey.Equal(keys[0].PublicKey))
+		assert.Equal(t, []byte("s3cr3t"), keys[1].Secret)
+
+		verifier, err := auth.NewVerifier(keys, auth.VerifierConfig{})
+		assert.NoError(t, err)
+		_, err = verifier.Verify(firmar(t, jwt.SigningMethodRS256, "rsa1", rsaKey, claimsValidos("u1")))
+		assert.NoError(t, err)
+		_, err = verifier.Verify(firmar(t, jwt.SigningMethodHS256, "hs1", []byte("s3cr3t"), claimsValidos("u1")))
+		assert.NoError(t, err)
+		_, err = verifier.Verify(firmar(t, jwt.SigningMethodHS256, "", []byte("s3cr3t"), claimsValidos("u1")))
+		assert.ErrorAs(t, err, &auth.ErrInvalidToken{}, "should require the kid when the keys have one")
+	})
+
+	t.Run("should load the keys from the env values", func(t *testing.T) {
+		der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+		assert.NoError(t, err)
+		publicaPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+		keys, err := auth.LoadKeys(auth.KeyConfig{HS256Secret: "s3cr3t", RS256PublicKey: string(publicaPEM)})
+		assert.NoError(t, err)
+		assert.Len(t, keys, 2)
+
+		path := filepath.Join(t.TempDir(), "public.pem")
+		pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)})
+		assert.NoError(t, os.WriteFile(path, pkcs1, 0o600))
+		keys, err = auth.LoadKeys(auth.KeyConfig{RS256PublicKeyFile: path})
+		assert.NoError(t, err)
+		if assert.Len(t, keys, 1) {
+			assert.True(t, rsaKey.PublicKey.Equal(keys[0].PublicKey))
+		}
+	})
+
+	t.Run("should fail without keys or with invalid ones", func(t *testing.T) {
+		_, err := auth.LoadKeys(auth.KeyConfig{})
+		assert.ErrorIs(t, err, auth.ErrNoKeys)
+		_, err = auth.LoadKeys(auth.KeyConfig{RS256PublicKey: "no es un pem"})
+		assert.ErrorAs(t, err, &auth.ErrInvalidKey{})
+		_, err = auth.ParseJWKS([]byte(`{"keys":[{"kty":"RSA","kid":"x","n":"","e":"AQAB"}]}`))
+		assert.ErrorAs(t, err, &auth.ErrInvalidKey{})
+	})
+}
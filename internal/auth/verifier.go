@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// VerifierConfig: Issuer y Audience solo se validan si vienen, Leeway es la tolerancia de reloj para exp y nbf
+type VerifierConfig struct {
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// Verifier valida la firma y los tiempos de los tokens, exp es obligatorio
+type Verifier struct {
+	keys   KeySet
+	parser *jwt.Parser
+}
+
+func NewVerifier(keys KeySet, cfg VerifierConfig) (*Verifier, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	opciones := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opciones = append(opciones, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opciones = append(opciones, jwt.WithAudience(cfg.Audience))
+	}
+	return &Verifier{keys: keys, parser: jwt.NewParser(opciones...)}, nil
+}
+
+// Verify valida el token (sin el "Bearer ") y devuelve sus claims
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.lookup(t.Method.Alg(), kid)
+	})
+	if err != nil {
+		return nil, ErrInvalidToken{Cause: err}
+	}
+	return claims, nil
+}
+
+// BearerToken saca el token de un header Authorization ("Bearer <token>"), vacio si no viene o es otro esquema
+func BearerToken(authorization string) string {
+	esquema, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(esquema, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
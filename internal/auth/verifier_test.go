@@ -0,0 +1,115 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
+)
+
+func firmar(t *testing.T, metodo jwt.SigningMethod, kid string, llave interface{}, claims auth.Claims) string {
+	token := jwt.NewWithClaims(metodo, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	firmado, err := token.SignedString(llave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return firmado
+}
+
+func claimsValidos(sub string) auth.Claims {
+	return auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: sub, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		Roles:            []string{"admin"},
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("s3cr3t")
+	keys := auth.KeySet{
+		{Algorithm: auth.AlgHS256, Secret: secret},
+		{ID: "rsa1", Algorithm: auth.AlgRS256, PublicKey: &rsaKey.PublicKey},
+	}
+	verifier, err := auth.NewVerifier(keys, auth.VerifierConfig{})
+	assert.NoError(t, err)
+
+	t.Run("should validate HS256 and RS256 tokens and return the claims", func(t *testing.T) {
+		claims, err := verifier.Verify(firmar(t, jwt.SigningMethodHS256, "", secret, claimsValidos("u1")))
+		assert.NoError(t, err)
+		assert.Equal(t, "u1", claims.Subject)
+		assert.Equal(t, []string{"admin"}, claims.Roles)
+
+		claims, err = verifier.Verify(firmar(t, jwt.SigningMethodRS256, "rsa1", rsaKey, claimsValidos("u2")))
+		assert.NoError(t, err)
+		assert.Equal(t, "u2", claims.Subject)
+	})
+
+	t.Run("should reject invalid tokens", func(t *testing.T) {
+		otraRSA, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.NoError(t, err)
+		publicaDER := x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)
+		sinExp := claimsValidos("u1")
+		sinExp.ExpiresAt = nil
+		vencido := claimsValidos("u1")
+		vencido.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+		casos := map[string]string{
+			"another secret":     firmar(t, jwt.SigningMethodHS256, "", []byte("otro"), claimsValidos("u1")),
+			"another rsa key":    firmar(t, jwt.SigningMethodRS256, "rsa1", otraRSA, claimsValidos("u1")),
+			"unknown kid":        firmar(t, jwt.SigningMethodRS256, "rsa2", rsaKey, claimsValidos("u1")),
+			"HS512 not allowed":  firmar(t, jwt.SigningMethodHS512, "", secret, claimsValidos("u1")),
+			"none not allowed":   firmar(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, claimsValidos("u1")),
+			"public key as hmac": firmar(t, jwt.SigningMethodHS256, "rsa1", publicaDER, claimsValidos("u1")),
+			"without exp":        firmar(t, jwt.SigningMethodHS256, "", secret, sinExp),
+			"expired":            firmar(t, jwt.SigningMethodHS256, "", secret, vencido),
+			"malformed":          "abc.def.ghi",
+		}
+		for nombre, token := range casos {
+			_, err := verifier.Verify(token)
+			assert.ErrorAs(t, err, &auth.ErrInvalidToken{}, nombre)
+		}
+
+		_, err = verifier.Verify("")
+		assert.ErrorIs(t, err, auth.ErrMissingToken)
+	})
+
+	t.Run("should validate the issuer and the audience when configured", func(t *testing.T) {
+		verifier, err := auth.NewVerifier(keys, auth.VerifierConfig{Issuer: "https://idp.test", Audience: "enrollments"})
+		assert.NoError(t, err)
+
+		claims := claimsValidos("u1")
+		claims.Issuer = "https://idp.test"
+		claims.Audience = jwt.ClaimStrings{"enrollments"}
+		_, err = verifier.Verify(firmar(t, jwt.SigningMethodHS256, "", secret, claims))
+		assert.NoError(t, err)
+
+		claims.Audience = jwt.ClaimStrings{"otra-api"}
+		_, err = verifier.Verify(firmar(t, jwt.SigningMethodHS256, "", secret, claims))
+		assert.ErrorAs(t, err, &auth.ErrInvalidToken{})
+	})
+
+	t.Run("should require at least one key", func(t *testing.T) {
+		_, err := auth.NewVerifier(nil, auth.VerifierConfig{})
+		assert.ErrorIs(t, err, auth.ErrNoKeys)
+	})
+}
+
+func TestBearerToken(t *testing.T) {
+	assert.Equal(t, "abc", auth.BearerToken("Bearer abc"))
+	assert.Equal(t, "abc", auth.BearerToken("bearer  abc "))
+	assert.Empty(t, auth.BearerToken("Basic abc"))
+	assert.Empty(t, auth.BearerToken("abc"))
+	assert.Empty(t, auth.BearerToken(""))
+}
@@ -0,0 +1,179 @@
+package enrollment
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+
+	courseSdk "github.com/IgnacioBO/go_micro_sdk/course"
+	userSdk "github.com/IgnacioBO/go_micro_sdk/user"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerConfig define cuando se abre el circuito y cuanto tiempo queda abierto
+// FailureThreshold son fallas seguidas para abrirlo, HalfOpenMaxCalls son los intentos de prueba que se dejan pasar despues de OpenTimeout
+type BreakerConfig struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	HalfOpenMaxCalls int
+}
+
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+	HalfOpenMaxCalls: 1,
+}
+
+// BreakerStatus es lo que mostramos en el endpoint de health
+type BreakerStatus struct {
+	Name       string       `json:"name"`
+	State      BreakerState `json:"state"`
+	Failures   int          `json:"failures"`
+	RetryAfter int          `json:"retry_after_seconds,omitempty"`
+}
+
+// CircuitBreaker corta las llamadas a un microservicio que esta fallando para no esperar a que cada request falle por timeout
+type CircuitBreaker struct {
+	name string
+	cfg  BreakerConfig
+	now  func() time.Time
+
+	mu            sync.Mutex
+	state         BreakerState
+	failures      int
+	openedAt      time.Time
+	halfOpenCalls int
+}
+
+func NewCircuitBreaker(name string, cfg BreakerConfig) *CircuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultBreakerConfig.FailureThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = DefaultBreakerConfig.OpenTimeout
+	}
+	if cfg.HalfOpenMaxCalls <= 0 {
+		cfg.HalfOpenMaxCalls = DefaultBreakerConfig.HalfOpenMaxCalls
+	}
+	return &CircuitBreaker{
+		name:  name,
+		cfg:   cfg,
+		now:   time.Now,
+		state: BreakerClosed,
+	}
+}
+
+// allow dice si la llamada puede pasar, si el circuito esta abierto devuelve ErrCircuitOpen con cuanto falta para reintentar
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		restante := b.cfg.OpenTimeout - b.now().Sub(b.openedAt)
+		if restante > 0 {
+			return ErrCircuitOpen{Service: b.name, RetryAfter: restante}
+		}
+		//Ya paso el OpenTimeout, dejamos pasar algunas llamadas de prueba
+		b.state = BreakerHalfOpen
+		b.halfOpenCalls = 0
+	}
+
+	if b.state == BreakerHalfOpen {
+		if b.halfOpenCalls >= b.cfg.HalfOpenMaxCalls {
+			return ErrCircuitOpen{Service: b.name, RetryAfter: time.Second}
+		}
+		b.halfOpenCalls++
+	}
+	return nil
+}
+
+// done registra el resultado de la llamada, los not found son una respuesta valida asi que cuentan como exito
+func (b *CircuitBreaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil || errors.As(err, &userSdk.ErrNotFound{}) || errors.As(err, &courseSdk.ErrNotFound{}) {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Status devuelve una foto del estado actual del circuito
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{Name: b.name, State: b.state, Failures: b.failures}
+	if b.state == BreakerOpen {
+		if restante := b.cfg.OpenTimeout - b.now().Sub(b.openedAt); restante > 0 {
+			status.RetryAfter = retryAfterSeconds(restante)
+		} else {
+			//La proxima llamada ya va a pasar como prueba
+			status.State = BreakerHalfOpen
+		}
+	}
+	return status
+}
+
+type userBreaker struct {
+	trans   userSdk.Transport
+	breaker *CircuitBreaker
+}
+
+// NewUserBreaker decora el userSdk.Transport con el circuit breaker
+func NewUserBreaker(trans userSdk.Transport, breaker *CircuitBreaker) userSdk.Transport {
+	return &userBreaker{trans: trans, breaker: breaker}
+}
+
+func (u *userBreaker) Get(id string) (*domain.User, error) {
+	if err := u.breaker.allow(); err != nil {
+		return nil, err
+	}
+	user, err := u.trans.Get(id)
+	u.breaker.done(err)
+	return user, err
+}
+
+type courseBreaker struct {
+	trans   courseSdk.Transport
+	breaker *CircuitBreaker
+}
+
+// NewCourseBreaker decora el courseSdk.Transport con el circuit breaker
+func NewCourseBreaker(trans courseSdk.Transport, breaker *CircuitBreaker) courseSdk.Transport {
+	return &courseBreaker{trans: trans, breaker: breaker}
+}
+
+func (c *courseBreaker) Get(id string) (*domain.Course, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	course, err := c.trans.Get(id)
+	c.breaker.done(err)
+	return course, err
+}
+
+// retryAfterSeconds redondea hacia arriba para que el cliente no reintente antes de tiempo
+func retryAfterSeconds(d time.Duration) int {
+	segundos := int((d + time.Second - 1) / time.Second)
+	if segundos < 1 {
+		return 1
+	}
+	return segundos
+}
@@ -0,0 +1,145 @@
+package enrollment_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	userSdk "github.com/IgnacioBO/go_micro_sdk/user"
+
+	courseSdkMock "github.com/IgnacioBO/go_micro_sdk/course/mock"
+	userSdkMock "github.com/IgnacioBO/go_micro_sdk/user/mock"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	cfg := enrollment.BreakerConfig{FailureThreshold: 2, OpenTimeout: 30 * time.Millisecond, HalfOpenMaxCalls: 1}
+
+	t.Run("should open after consecutive failures and fail fast", func(t *testing.T) {
+		llamadas := 0
+		breaker := enrollment.NewCircuitBreaker("user", cfg)
+		trans := enrollment.NewUserBreaker(&userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				llamadas++
+				return nil, errors.New("connection refused")
+			},
+		}, breaker)
+
+		_, _ = trans.Get("1")
+		assert.Equal(t, enrollment.BreakerClosed, breaker.Status().State)
+		_, _ = trans.Get("1")
+		assert.Equal(t, enrollment.BreakerOpen, breaker.Status().State)
+		assert.Equal(t, 1, breaker.Status().RetryAfter)
+
+		_, err := trans.Get("1")
+		assert.ErrorAs(t, err, &enrollment.ErrCircuitOpen{})
+		assert.Equal(t, 2, llamadas)
+	})
+
+	t.Run("should not count not found as a failure", func(t *testing.T) {
+		breaker := enrollment.NewCircuitBreaker("user", cfg)
+		trans := enrollment.NewUserBreaker(&userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				return nil, userSdk.ErrNotFound{Message: "user not found"}
+			},
+		}, breaker)
+
+		for i := 0; i < 5; i++ {
+			_, _ = trans.Get("1")
+		}
+		assert.Equal(t, enrollment.BreakerClosed, breaker.Status().State)
+		assert.Equal(t, 0, breaker.Status().Failures)
+	})
+
+	t.Run("should close again after a successful half-open call", func(t *testing.T) {
+		fallar := true
+		breaker := enrollment.NewCircuitBreaker("course", cfg)
+		trans := enrollment.NewCourseBreaker(&courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				if fallar {
+					return nil, errors.New("connection refused")
+				}
+				return &domain.Course{ID: id}, nil
+			},
+		}, breaker)
+
+		_, _ = trans.Get("1")
+		_, _ = trans.Get("1")
+		assert.Equal(t, enrollment.BreakerOpen, breaker.Status().State)
+
+		time.Sleep(cfg.OpenTimeout)
+		assert.Equal(t, enrollment.BreakerHalfOpen, breaker.Status().State)
+
+		fallar = false
+		course, err := trans.Get("1")
+		assert.NoError(t, err)
+		assert.NotNil(t, course)
+		assert.Equal(t, enrollment.BreakerClosed, breaker.Status().State)
+	})
+
+	t.Run("should reopen if the half-open call fails", func(t *testing.T) {
+		breaker := enrollment.NewCircuitBreaker("course", cfg)
+		trans := enrollment.NewCourseBreaker(&courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return nil, errors.New("connection refused")
+			},
+		}, breaker)
+
+		_, _ = trans.Get("1")
+		_, _ = trans.Get("1")
+		time.Sleep(cfg.OpenTimeout)
+
+		_, err := trans.Get("1")
+		assert.NotErrorIs(t, err, enrollment.ErrCircuitOpen{})
+		assert.Equal(t, enrollment.BreakerOpen, breaker.Status().State)
+	})
+}
+
+func TestEndpoint_CircuitOpen(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	breaker := enrollment.NewCircuitBreaker("course", enrollment.BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+	course := enrollment.NewCourseBreaker(&courseSdkMock.CourseSdkMock{
+		GetMock: func(id string) (*domain.Course, error) {
+			return nil, errors.New("connection refused")
+		},
+	}, breaker)
+	user := &userSdkMock.UserSdkMock{
+		GetMock: func(id string) (*domain.User, error) {
+			return &domain.User{ID: id}, nil
+		},
+	}
+
+	svc := enrollment.NewService(l, user, course, &mockRepository{}, enrollment.WithUpstreamConfig(enrollment.UpstreamConfig{MaxRetries: 0}))
+	endpoints := enrollment.MakeEndpoints(svc, enrollment.Config{Breakers: []*enrollment.CircuitBreaker{breaker}})
+
+	t.Run("should return 503 with Retry-After when the circuit is open", func(t *testing.T) {
+		//La primera llamada falla y abre el circuito, la segunda ya falla rapido
+		_, _ = endpoints.Create(context.Background(), enrollment.CreateRequest{UserID: "1", CourseID: "2"})
+		_, err := endpoints.Create(context.Background(), enrollment.CreateRequest{UserID: "1", CourseID: "2"})
+
+		resp := err.(response.Response)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+		headerer, ok := err.(interface{ Headers() http.Header })
+		assert.True(t, ok)
+		assert.Equal(t, "60", headerer.Headers().Get("Retry-After"))
+	})
+
+	t.Run("should expose the circuit state on health", func(t *testing.T) {
+		resp, err := endpoints.Health(context.Background(), nil)
+		assert.NoError(t, err)
+		health := resp.(response.Response).GetData().(enrollment.HealthResponse)
+		assert.Equal(t, "degraded", health.Status)
+		assert.Equal(t, enrollment.BreakerOpen, health.Circuits[0].State)
+		assert.Equal(t, "course", health.Circuits[0].Name)
+	})
+}
@@ -0,0 +1,151 @@
+package enrollment
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+)
+
+// Modos del bulk: transaction inserta todo o nada, per_item inserta cada uno por separado
+const (
+	BulkModeTransaction = "transaction"
+	BulkModePerItem     = "per_item"
+)
+
+// Cantidad de usuarios que se validan en paralelo contra el microservicio de users (si no se configura otra)
+const defaultBulkConcurrency = 10
+
+// BulkResult es el resultado de cada item del bulk, en el mismo orden en que vinieron
+type BulkResult struct {
+	Item       CreateRequest
+	Enrollment *domain.Enrollment
+	Err        error
+}
+
+// WithBulkConcurrency cambia cuantos usuarios se validan en paralelo en el BulkCreate
+func WithBulkConcurrency(n int) ServiceOption {
+	return func(s *service) {
+		if n > 0 {
+			s.bulkConcurrency = n
+		}
+	}
+}
+
+func (s service) BulkCreate(ctx context.Context, items []CreateRequest, mode string) ([]BulkResult, error) {
+	s.log.Printf("BulkCreate enrollment service, items: %d, mode: %s\n", len(items), mode)
+
+	resultados := make([]BulkResult, len(items))
+	for i, item := range items {
+		resultados[i].Item = item
+	}
+
+	//Cada curso se valida una sola vez (normalmente viene un solo curso para todo el bulk)
+	erroresCursos := map[string]error{}
+	for _, item := range items {
+		if _, ok := erroresCursos[item.CourseID]; ok {
+			continue
+		}
+		_, err := s.courses.Get(ctx, item.CourseID)
+		erroresCursos[item.CourseID] = err
+	}
+
+	//Los usuarios se validan en paralelo, pero maximo bulkConcurrency a la vez (el semaforo es un channel con buffer)
+	erroresUsers := s.validarUsers(ctx, items)
+
+	var validos []*domain.Enrollment
+	var indicesValidos []int
+	for i, item := range items {
+		if err := erroresCursos[item.CourseID]; err != nil {
+			resultados[i].Err = err
+			continue
+		}
+		if err := erroresUsers[item.UserID]; err != nil {
+			resultados[i].Err = err
+			continue
+		}
+		validos = append(validos, &domain.Enrollment{
+			UserID:   item.UserID,
+			CourseID: item.CourseID,
+			Status:   domain.Pending,
+		})
+		indicesValidos = append(indicesValidos, i)
+	}
+
+	if mode == BulkModeTransaction {
+		//Todo o nada: si algun item no paso la validacion no insertamos ninguno
+		var errBulk error
+		if len(validos) != len(items) {
+			errBulk = ErrBulkAborted
+		} else if err := s.repo.CreateBulk(ctx, validos); err != nil {
+			errBulk = err
+		}
+		//Si el insert fallo por un duplicado, el error va solo en el item duplicado y los demas quedan abortados
+		var duplicado ErrAlreadyEnrolled
+		esDuplicado := errors.As(errBulk, &duplicado)
+		for n, i := range indicesValidos {
+			switch {
+			case errBulk == nil:
+				resultados[i].Enrollment = validos[n]
+			case esDuplicado && (validos[n].UserID != duplicado.UserID || validos[n].CourseID != duplicado.CourseID):
+				resultados[i].Err = ErrBulkAborted
+			default:
+				resultados[i].Err = errBulk
+			}
+		}
+		return resultados, nil
+	}
+
+	//per_item: cada uno se inserta por separado, si uno falla los otros siguen
+	for n, i := range indicesValidos {
+		err := s.repo.Create(ctx, validos[n])
+		if errors.As(err, &ErrAlreadyEnrolled{}) && s.reactivate {
+			resultados[i].Enrollment, resultados[i].Err = s.reactivateEnrollment(ctx, validos[n].UserID, validos[n].CourseID, err)
+			continue
+		}
+		if err != nil {
+			resultados[i].Err = err
+			continue
+		}
+		resultados[i].Enrollment = validos[n]
+	}
+
+	return resultados, nil
+}
+
+// validarUsers hace el get de cada user distinto en paralelo y devuelve el error de cada uno (nil si existe)
+func (s service) validarUsers(ctx context.Context, items []CreateRequest) map[string]error {
+	concurrencia := s.bulkConcurrency
+	if concurrencia <= 0 {
+		concurrencia = defaultBulkConcurrency
+	}
+
+	errores := map[string]error{}
+	vistos := map[string]bool{} //Para no validar 2 veces el mismo user (solo lo usa este loop, no las goroutines)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaforo := make(chan struct{}, concurrencia)
+
+	for _, item := range items {
+		if vistos[item.UserID] {
+			continue
+		}
+		vistos[item.UserID] = true
+
+		wg.Add(1)
+		semaforo <- struct{}{}
+		go func(userID string) {
+			defer wg.Done()
+			defer func() { <-semaforo }()
+
+			_, err := s.users.Get(ctx, userID)
+			mu.Lock()
+			errores[userID] = err
+			mu.Unlock()
+		}(item.UserID)
+	}
+	wg.Wait()
+
+	return errores
+}
@@ -0,0 +1,230 @@
+package enrollment_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	courseSdk "github.com/IgnacioBO/go_micro_sdk/course"
+	userSdk "github.com/IgnacioBO/go_micro_sdk/user"
+
+	courseSdkMock "github.com/IgnacioBO/go_micro_sdk/course/mock"
+	userSdkMock "github.com/IgnacioBO/go_micro_sdk/user/mock"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+func TestService_BulkCreate(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	items := []enrollment.CreateRequest{
+		{UserID: "user1", CourseID: "course1"},
+		{UserID: "user2", CourseID: "course1"},
+		{UserID: "user3", CourseID: "course1"},
+	}
+
+	//user2 no existe, el resto si
+	userMock := &userSdkMock.UserSdkMock{
+		GetMock: func(id string) (*domain.User, error) {
+			if id == "user2" {
+				return nil, userSdk.ErrNotFound{Message: "User not found"}
+			}
+			return &domain.User{ID: id}, nil
+		},
+	}
+
+	t.Run("should validate the course only once", func(t *testing.T) {
+		var counter int32 = 0
+		courseMock := &courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				atomic.AddInt32(&counter, 1)
+				return &domain.Course{ID: id}, nil
+			},
+		}
+		repo := &mockRepository{
+			CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
+				return nil
+			},
+		}
+
+		svc := enrollment.NewService(l, userMock, courseMock, repo, enrollment.WithBulkConcurrency(2))
+		_, err := svc.BulkCreate(context.Background(), items, enrollment.BulkModePerItem)
+
+		assert.NoError(t, err, "expected no error but got %v", err)
+		assert.Equal(t, int32(1), counter, "expected course to be validated %d times but got %d", 1, counter)
+	})
+
+	t.Run("should insert valid items on per item mode", func(t *testing.T) {
+		courseMock := &courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return &domain.Course{ID: id}, nil
+			},
+		}
+		repo := &mockRepository{
+			CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
+				e.ID = "id_" + e.UserID
+				return nil
+			},
+		}
+
+		svc := enrollment.NewService(l, userMock, courseMock, repo)
+		resultados, err := svc.BulkCreate(context.Background(), items, enrollment.BulkModePerItem)
+
+		assert.NoError(t, err, "expected no error but got %v", err)
+		assert.Len(t, resultados, 3, "expected %d results but got %d", 3, len(resultados))
+		assert.NoError(t, resultados[0].Err, "expected no error on item 0 but got %v", resultados[0].Err)
+		assert.Equal(t, "id_user1", resultados[0].Enrollment.ID, "expected enrollment ID to be '%s' but got '%s'", "id_user1", resultados[0].Enrollment.ID)
+		assert.ErrorIs(t, resultados[1].Err, userSdk.ErrNotFound{Message: "User not found"}, "expected user not found on item 1 but got %v", resultados[1].Err)
+		assert.Nil(t, resultados[1].Enrollment, "expected enrollment on item 1 to be nil")
+		assert.NoError(t, resultados[2].Err, "expected no error on item 2 but got %v", resultados[2].Err)
+	})
+
+	t.Run("should not insert anything on transaction mode if one item fails", func(t *testing.T) {
+		courseMock := &courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return &domain.Course{ID: id}, nil
+			},
+		}
+		repo := &mockRepository{
+			CreateBulkMock: func(ctx context.Context, enrollments []*domain.Enrollment) error {
+				t.Fatal("create bulk should not be called")
+				return nil
+			},
+		}
+
+		svc := enrollment.NewService(l, userMock, courseMock, repo)
+		resultados, err := svc.BulkCreate(context.Background(), items, enrollment.BulkModeTransaction)
+
+		assert.NoError(t, err, "expected no error but got %v", err)
+		assert.ErrorIs(t, resultados[0].Err, enrollment.ErrBulkAborted, "expected aborted error on item 0 but got %v", resultados[0].Err)
+		assert.ErrorIs(t, resultados[1].Err, userSdk.ErrNotFound{Message: "User not found"}, "expected user not found on item 1 but got %v", resultados[1].Err)
+		assert.ErrorIs(t, resultados[2].Err, enrollment.ErrBulkAborted, "expected aborted error on item 2 but got %v", resultados[2].Err)
+	})
+
+	t.Run("should report the duplicate only on its item in transaction mode", func(t *testing.T) {
+		courseMock := &courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return &domain.Course{ID: id}, nil
+			},
+		}
+		todosValidos := &userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				return &domain.User{ID: id}, nil
+			},
+		}
+		repo := &mockRepository{
+			CreateBulkMock: func(ctx context.Context, enrollments []*domain.Enrollment) error {
+				return enrollment.ErrAlreadyEnrolled{UserID: "user2", CourseID: "course1"}
+			},
+		}
+
+		svc := enrollment.NewService(l, todosValidos, courseMock, repo)
+		resultados, err := svc.BulkCreate(context.Background(), items, enrollment.BulkModeTransaction)
+
+		assert.NoError(t, err)
+		assert.ErrorIs(t, resultados[0].Err, enrollment.ErrBulkAborted)
+		assert.ErrorIs(t, resultados[1].Err, enrollment.ErrAlreadyEnrolled{UserID: "user2", CourseID: "course1"})
+		assert.ErrorIs(t, resultados[2].Err, enrollment.ErrBulkAborted)
+	})
+
+	t.Run("should return error on every item if course not found", func(t *testing.T) {
+		courseMock := &courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return nil, courseSdk.ErrNotFound{Message: "Course not found"}
+			},
+		}
+
+		svc := enrollment.NewService(l, userMock, courseMock, &mockRepository{})
+		resultados, err := svc.BulkCreate(context.Background(), items, enrollment.BulkModePerItem)
+
+		assert.NoError(t, err, "expected no error but got %v", err)
+		for _, r := range resultados {
+			assert.ErrorIs(t, r.Err, courseSdk.ErrNotFound{Message: "Course not found"}, "expected course not found but got %v", r.Err)
+		}
+	})
+}
+
+func TestEndpoint_BulkCreate(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should return error if items are empty", func(t *testing.T) {
+		enrollmentEndpoint := enrollment.MakeEndpoints(nil, enrollment.Config{LimitPageDefault: "10"})
+		_, err := enrollmentEndpoint.BulkCreate(context.Background(), enrollment.BulkCreateRequest{})
+
+		resp := err.(response.Response)
+		assert.EqualError(t, err, enrollment.ErrBulkEmpty.Error(), "expected error message to be '%s' but got '%s'", enrollment.ErrBulkEmpty.Error(), err.Error())
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode(), "expected status code to be %d but got %d", http.StatusBadRequest, resp.StatusCode())
+	})
+
+	t.Run("should return error if there are too many items", func(t *testing.T) {
+		enrollmentEndpoint := enrollment.MakeEndpoints(nil, enrollment.Config{LimitPageDefault: "10", BulkMaxItems: 1})
+		_, err := enrollmentEndpoint.BulkCreate(context.Background(), enrollment.BulkCreateRequest{
+			Items: []enrollment.CreateRequest{{UserID: "u1", CourseID: "c1"}, {UserID: "u2", CourseID: "c1"}},
+		})
+
+		resp := err.(response.Response)
+		assert.EqualError(t, err, enrollment.ErrBulkTooLarge{Max: 1}.Error(), "expected too large error but got '%s'", err.Error())
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode(), "expected status code to be %d but got %d", http.StatusBadRequest, resp.StatusCode())
+	})
+
+	t.Run("should return error if mode is not valid", func(t *testing.T) {
+		enrollmentEndpoint := enrollment.MakeEndpoints(nil, enrollment.Config{LimitPageDefault: "10"})
+		_, err := enrollmentEndpoint.BulkCreate(context.Background(), enrollment.BulkCreateRequest{
+			Items: []enrollment.CreateRequest{{UserID: "u1", CourseID: "c1"}},
+			Mode:  "all",
+		})
+
+		resp := err.(response.Response)
+		assert.EqualError(t, err, enrollment.ErrInvalidBulkMode{Mode: "all"}.Error(), "expected invalid mode error but got '%s'", err.Error())
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode(), "expected status code to be %d but got %d", http.StatusBadRequest, resp.StatusCode())
+	})
+
+	t.Run("should return status code per item", func(t *testing.T) {
+		userMock := &userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				return &domain.User{ID: id}, nil
+			},
+		}
+		courseMock := &courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return &domain.Course{ID: id}, nil
+			},
+		}
+		repo := &mockRepository{
+			CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
+				switch e.UserID {
+				case "user2":
+					return enrollment.ErrAlreadyEnrolled{UserID: e.UserID, CourseID: e.CourseID}
+				case "user3":
+					return errors.New("repo error")
+				}
+				return nil
+			},
+		}
+
+		svc := enrollment.NewService(l, userMock, courseMock, repo)
+		enrollmentEndpoint := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+		enrollmentsResponse, err := enrollmentEndpoint.BulkCreate(context.Background(), enrollment.BulkCreateRequest{
+			Items: []enrollment.CreateRequest{
+				{UserID: "user1", CourseID: "course1"},
+				{UserID: "user2", CourseID: "course1"},
+				{UserID: "user3", CourseID: "course1"},
+			},
+		})
+
+		assert.NoError(t, err, "expected no error but got %v", err)
+		resultados := enrollmentsResponse.(response.Response).GetData().([]enrollment.BulkCreateResponse)
+		assert.Equal(t, http.StatusCreated, resultados[0].StatusCode, "expected item 0 status code to be %d but got %d", http.StatusCreated, resultados[0].StatusCode)
+		assert.Equal(t, http.StatusConflict, resultados[1].StatusCode, "expected item 1 status code to be %d but got %d", http.StatusConflict, resultados[1].StatusCode)
+		assert.Equal(t, http.StatusInternalServerError, resultados[2].StatusCode, "expected item 2 status code to be %d but got %d", http.StatusInternalServerError, resultados[2].StatusCode)
+		assert.Equal(t, "repo error", resultados[2].Error, "expected item 2 error to be '%s' but got '%s'", "repo error", resultados[2].Error)
+	})
+}
@@ -0,0 +1,208 @@
+package enrollment
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+
+	courseSdk "github.com/IgnacioBO/go_micro_sdk/course"
+	userSdk "github.com/IgnacioBO/go_micro_sdk/user"
+)
+
+// CacheConfig define cuanto duran las entradas del cache de users y courses
+// NotFoundTTL es para los 404 (cache negativo), conviene que sea mas corto por si crean el user/course despues
+type CacheConfig struct {
+	TTL         time.Duration
+	NotFoundTTL time.Duration
+	MaxEntries  int
+}
+
+var DefaultCacheConfig = CacheConfig{
+	TTL:         5 * time.Minute,
+	NotFoundTTL: 30 * time.Second,
+	MaxEntries:  10000,
+}
+
+// CacheStats son los contadores que mostramos en el health para monitorear el cache
+// Shared son las llamadas que esperaron a otra que ya estaba buscando el mismo id (singleflight)
+type CacheStats struct {
+	Name    string `json:"name"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Shared  uint64 `json:"shared"`
+	Entries int    `json:"entries"`
+}
+
+// CacheReporter lo implementan UserCache y CourseCache, sirve para listar los caches en el Config de los endpoints
+type CacheReporter interface {
+	Stats() CacheStats
+}
+
+// UserCache decora el userSdk.Transport con un cache TTL + LRU
+type UserCache struct {
+	trans userSdk.Transport
+	cache *lookupCache[*domain.User]
+}
+
+func NewUserCache(trans userSdk.Transport, cfg CacheConfig) *UserCache {
+	return &UserCache{trans: trans, cache: newLookupCache[*domain.User]("user", cfg)}
+}
+
+func (u *UserCache) Get(id string) (*domain.User, error) {
+	return u.cache.get(id, func() (*domain.User, error) {
+		return u.trans.Get(id)
+	})
+}
+
+func (u *UserCache) Stats() CacheStats {
+	return u.cache.stats()
+}
+
+// CourseCache decora el courseSdk.Transport con un cache TTL + LRU
+type CourseCache struct {
+	trans courseSdk.Transport
+	cache *lookupCache[*domain.Course]
+}
+
+func NewCourseCache(trans courseSdk.Transport, cfg CacheConfig) *CourseCache {
+	return &CourseCache{trans: trans, cache: newLookupCache[*domain.Course]("course", cfg)}
+}
+
+func (c *CourseCache) Get(id string) (*domain.Course, error) {
+	return c.cache.get(id, func() (*domain.Course, error) {
+		return c.trans.Get(id)
+	})
+}
+
+func (c *CourseCache) Stats() CacheStats {
+	return c.cache.stats()
+}
+
+type entradaCache[T any] struct {
+	id     string
+	valor  T
+	err    error //Solo se guardan errores not found
+	expira time.Time
+}
+
+// llamadaEnCurso es una busqueda al microservicio que todavia no termina, los demas requests del mismo id la esperan
+type llamadaEnCurso[T any] struct {
+	listo chan struct{}
+	valor T
+	err   error
+}
+
+// lookupCache es el cache generico que usan UserCache y CourseCache
+// El frente de la lista lru es lo ultimo usado, al pasar MaxEntries se saca lo del final
+type lookupCache[T any] struct {
+	name string
+	cfg  CacheConfig
+	now  func() time.Time
+
+	mu       sync.Mutex
+	entradas map[string]*list.Element
+	lru      *list.List
+	enCurso  map[string]*llamadaEnCurso[T]
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	shared atomic.Uint64
+}
+
+func newLookupCache[T any](name string, cfg CacheConfig) *lookupCache[T] {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = DefaultCacheConfig.MaxEntries
+	}
+	return &lookupCache[T]{
+		name:     name,
+		cfg:      cfg,
+		now:      time.Now,
+		entradas: make(map[string]*list.Element),
+		lru:      list.New(),
+		enCurso:  make(map[string]*llamadaEnCurso[T]),
+	}
+}
+
+func (c *lookupCache[T]) get(id string, fn func() (T, error)) (T, error) {
+	c.mu.Lock()
+	if elem, ok := c.entradas[id]; ok {
+		entrada := elem.Value.(*entradaCache[T])
+		if c.now().Before(entrada.expira) {
+			c.lru.MoveToFront(elem)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return entrada.valor, entrada.err
+		}
+		//Expiro, la sacamos y se busca de nuevo
+		c.lru.Remove(elem)
+		delete(c.entradas, id)
+	}
+	c.misses.Add(1)
+
+	//Si otro request ya esta buscando este id, esperamos su resultado en vez de llamar de nuevo
+	if llamada, ok := c.enCurso[id]; ok {
+		c.mu.Unlock()
+		c.shared.Add(1)
+		<-llamada.listo
+		return llamada.valor, llamada.err
+	}
+	llamada := &llamadaEnCurso[T]{listo: make(chan struct{})}
+	c.enCurso[id] = llamada
+	c.mu.Unlock()
+
+	llamada.valor, llamada.err = fn()
+
+	c.mu.Lock()
+	delete(c.enCurso, id)
+	c.guardar(id, llamada.valor, llamada.err)
+	c.mu.Unlock()
+	close(llamada.listo)
+
+	return llamada.valor, llamada.err
+}
+
+// guardar agrega la entrada si corresponde, se llama con el mutex tomado
+// Los errores que no son not found (timeouts, 500) no se guardan, asi el siguiente request vuelve a intentar
+func (c *lookupCache[T]) guardar(id string, valor T, err error) {
+	ttl := c.cfg.TTL
+	if err != nil {
+		if !errors.As(err, &userSdk.ErrNotFound{}) && !errors.As(err, &courseSdk.ErrNotFound{}) {
+			return
+		}
+		ttl = c.cfg.NotFoundTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	entrada := &entradaCache[T]{id: id, valor: valor, err: err, expira: c.now().Add(ttl)}
+	if elem, ok := c.entradas[id]; ok {
+		elem.Value = entrada
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entradas[id] = c.lru.PushFront(entrada)
+
+	for c.lru.Len() > c.cfg.MaxEntries {
+		ultimo := c.lru.Back()
+		c.lru.Remove(ultimo)
+		delete(c.entradas, ultimo.Value.(*entradaCache[T]).id)
+	}
+}
+
+func (c *lookupCache[T]) stats() CacheStats {
+	c.mu.Lock()
+	entries := c.lru.Len()
+	c.mu.Unlock()
+	return CacheStats{
+		Name:    c.name,
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Shared:  c.shared.Load(),
+		Entries: entries,
+	}
+}
@@ -0,0 +1,156 @@
+package enrollment_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	courseSdk "github.com/IgnacioBO/go_micro_sdk/course"
+	userSdk "github.com/IgnacioBO/go_micro_sdk/user"
+
+	courseSdkMock "github.com/IgnacioBO/go_micro_sdk/course/mock"
+	userSdkMock "github.com/IgnacioBO/go_micro_sdk/user/mock"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+func TestUserCache(t *testing.T) {
+	cfg := enrollment.CacheConfig{TTL: time.Minute, NotFoundTTL: 20 * time.Millisecond, MaxEntries: 2}
+
+	t.Run("should call upstream once and then hit the cache", func(t *testing.T) {
+		var llamadas int32
+		cache := enrollment.NewUserCache(&userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				atomic.AddInt32(&llamadas, 1)
+				return &domain.User{ID: id}, nil
+			},
+		}, cfg)
+
+		for i := 0; i < 3; i++ {
+			user, err := cache.Get("1")
+			assert.NoError(t, err)
+			assert.Equal(t, "1", user.ID)
+		}
+
+		assert.Equal(t, int32(1), llamadas)
+		stats := cache.Stats()
+		assert.Equal(t, uint64(2), stats.Hits)
+		assert.Equal(t, uint64(1), stats.Misses)
+		assert.Equal(t, 1, stats.Entries)
+	})
+
+	t.Run("should cache not found with the shorter ttl", func(t *testing.T) {
+		var llamadas int32
+		cache := enrollment.NewUserCache(&userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				atomic.AddInt32(&llamadas, 1)
+				return nil, userSdk.ErrNotFound{Message: "user not found"}
+			},
+		}, cfg)
+
+		_, err := cache.Get("1")
+		assert.ErrorAs(t, err, &userSdk.ErrNotFound{})
+		_, err = cache.Get("1")
+		assert.ErrorAs(t, err, &userSdk.ErrNotFound{})
+		assert.Equal(t, int32(1), llamadas)
+
+		time.Sleep(cfg.NotFoundTTL)
+		_, _ = cache.Get("1")
+		assert.Equal(t, int32(2), llamadas)
+	})
+
+	t.Run("should not cache upstream errors", func(t *testing.T) {
+		var llamadas int32
+		cache := enrollment.NewUserCache(&userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				atomic.AddInt32(&llamadas, 1)
+				return nil, errors.New("connection refused")
+			},
+		}, cfg)
+
+		_, _ = cache.Get("1")
+		_, _ = cache.Get("1")
+		assert.Equal(t, int32(2), llamadas)
+		assert.Equal(t, 0, cache.Stats().Entries)
+	})
+
+	t.Run("should evict the least recently used entry", func(t *testing.T) {
+		var llamadas int32
+		cache := enrollment.NewUserCache(&userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				atomic.AddInt32(&llamadas, 1)
+				return &domain.User{ID: id}, nil
+			},
+		}, cfg)
+
+		_, _ = cache.Get("1")
+		_, _ = cache.Get("2")
+		_, _ = cache.Get("1") //El 1 queda como el mas reciente
+		_, _ = cache.Get("3") //Saca al 2
+		assert.Equal(t, int32(3), llamadas)
+		assert.Equal(t, 2, cache.Stats().Entries)
+
+		_, _ = cache.Get("1")
+		assert.Equal(t, int32(3), llamadas)
+		_, _ = cache.Get("2")
+		assert.Equal(t, int32(4), llamadas)
+	})
+}
+
+func TestCourseCache(t *testing.T) {
+	t.Run("should share one upstream call between concurrent requests", func(t *testing.T) {
+		var llamadas int32
+		cache := enrollment.NewCourseCache(&courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				atomic.AddInt32(&llamadas, 1)
+				time.Sleep(50 * time.Millisecond)
+				return &domain.Course{ID: id}, nil
+			},
+		}, enrollment.DefaultCacheConfig)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				course, err := cache.Get("1")
+				assert.NoError(t, err)
+				assert.Equal(t, "1", course.ID)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), llamadas)
+		stats := cache.Stats()
+		assert.Equal(t, uint64(10), stats.Misses)
+		assert.Equal(t, uint64(9), stats.Shared)
+	})
+
+	t.Run("should share not found between concurrent requests", func(t *testing.T) {
+		var llamadas int32
+		cache := enrollment.NewCourseCache(&courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				atomic.AddInt32(&llamadas, 1)
+				time.Sleep(50 * time.Millisecond)
+				return nil, courseSdk.ErrNotFound{Message: "course not found"}
+			},
+		}, enrollment.DefaultCacheConfig)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := cache.Get("1")
+				assert.ErrorAs(t, err, &courseSdk.ErrNotFound{})
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), llamadas)
+	})
+}
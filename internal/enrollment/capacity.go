@@ -0,0 +1,222 @@
+package enrollment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Waitlisted es el status de los enrollments que quedaron en lista de espera porque el curso no tenia cupos
+// (no esta en domain.EnrollStatus porque es propio de este microservicio)
+const Waitlisted domain.EnrollStatus = "W"
+
+// CourseCapacity guarda los cupos de cada curso. Si un curso no tiene fila aqui no tiene limite de cupos
+type CourseCapacity struct {
+	CourseID  string     `json:"course_id" gorm:"type:char(36);not null;primaryKey"`
+	Capacity  int        `json:"capacity" gorm:"not null"`
+	CreatedAt *time.Time `json:"-"`
+	UpdatedAt *time.Time `json:"-"`
+}
+
+// WaitlistedEnrollment es lo que se responde cuando el enrollment quedo en lista de espera (con su posicion en la fila)
+type WaitlistedEnrollment struct {
+	*domain.Enrollment
+	WaitlistPosition int `json:"waitlist_position"`
+}
+
+// ocupaCupo dice si un enrollment con ese status cuenta como cupo usado del curso
+func ocupaCupo(status domain.EnrollStatus) bool {
+	return status == domain.Pending || status == domain.Active || status == domain.Studying
+}
+
+// *** SERVICE ***
+
+func (s service) GetCapacity(ctx context.Context, courseID string) (*CourseCapacity, error) {
+	s.log.Println("GetCapacity service")
+	return s.repo.GetCapacity(ctx, courseID)
+}
+
+func (s service) SetCapacity(ctx context.Context, courseID string, capacity int) (*CourseCapacity, error) {
+	s.log.Println("SetCapacity service")
+
+	if capacity < 0 {
+		return nil, ErrInvalidCapacity
+	}
+	//Validamos que el curso exista en el microservicio de courses
+	if _, err := s.courses.Get(ctx, courseID); err != nil {
+		return nil, err
+	}
+
+	cupo := &CourseCapacity{CourseID: courseID, Capacity: capacity}
+	if err := s.repo.SetCapacity(ctx, cupo); err != nil {
+		return nil, err
+	}
+	s.log.Printf("service - capacity of course %s set to %d\n", courseID, capacity)
+	return cupo, nil
+}
+
+func (s service) WaitlistPosition(ctx context.Context, e *domain.Enrollment) (int, error) {
+	if e.Status != Waitlisted {
+		return 0, nil
+	}
+	return s.repo.WaitlistPosition(ctx, e)
+}
+
+// *** REPOSITORY ***
+
+func (r *repo) GetCapacity(ctx context.Context, courseID string) (*CourseCapacity, error) {
+	r.log.Println("repository GetCapacity:", courseID)
+
+	var cupo CourseCapacity
+	result := r.db.WithContext(ctx).Where("course_id = ?", courseID).First(&cupo)
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrCapacityNotFound{courseID}
+		}
+		return nil, result.Error
+	}
+	return &cupo, nil
+}
+
+// SetCapacity crea o actualiza los cupos del curso, si quedan cupos libres se promueve a los de la lista de espera
+func (r *repo) SetCapacity(ctx context.Context, capacity *CourseCapacity) error {
+	r.log.Println("repository SetCapacity:", capacity.CourseID, capacity.Capacity)
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		//OnConflict hace un upsert (si ya existe el course_id actualiza el capacity)
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "course_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"capacity", "updated_at"}),
+		}).Create(capacity).Error
+		if err != nil {
+			return err
+		}
+		return promoverWaitlist(tx, capacity.CourseID)
+	})
+	if err != nil {
+		r.log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// WaitlistPosition cuenta cuantos estan antes en la lista de espera del mismo curso (por orden de llegada)
+func (r *repo) WaitlistPosition(ctx context.Context, e *domain.Enrollment) (int, error) {
+	var antes int64
+	tx := r.db.WithContext(ctx).Model(domain.Enrollment{}).
+		Where("course_id = ? AND status = ? AND deleted_at IS NULL", e.CourseID, Waitlisted).
+		Where("created_at < ? OR (created_at = ? AND id < ?)", e.CreatedAt, e.CreatedAt, e.ID).
+		Count(&antes)
+	if tx.Error != nil {
+		r.log.Println(tx.Error)
+		return 0, tx.Error
+	}
+	return int(antes) + 1, nil
+}
+
+// crearConCupo inserta el enrollment, pero si el curso ya no tiene cupos lo deja en lista de espera
+// Debe llamarse dentro de una transaccion, porque cursoLleno bloquea la fila de cupos del curso hasta el commit
+func crearConCupo(tx *gorm.DB, e *domain.Enrollment) error {
+	if e.Status == domain.Pending {
+		lleno, err := cursoLleno(tx, e.CourseID)
+		if err != nil {
+			return err
+		}
+		if lleno {
+			e.Status = Waitlisted
+		}
+	}
+	if err := tx.Create(e).Error; err != nil {
+		return err
+	}
+	actor := ActorFromContext(tx.Statement.Context)
+	if err := registrarHistorial(tx, e.ID, "", e.Status, actor); err != nil {
+		return err
+	}
+	return registrarEvento(tx, EventEnrollmentCreated, *e, "", actor)
+}
+
+// cursoLleno bloquea (SELECT ... FOR UPDATE) la fila de cupos del curso y dice si ya no quedan cupos
+// Asi dos inscripciones al mismo tiempo no pueden tomar el ultimo cupo las dos
+func cursoLleno(tx *gorm.DB, courseID string) (bool, error) {
+	libres, err := cuposLibres(tx, courseID)
+	if err != nil {
+		return false, err
+	}
+	return libres == 0, nil
+}
+
+// cuposLibres devuelve cuantos cupos quedan en el curso (-1 si el curso no tiene limite)
+func cuposLibres(tx *gorm.DB, courseID string) (int, error) {
+	var cupo CourseCapacity
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("course_id = ?", courseID).Limit(1).Find(&cupo)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return -1, nil
+	}
+
+	var ocupados int64
+	err := tx.Model(domain.Enrollment{}).
+		Where("course_id = ? AND status IN ? AND deleted_at IS NULL", courseID, []domain.EnrollStatus{domain.Pending, domain.Active, domain.Studying}).
+		Count(&ocupados).Error
+	if err != nil {
+		return 0, err
+	}
+
+	libres := cupo.Capacity - int(ocupados)
+	if libres < 0 {
+		libres = 0
+	}
+	return libres, nil
+}
+
+// promoverWaitlist pasa a Pending a los mas antiguos de la lista de espera mientras queden cupos libres
+func promoverWaitlist(tx *gorm.DB, courseID string) error {
+	libres, err := cuposLibres(tx, courseID)
+	if err != nil {
+		return err
+	}
+	if libres == 0 {
+		return nil
+	}
+
+	q := tx.Model(domain.Enrollment{}).
+		Where("course_id = ? AND status = ? AND deleted_at IS NULL", courseID, Waitlisted).
+		Order("created_at asc, id asc")
+	if libres > 0 {
+		q = q.Limit(libres)
+	}
+	//Traemos las filas completas (no solo el id) porque el evento lleva user_id y course_id
+	var enEspera []domain.Enrollment
+	if err := q.Find(&enEspera).Error; err != nil {
+		return err
+	}
+	if len(enEspera) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(enEspera))
+	for _, e := range enEspera {
+		ids = append(ids, e.ID)
+	}
+	if err := tx.Model(domain.Enrollment{}).Where("id IN ?", ids).Updates(map[string]interface{}{"status": domain.Pending, "version": gorm.Expr("version + 1")}).Error; err != nil {
+		return err
+	}
+	//La promocion la hace el sistema, no quien libero el cupo
+	for _, e := range enEspera {
+		if err := registrarHistorial(tx, e.ID, Waitlisted, domain.Pending, ActorSystem); err != nil {
+			return err
+		}
+		e.Status = domain.Pending
+		if err := registrarEvento(tx, EventEnrollmentStatusChanged, e, Waitlisted, ActorSystem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
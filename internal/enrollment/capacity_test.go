@@ -0,0 +1,146 @@
+package enrollment_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	courseSdk "github.com/IgnacioBO/go_micro_sdk/course"
+
+	courseSdkMock "github.com/IgnacioBO/go_micro_sdk/course/mock"
+	userSdkMock "github.com/IgnacioBO/go_micro_sdk/user/mock"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+func TestService_SetCapacity(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should return error if capacity is negative", func(t *testing.T) {
+		svc := enrollment.NewService(l, nil, nil, nil)
+		cupo, err := svc.SetCapacity(context.Background(), "course1", -1)
+
+		assert.ErrorIs(t, err, enrollment.ErrInvalidCapacity, "expected error to be %v but got %v", enrollment.ErrInvalidCapacity, err)
+		assert.Nil(t, cupo, "expected capacity to be nil")
+	})
+
+	t.Run("should return error if course not found", func(t *testing.T) {
+		var wantError error = courseSdk.ErrNotFound{Message: "Course not found"}
+
+		courseMock := &courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return nil, courseSdk.ErrNotFound{Message: "Course not found"}
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, courseMock, nil)
+		cupo, err := svc.SetCapacity(context.Background(), "course1", 10)
+
+		assert.ErrorIs(t, err, wantError, "expected error to be %v but got %v", wantError, err)
+		assert.Nil(t, cupo, "expected capacity to be nil")
+	})
+
+	t.Run("should set capacity", func(t *testing.T) {
+		var counter int = 0
+
+		courseMock := &courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return &domain.Course{ID: id}, nil
+			},
+		}
+		repo := &mockRepository{
+			SetCapacityMock: func(ctx context.Context, capacity *enrollment.CourseCapacity) error {
+				counter++
+				assert.Equal(t, "course1", capacity.CourseID, "expected course ID to be '%s' but got '%s'", "course1", capacity.CourseID)
+				assert.Equal(t, 10, capacity.Capacity, "expected capacity to be %d but got %d", 10, capacity.Capacity)
+				return nil
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, courseMock, repo)
+		cupo, err := svc.SetCapacity(context.Background(), "course1", 10)
+
+		assert.NoError(t, err, "expected no error but got %v", err)
+		assert.Equal(t, 1, counter, "expected counter to be %d but got %d", 1, counter)
+		assert.Equal(t, 10, cupo.Capacity, "expected capacity to be %d but got %d", 10, cupo.Capacity)
+	})
+}
+
+func TestEndpoint_CreateWaitlisted(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	userMock := &userSdkMock.UserSdkMock{
+		GetMock: func(id string) (*domain.User, error) {
+			return &domain.User{}, nil
+		},
+	}
+	courseMock := &courseSdkMock.CourseSdkMock{
+		GetMock: func(id string) (*domain.Course, error) {
+			return &domain.Course{}, nil
+		},
+	}
+
+	t.Run("should return accepted with waitlist position", func(t *testing.T) {
+		repo := &mockRepository{
+			//Simulamos que el repo no encontro cupo y lo dejo en lista de espera
+			CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
+				e.ID = "123"
+				e.Status = enrollment.Waitlisted
+				return nil
+			},
+			WaitlistPositionMock: func(ctx context.Context, e *domain.Enrollment) (int, error) {
+				assert.Equal(t, "123", e.ID, "expected enrollment ID to be '%s' but got '%s'", "123", e.ID)
+				return 3, nil
+			},
+		}
+
+		svc := enrollment.NewService(l, userMock, courseMock, repo)
+		enrollmentEndpoint := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+		enrollmentsResponse, err := enrollmentEndpoint.Create(context.Background(), enrollment.CreateRequest{
+			UserID:   "user1",
+			CourseID: "course1",
+		})
+
+		assert.NoError(t, err, "expected no error but got %v", err)
+		resp := enrollmentsResponse.(response.Response)
+		data := resp.GetData().(enrollment.WaitlistedEnrollment)
+
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode(), "expected status code to be %d but got %d", http.StatusAccepted, resp.StatusCode())
+		assert.Equal(t, enrollment.Waitlisted, data.Status, "expected status to be '%s' but got '%s'", enrollment.Waitlisted, data.Status)
+		assert.Equal(t, 3, data.WaitlistPosition, "expected waitlist position to be %d but got %d", 3, data.WaitlistPosition)
+	})
+}
+
+func TestEndpoint_Capacity(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should return error if capacity is missing", func(t *testing.T) {
+		enrollmentEndpoint := enrollment.MakeEndpoints(nil, enrollment.Config{LimitPageDefault: "10"})
+		_, err := enrollmentEndpoint.SetCapacity(context.Background(), enrollment.SetCapacityRequest{CourseID: "course1"})
+
+		resp := err.(response.Response)
+		assert.EqualError(t, err, enrollment.ErrCapacityRequired.Error(), "expected error message to be '%s' but got '%s'", enrollment.ErrCapacityRequired.Error(), err.Error())
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode(), "expected status code to be %d but got %d", http.StatusBadRequest, resp.StatusCode())
+	})
+
+	t.Run("should return not found if course has no capacity", func(t *testing.T) {
+		repo := &mockRepository{
+			GetCapacityMock: func(ctx context.Context, courseID string) (*enrollment.CourseCapacity, error) {
+				return nil, enrollment.ErrCapacityNotFound{CourseID: courseID}
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repo)
+		enrollmentEndpoint := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+		_, err := enrollmentEndpoint.GetCapacity(context.Background(), enrollment.GetCapacityRequest{CourseID: "course1"})
+
+		resp := err.(response.Response)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode(), "expected status code to be %d but got %d", http.StatusNotFound, resp.StatusCode())
+	})
+}
@@ -0,0 +1,151 @@
+package enrollment
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_domain/domain"
+)
+
+// Cursor es la posicion del ultimo enrollment de una pagina, la siguiente pagina parte despues de el
+// Guarda los valores de las columnas del orden (ver sort.go) y el id, que desempata cuando se repiten
+// Sort es el orden con el que se armo, la siguiente pagina tiene que pedir el mismo
+type Cursor struct {
+	Sort      string     `json:"o,omitempty"`
+	CreatedAt *time.Time `json:"c,omitempty"`
+	UpdatedAt *time.Time `json:"u,omitempty"`
+	Status    string     `json:"s,omitempty"`
+	UserID    string     `json:"uid,omitempty"`
+	CourseID  string     `json:"cid,omitempty"`
+	ID        string     `json:"i"`
+}
+
+// EncodeCursor arma el cursor opaco que le devolvemos al cliente (json en base64 url)
+func EncodeCursor(e domain.Enrollment, orden []SortField) string {
+	b, _ := json.Marshal(cursorDe(e, ordenCompleto(orden)))
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// cursorDe guarda del enrollment los valores de las columnas del orden
+func cursorDe(e domain.Enrollment, orden []SortField) Cursor {
+	c := Cursor{Sort: sortString(orden), ID: e.ID}
+	for _, campo := range orden {
+		switch campo.Column {
+		case "created_at":
+			c.CreatedAt = e.CreatedAt
+		case "updated_at":
+			c.UpdatedAt = e.UpdatedAt
+		case "status":
+			c.Status = string(e.Status)
+		case "user_id":
+			c.UserID = e.UserID
+		case "course_id":
+			c.CourseID = e.CourseID
+		}
+	}
+	return c
+}
+
+// DecodeCursor valida y lee el cursor que manda el cliente
+// El cursor tiene que ser del mismo orden que se esta pidiendo, si no las paginas no calzan
+func DecodeCursor(s string, orden []SortField) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor{Cursor: s}
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor{Cursor: s}
+	}
+	//Los cursores viejos no traian el orden, eran siempre del orden por defecto
+	if c.Sort == "" {
+		c.Sort = sortString(DefaultSort)
+	}
+	if c.Sort != sortString(orden) {
+		return nil, ErrInvalidCursor{Cursor: s}
+	}
+	for _, campo := range ordenCompleto(orden) {
+		if _, ok := c.valor(campo.Column); !ok {
+			return nil, ErrInvalidCursor{Cursor: s}
+		}
+	}
+	return &c, nil
+}
+
+// valor devuelve el valor guardado en el cursor para una columna del orden
+func (c Cursor) valor(columna string) (interface{}, bool) {
+	switch columna {
+	case "created_at":
+		if c.CreatedAt == nil {
+			return nil, false
+		}
+		return *c.CreatedAt, true
+	case "updated_at":
+		if c.UpdatedAt == nil {
+			return nil, false
+		}
+		return *c.UpdatedAt, true
+	case "status":
+		return c.Status, c.Status != ""
+	case "user_id":
+		return c.UserID, c.UserID != ""
+	case "course_id":
+		return c.CourseID, c.CourseID != ""
+	case "id":
+		return c.ID, c.ID != ""
+	}
+	return nil, false
+}
+
+// condicionCursor arma el WHERE del keyset para un orden de varias columnas, ej con (created_at desc, id desc):
+// (created_at < ?) OR (created_at = ? AND id < ?)
+func condicionCursor(orden []SortField, c *Cursor) (string, []interface{}) {
+	var condiciones []string
+	var args []interface{}
+	for i, campo := range orden {
+		var partes []string
+		for _, anterior := range orden[:i] {
+			valor, _ := c.valor(anterior.Column)
+			partes = append(partes, anterior.Column+" = ?")
+			args = append(args, valor)
+		}
+		operador := " > ?"
+		if campo.Desc {
+			operador = " < ?"
+		}
+		valor, _ := c.valor(campo.Column)
+		partes = append(partes, campo.Column+operador)
+		args = append(args, valor)
+		condiciones = append(condiciones, "("+strings.Join(partes, " AND ")+")")
+	}
+	return "(" + strings.Join(condiciones, " OR ") + ")", args
+}
+
+// ListMeta es el meta del listado cuando se usa cursor o count=false
+// TotalCount y PageCount son punteros porque sin count no se conocen (y 0 es un valor valido)
+type ListMeta struct {
+	TotalCount *int   `json:"total_count,omitempty"`
+	Page       int    `json:"page,omitempty"`
+	PerPage    int    `json:"per_page"`
+	PageCount  *int   `json:"page_count,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// listResponse es un SuccessResponse con ListMeta, el de go_lib_response solo acepta *meta.Meta
+// El Meta de aca tapa al del SuccessResponse al hacer el json (el campo menos anidado gana)
+type listResponse struct {
+	*response.SuccessResponse
+	Meta ListMeta `json:"meta"`
+}
+
+func (l listResponse) GetBody() ([]byte, error) {
+	return json.Marshal(l)
+}
+
+// GetListMeta es para los transportes que no usan el json (ej: gRPC), el Meta de SuccessResponse aca siempre es nil
+func (l listResponse) GetListMeta() ListMeta {
+	return l.Meta
+}
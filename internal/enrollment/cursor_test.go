@@ -0,0 +1,126 @@
+package enrollment_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+func TestCursor(t *testing.T) {
+	t.Run("should encode and decode a cursor", func(t *testing.T) {
+		creado := time.Date(2024, 5, 10, 12, 30, 0, 123000000, time.UTC)
+		cursor, err := enrollment.DecodeCursor(enrollment.EncodeCursor(domain.Enrollment{ID: "abc", CreatedAt: &creado}, nil), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "abc", cursor.ID)
+		assert.True(t, creado.Equal(*cursor.CreatedAt))
+	})
+
+	t.Run("should reject a malformed cursor", func(t *testing.T) {
+		for _, valor := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+			_, err := enrollment.DecodeCursor(valor, nil)
+			assert.ErrorAs(t, err, &enrollment.ErrInvalidCursor{}, valor)
+		}
+	})
+}
+
+func TestEndpoint_GetAllCursor(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	creado := time.Date(2024, 5, 10, 12, 30, 0, 0, time.UTC)
+	enrolls := []domain.Enrollment{
+		{ID: "3", CreatedAt: &creado},
+		{ID: "2", CreatedAt: &creado},
+		{ID: "1", CreatedAt: &creado},
+	}
+
+	t.Run("should return 400 on invalid cursor", func(t *testing.T) {
+		svc := enrollment.NewService(l, nil, nil, &mockRepository{})
+		endpoints := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+
+		_, err := endpoints.GetAll(context.Background(), enrollment.GetAllRequest{Cursor: "????"})
+		assert.Equal(t, http.StatusBadRequest, err.(response.Response).StatusCode())
+	})
+
+	t.Run("should page by cursor without counting", func(t *testing.T) {
+		cursor := enrollment.EncodeCursor(domain.Enrollment{ID: "9", CreatedAt: &creado}, nil)
+		repo := &mockRepository{
+			GetAllMock: func(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error) {
+				assert.NotNil(t, filtros.Cursor)
+				assert.Equal(t, "9", filtros.Cursor.ID)
+				assert.Equal(t, 0, offset)
+				assert.Equal(t, 3, limit) //Pide uno mas que el limit para saber si hay siguiente pagina
+				return enrolls, nil
+			},
+		}
+		svc := enrollment.NewService(l, nil, nil, repo)
+		endpoints := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+
+		resp, err := endpoints.GetAll(context.Background(), enrollment.GetAllRequest{Cursor: cursor, Limit: 2, SkipCount: true})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.(response.Response).StatusCode())
+		assert.Equal(t, enrolls[:2], resp.(response.Response).GetData())
+
+		body, err := resp.(response.Response).GetBody()
+		assert.NoError(t, err)
+		var decoded struct {
+			Meta enrollment.ListMeta `json:"meta"`
+		}
+		assert.NoError(t, json.Unmarshal(body, &decoded))
+		assert.Equal(t, 2, decoded.Meta.PerPage)
+		assert.Nil(t, decoded.Meta.TotalCount)
+		assert.Equal(t, enrollment.EncodeCursor(enrolls[1], nil), decoded.Meta.NextCursor)
+	})
+
+	t.Run("should not return next cursor on the last page", func(t *testing.T) {
+		repo := &mockRepository{
+			GetAllMock: func(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error) {
+				return enrolls, nil
+			},
+			CountMock: func(ctx context.Context, filtros enrollment.Filtros) (int, error) {
+				assert.Nil(t, filtros.Cursor)
+				return 3, nil
+			},
+		}
+		svc := enrollment.NewService(l, nil, nil, repo)
+		endpoints := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+
+		cursor := enrollment.EncodeCursor(domain.Enrollment{ID: "9", CreatedAt: &creado}, nil)
+		resp, err := endpoints.GetAll(context.Background(), enrollment.GetAllRequest{Cursor: cursor})
+		assert.NoError(t, err)
+
+		body, _ := resp.(response.Response).GetBody()
+		var decoded struct {
+			Meta enrollment.ListMeta `json:"meta"`
+		}
+		assert.NoError(t, json.Unmarshal(body, &decoded))
+		assert.Equal(t, 3, *decoded.Meta.TotalCount)
+		assert.Equal(t, 10, decoded.Meta.PerPage)
+		assert.Empty(t, decoded.Meta.NextCursor)
+	})
+
+	t.Run("should skip count in offset mode", func(t *testing.T) {
+		repo := &mockRepository{
+			GetAllMock: func(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error) {
+				assert.Equal(t, 2, offset)
+				assert.Equal(t, 3, limit)
+				return enrolls, nil
+			},
+		}
+		svc := enrollment.NewService(l, nil, nil, repo)
+		endpoints := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+
+		resp, err := endpoints.GetAll(context.Background(), enrollment.GetAllRequest{Page: 2, Limit: 2, SkipCount: true})
+		assert.NoError(t, err)
+		assert.Len(t, resp.(response.Response).GetData(), 2)
+	})
+}
@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_domain/domain"
 	"github.com/IgnacioBO/gomicro_meta/meta"
 
 	courseSdk "github.com/IgnacioBO/go_micro_sdk/course"
@@ -17,9 +21,19 @@ type (
 	//Controller sera una funcion que reciba REspone y Request
 	Controller func(ctx context.Context, request interface{}) (interface{}, error)
 	Endpoints  struct {
-		Create Controller
-		GetAll Controller
-		Update Controller
+		Create     Controller
+		BulkCreate Controller
+		Get        Controller
+		GetAll     Controller
+		Update     Controller
+		Delete     Controller
+		Restore    Controller
+		History    Controller
+
+		GetCapacity Controller
+		SetCapacity Controller
+
+		Health Controller
 	}
 	//Definiremos una struct para definir el request del Craete, con los campos que quiero recibir y los tags de json
 	CreateRequest struct {
@@ -27,20 +41,83 @@ type (
 		CourseID string `json:"course_id"`
 	}
 
+	//Request del bulk, mode puede ser transaction o per_item (por defecto per_item)
+	BulkCreateRequest struct {
+		Items []CreateRequest `json:"items"`
+		Mode  string          `json:"mode"`
+	}
+
+	//Resultado de cada item del bulk con su propio status code
+	BulkCreateResponse struct {
+		UserID     string             `json:"user_id"`
+		CourseID   string             `json:"course_id"`
+		StatusCode int                `json:"status_code"`
+		Enrollment *domain.Enrollment `json:"enrollment,omitempty"`
+		Error      string             `json:"error,omitempty"`
+	}
+
+	GetRequest struct {
+		ID     string
+		Expand []string
+	}
+
 	UpdateRequest struct {
-		ID     string  `json:"id"`
-		Status *string `json:"status"`
+		ID      string  `json:"id"`
+		Status  *string `json:"status"`
+		IfMatch string  `json:"-"` //Header If-Match (ETag de la version que el cliente leyo)
 	}
 	//Struct para guardar la cant page por defecto y otras conf
 	Config struct {
 		LimitPageDefault string
+		BulkMaxItems     int
+		Breakers         []*CircuitBreaker //Circuit breakers de users y courses que se muestran en el health
+		Caches           []CacheReporter   //Caches de users y courses, se muestran los contadores en el health
 	}
 
+	//Los filtros vienen como texto desde el query string, el endpoint los valida y los pasa a Filtros
 	GetAllRequest struct {
-		UserID   string
+		UserID         string //Uno o varios separados por coma
+		CourseID       string //Uno o varios separados por coma
+		Status         string //Uno o varios separados por coma, ej: P,A
+		ExcludeStatus  string
+		CreatedFrom    string
+		CreatedTo      string
+		UpdatedFrom    string
+		UpdatedTo      string
+		IncludeDeleted bool
+		Limit          int
+		Page           int
+		Sort           string //Columnas separadas por coma, con "-" adelante es descendente, ej: -updated_at,status
+		Cursor         string //Si viene cursor se pagina por keyset y se ignora Page
+		SkipCount      bool   //count=false, no se hace el Count (en tablas grandes es caro)
+	}
+
+	DeleteRequest struct {
+		ID string
+	}
+
+	RestoreRequest struct {
+		ID string
+	}
+
+	HistoryRequest struct {
+		ID string
+	}
+
+	GetCapacityRequest struct {
 		CourseID string
-		Limit    int
-		Page     int
+	}
+
+	SetCapacityRequest struct {
+		CourseID string `json:"-"`
+		Capacity *int   `json:"capacity"`
+	}
+
+	//Status es "ok" si todos los circuitos estan cerrados, si no "degraded"
+	HealthResponse struct {
+		Status   string          `json:"status"`
+		Circuits []BreakerStatus `json:"circuits"`
+		Caches   []CacheStats    `json:"caches"`
 	}
 )
 
@@ -49,9 +126,19 @@ type (
 // Esta funcion va a DEVOLVER una struct de Endpoints, estos endpoints son los que vamos a poder utuaizlar en unestro dominio (course)
 func MakeEndpoints(s Service, c Config) Endpoints {
 	return Endpoints{
-		Create: makeCreateEndpoint(s),
-		GetAll: makeGetAllEndpoint(s, c),
-		Update: makeUpdateEndpoint(s),
+		Create:     makeCreateEndpoint(s),
+		BulkCreate: makeBulkCreateEndpoint(s, c),
+		Get:        makeGetEndpoint(s),
+		GetAll:     makeGetAllEndpoint(s, c),
+		Update:     makeUpdateEndpoint(s),
+		Delete:     makeDeleteEndpoint(s),
+		Restore:    makeRestoreEndpoint(s),
+		History:    makeHistoryEndpoint(s),
+
+		GetCapacity: makeGetCapacityEndpoint(s),
+		SetCapacity: makeSetCapacityEndpoint(s),
+
+		Health: makeHealthEndpoint(c),
 	}
 }
 
@@ -75,13 +162,144 @@ func makeCreateEndpoint(s Service) Controller {
 
 		enrollNuevo, err := s.Create(ctx, reqStruct.UserID, reqStruct.CourseID)
 		if err != nil {
-			if errors.As(err, &userSdk.ErrNotFound{}) || errors.As(err, &courseSdk.ErrNotFound{}) {
+			return nil, createErrorResponse(err)
+		}
+
+		//Si el curso estaba lleno queda en lista de espera, respondemos 202 con la posicion en la fila
+		if enrollNuevo.Status == Waitlisted {
+			return waitlistedResponse(ctx, s, enrollNuevo, response.Accepted)
+		}
+
+		return response.Created("success", enrollNuevo, nil), nil
+	}
+}
+
+// createErrorResponse transforma un error del Create en un response con su status code (lo usa el create y el bulk)
+func createErrorResponse(err error) response.Response {
+	//Va primero: si un lookup no se pudo hacer no sabemos si el otro not found es todo lo que falta, mejor que reintenten
+	if errors.As(err, &ErrUpstreamUnavailable{}) {
+		return unavailableResponse(err)
+	}
+	if errors.As(err, &userSdk.ErrNotFound{}) || errors.As(err, &courseSdk.ErrNotFound{}) {
+		return response.NotFound(err.Error())
+	}
+	if errors.As(err, &ErrAlreadyEnrolled{}) || errors.Is(err, ErrBulkAborted) {
+		return errorResponse(err.Error(), http.StatusConflict)
+	}
+	if errors.As(err, &ErrForbidden{}) {
+		return response.Forbidden(err.Error())
+	}
+	return response.InternalServerError(err.Error())
+}
+
+// listErrorResponse es el error del Count y GetAll del listado, solo la politica de roles puede rechazar el filtro
+func listErrorResponse(err error) response.Response {
+	if errors.As(err, &ErrForbidden{}) {
+		return response.Forbidden(err.Error())
+	}
+	return response.InternalServerError(err.Error())
+}
+
+func makeBulkCreateEndpoint(s Service, config Config) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		fmt.Println("bulk create enrollment")
+
+		reqStruct := request.(BulkCreateRequest)
+		if len(reqStruct.Items) == 0 {
+			return nil, response.BadRequest(ErrBulkEmpty.Error())
+		}
+		if config.BulkMaxItems > 0 && len(reqStruct.Items) > config.BulkMaxItems {
+			return nil, response.BadRequest(ErrBulkTooLarge{config.BulkMaxItems}.Error())
+		}
+		if reqStruct.Mode == "" {
+			reqStruct.Mode = BulkModePerItem
+		}
+		if reqStruct.Mode != BulkModeTransaction && reqStruct.Mode != BulkModePerItem {
+			return nil, response.BadRequest(ErrInvalidBulkMode{reqStruct.Mode}.Error())
+		}
+		//Igual que en el create, user_id y course_id son obligatorios en cada item
+		for _, item := range reqStruct.Items {
+			if item.UserID == "" {
+				return nil, response.BadRequest(ErrUserIDRequired.Error())
+			}
+			if item.CourseID == "" {
+				return nil, response.BadRequest(ErrCourseIDRequired.Error())
+			}
+		}
+
+		resultados, err := s.BulkCreate(ctx, reqStruct.Items, reqStruct.Mode)
+		if err != nil {
+			if errors.As(err, &ErrForbidden{}) {
+				return nil, response.Forbidden(err.Error())
+			}
+			return nil, response.InternalServerError(err.Error())
+		}
+
+		respuesta := make([]BulkCreateResponse, len(resultados))
+		for i, r := range resultados {
+			respuesta[i] = BulkCreateResponse{
+				UserID:     r.Item.UserID,
+				CourseID:   r.Item.CourseID,
+				StatusCode: http.StatusCreated,
+				Enrollment: r.Enrollment,
+			}
+			if r.Err != nil {
+				respuesta[i].StatusCode = createErrorResponse(r.Err).StatusCode()
+				respuesta[i].Error = r.Err.Error()
+			} else if r.Enrollment.Status == Waitlisted {
+				respuesta[i].StatusCode = http.StatusAccepted
+			}
+		}
+
+		return response.OK("success", respuesta, nil), nil
+	}
+}
+
+func makeGetEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		fmt.Println("get enrollment")
+
+		reqStruct := request.(GetRequest)
+		if reqStruct.ID == "" {
+			return nil, response.BadRequest(ErrIDRequired.Error())
+		}
+
+		//Pasamos los valores de expand (ej: ?expand=user,course) al struct Expand del service
+		var expand Expand
+		for _, e := range reqStruct.Expand {
+			switch e {
+			case "user":
+				expand.User = true
+			case "course":
+				expand.Course = true
+			default:
+				return nil, response.BadRequest(ErrInvalidExpand{e}.Error())
+			}
+		}
+
+		enroll, version, err := s.Get(ctx, reqStruct.ID, expand)
+		if err != nil {
+			if errors.As(err, &ErrEnrollNotFound{}) {
 				return nil, response.NotFound(err.Error())
 			}
+			if errors.As(err, &ErrUpstreamUnavailable{}) {
+				return nil, unavailableResponse(err)
+			}
+			if errors.As(err, &ErrForbidden{}) {
+				return nil, response.Forbidden(err.Error())
+			}
 			return nil, response.InternalServerError(err.Error())
 		}
 
-		return response.Created("success", enrollNuevo, nil), nil
+		if enroll.Status == Waitlisted {
+			resp, err := waitlistedResponse(ctx, s, enroll, response.OK)
+			if err != nil {
+				return nil, err
+			}
+			return conETag(resp, version), nil
+		}
+
+		return conETag(response.OK("success", enroll, nil), version), nil
 	}
 }
 
@@ -91,29 +309,90 @@ func makeGetAllEndpoint(s Service, config Config) Controller {
 
 		getAllParametros := request.(GetAllRequest)
 		//Luego con podemos acceder a los parametos y guardarlos en el struct Filtro (creado en service.go)
-		filtros := Filtros{
-			UserID:   getAllParametros.UserID,
-			CourseID: getAllParametros.CourseID,
+		filtros, err := armarFiltros(getAllParametros)
+		if err != nil {
+			return nil, response.BadRequest(err.Error())
 		}
 
-		//Ahora llamaremos al Count del service que creamos (antes de hacer la consulta completa)
-		cantidad, err := s.Count(ctx, filtros)
-		if err != nil {
-			return nil, response.InternalServerError(err.Error())
+		if getAllParametros.Cursor != "" {
+			cursor, err := DecodeCursor(getAllParametros.Cursor, filtros.Sort)
+			if err != nil {
+				return nil, response.BadRequest(err.Error())
+			}
+			filtros.Cursor = cursor
 		}
-		//Luego crearemos un meta y le agregaremos la cantidad que consultamos, luego el meta lo ageregaremos a la respuesta
-		meta, err := meta.New(getAllParametros.Page, getAllParametros.Limit, cantidad, config.LimitPageDefault)
-		if err != nil {
-			return nil, response.InternalServerError(err.Error())
+
+		//Modo offset con count, es el de siempre y se deja igual para no romper a los clientes que ya lo usan
+		if filtros.Cursor == nil && !getAllParametros.SkipCount {
+			//Ahora llamaremos al Count del service que creamos (antes de hacer la consulta completa)
+			cantidad, err := s.Count(ctx, filtros)
+			if err != nil {
+				return nil, listErrorResponse(err)
+			}
+			//Luego crearemos un meta y le agregaremos la cantidad que consultamos, luego el meta lo ageregaremos a la respuesta
+			meta, err := meta.New(getAllParametros.Page, getAllParametros.Limit, cantidad, config.LimitPageDefault)
+			if err != nil {
+				return nil, response.InternalServerError(err.Error())
+			}
+
+			allUsers, err := s.GetAll(ctx, filtros, meta.Offset(), meta.Limit()) //GetAll recibe el offset (desde q resultado mostrar) y el limit (cuantos desde el offset)
+			if err != nil {
+				return nil, listErrorResponse(err)
+			}
+
+			return response.OK("success", allUsers, meta), nil
 		}
 
-		allUsers, err := s.GetAll(ctx, filtros, meta.Offset(), meta.Limit()) //GetAll recibe el offset (desde q resultado mostrar) y el limit (cuantos desde el offset)
+		return getAllPaginado(ctx, s, filtros, getAllParametros, config)
+	}
+}
+
+// getAllPaginado responde el listado con cursor y/o sin count, con next_cursor en el meta si hay mas resultados
+func getAllPaginado(ctx context.Context, s Service, filtros Filtros, parametros GetAllRequest, config Config) (interface{}, error) {
+	listMeta := ListMeta{}
+	total := -1 //Con total negativo meta.New no calcula paginas, solo lo usamos para resolver el per_page por defecto
+	if !parametros.SkipCount {
+		//El total es de todo el listado, no solo de lo que queda despues del cursor
+		filtrosCount := filtros
+		filtrosCount.Cursor = nil
+		cantidad, err := s.Count(ctx, filtrosCount)
 		if err != nil {
-			return nil, response.InternalServerError(err.Error())
+			return nil, listErrorResponse(err)
 		}
+		total = cantidad
+		listMeta.TotalCount = &cantidad
+	}
+
+	paginacion, err := meta.New(parametros.Page, parametros.Limit, total, config.LimitPageDefault)
+	if err != nil {
+		return nil, response.InternalServerError(err.Error())
+	}
+	listMeta.PerPage = paginacion.Limit()
+	if listMeta.TotalCount != nil {
+		listMeta.PageCount = &paginacion.PageCount
+	}
+
+	offset := 0
+	if filtros.Cursor == nil {
+		//Offset sin count, no sabemos cuantas paginas hay asi que no acotamos la page
+		offset = paginacion.Offset()
+		listMeta.Page = paginacion.Page
+	}
 
-		return response.OK("success", allUsers, meta), nil
+	//Pedimos uno extra para saber si hay otra pagina sin tener que contar
+	allEnroll, err := s.GetAll(ctx, filtros, offset, paginacion.Limit()+1)
+	if err != nil {
+		return nil, listErrorResponse(err)
 	}
+	if len(allEnroll) > paginacion.Limit() {
+		allEnroll = allEnroll[:paginacion.Limit()]
+		listMeta.NextCursor = EncodeCursor(allEnroll[len(allEnroll)-1], filtros.Sort)
+	}
+
+	return listResponse{
+		SuccessResponse: &response.SuccessResponse{Message: "success", Status: http.StatusOK, Data: allEnroll},
+		Meta:            listMeta,
+	}, nil
 }
 
 func makeUpdateEndpoint(s Service) Controller {
@@ -131,7 +410,7 @@ func makeUpdateEndpoint(s Service) Controller {
 		}
 		id := reqStruct.ID
 
-		err := s.Update(ctx, id, reqStruct.Status)
+		version, err := s.Update(ctx, id, reqStruct.Status, ParseIfMatch(reqStruct.IfMatch))
 		if err != nil {
 			//Validamos
 			if errors.As(err, &ErrEnrollNotFound{}) {
@@ -140,11 +419,221 @@ func makeUpdateEndpoint(s Service) Controller {
 			if errors.As(err, &ErrInvalidStatus{}) {
 				return nil, response.BadRequest(err.Error())
 			}
+			if errors.As(err, &ErrInvalidTransition{}) || errors.As(err, &ErrStatusConflict{}) {
+				return nil, errorResponse(err.Error(), http.StatusConflict)
+			}
+			if errors.As(err, &ErrPreconditionFailed{}) {
+				return nil, errorResponse(err.Error(), http.StatusPreconditionFailed)
+			}
+			if errors.As(err, &ErrForbidden{}) {
+				return nil, response.Forbidden(err.Error())
+			}
+
+			return nil, response.InternalServerError(err.Error())
+		}
+
+		return conETag(response.OK("success", reqStruct, nil), version), nil
+
+	}
+}
+
+func makeDeleteEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		fmt.Println("delete enrollment")
+
+		reqStruct := request.(DeleteRequest)
+		if reqStruct.ID == "" {
+			return nil, response.BadRequest(ErrIDRequired.Error())
+		}
+
+		if err := s.Delete(ctx, reqStruct.ID); err != nil {
+			if errors.As(err, &ErrEnrollNotFound{}) {
+				return nil, response.NotFound(err.Error())
+			}
+			if errors.As(err, &ErrForbidden{}) {
+				return nil, response.Forbidden(err.Error())
+			}
+			return nil, response.InternalServerError(err.Error())
+		}
 
+		return response.OK("success", nil, nil), nil
+	}
+}
+
+func makeRestoreEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		fmt.Println("restore enrollment")
+
+		reqStruct := request.(RestoreRequest)
+		if reqStruct.ID == "" {
+			return nil, response.BadRequest(ErrIDRequired.Error())
+		}
+
+		if err := s.Restore(ctx, reqStruct.ID); err != nil {
+			if errors.As(err, &ErrEnrollNotFound{}) {
+				return nil, response.NotFound(err.Error())
+			}
+			if errors.As(err, &ErrAlreadyEnrolled{}) {
+				return nil, errorResponse(err.Error(), http.StatusConflict)
+			}
+			if errors.As(err, &ErrForbidden{}) {
+				return nil, response.Forbidden(err.Error())
+			}
+			return nil, response.InternalServerError(err.Error())
+		}
+
+		return response.OK("success", nil, nil), nil
+	}
+}
+
+func makeHistoryEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		fmt.Println("history enrollment")
+
+		reqStruct := request.(HistoryRequest)
+		if reqStruct.ID == "" {
+			return nil, response.BadRequest(ErrIDRequired.Error())
+		}
+
+		historial, err := s.History(ctx, reqStruct.ID)
+		if err != nil {
+			if errors.As(err, &ErrEnrollNotFound{}) {
+				return nil, response.NotFound(err.Error())
+			}
+			if errors.As(err, &ErrForbidden{}) {
+				return nil, response.Forbidden(err.Error())
+			}
 			return nil, response.InternalServerError(err.Error())
 		}
 
-		return response.OK("success", reqStruct, nil), nil
+		return response.OK("success", historial, nil), nil
+	}
+}
 
+// waitlistedResponse agrega la posicion en la lista de espera al enrollment (usa el constructor de response que le pasen, ej: response.OK)
+func waitlistedResponse(ctx context.Context, s Service, enroll *domain.Enrollment, responder func(string, interface{}, *meta.Meta) response.Response) (response.Response, error) {
+	posicion, err := s.WaitlistPosition(ctx, enroll)
+	if err != nil {
+		return nil, response.InternalServerError(err.Error())
+	}
+	return responder("waitlisted", WaitlistedEnrollment{Enrollment: enroll, WaitlistPosition: posicion}, nil), nil
+}
+
+func makeGetCapacityEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		fmt.Println("get course capacity")
+
+		reqStruct := request.(GetCapacityRequest)
+		if reqStruct.CourseID == "" {
+			return nil, response.BadRequest(ErrCourseIDRequired.Error())
+		}
+
+		cupo, err := s.GetCapacity(ctx, reqStruct.CourseID)
+		if err != nil {
+			if errors.As(err, &ErrCapacityNotFound{}) {
+				return nil, response.NotFound(err.Error())
+			}
+			return nil, response.InternalServerError(err.Error())
+		}
+
+		return response.OK("success", cupo, nil), nil
+	}
+}
+
+func makeSetCapacityEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		fmt.Println("set course capacity")
+
+		reqStruct := request.(SetCapacityRequest)
+		if reqStruct.CourseID == "" {
+			return nil, response.BadRequest(ErrCourseIDRequired.Error())
+		}
+		if reqStruct.Capacity == nil {
+			return nil, response.BadRequest(ErrCapacityRequired.Error())
+		}
+
+		cupo, err := s.SetCapacity(ctx, reqStruct.CourseID, *reqStruct.Capacity)
+		if err != nil {
+			if errors.Is(err, ErrInvalidCapacity) {
+				return nil, response.BadRequest(err.Error())
+			}
+			if errors.As(err, &courseSdk.ErrNotFound{}) {
+				return nil, response.NotFound(err.Error())
+			}
+			if errors.As(err, &ErrUpstreamUnavailable{}) {
+				return nil, unavailableResponse(err)
+			}
+			if errors.As(err, &ErrForbidden{}) {
+				return nil, response.Forbidden(err.Error())
+			}
+			return nil, response.InternalServerError(err.Error())
+		}
+
+		return response.OK("success", cupo, nil), nil
+	}
+}
+
+// El health responde siempre 200, que users o courses esten caidos no significa que esta instancia este mal
+func makeHealthEndpoint(config Config) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		health := HealthResponse{Status: "ok", Circuits: []BreakerStatus{}, Caches: []CacheStats{}}
+		for _, breaker := range config.Breakers {
+			status := breaker.Status()
+			if status.State != BreakerClosed {
+				health.Status = "degraded"
+			}
+			health.Circuits = append(health.Circuits, status)
+		}
+		for _, cache := range config.Caches {
+			health.Caches = append(health.Caches, cache.Stats())
+		}
+		return response.OK("success", health, nil), nil
+	}
+}
+
+// response no tiene helpers para todos los status code (ej: 409), asi que armamos el ErrorResponse a mano
+func errorResponse(msg string, code int) response.Response {
+	return &response.ErrorResponse{Status: code, Message: msg}
+}
+
+// retryAfterResponse es un ErrorResponse que ademas agrega headers, go-kit los usa si el error implementa Headers() (httptransport.Headerer)
+type retryAfterResponse struct {
+	*response.ErrorResponse
+	retryAfter time.Duration
+}
+
+func (r retryAfterResponse) Headers() http.Header {
+	return http.Header{"Retry-After": []string{strconv.Itoa(retryAfterSeconds(r.retryAfter))}}
+}
+
+// etagResponse es un SuccessResponse que ademas manda el header ETag con la version del enrollment
+type etagResponse struct {
+	*response.SuccessResponse
+	version int
+}
+
+func (r etagResponse) Headers() http.Header {
+	headers := http.Header{}
+	headers.Set("ETag", ETag(r.version))
+	return headers
+}
+
+// conETag agrega el ETag de la version a una respuesta exitosa
+func conETag(resp response.Response, version int) response.Response {
+	if exito, ok := resp.(*response.SuccessResponse); ok {
+		return etagResponse{SuccessResponse: exito, version: version}
+	}
+	return resp
+}
+
+// unavailableResponse responde 503, y si el circuito esta abierto agrega Retry-After para que el cliente sepa cuando reintentar
+func unavailableResponse(err error) response.Response {
+	var circuitoAbierto ErrCircuitOpen
+	if errors.As(err, &circuitoAbierto) {
+		return retryAfterResponse{
+			ErrorResponse: &response.ErrorResponse{Status: http.StatusServiceUnavailable, Message: err.Error()},
+			retryAfter:    circuitoAbierto.RetryAfter,
+		}
 	}
+	return errorResponse(err.Error(), http.StatusServiceUnavailable)
 }
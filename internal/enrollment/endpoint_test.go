@@ -9,6 +9,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -91,6 +92,12 @@ func TestEndpoint_Create(t *testing.T) {
 					return nil, userSdk.ErrNotFound{Message: "User not found"}
 				},
 			},
+			//El course se busca al mismo tiempo que el user, asi que tambien hay que mockearlo
+			courseSdkMock: &courseSdkMock.CourseSdkMock{
+				GetMock: func(id string) (*domain.Course, error) {
+					return &domain.Course{}, nil
+				},
+			},
 			wantError: userSdk.ErrNotFound{Message: "User not found"},
 			wantCode:  http.StatusNotFound,
 		},
@@ -112,14 +119,19 @@ func TestEndpoint_Create(t *testing.T) {
 		},
 		{
 			tag: "should return error different from not found",
-			//Le pasamos user para que no de error al hacer el get del user
+			//Un error que no es not found se reintenta y termina como servicio no disponible (503)
 			userSdkMock: &userSdkMock.UserSdkMock{
 				GetMock: func(id string) (*domain.User, error) {
 					return nil, errors.New("some other error")
 				},
 			},
-			wantError: errors.New("some other error"),
-			wantCode:  http.StatusInternalServerError,
+			courseSdkMock: &courseSdkMock.CourseSdkMock{
+				GetMock: func(id string) (*domain.Course, error) {
+					return &domain.Course{}, nil
+				},
+			},
+			wantError: enrollment.ErrUpstreamUnavailable{Service: "user", Err: errors.New("some other error")},
+			wantCode:  http.StatusServiceUnavailable,
 		},
 		{
 			tag: "should return error from repository",
@@ -142,6 +154,26 @@ func TestEndpoint_Create(t *testing.T) {
 			wantError: errors.New("error from repository"),
 			wantCode:  http.StatusInternalServerError,
 		},
+		{
+			tag: "should return conflict if already enrolled",
+			userSdkMock: &userSdkMock.UserSdkMock{
+				GetMock: func(id string) (*domain.User, error) {
+					return &domain.User{}, nil
+				},
+			},
+			courseSdkMock: &courseSdkMock.CourseSdkMock{
+				GetMock: func(id string) (*domain.Course, error) {
+					return &domain.Course{}, nil
+				},
+			},
+			repositoryMock: &mockRepository{
+				CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
+					return enrollment.ErrAlreadyEnrolled{UserID: e.UserID, CourseID: e.CourseID}
+				},
+			},
+			wantError: enrollment.ErrAlreadyEnrolled{UserID: "user1", CourseID: "course1"},
+			wantCode:  http.StatusConflict,
+		},
 		{
 			tag: "should create new enrollment",
 			userSdkMock: &userSdkMock.UserSdkMock{
@@ -229,14 +261,14 @@ func TestEndpoint_Create(t *testing.T) {
 			Status:   wantStatus,
 		}
 
-		var wantCounter int = 3
-		var counter int = 0
+		var wantCounter int32 = 3
+		var counter int32 = 0 //int32 + atomic porque el user y el course se buscan en paralelo
 
 		//Aqui para variar usaremos el mock desde userSdk y courseSdk en vez de lso creados en este proyecto
 		userSdk := &userSdkMock.UserSdkMock{
 			GetMock: func(id string) (*domain.User, error) {
 				assert.Equal(t, wantUserId, id, "expected user ID to be '%s' but got '%s'", wantUserId, id)
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return &domain.User{}, nil
 			},
 		}
@@ -244,7 +276,7 @@ func TestEndpoint_Create(t *testing.T) {
 		courseSdk := &courseSdkMock.CourseSdkMock{
 			GetMock: func(id string) (*domain.Course, error) {
 				assert.Equal(t, wantCourseId, id, "expected course ID to be '%s' but got '%s'", wantCourseId, id)
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return &domain.Course{}, nil
 			},
 		}
@@ -252,7 +284,7 @@ func TestEndpoint_Create(t *testing.T) {
 		repo := &mockRepository{
 			CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
 				e.ID = "123" // Simulamos que el repo asigna un ID al enrollment
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return nil
 			},
 		}
@@ -371,6 +403,29 @@ func TestEndpoint_GetAll(t *testing.T) {
 
 	})
 
+	t.Run("should pass include deleted filter", func(t *testing.T) {
+		wantFiltros := enrollment.Filtros{UserID: "user1", IncludeDeleted: true}
+
+		repo := &mockRepository{
+			GetAllMock: func(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error) {
+				assert.Equal(t, wantFiltros, filtros, "expected filters to be %v but got %v", wantFiltros, filtros)
+				return []domain.Enrollment{}, nil
+			},
+			CountMock: func(ctx context.Context, filtros enrollment.Filtros) (int, error) {
+				assert.Equal(t, wantFiltros, filtros, "expected filters to be %v but got %v", wantFiltros, filtros)
+				return 0, nil
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repo)
+		enrollmentEndpoint := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+		_, err := enrollmentEndpoint.GetAll(context.Background(), enrollment.GetAllRequest{
+			UserID:         "user1",
+			IncludeDeleted: true,
+		})
+		assert.NoError(t, err, "expected no error but got %v", err)
+	})
+
 	t.Run("should return enrollments", func(t *testing.T) {
 
 		wantEnrollments := []domain.Enrollment{
@@ -475,8 +530,8 @@ func TestEndpoint_Updated(t *testing.T) {
 		wantError := enrollment.ErrEnrollNotFound{id}
 
 		repositoryMock := &mockRepository{
-			UpdateMock: func(ctx context.Context, id string, status *string) error {
-				return enrollment.ErrEnrollNotFound{id}
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return nil, enrollment.ErrEnrollNotFound{id}
 			},
 		}
 
@@ -504,7 +559,7 @@ func TestEndpoint_Updated(t *testing.T) {
 		wantError := enrollment.ErrInvalidStatus{Status: status}
 
 		repositoryMock := &mockRepository{
-			UpdateMock: func(ctx context.Context, id string, status *string) error {
+			UpdateMock: func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
 				return nil
 			},
 		}
@@ -527,13 +582,16 @@ func TestEndpoint_Updated(t *testing.T) {
 	})
 
 	t.Run("should return error if service returns error from repository", func(t *testing.T) {
-		status := "P"
+		status := "A"
 		id := "1"
 
 		wantError := errors.New("error from repo")
 
 		repositoryMock := &mockRepository{
-			UpdateMock: func(ctx context.Context, id string, status *string) error {
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return &domain.Enrollment{ID: id, Status: domain.Pending}, nil
+			},
+			UpdateMock: func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
 				return errors.New("error from repo")
 			},
 		}
@@ -560,8 +618,12 @@ func TestEndpoint_Updated(t *testing.T) {
 		id := "1"
 
 		repositoryMock := &mockRepository{
-			UpdateMock: func(ctx context.Context, id string, status *string) error {
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return &domain.Enrollment{ID: id, Status: domain.Pending}, nil
+			},
+			UpdateMock: func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
 				assert.Equal(t, id, "1", "expected enrollment ID to be '%s' but got '%s'", id, "1")
+				assert.Equal(t, domain.Pending, currentStatus, "expected current Status to be '%s' but got '%s'", domain.Pending, currentStatus)
 				assert.Equal(t, *status, "A", "expected enrollment Status to be '%s' but got '%s'", *status, "A")
 				assert.NotNil(t, status, "expected enrollment Status to not be nil")
 				return nil
@@ -585,4 +647,241 @@ func TestEndpoint_Updated(t *testing.T) {
 		assert.Equal(t, status, *responseData.Status, "expected enrollment Status to be '%s' but got '%s'", status, *responseData.Status)
 
 	})
+
+	t.Run("should return the new ETag and 412 on a stale If-Match", func(t *testing.T) {
+		status := "A"
+		repositoryMock := &mockRepository{
+			GetVersionedMock: func(ctx context.Context, id string) (*domain.Enrollment, int, error) {
+				return &domain.Enrollment{ID: id, Status: domain.Pending}, 5, nil
+			},
+			UpdateMock: func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
+				return nil
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repositoryMock)
+		enrollmentEndpoint := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+
+		enrollmentsResponse, err := enrollmentEndpoint.Update(context.Background(), enrollment.UpdateRequest{ID: "1", Status: &status, IfMatch: `"5"`})
+		assert.NoError(t, err)
+		headers := enrollmentsResponse.(interface{ Headers() http.Header }).Headers()
+		assert.Equal(t, `"6"`, headers.Get("ETag"))
+
+		_, err = enrollmentEndpoint.Update(context.Background(), enrollment.UpdateRequest{ID: "1", Status: &status, IfMatch: `"4"`})
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusPreconditionFailed, err.(response.Response).StatusCode())
+	})
+}
+
+func TestEndpoint_UpdateTransition(t *testing.T) {
+
+	l := log.New(io.Discard, "", 0)
+
+	//Tabla con los casos que deben responder 409
+	opciones := []struct {
+		tag       string
+		current   domain.EnrollStatus
+		status    string
+		updateErr error
+		wantError error
+	}{
+		{
+			tag:       "should return conflict if transition is not allowed",
+			current:   domain.Inactive,
+			status:    "S",
+			wantError: enrollment.ErrInvalidTransition{From: domain.Inactive, To: domain.Studying},
+		},
+		{
+			tag:       "should return conflict if pending goes to studying",
+			current:   domain.Pending,
+			status:    "S",
+			wantError: enrollment.ErrInvalidTransition{From: domain.Pending, To: domain.Studying},
+		},
+		{
+			tag:       "should return conflict if status changed concurrently",
+			current:   domain.Active,
+			status:    "S",
+			updateErr: enrollment.ErrStatusConflict{EnrollmentID: "1", Status: domain.Active},
+			wantError: enrollment.ErrStatusConflict{EnrollmentID: "1", Status: domain.Active},
+		},
+	}
+
+	for _, opcion := range opciones {
+		t.Run(opcion.tag, func(t *testing.T) {
+			repositoryMock := &mockRepository{
+				GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+					return &domain.Enrollment{ID: id, Status: opcion.current}, nil
+				},
+				UpdateMock: func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
+					return opcion.updateErr
+				},
+			}
+
+			svc := enrollment.NewService(l, nil, nil, repositoryMock)
+			enrollmentEndpoint := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+			enrollmentsResponse, err := enrollmentEndpoint.Update(context.Background(), enrollment.UpdateRequest{
+				ID:     "1",
+				Status: &opcion.status,
+			})
+
+			assert.Error(t, err, "expected error but got nil")
+			resp := err.(response.Response)
+
+			assert.EqualError(t, err, opcion.wantError.Error(), "expected error message to be '%s' but got '%s'", opcion.wantError.Error(), err.Error())
+			assert.Equal(t, http.StatusConflict, resp.StatusCode(), "expected status code to be %d but got %d", http.StatusConflict, resp.StatusCode())
+			assert.Nil(t, enrollmentsResponse, "expected enrollments to be nil")
+		})
+	}
+}
+
+func TestEndpoint_Get(t *testing.T) {
+
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should return error if expand is not valid", func(t *testing.T) {
+		enrollmentEndpoint := enrollment.MakeEndpoints(nil, enrollment.Config{LimitPageDefault: "10"})
+		wantError := enrollment.ErrInvalidExpand{Expand: "teacher"}
+
+		enrollmentsResponse, err := enrollmentEndpoint.Get(context.Background(), enrollment.GetRequest{
+			ID:     "1",
+			Expand: []string{"user", "teacher"},
+		})
+
+		assert.Error(t, err, "expected error but got nil")
+		resp := err.(response.Response)
+
+		assert.EqualError(t, err, wantError.Error(), "expected error message to be '%s' but got '%s'", wantError.Error(), err.Error())
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode(), "expected status code to be %d but got %d", http.StatusBadRequest, resp.StatusCode())
+		assert.Nil(t, enrollmentsResponse, "expected enrollments to be nil")
+	})
+
+	t.Run("should return error if enrollment not found on repository", func(t *testing.T) {
+		id := "1"
+		wantError := enrollment.ErrEnrollNotFound{id}
+
+		repositoryMock := &mockRepository{
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return nil, enrollment.ErrEnrollNotFound{id}
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repositoryMock)
+		enrollmentEndpoint := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+		enrollmentsResponse, err := enrollmentEndpoint.Get(context.Background(), enrollment.GetRequest{ID: id})
+
+		assert.Error(t, err, "expected error but got nil")
+		resp := err.(response.Response)
+
+		assert.EqualError(t, err, wantError.Error(), "expected error message to be '%s' but got '%s'", wantError.Error(), err.Error())
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode(), "expected status code to be %d but got %d", http.StatusNotFound, resp.StatusCode())
+		assert.Nil(t, enrollmentsResponse, "expected enrollments to be nil")
+	})
+
+	t.Run("should return enrollment with course expanded", func(t *testing.T) {
+		wantEnrollment := &domain.Enrollment{
+			ID:       "1",
+			UserID:   "user1",
+			CourseID: "course1",
+			Course:   &domain.Course{ID: "course1"},
+			Status:   domain.Active,
+		}
+
+		repositoryMock := &mockRepository{
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return &domain.Enrollment{ID: "1", UserID: "user1", CourseID: "course1", Status: domain.Active}, nil
+			},
+		}
+		courseSdk := &courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return &domain.Course{ID: id}, nil
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, courseSdk, repositoryMock)
+		enrollmentEndpoint := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+		enrollmentsResponse, err := enrollmentEndpoint.Get(context.Background(), enrollment.GetRequest{
+			ID:     "1",
+			Expand: []string{"course"},
+		})
+
+		assert.NoError(t, err, "expected no error but got %v", err)
+		resp := enrollmentsResponse.(response.Response)
+		enroll := resp.GetData().(*domain.Enrollment)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode(), "expected status code to be %d but got %d", http.StatusOK, resp.StatusCode())
+		assert.Equal(t, wantEnrollment, enroll, "expected enrollment to be %v but got %v", wantEnrollment, enroll)
+	})
+
+	t.Run("should return the version as ETag", func(t *testing.T) {
+		repositoryMock := &mockRepository{
+			GetVersionedMock: func(ctx context.Context, id string) (*domain.Enrollment, int, error) {
+				return &domain.Enrollment{ID: id, Status: domain.Active}, 3, nil
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repositoryMock)
+		enrollmentEndpoint := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+		enrollmentsResponse, err := enrollmentEndpoint.Get(context.Background(), enrollment.GetRequest{ID: "1"})
+
+		assert.NoError(t, err)
+		headers := enrollmentsResponse.(interface{ Headers() http.Header }).Headers()
+		assert.Equal(t, `"3"`, headers.Get("ETag"))
+	})
+}
+
+func TestEndpoint_Delete(t *testing.T) {
+
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should return error if enrollment not found", func(t *testing.T) {
+		id := "1"
+		wantError := enrollment.ErrEnrollNotFound{id}
+
+		repositoryMock := &mockRepository{
+			DeleteMock: func(ctx context.Context, id string) error {
+				return enrollment.ErrEnrollNotFound{id}
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repositoryMock)
+		enrollmentEndpoint := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+		enrollmentsResponse, err := enrollmentEndpoint.Delete(context.Background(), enrollment.DeleteRequest{ID: id})
+
+		assert.Error(t, err, "expected error but got nil")
+		resp := err.(response.Response)
+
+		assert.EqualError(t, err, wantError.Error(), "expected error message to be '%s' but got '%s'", wantError.Error(), err.Error())
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode(), "expected status code to be %d but got %d", http.StatusNotFound, resp.StatusCode())
+		assert.Nil(t, enrollmentsResponse, "expected enrollments to be nil")
+	})
+
+	t.Run("should delete and restore enrollment", func(t *testing.T) {
+		var counter int = 0
+
+		repositoryMock := &mockRepository{
+			DeleteMock: func(ctx context.Context, id string) error {
+				assert.Equal(t, "1", id, "expected enrollment ID to be '%s' but got '%s'", "1", id)
+				counter++
+				return nil
+			},
+			RestoreMock: func(ctx context.Context, id string) error {
+				assert.Equal(t, "1", id, "expected enrollment ID to be '%s' but got '%s'", "1", id)
+				counter++
+				return nil
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repositoryMock)
+		enrollmentEndpoint := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+
+		enrollmentsResponse, err := enrollmentEndpoint.Delete(context.Background(), enrollment.DeleteRequest{ID: "1"})
+		assert.NoError(t, err, "expected no error but got %v", err)
+		assert.Equal(t, http.StatusOK, enrollmentsResponse.(response.Response).StatusCode(), "expected status code to be %d", http.StatusOK)
+
+		enrollmentsResponse, err = enrollmentEndpoint.Restore(context.Background(), enrollment.RestoreRequest{ID: "1"})
+		assert.NoError(t, err, "expected no error but got %v", err)
+		assert.Equal(t, http.StatusOK, enrollmentsResponse.(response.Response).StatusCode(), "expected status code to be %d", http.StatusOK)
+
+		assert.Equal(t, 2, counter, "expected counter to be %d but got %d", 2, counter)
+	})
 }
@@ -3,15 +3,36 @@ package enrollment
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
 )
 
 var ErrUserIDRequired = errors.New("user_id is required")
 var ErrCourseIDRequired = errors.New("course_id is required")
 
+var ErrIDRequired = errors.New("id is required")
+
+var ErrCapacityRequired = errors.New("capacity is required")
+var ErrInvalidCapacity = errors.New("capacity cant be negative")
+
+var ErrBulkEmpty = errors.New("items are required")
+var ErrBulkAborted = errors.New("enrollment not created because another item of the transaction failed")
+
 var ErrStatusRequired = errors.New("status is required")
 
 var ErrStatusTooLong = errors.New("status cant have more than 2 char")
 
+// ErrForbidden es cuando la politica de roles no deja hacer la accion (403)
+type ErrForbidden struct {
+	Action string
+}
+
+func (e ErrForbidden) Error() string {
+	return fmt.Sprintf("not allowed to %s", e.Action)
+}
+
 type ErrEnrollNotFound struct {
 	EnrollmentID string
 }
@@ -27,3 +48,136 @@ type ErrInvalidStatus struct {
 func (e ErrInvalidStatus) Error() string {
 	return fmt.Sprintf("invalid: %s status", e.Status)
 }
+
+type ErrInvalidExpand struct {
+	Expand string
+}
+
+func (e ErrInvalidExpand) Error() string {
+	return fmt.Sprintf("invalid expand: %s, allowed values are user and course", e.Expand)
+}
+
+type ErrInvalidTransition struct {
+	From domain.EnrollStatus
+	To   domain.EnrollStatus
+}
+
+func (e ErrInvalidTransition) Error() string {
+	return fmt.Sprintf("invalid status transition from %s to %s", e.From, e.To)
+}
+
+type ErrStatusConflict struct {
+	EnrollmentID string
+	Status       domain.EnrollStatus
+}
+
+func (e ErrStatusConflict) Error() string {
+	return fmt.Sprintf("enrollment with id: %s is no longer in status %s", e.EnrollmentID, e.Status)
+}
+
+type ErrAlreadyEnrolled struct {
+	UserID   string
+	CourseID string
+}
+
+func (e ErrAlreadyEnrolled) Error() string {
+	return fmt.Sprintf("user with id: %s is already enrolled in course with id: %s", e.UserID, e.CourseID)
+}
+
+type ErrBulkTooLarge struct {
+	Max int
+}
+
+func (e ErrBulkTooLarge) Error() string {
+	return fmt.Sprintf("bulk cant have more than %d items", e.Max)
+}
+
+type ErrInvalidBulkMode struct {
+	Mode string
+}
+
+func (e ErrInvalidBulkMode) Error() string {
+	return fmt.Sprintf("invalid bulk mode: %s, allowed values are %s and %s", e.Mode, BulkModeTransaction, BulkModePerItem)
+}
+
+type ErrCapacityNotFound struct {
+	CourseID string
+}
+
+func (e ErrCapacityNotFound) Error() string {
+	return fmt.Sprintf("course with id: %s has no capacity limit", e.CourseID)
+}
+
+type ErrUpstreamUnavailable struct {
+	Service string
+	Err     error
+}
+
+func (e ErrUpstreamUnavailable) Error() string {
+	return fmt.Sprintf("%s service unavailable: %v", e.Service, e.Err)
+}
+
+func (e ErrUpstreamUnavailable) Unwrap() error {
+	return e.Err
+}
+
+type ErrCircuitOpen struct {
+	Service    string
+	RetryAfter time.Duration
+}
+
+func (e ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("%s service circuit is open, retry after %s", e.Service, e.RetryAfter.Round(time.Second))
+}
+
+// ErrLookupFailed junta los errores del user y del course cuando fallan los dos
+// Implementa Unwrap() []error asi errors.As/errors.Is siguen encontrando cada error
+type ErrLookupFailed struct {
+	Errs []error
+}
+
+func (e ErrLookupFailed) Error() string {
+	mensajes := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		mensajes = append(mensajes, err.Error())
+	}
+	return strings.Join(mensajes, "; ")
+}
+
+func (e ErrLookupFailed) Unwrap() []error {
+	return e.Errs
+}
+
+type ErrInvalidCursor struct {
+	Cursor string
+}
+
+func (e ErrInvalidCursor) Error() string {
+	return fmt.Sprintf("invalid cursor '%s'", e.Cursor)
+}
+
+type ErrInvalidDate struct {
+	Param string
+	Value string
+}
+
+func (e ErrInvalidDate) Error() string {
+	return fmt.Sprintf("invalid %s '%s', use RFC3339 (2006-01-02T15:04:05Z) or a date (2006-01-02)", e.Param, e.Value)
+}
+
+type ErrInvalidSort struct {
+	Field string
+}
+
+func (e ErrInvalidSort) Error() string {
+	return fmt.Sprintf("invalid sort field '%s'", e.Field)
+}
+
+type ErrPreconditionFailed struct {
+	EnrollmentID string
+	Version      int
+}
+
+func (e ErrPreconditionFailed) Error() string {
+	return fmt.Sprintf("enrollment with id: %s has been modified, current version is %d", e.EnrollmentID, e.Version)
+}
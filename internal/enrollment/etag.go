@@ -0,0 +1,51 @@
+package enrollment
+
+import (
+	"strconv"
+	"strings"
+)
+
+// IfMatch es la precondicion del header If-Match del PATCH (el valor cero es que no vino el header)
+type IfMatch struct {
+	Present  bool  //Vino el header
+	Any      bool  //If-Match: * (cualquier version, solo pide que exista)
+	Versions []int //Versiones de los ETag que mandaron
+}
+
+// ETag arma el ETag (fuerte) de una version del enrollment, ej: "3"
+func ETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// ParseIfMatch lee el header If-Match ("3", "2", "3" o *)
+// If-Match compara en forma fuerte, asi que los ETag debiles (W/"3") o que no son nuestros nunca coinciden
+func ParseIfMatch(header string) IfMatch {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return IfMatch{}
+	}
+	ifMatch := IfMatch{Present: true}
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag == "*" {
+			ifMatch.Any = true
+			continue
+		}
+		valor, err := strconv.Unquote(etag)
+		if err != nil || !strings.HasPrefix(etag, `"`) {
+			continue
+		}
+		if version, err := strconv.Atoi(valor); err == nil {
+			ifMatch.Versions = append(ifMatch.Versions, version)
+		}
+	}
+	return ifMatch
+}
+
+// Matches dice si la version actual cumple la precondicion
+func (m IfMatch) Matches(version int) bool {
+	if !m.Present || m.Any {
+		return true
+	}
+	return contiene(m.Versions, version)
+}
@@ -0,0 +1,95 @@
+package enrollment
+
+import (
+	"strings"
+	"time"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+)
+
+// armarFiltros pasa los parametros del GET /enrollments (que vienen como texto) al struct Filtros
+// Valida los status y las fechas, si algo viene mal devuelve el error para responder 400
+func armarFiltros(req GetAllRequest) (Filtros, error) {
+	filtros := Filtros{IncludeDeleted: req.IncludeDeleted}
+
+	//user_id y course_id aceptan una lista separada por coma, ej: user_id=a,b,c
+	if ids := dividirLista(req.UserID); len(ids) > 1 {
+		filtros.UserIDs = ids
+	} else {
+		filtros.UserID = req.UserID
+	}
+	if ids := dividirLista(req.CourseID); len(ids) > 1 {
+		filtros.CourseIDs = ids
+	} else {
+		filtros.CourseID = req.CourseID
+	}
+
+	var err error
+	if filtros.Statuses, err = parseStatuses(req.Status); err != nil {
+		return Filtros{}, err
+	}
+	if filtros.ExcludeStatuses, err = parseStatuses(req.ExcludeStatus); err != nil {
+		return Filtros{}, err
+	}
+
+	if filtros.CreatedFrom, err = parseFecha("created_from", req.CreatedFrom, false); err != nil {
+		return Filtros{}, err
+	}
+	if filtros.CreatedTo, err = parseFecha("created_to", req.CreatedTo, true); err != nil {
+		return Filtros{}, err
+	}
+	if filtros.UpdatedFrom, err = parseFecha("updated_from", req.UpdatedFrom, false); err != nil {
+		return Filtros{}, err
+	}
+	if filtros.UpdatedTo, err = parseFecha("updated_to", req.UpdatedTo, true); err != nil {
+		return Filtros{}, err
+	}
+
+	if filtros.Sort, err = ParseSort(req.Sort); err != nil {
+		return Filtros{}, err
+	}
+
+	return filtros, nil
+}
+
+// dividirLista separa "a,b,c" en sus valores sacando espacios y vacios
+func dividirLista(valor string) []string {
+	var lista []string
+	for _, v := range strings.Split(valor, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			lista = append(lista, v)
+		}
+	}
+	return lista
+}
+
+func parseStatuses(valor string) ([]domain.EnrollStatus, error) {
+	var statuses []domain.EnrollStatus
+	for _, v := range dividirLista(valor) {
+		status := domain.EnrollStatus(v)
+		if !validStatus(status) {
+			return nil, ErrInvalidStatus{Status: v}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// parseFecha acepta RFC3339 (2024-05-10T15:04:05Z) o solo la fecha (2024-05-10)
+// Si es solo la fecha y es el limite "hasta", se toma hasta el final de ese dia
+func parseFecha(param, valor string, hasta bool) (*time.Time, error) {
+	if valor == "" {
+		return nil, nil
+	}
+	if fecha, err := time.Parse(time.RFC3339, valor); err == nil {
+		return &fecha, nil
+	}
+	fecha, err := time.ParseInLocation(time.DateOnly, valor, time.Local)
+	if err != nil {
+		return nil, ErrInvalidDate{Param: param, Value: valor}
+	}
+	if hasta {
+		fecha = fecha.Add(24*time.Hour - time.Millisecond)
+	}
+	return &fecha, nil
+}
@@ -0,0 +1,98 @@
+package enrollment_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+func TestEndpoint_GetAllFilters(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should pass the same filters to count and getall", func(t *testing.T) {
+		desde := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		hasta := time.Date(2024, 5, 31, 0, 0, 0, 0, time.Local).Add(24*time.Hour - time.Millisecond)
+		wantFiltros := enrollment.Filtros{
+			UserIDs:         []string{"a", "b", "c"},
+			CourseID:        "course1",
+			Statuses:        []domain.EnrollStatus{domain.Pending, domain.Active},
+			ExcludeStatuses: []domain.EnrollStatus{domain.Inactive},
+			CreatedFrom:     &desde,
+			UpdatedTo:       &hasta,
+		}
+
+		var filtrosCount, filtrosGetAll enrollment.Filtros
+		repo := &mockRepository{
+			CountMock: func(ctx context.Context, filtros enrollment.Filtros) (int, error) {
+				filtrosCount = filtros
+				return 0, nil
+			},
+			GetAllMock: func(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error) {
+				filtrosGetAll = filtros
+				return []domain.Enrollment{}, nil
+			},
+		}
+		svc := enrollment.NewService(l, nil, nil, repo)
+		endpoints := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+
+		_, err := endpoints.GetAll(context.Background(), enrollment.GetAllRequest{
+			UserID:        "a, b,c",
+			CourseID:      "course1",
+			Status:        "P,A",
+			ExcludeStatus: "I",
+			CreatedFrom:   "2024-05-01T10:00:00Z",
+			UpdatedTo:     "2024-05-31",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, wantFiltros, filtrosCount)
+		assert.Equal(t, wantFiltros, filtrosGetAll)
+	})
+
+	opciones := []struct {
+		tag       string
+		request   enrollment.GetAllRequest
+		wantError error
+	}{
+		{
+			tag:       "should return 400 on unknown status",
+			request:   enrollment.GetAllRequest{Status: "P,X"},
+			wantError: enrollment.ErrInvalidStatus{Status: "X"},
+		},
+		{
+			tag:       "should return 400 on unknown excluded status",
+			request:   enrollment.GetAllRequest{ExcludeStatus: "deleted"},
+			wantError: enrollment.ErrInvalidStatus{Status: "deleted"},
+		},
+		{
+			tag:       "should return 400 on malformed created_from",
+			request:   enrollment.GetAllRequest{CreatedFrom: "10/05/2024"},
+			wantError: enrollment.ErrInvalidDate{Param: "created_from", Value: "10/05/2024"},
+		},
+		{
+			tag:       "should return 400 on malformed updated_to",
+			request:   enrollment.GetAllRequest{UpdatedTo: "2024-13-01"},
+			wantError: enrollment.ErrInvalidDate{Param: "updated_to", Value: "2024-13-01"},
+		},
+	}
+
+	for _, opcion := range opciones {
+		t.Run(opcion.tag, func(t *testing.T) {
+			svc := enrollment.NewService(l, nil, nil, &mockRepository{})
+			endpoints := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+
+			resp, err := endpoints.GetAll(context.Background(), opcion.request)
+			assert.Nil(t, resp)
+			assert.EqualError(t, err, opcion.wantError.Error())
+			assert.Equal(t, http.StatusBadRequest, err.(response.Response).StatusCode())
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package enrollment
+
+import (
+	"context"
+	"time"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"gorm.io/gorm"
+)
+
+// Actores que no vienen de un request: system es cuando el cambio lo hace el propio servicio (ej: promover de la lista de espera)
+const (
+	ActorAnonymous = "anonymous"
+	ActorSystem    = "system"
+)
+
+// StatusHistory es cada cambio de status de un enrollment (OldStatus vacio es la creacion)
+type StatusHistory struct {
+	ID           uint                `json:"-" gorm:"primaryKey"`
+	EnrollmentID string              `json:"enrollment_id" gorm:"type:char(36);not null;index"`
+	OldStatus    domain.EnrollStatus `json:"old_status" gorm:"type:char(2)"`
+	NewStatus    domain.EnrollStatus `json:"new_status" gorm:"type:char(2);not null"`
+	Actor        string              `json:"actor" gorm:"type:varchar(100);not null"`
+	CreatedAt    time.Time           `json:"created_at"`
+}
+
+func (StatusHistory) TableName() string {
+	return "enrollment_status_history"
+}
+
+// actorKey es la key del contexto donde va quien hace el request (tipo propio para que no choque con otras keys)
+type actorKey struct{}
+
+// WithActor guarda en el contexto quien hace el cambio, para dejarlo en el historial
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext devuelve el actor del contexto o ActorAnonymous si no viene
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return ActorAnonymous
+}
+
+// *** SERVICE ***
+
+func (s service) History(ctx context.Context, id string) ([]StatusHistory, error) {
+	s.log.Println("History enrollment service")
+
+	//Validamos que exista para devolver 404 en vez de una lista vacia
+	if _, err := s.repo.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.History(ctx, id)
+}
+
+// *** REPOSITORY ***
+
+func (r *repo) History(ctx context.Context, id string) ([]StatusHistory, error) {
+	r.log.Println("repository History:", id)
+
+	var historial []StatusHistory
+	result := r.db.WithContext(ctx).Where("enrollment_id = ?", id).Order("created_at asc, id asc").Find(&historial)
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		return nil, result.Error
+	}
+	return historial, nil
+}
+
+// registrarHistorial inserta el cambio de status, se llama dentro de la misma transaccion que el cambio
+func registrarHistorial(tx *gorm.DB, enrollmentID string, oldStatus, newStatus domain.EnrollStatus, actor string) error {
+	return tx.Create(&StatusHistory{
+		EnrollmentID: enrollmentID,
+		OldStatus:    oldStatus,
+		NewStatus:    newStatus,
+		Actor:        actor,
+	}).Error
+}
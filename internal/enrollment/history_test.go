@@ -0,0 +1,78 @@
+package enrollment_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+func TestActorFromContext(t *testing.T) {
+
+	t.Run("should return anonymous if there is no actor", func(t *testing.T) {
+		actor := enrollment.ActorFromContext(context.Background())
+		assert.Equal(t, enrollment.ActorAnonymous, actor, "expected actor to be '%s' but got '%s'", enrollment.ActorAnonymous, actor)
+	})
+
+	t.Run("should return the actor of the context", func(t *testing.T) {
+		ctx := enrollment.WithActor(context.Background(), "admin1")
+		actor := enrollment.ActorFromContext(ctx)
+		assert.Equal(t, "admin1", actor, "expected actor to be '%s' but got '%s'", "admin1", actor)
+	})
+}
+
+func TestService_History(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should return not found error", func(t *testing.T) {
+		var wantError error = enrollment.ErrEnrollNotFound{"1"}
+
+		repo := &mockRepository{
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return nil, enrollment.ErrEnrollNotFound{id}
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repo)
+		historial, err := svc.History(context.Background(), "1")
+
+		assert.ErrorIs(t, err, wantError, "expected error to be %v but got %v", wantError, err)
+		assert.Nil(t, historial, "expected history to be nil")
+	})
+
+	t.Run("should return history", func(t *testing.T) {
+		wantHistorial := []enrollment.StatusHistory{
+			{EnrollmentID: "1", OldStatus: "", NewStatus: domain.Pending, Actor: "user1"},
+			{EnrollmentID: "1", OldStatus: domain.Pending, NewStatus: domain.Active, Actor: "admin1"},
+		}
+
+		repo := &mockRepository{
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return &domain.Enrollment{ID: id}, nil
+			},
+			HistoryMock: func(ctx context.Context, id string) ([]enrollment.StatusHistory, error) {
+				return []enrollment.StatusHistory{
+					{EnrollmentID: "1", OldStatus: "", NewStatus: domain.Pending, Actor: "user1"},
+					{EnrollmentID: "1", OldStatus: domain.Pending, NewStatus: domain.Active, Actor: "admin1"},
+				}, nil
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repo)
+		enrollmentEndpoint := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+		enrollmentsResponse, err := enrollmentEndpoint.History(context.Background(), enrollment.HistoryRequest{ID: "1"})
+
+		assert.NoError(t, err, "expected no error but got %v", err)
+		resp := enrollmentsResponse.(response.Response)
+		historial := resp.GetData().([]enrollment.StatusHistory)
+		assert.Equal(t, http.StatusOK, resp.StatusCode(), "expected status code to be %d but got %d", http.StatusOK, resp.StatusCode())
+		assert.Equal(t, wantHistorial, historial, "expected history to be %v but got %v", wantHistorial, historial)
+	})
+}
@@ -0,0 +1,463 @@
+package enrollment
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/google/uuid"
+)
+
+// memoryRepo es un Repository en memoria para desarrollo local y tests (DB_DRIVER=memory)
+// Imita al repo de gorm: mismos filtros, orden, paginacion, errores, cupos e historial
+// Todas las escrituras toman el mutex completo, asi cada metodo es atomico como una transaccion
+type memoryRepo struct {
+	log *log.Logger
+
+	mu         sync.RWMutex
+	enrolls    map[string]*memoryEnrollment
+	capacities map[string]CourseCapacity
+	history    []StatusHistory
+	outbox     []OutboxMessage
+}
+
+type memoryEnrollment struct {
+	enroll    domain.Enrollment
+	deletedAt *time.Time
+	version   int
+}
+
+func NewMemoryRepo(log *log.Logger) Repository {
+	return &memoryRepo{
+		log:        log,
+		enrolls:    make(map[string]*memoryEnrollment),
+		capacities: make(map[string]CourseCapacity),
+	}
+}
+
+func (r *memoryRepo) Create(ctx context.Context, enrollment *domain.Enrollment) error {
+	r.log.Println("memory repository Create:", enrollment)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.crear(enrollment, ActorFromContext(ctx)); err != nil {
+		r.log.Println(err)
+		return err
+	}
+	r.log.Printf("enrollment created with id: %s, status: %s\n", enrollment.ID, enrollment.Status)
+	return nil
+}
+
+// CreateBulk inserta todos o ninguno, si uno falla se deshace lo que ya se habia insertado
+func (r *memoryRepo) CreateBulk(ctx context.Context, enrollments []*domain.Enrollment) error {
+	r.log.Println("memory repository CreateBulk:", len(enrollments))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	largoHistorial, largoOutbox := len(r.history), len(r.outbox)
+	var insertados []string
+	for _, enrollment := range enrollments {
+		if err := r.crear(enrollment, ActorFromContext(ctx)); err != nil {
+			for _, id := range insertados {
+				delete(r.enrolls, id)
+			}
+			r.history = r.history[:largoHistorial]
+			r.outbox = r.outbox[:largoOutbox]
+			r.log.Println(err)
+			return err
+		}
+		insertados = append(insertados, enrollment.ID)
+	}
+	r.log.Printf("enrollments created in bulk: %d\n", len(enrollments))
+	return nil
+}
+
+func (r *memoryRepo) Get(ctx context.Context, id string) (*domain.Enrollment, error) {
+	enroll, _, err := r.GetVersioned(ctx, id)
+	return enroll, err
+}
+
+func (r *memoryRepo) GetVersioned(ctx context.Context, id string) (*domain.Enrollment, int, error) {
+	r.log.Println("memory repository Get by id:", id)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, ok := r.enrolls[id]
+	if !ok || m.deletedAt != nil {
+		return nil, 0, ErrEnrollNotFound{id}
+	}
+	enroll := m.enroll
+	return &enroll, m.version, nil
+}
+
+func (r *memoryRepo) GetAll(ctx context.Context, filtros Filtros, offset, limit int) ([]domain.Enrollment, error) {
+	r.log.Println("memory repository GetAll:")
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	orden := ordenCompleto(filtros.Sort)
+	allEnroll := []domain.Enrollment{}
+	for _, m := range r.enrolls {
+		if !cumpleFiltros(m, filtros) {
+			continue
+		}
+		//Con cursor solo va lo que queda despues del ultimo de la pagina anterior
+		if filtros.Cursor != nil && compararCursor(cursorDe(m.enroll, orden), *filtros.Cursor, orden) <= 0 {
+			continue
+		}
+		allEnroll = append(allEnroll, m.enroll)
+	}
+
+	sort.Slice(allEnroll, func(i, j int) bool {
+		return compararCursor(cursorDe(allEnroll[i], orden), cursorDe(allEnroll[j], orden), orden) < 0
+	})
+
+	if offset >= len(allEnroll) {
+		return []domain.Enrollment{}, nil
+	}
+	allEnroll = allEnroll[offset:]
+	if limit >= 0 && limit < len(allEnroll) {
+		allEnroll = allEnroll[:limit]
+	}
+	return allEnroll, nil
+}
+
+func (r *memoryRepo) Count(ctx context.Context, filtros Filtros) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cantidad := 0
+	for _, m := range r.enrolls {
+		if cumpleFiltros(m, filtros) {
+			cantidad++
+		}
+	}
+	return cantidad, nil
+}
+
+// Update hace el mismo compare-and-set que el repo de gorm (status y version si es mayor a 0)
+func (r *memoryRepo) Update(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
+	r.log.Println("memory repository Update")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.enrolls[id]
+	if !ok || m.deletedAt != nil {
+		return ErrEnrollNotFound{id}
+	}
+	if m.enroll.Status != currentStatus || (version > 0 && m.version != version) {
+		return ErrStatusConflict{EnrollmentID: id, Status: currentStatus}
+	}
+	if status == nil {
+		m.version++
+		return nil
+	}
+
+	nuevo := domain.EnrollStatus(*status)
+	r.cambiarStatus(m, nuevo, ActorFromContext(ctx))
+	if nuevo == domain.Inactive && ocupaCupo(currentStatus) {
+		r.promoverWaitlist(m.enroll.CourseID)
+	}
+	r.log.Printf("enrollment updated with id: %s\n", id)
+	return nil
+}
+
+func (r *memoryRepo) Reactivate(ctx context.Context, id string) (*domain.Enrollment, error) {
+	r.log.Println("memory repository Reactivate")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.enrolls[id]
+	if !ok || m.deletedAt != nil {
+		return nil, ErrEnrollNotFound{id}
+	}
+	if m.enroll.Status != domain.Inactive {
+		return nil, ErrStatusConflict{EnrollmentID: id, Status: domain.Inactive}
+	}
+
+	nuevo := domain.Pending
+	if r.cuposLibres(m.enroll.CourseID) == 0 {
+		nuevo = Waitlisted
+	}
+	//Igual que en el de gorm, es una inscripcion nueva y en la lista de espera queda al final
+	ahora := time.Now()
+	m.enroll.CreatedAt = &ahora
+	r.cambiarStatus(m, nuevo, ActorFromContext(ctx))
+	enroll := m.enroll
+	return &enroll, nil
+}
+
+func (r *memoryRepo) Delete(ctx context.Context, id string) error {
+	r.log.Println("memory repository Delete")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.enrolls[id]
+	if !ok || m.deletedAt != nil {
+		return ErrEnrollNotFound{id}
+	}
+	ahora := time.Now()
+	m.deletedAt = &ahora
+	m.version++
+	r.registrarEvento(EventEnrollmentDeleted, m.enroll, "", ActorFromContext(ctx))
+
+	if ocupaCupo(m.enroll.Status) {
+		r.promoverWaitlist(m.enroll.CourseID)
+	}
+	r.log.Printf("enrollment deleted with id: %s\n", id)
+	return nil
+}
+
+func (r *memoryRepo) Restore(ctx context.Context, id string) error {
+	r.log.Println("memory repository Restore")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.enrolls[id]
+	if !ok || m.deletedAt == nil {
+		return ErrEnrollNotFound{id}
+	}
+	//Despues de borrarlo el user se pudo volver a inscribir en el curso
+	if r.inscrito(m.enroll.UserID, m.enroll.CourseID) {
+		return ErrAlreadyEnrolled{UserID: m.enroll.UserID, CourseID: m.enroll.CourseID}
+	}
+	if ocupaCupo(m.enroll.Status) && r.cuposLibres(m.enroll.CourseID) == 0 {
+		r.cambiarStatus(m, Waitlisted, ActorFromContext(ctx))
+	} else {
+		m.version++
+	}
+	m.deletedAt = nil
+	r.log.Printf("enrollment restored with id: %s\n", id)
+	return nil
+}
+
+func (r *memoryRepo) GetCapacity(ctx context.Context, courseID string) (*CourseCapacity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cupo, ok := r.capacities[courseID]
+	if !ok {
+		return nil, ErrCapacityNotFound{CourseID: courseID}
+	}
+	return &cupo, nil
+}
+
+func (r *memoryRepo) SetCapacity(ctx context.Context, capacity *CourseCapacity) error {
+	r.log.Println("memory repository SetCapacity:", capacity.CourseID, capacity.Capacity)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ahora := time.Now()
+	if existente, ok := r.capacities[capacity.CourseID]; ok {
+		capacity.CreatedAt = existente.CreatedAt
+	} else {
+		capacity.CreatedAt = &ahora
+	}
+	capacity.UpdatedAt = &ahora
+	r.capacities[capacity.CourseID] = *capacity
+
+	r.promoverWaitlist(capacity.CourseID)
+	return nil
+}
+
+func (r *memoryRepo) WaitlistPosition(ctx context.Context, e *domain.Enrollment) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	antes := 0
+	for _, m := range r.enrolls {
+		if m.deletedAt != nil || m.enroll.CourseID != e.CourseID || m.enroll.Status != Waitlisted {
+			continue
+		}
+		if llegoAntes(m.enroll, *e) {
+			antes++
+		}
+	}
+	return antes + 1, nil
+}
+
+func (r *memoryRepo) History(ctx context.Context, id string) ([]StatusHistory, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	historial := []StatusHistory{}
+	for _, h := range r.history {
+		if h.EnrollmentID == id {
+			historial = append(historial, h)
+		}
+	}
+	return historial, nil
+}
+
+// crear es el crearConCupo del repo en memoria, se llama con el mutex tomado
+func (r *memoryRepo) crear(e *domain.Enrollment, actor string) error {
+	//Igual que el unique index (user_id, course_id) de las filas vivas, los borrados no cuentan
+	if r.inscrito(e.UserID, e.CourseID) {
+		return ErrAlreadyEnrolled{UserID: e.UserID, CourseID: e.CourseID}
+	}
+
+	if e.Status == domain.Pending && r.cuposLibres(e.CourseID) == 0 {
+		e.Status = Waitlisted
+	}
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	ahora := time.Now()
+	e.CreatedAt = &ahora
+	e.UpdatedAt = &ahora
+
+	r.enrolls[e.ID] = &memoryEnrollment{enroll: *e, version: 1}
+	r.registrarHistorial(e.ID, "", e.Status, actor)
+	r.registrarEvento(EventEnrollmentCreated, *e, "", actor)
+	return nil
+}
+
+// inscrito dice si el user ya tiene un enrollment vivo (no borrado) en el curso, se llama con el mutex tomado
+func (r *memoryRepo) inscrito(userID, courseID string) bool {
+	for _, m := range r.enrolls {
+		if m.deletedAt == nil && m.enroll.UserID == userID && m.enroll.CourseID == courseID {
+			return true
+		}
+	}
+	return false
+}
+
+// cambiarStatus cambia el status y cuenta como una escritura (sube la version)
+func (r *memoryRepo) cambiarStatus(m *memoryEnrollment, status domain.EnrollStatus, actor string) {
+	r.registrarHistorial(m.enroll.ID, m.enroll.Status, status, actor)
+	anterior := m.enroll.Status
+	ahora := time.Now()
+	m.enroll.Status = status
+	m.enroll.UpdatedAt = &ahora
+	m.version++
+	r.registrarEvento(EventEnrollmentStatusChanged, m.enroll, anterior, actor)
+}
+
+// cuposLibres devuelve cuantos cupos quedan en el curso (-1 si el curso no tiene limite)
+func (r *memoryRepo) cuposLibres(courseID string) int {
+	cupo, ok := r.capacities[courseID]
+	if !ok {
+		return -1
+	}
+	ocupados := 0
+	for _, m := range r.enrolls {
+		if m.deletedAt == nil && m.enroll.CourseID == courseID && ocupaCupo(m.enroll.Status) {
+			ocupados++
+		}
+	}
+	if libres := cupo.Capacity - ocupados; libres > 0 {
+		return libres
+	}
+	return 0
+}
+
+// promoverWaitlist pasa a Pending a los mas antiguos de la lista de espera mientras queden cupos libres
+func (r *memoryRepo) promoverWaitlist(courseID string) {
+	libres := r.cuposLibres(courseID)
+	if libres == 0 {
+		return
+	}
+
+	var enEspera []*memoryEnrollment
+	for _, m := range r.enrolls {
+		if m.deletedAt == nil && m.enroll.CourseID == courseID && m.enroll.Status == Waitlisted {
+			enEspera = append(enEspera, m)
+		}
+	}
+	sort.Slice(enEspera, func(i, j int) bool {
+		return llegoAntes(enEspera[i].enroll, enEspera[j].enroll)
+	})
+	if libres > 0 && libres < len(enEspera) {
+		enEspera = enEspera[:libres]
+	}
+	//La promocion la hace el sistema, no quien libero el cupo
+	for _, m := range enEspera {
+		r.cambiarStatus(m, domain.Pending, ActorSystem)
+	}
+}
+
+func (r *memoryRepo) registrarHistorial(enrollmentID string, oldStatus, newStatus domain.EnrollStatus, actor string) {
+	r.history = append(r.history, StatusHistory{
+		ID:           uint(len(r.history) + 1),
+		EnrollmentID: enrollmentID,
+		OldStatus:    oldStatus,
+		NewStatus:    newStatus,
+		Actor:        actor,
+		CreatedAt:    time.Now(),
+	})
+}
+
+// cumpleFiltros es el aplicarFiltros del repo en memoria
+func cumpleFiltros(m *memoryEnrollment, filtros Filtros) bool {
+	e := m.enroll
+	switch {
+	case filtros.CourseID != "" && e.CourseID != filtros.CourseID,
+		filtros.UserID != "" && e.UserID != filtros.UserID,
+		len(filtros.CourseIDs) > 0 && !contiene(filtros.CourseIDs, e.CourseID),
+		len(filtros.UserIDs) > 0 && !contiene(filtros.UserIDs, e.UserID),
+		len(filtros.Statuses) > 0 && !contiene(filtros.Statuses, e.Status),
+		len(filtros.ExcludeStatuses) > 0 && contiene(filtros.ExcludeStatuses, e.Status),
+		filtros.CreatedFrom != nil && (e.CreatedAt == nil || e.CreatedAt.Before(*filtros.CreatedFrom)),
+		filtros.CreatedTo != nil && (e.CreatedAt == nil || e.CreatedAt.After(*filtros.CreatedTo)),
+		filtros.UpdatedFrom != nil && (e.UpdatedAt == nil || e.UpdatedAt.Before(*filtros.UpdatedFrom)),
+		filtros.UpdatedTo != nil && (e.UpdatedAt == nil || e.UpdatedAt.After(*filtros.UpdatedTo)),
+		!filtros.IncludeDeleted && m.deletedAt != nil:
+		return false
+	}
+	return true
+}
+
+func contiene[T comparable](lista []T, valor T) bool {
+	for _, v := range lista {
+		if v == valor {
+			return true
+		}
+	}
+	return false
+}
+
+// llegoAntes ordena por orden de llegada (created_at, id), igual que la lista de espera del repo de gorm
+func llegoAntes(a, b domain.Enrollment) bool {
+	if !a.CreatedAt.Equal(*b.CreatedAt) {
+		return a.CreatedAt.Before(*b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+// compararCursor compara dos posiciones segun el orden: negativo si a va antes que b, positivo si va despues
+func compararCursor(a, b Cursor, orden []SortField) int {
+	for _, campo := range orden {
+		va, _ := a.valor(campo.Column)
+		vb, _ := b.valor(campo.Column)
+
+		var cmp int
+		switch x := va.(type) {
+		case time.Time:
+			y, _ := vb.(time.Time)
+			cmp = x.Compare(y)
+		case string:
+			y, _ := vb.(string)
+			cmp = strings.Compare(x, y)
+		}
+		if campo.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
@@ -17,10 +17,22 @@ type mockRepository struct {
 	//Aca tendremos campos que representen los datos que queramos mockear, por ejemplo el getAll en una parte usa s.repo.GetAll le pasamos valores que queremos que devuelva y asi mockear
 	//Para eso generaremos para cada ese metodo un campo de nuestra struct que sera funciones que devuelvan los mismo valores que cada metodo
 	//Entonces
-	CreateMock func(ctx context.Context, e *domain.Enrollment) error
-	GetAllMock func(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error)
-	CountMock  func(ctx context.Context, filtros enrollment.Filtros) (int, error)
-	UpdateMock func(ctx context.Context, id string, status *string) error
+	CreateMock     func(ctx context.Context, e *domain.Enrollment) error
+	CreateBulkMock func(ctx context.Context, enrollments []*domain.Enrollment) error
+	GetMock        func(ctx context.Context, id string) (*domain.Enrollment, error)
+	//Si no se setea GetVersionedMock se usa GetMock con version 1
+	GetVersionedMock func(ctx context.Context, id string) (*domain.Enrollment, int, error)
+	GetAllMock       func(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error)
+	CountMock        func(ctx context.Context, filtros enrollment.Filtros) (int, error)
+	UpdateMock       func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error
+	DeleteMock       func(ctx context.Context, id string) error
+	RestoreMock      func(ctx context.Context, id string) error
+	ReactivateMock   func(ctx context.Context, id string) (*domain.Enrollment, error)
+
+	GetCapacityMock      func(ctx context.Context, courseID string) (*enrollment.CourseCapacity, error)
+	SetCapacityMock      func(ctx context.Context, capacity *enrollment.CourseCapacity) error
+	WaitlistPositionMock func(ctx context.Context, e *domain.Enrollment) (int, error)
+	HistoryMock          func(ctx context.Context, id string) ([]enrollment.StatusHistory, error)
 	//Y ahora en cada funcion de abajo retornamos la funcion que corresponde a ese metodo
 }
 
@@ -34,6 +46,22 @@ func (m *mockRepository) Create(ctx context.Context, e *domain.Enrollment) error
 	return m.CreateMock(ctx, e)
 }
 
+func (m *mockRepository) CreateBulk(ctx context.Context, enrollments []*domain.Enrollment) error {
+	return m.CreateBulkMock(ctx, enrollments)
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (*domain.Enrollment, error) {
+	return m.GetMock(ctx, id)
+}
+
+func (m *mockRepository) GetVersioned(ctx context.Context, id string) (*domain.Enrollment, int, error) {
+	if m.GetVersionedMock == nil {
+		enroll, err := m.GetMock(ctx, id)
+		return enroll, 1, err
+	}
+	return m.GetVersionedMock(ctx, id)
+}
+
 func (m *mockRepository) GetAll(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error) {
 	return m.GetAllMock(ctx, filtros, offset, limit)
 }
@@ -42,8 +70,36 @@ func (m *mockRepository) Count(ctx context.Context, filtros enrollment.Filtros)
 	return m.CountMock(ctx, filtros)
 }
 
-func (m *mockRepository) Update(ctx context.Context, id string, status *string) error {
-	return m.UpdateMock(ctx, id, status)
+func (m *mockRepository) Update(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
+	return m.UpdateMock(ctx, id, currentStatus, version, status)
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	return m.DeleteMock(ctx, id)
+}
+
+func (m *mockRepository) Restore(ctx context.Context, id string) error {
+	return m.RestoreMock(ctx, id)
+}
+
+func (m *mockRepository) Reactivate(ctx context.Context, id string) (*domain.Enrollment, error) {
+	return m.ReactivateMock(ctx, id)
+}
+
+func (m *mockRepository) GetCapacity(ctx context.Context, courseID string) (*enrollment.CourseCapacity, error) {
+	return m.GetCapacityMock(ctx, courseID)
+}
+
+func (m *mockRepository) SetCapacity(ctx context.Context, capacity *enrollment.CourseCapacity) error {
+	return m.SetCapacityMock(ctx, capacity)
+}
+
+func (m *mockRepository) WaitlistPosition(ctx context.Context, e *domain.Enrollment) (int, error) {
+	return m.WaitlistPositionMock(ctx, e)
+}
+
+func (m *mockRepository) History(ctx context.Context, id string) ([]enrollment.StatusHistory, error) {
+	return m.HistoryMock(ctx, id)
 }
 
 //MOcks de sdk -> Lo implementamos en el SDK pero lo dejamos aqui para que sea mas facil de entender
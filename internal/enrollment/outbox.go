@@ -0,0 +1,217 @@
+package enrollment
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Tipos de eventos de dominio que se publican a otros servicios (billing, notificaciones, analytics)
+const (
+	EventEnrollmentCreated       = "EnrollmentCreated"
+	EventEnrollmentStatusChanged = "EnrollmentStatusChanged"
+	EventEnrollmentDeleted       = "EnrollmentDeleted"
+)
+
+// Event es un evento de dominio del enrollment. ID es unico por evento, asi los consumidores pueden descartar duplicados
+// (la entrega es at-least-once, el mismo evento puede llegar mas de una vez)
+type Event struct {
+	ID           string              `json:"id"`
+	Type         string              `json:"type"`
+	EnrollmentID string              `json:"enrollment_id"`
+	UserID       string              `json:"user_id"`
+	CourseID     string              `json:"course_id"`
+	OldStatus    domain.EnrollStatus `json:"old_status,omitempty"` //Solo en EnrollmentStatusChanged
+	Status       domain.EnrollStatus `json:"status"`
+	Actor        string              `json:"actor"`
+	OccurredAt   time.Time           `json:"occurred_at"`
+}
+
+// OutboxMessage es la fila de la tabla outbox: el evento se guarda en la misma transaccion que el cambio
+// y despues el Relay lo publica (PublishedAt nil es que falta publicarlo)
+// FailedAt es que el Relay lo dejo de reintentar (muerto), queda en la tabla con LastError para revisarlo a mano
+type OutboxMessage struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	EventID      string     `json:"event_id"`
+	EventType    string     `json:"event_type"`
+	EnrollmentID string     `json:"enrollment_id"`
+	Payload      string     `json:"payload"`
+	CreatedAt    time.Time  `json:"created_at"`
+	PublishedAt  *time.Time `json:"published_at"`
+	Attempts     int        `json:"attempts"`
+	LastError    string     `json:"last_error"`
+	FailedAt     *time.Time `json:"failed_at"`
+}
+
+func (OutboxMessage) TableName() string {
+	return "outbox"
+}
+
+// OutboxStore es de donde el Relay lee los eventos pendientes (lo implementan el repo de gorm y el de memoria)
+type OutboxStore interface {
+	PendingEvents(ctx context.Context, limit int) ([]OutboxMessage, error)
+	MarkEventPublished(ctx context.Context, id uint) error
+	MarkEventFailed(ctx context.Context, id uint, cause error) error
+	MarkEventDead(ctx context.Context, id uint, cause error) error
+	CountDeadEvents(ctx context.Context) (int64, error)
+}
+
+// nuevoEvento arma el evento con los datos del enrollment (oldStatus vacio si no es un cambio de status)
+func nuevoEvento(tipo string, e domain.Enrollment, oldStatus domain.EnrollStatus, actor string) Event {
+	return Event{
+		ID:           uuid.New().String(),
+		Type:         tipo,
+		EnrollmentID: e.ID,
+		UserID:       e.UserID,
+		CourseID:     e.CourseID,
+		OldStatus:    oldStatus,
+		Status:       e.Status,
+		Actor:        actor,
+		OccurredAt:   time.Now().UTC(),
+	}
+}
+
+// mensajeOutbox pasa el evento a la fila de la outbox (el evento completo va como json en Payload)
+func mensajeOutbox(evento Event) (OutboxMessage, error) {
+	payload, err := json.Marshal(evento)
+	if err != nil {
+		return OutboxMessage{}, err
+	}
+	return OutboxMessage{
+		EventID:      evento.ID,
+		EventType:    evento.Type,
+		EnrollmentID: evento.EnrollmentID,
+		Payload:      string(payload),
+		CreatedAt:    evento.OccurredAt,
+	}, nil
+}
+
+// *** REPOSITORY ***
+
+// registrarEvento inserta el evento en la outbox, se llama dentro de la misma transaccion que el cambio
+// Asi o se guardan los dos (el cambio y el evento) o ninguno
+func registrarEvento(tx *gorm.DB, tipo string, e domain.Enrollment, oldStatus domain.EnrollStatus, actor string) error {
+	mensaje, err := mensajeOutbox(nuevoEvento(tipo, e, oldStatus, actor))
+	if err != nil {
+		return err
+	}
+	return tx.Create(&mensaje).Error
+}
+
+func (r *repo) PendingEvents(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	var mensajes []OutboxMessage
+	result := r.db.WithContext(ctx).Where("published_at IS NULL AND failed_at IS NULL").Order("id asc").Limit(limit).Find(&mensajes)
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		return nil, result.Error
+	}
+	return mensajes, nil
+}
+
+func (r *repo) MarkEventPublished(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&OutboxMessage{}).Where("id = ?", id).Update("published_at", time.Now().UTC()).Error
+}
+
+func (r *repo) MarkEventFailed(ctx context.Context, id uint, cause error) error {
+	return r.db.WithContext(ctx).Model(&OutboxMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": cause.Error(),
+	}).Error
+}
+
+func (r *repo) MarkEventDead(ctx context.Context, id uint, cause error) error {
+	return r.db.WithContext(ctx).Model(&OutboxMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": cause.Error(),
+		"failed_at":  time.Now().UTC(),
+	}).Error
+}
+
+func (r *repo) CountDeadEvents(ctx context.Context) (int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).Model(&OutboxMessage{}).Where("failed_at IS NOT NULL").Count(&total).Error
+	return total, err
+}
+
+// *** MEMORY REPOSITORY ***
+
+// registrarEvento es el registrarEvento del repo en memoria, se llama con el mutex tomado
+func (r *memoryRepo) registrarEvento(tipo string, e domain.Enrollment, oldStatus domain.EnrollStatus, actor string) {
+	mensaje, err := mensajeOutbox(nuevoEvento(tipo, e, oldStatus, actor))
+	if err != nil {
+		r.log.Println(err)
+		return
+	}
+	mensaje.ID = uint(len(r.outbox) + 1)
+	r.outbox = append(r.outbox, mensaje)
+}
+
+func (r *memoryRepo) PendingEvents(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var mensajes []OutboxMessage
+	for _, mensaje := range r.outbox {
+		if mensaje.PublishedAt == nil && mensaje.FailedAt == nil {
+			mensajes = append(mensajes, mensaje)
+		}
+	}
+	sort.Slice(mensajes, func(i, j int) bool { return mensajes[i].ID < mensajes[j].ID })
+	if limit >= 0 && limit < len(mensajes) {
+		mensajes = mensajes[:limit]
+	}
+	return mensajes, nil
+}
+
+func (r *memoryRepo) MarkEventPublished(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id > 0 && int(id) <= len(r.outbox) {
+		ahora := time.Now().UTC()
+		r.outbox[id-1].PublishedAt = &ahora
+	}
+	return nil
+}
+
+func (r *memoryRepo) MarkEventFailed(ctx context.Context, id uint, cause error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id > 0 && int(id) <= len(r.outbox) {
+		r.outbox[id-1].Attempts++
+		r.outbox[id-1].LastError = cause.Error()
+	}
+	return nil
+}
+
+func (r *memoryRepo) MarkEventDead(ctx context.Context, id uint, cause error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id > 0 && int(id) <= len(r.outbox) {
+		ahora := time.Now().UTC()
+		r.outbox[id-1].Attempts++
+		r.outbox[id-1].LastError = cause.Error()
+		r.outbox[id-1].FailedAt = &ahora
+	}
+	return nil
+}
+
+func (r *memoryRepo) CountDeadEvents(ctx context.Context) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var total int64
+	for _, mensaje := range r.outbox {
+		if mensaje.FailedAt != nil {
+			total++
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,247 @@
+package enrollment
+
+import (
+	"context"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
+)
+
+// policyService decora el Service con las reglas de acceso segun los claims del token:
+//   - admin puede todo
+//   - instructor lista, ve y actualiza los enrollments de los cursos que dicta (claim courses)
+//   - student crea y ve solo sus enrollments (user_id igual al subject)
+//
+// Si el token tiene varios roles, en los listados manda el de mas permisos. Sin claims en el contexto se rechaza todo
+// Lo que no se redefine aca (GetCapacity, WaitlistPosition) pasa directo al Service
+type policyService struct {
+	Service
+}
+
+// NewPolicyService va entre los Endpoints y el Service, solo tiene sentido con el middleware de auth (que deja los claims)
+func NewPolicyService(next Service) Service {
+	return &policyService{Service: next}
+}
+
+// permisos es lo que la politica necesita de los claims
+type permisos struct {
+	subject    string
+	admin      bool
+	instructor bool
+	student    bool
+	cursos     []string
+}
+
+func permisosDe(ctx context.Context) (permisos, error) {
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return permisos{}, ErrForbidden{Action: "access enrollments without credentials"}
+	}
+	return permisos{
+		subject:    claims.Subject,
+		admin:      claims.HasRole(auth.RoleAdmin),
+		instructor: claims.HasRole(auth.RoleInstructor),
+		student:    claims.HasRole(auth.RoleStudent) && claims.Subject != "",
+		cursos:     claims.Courses,
+	}, nil
+}
+
+func (p permisos) puedeCrear(userID string) bool {
+	return p.admin || (p.student && userID == p.subject)
+}
+
+func (p permisos) puedeVer(e *domain.Enrollment) bool {
+	return p.admin || (p.student && e.UserID == p.subject) || (p.instructor && contiene(p.cursos, e.CourseID))
+}
+
+// scope acota los filtros del listado a lo que puede ver: el student solo lo suyo y el instructor sus cursos
+// Si pide explicitamente algo que no puede ver es 403 (en vez de devolver la lista vacia)
+func (p permisos) scope(filtros Filtros) (Filtros, error) {
+	if p.admin {
+		return filtros, nil
+	}
+	if filtros.IncludeDeleted {
+		return Filtros{}, ErrForbidden{Action: "list deleted enrollments"}
+	}
+
+	switch {
+	case p.instructor:
+		pedidos := append([]string{}, filtros.CourseIDs...)
+		if filtros.CourseID != "" {
+			pedidos = append(pedidos, filtros.CourseID)
+		}
+		if len(pedidos) == 0 {
+			if len(p.cursos) == 0 {
+				return Filtros{}, ErrForbidden{Action: "list enrollments without courses assigned"}
+			}
+			filtros.CourseIDs = p.cursos
+			return filtros, nil
+		}
+		for _, c := range pedidos {
+			if !contiene(p.cursos, c) {
+				return Filtros{}, ErrForbidden{Action: "list enrollments of course " + c}
+			}
+		}
+		return filtros, nil
+
+	case p.student:
+		pedidos := append([]string{}, filtros.UserIDs...)
+		if filtros.UserID != "" {
+			pedidos = append(pedidos, filtros.UserID)
+		}
+		for _, u := range pedidos {
+			if u != p.subject {
+				return Filtros{}, ErrForbidden{Action: "list enrollments of other users"}
+			}
+		}
+		filtros.UserID = p.subject
+		filtros.UserIDs = nil
+		return filtros, nil
+	}
+	return Filtros{}, ErrForbidden{Action: "list enrollments"}
+}
+
+func (s *policyService) Create(ctx context.Context, userID, courseID string) (*domain.Enrollment, error) {
+	p, err := permisosDe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !p.puedeCrear(userID) {
+		return nil, ErrForbidden{Action: "create enrollments for user " + userID}
+	}
+	return s.Service.Create(ctx, userID, courseID)
+}
+
+// BulkCreate se rechaza entero si algun item no se puede crear, asi no queda a medias
+func (s *policyService) BulkCreate(ctx context.Context, items []CreateRequest, mode string) ([]BulkResult, error) {
+	p, err := permisosDe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if !p.puedeCrear(item.UserID) {
+			return nil, ErrForbidden{Action: "create enrollments for user " + item.UserID}
+		}
+	}
+	return s.Service.BulkCreate(ctx, items, mode)
+}
+
+// Get primero trae el enrollment sin expand y revisa que lo pueda ver, asi no se llama al servicio de users o courses
+// por un enrollment ajeno. Si no lo puede ver es 404 (igual que si no existiera) para no confirmar que el id existe
+func (s *policyService) Get(ctx context.Context, id string, expand Expand) (*domain.Enrollment, int, error) {
+	p, err := permisosDe(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	enroll, version, err := s.Service.Get(ctx, id, Expand{})
+	if err != nil {
+		return nil, 0, err
+	}
+	if !p.puedeVer(enroll) {
+		return nil, 0, ErrEnrollNotFound{EnrollmentID: id}
+	}
+	if expand.User || expand.Course {
+		return s.Service.Get(ctx, id, expand)
+	}
+	return enroll, version, nil
+}
+
+func (s *policyService) GetAll(ctx context.Context, filtros Filtros, offset, limit int) ([]domain.Enrollment, error) {
+	p, err := permisosDe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if filtros, err = p.scope(filtros); err != nil {
+		return nil, err
+	}
+	return s.Service.GetAll(ctx, filtros, offset, limit)
+}
+
+// Count se acota igual que GetAll, si no el total del meta contaria enrollments que no puede ver
+func (s *policyService) Count(ctx context.Context, filtros Filtros) (int, error) {
+	p, err := permisosDe(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if filtros, err = p.scope(filtros); err != nil {
+		return 0, err
+	}
+	return s.Service.Count(ctx, filtros)
+}
+
+// Update lo puede hacer el admin o el instructor del curso del enrollment (el student no cambia status)
+func (s *policyService) Update(ctx context.Context, id string, status *string, ifMatch IfMatch) (int, error) {
+	p, err := permisosDe(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !p.admin {
+		if !p.instructor {
+			return 0, ErrForbidden{Action: "update enrollments"}
+		}
+		enroll, _, err := s.Service.Get(ctx, id, Expand{})
+		if err != nil {
+			return 0, err
+		}
+		if !contiene(p.cursos, enroll.CourseID) {
+			return 0, ErrEnrollNotFound{EnrollmentID: id}
+		}
+	}
+	return s.Service.Update(ctx, id, status, ifMatch)
+}
+
+// History usa el mismo chequeo que Get (404 si no lo puede ver)
+func (s *policyService) History(ctx context.Context, id string) ([]StatusHistory, error) {
+	if _, _, err := s.Get(ctx, id, Expand{}); err != nil {
+		return nil, err
+	}
+	return s.Service.History(ctx, id)
+}
+
+func (s *policyService) Delete(ctx context.Context, id string) error {
+	if err := soloAdmin(ctx, "delete enrollments"); err != nil {
+		return err
+	}
+	return s.Service.Delete(ctx, id)
+}
+
+func (s *policyService) Restore(ctx context.Context, id string) error {
+	if err := soloAdmin(ctx, "restore enrollments"); err != nil {
+		return err
+	}
+	return s.Service.Restore(ctx, id)
+}
+
+func (s *policyService) SetCapacity(ctx context.Context, courseID string, capacity int) (*CourseCapacity, error) {
+	if err := soloAdmin(ctx, "set the capacity of a course"); err != nil {
+		return nil, err
+	}
+	return s.Service.SetCapacity(ctx, courseID, capacity)
+}
+
+func soloAdmin(ctx context.Context, accion string) error {
+	p, err := permisosDe(ctx)
+	if err != nil {
+		return err
+	}
+	if !p.admin {
+		return ErrForbidden{Action: accion}
+	}
+	return nil
+}
+
+// ScopeStreamFilter aplica al stream SSE las mismas reglas que al listado (el stream no pasa por el Service)
+func ScopeStreamFilter(ctx context.Context, filtro StreamFilter) (StreamFilter, error) {
+	p, err := permisosDe(ctx)
+	if err != nil {
+		return StreamFilter{}, err
+	}
+	filtros, err := p.scope(Filtros{CourseIDs: filtro.CourseIDs, UserIDs: filtro.UserIDs})
+	if err != nil {
+		return StreamFilter{}, err
+	}
+	if filtros.UserID != "" {
+		filtros.UserIDs = []string{filtros.UserID}
+	}
+	return StreamFilter{CourseIDs: filtros.CourseIDs, UserIDs: filtros.UserIDs}, nil
+}
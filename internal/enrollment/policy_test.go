@@ -0,0 +1,177 @@
+package enrollment_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+// serviceStub es el Service que esta detras de la politica, guarda los filtros que le llegan al GetAll
+// Los metodos que no se redefinen aca no se usan en estos test (el Service embebido es nil)
+type serviceStub struct {
+	enrollment.Service
+	enrolls  map[string]*domain.Enrollment
+	filtros  enrollment.Filtros
+	llamadas int
+	expands  []enrollment.Expand
+}
+
+func (s *serviceStub) Create(ctx context.Context, userID, courseID string) (*domain.Enrollment, error) {
+	s.llamadas++
+	return &domain.Enrollment{ID: "nuevo", UserID: userID, CourseID: courseID}, nil
+}
+
+func (s *serviceStub) Get(ctx context.Context, id string, expand enrollment.Expand) (*domain.Enrollment, int, error) {
+	s.expands = append(s.expands, expand)
+	enroll, ok := s.enrolls[id]
+	if !ok {
+		return nil, 0, enrollment.ErrEnrollNotFound{EnrollmentID: id}
+	}
+	return enroll, 1, nil
+}
+
+func (s *serviceStub) GetAll(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error) {
+	s.llamadas++
+	s.filtros = filtros
+	return nil, nil
+}
+
+func (s *serviceStub) Update(ctx context.Context, id string, status *string, ifMatch enrollment.IfMatch) (int, error) {
+	s.llamadas++
+	return 2, nil
+}
+
+func conClaims(subject string, courses []string, roles ...string) context.Context {
+	return auth.WithClaims(context.Background(), &auth.Claims{Roles: roles, Courses: courses, RegisteredClaims: jwt.RegisteredClaims{Subject: subject}})
+}
+
+func TestPolicyService(t *testing.T) {
+	nuevoStub := func() *serviceStub {
+		return &serviceStub{enrolls: map[string]*domain.Enrollment{
+			"e1": {ID: "e1", UserID: "u1", CourseID: "c1"},
+			"e2": {ID: "e2", UserID: "u2", CourseID: "c2"},
+		}}
+	}
+	student := conClaims("u1", nil, auth.RoleStudent)
+	instructor := conClaims("i1", []string{"c1"}, auth.RoleInstructor)
+	admin := conClaims("a1", nil, auth.RoleAdmin)
+
+	t.Run("should deny everything without claims", func(t *testing.T) {
+		stub := nuevoStub()
+		s := enrollment.NewPolicyService(stub)
+		_, err := s.Create(context.Background(), "u1", "c1")
+		assert.ErrorAs(t, err, &enrollment.ErrForbidden{})
+		_, err = s.GetAll(context.Background(), enrollment.Filtros{}, 0, 10)
+		assert.ErrorAs(t, err, &enrollment.ErrForbidden{})
+		assert.Equal(t, 0, stub.llamadas, "should not call the service")
+	})
+
+	t.Run("should let students create and view only their enrollments", func(t *testing.T) {
+		stub := nuevoStub()
+		s := enrollment.NewPolicyService(stub)
+
+		_, err := s.Create(student, "u1", "c1")
+		assert.NoError(t, err)
+		_, err = s.Create(student, "u2", "c1")
+		assert.ErrorAs(t, err, &enrollment.ErrForbidden{})
+		_, err = s.BulkCreate(student, []enrollment.CreateRequest{{UserID: "u1", CourseID: "c1"}, {UserID: "u2", CourseID: "c1"}}, enrollment.BulkModePerItem)
+		assert.ErrorAs(t, err, &enrollment.ErrForbidden{})
+
+		_, _, err = s.Get(student, "e1", enrollment.Expand{})
+		assert.NoError(t, err)
+		_, _, err = s.Get(student, "e2", enrollment.Expand{})
+		assert.ErrorAs(t, err, &enrollment.ErrEnrollNotFound{}, "should hide the enrollments of other users")
+
+		_, err = s.Update(student, "e1", nil, enrollment.IfMatch{})
+		assert.ErrorAs(t, err, &enrollment.ErrForbidden{})
+		assert.Equal(t, 1, stub.llamadas, "should only call the service for the allowed create")
+	})
+
+	t.Run("should force the user filter for students", func(t *testing.T) {
+		stub := nuevoStub()
+		s := enrollment.NewPolicyService(stub)
+
+		_, err := s.GetAll(student, enrollment.Filtros{CourseID: "c1"}, 0, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, "u1", stub.filtros.UserID)
+		assert.Equal(t, "c1", stub.filtros.CourseID)
+
+		_, err = s.GetAll(student, enrollment.Filtros{UserIDs: []string{"u1", "u2"}}, 0, 10)
+		assert.ErrorAs(t, err, &enrollment.ErrForbidden{})
+		_, err = s.GetAll(student, enrollment.Filtros{IncludeDeleted: true}, 0, 10)
+		assert.ErrorAs(t, err, &enrollment.ErrForbidden{})
+	})
+
+	t.Run("should let instructors list and update the courses they teach", func(t *testing.T) {
+		stub := nuevoStub()
+		s := enrollment.NewPolicyService(stub)
+
+		_, err := s.GetAll(instructor, enrollment.Filtros{}, 0, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"c1"}, stub.filtros.CourseIDs)
+		_, err = s.GetAll(instructor, enrollment.Filtros{CourseID: "c2"}, 0, 10)
+		assert.ErrorAs(t, err, &enrollment.ErrForbidden{})
+
+		_, _, err = s.Get(instructor, "e1", enrollment.Expand{})
+		assert.NoError(t, err)
+		_, _, err = s.Get(instructor, "e2", enrollment.Expand{})
+		assert.ErrorAs(t, err, &enrollment.ErrEnrollNotFound{})
+
+		_, err = s.Update(instructor, "e1", nil, enrollment.IfMatch{})
+		assert.NoError(t, err)
+		_, err = s.Update(instructor, "e2", nil, enrollment.IfMatch{})
+		assert.ErrorAs(t, err, &enrollment.ErrEnrollNotFound{})
+		_, err = s.Update(instructor, "no-existe", nil, enrollment.IfMatch{})
+		assert.ErrorAs(t, err, &enrollment.ErrEnrollNotFound{})
+
+		_, err = s.Create(instructor, "i1", "c1")
+		assert.ErrorAs(t, err, &enrollment.ErrForbidden{})
+	})
+
+	t.Run("should check the access before expanding", func(t *testing.T) {
+		stub := nuevoStub()
+		s := enrollment.NewPolicyService(stub)
+		expand := enrollment.Expand{User: true, Course: true}
+
+		_, _, err := s.Get(student, "e2", expand)
+		assert.ErrorAs(t, err, &enrollment.ErrEnrollNotFound{})
+		assert.Equal(t, []enrollment.Expand{{}}, stub.expands, "should not expand an enrollment it cannot see")
+
+		stub.expands = nil
+		_, _, err = s.Get(student, "e1", expand)
+		assert.NoError(t, err)
+		assert.Equal(t, []enrollment.Expand{{}, expand}, stub.expands)
+	})
+
+	t.Run("should let admins do anything", func(t *testing.T) {
+		stub := nuevoStub()
+		s := enrollment.NewPolicyService(stub)
+
+		_, err := s.Create(admin, "u2", "c2")
+		assert.NoError(t, err)
+		_, _, err = s.Get(admin, "e2", enrollment.Expand{})
+		assert.NoError(t, err)
+		_, err = s.GetAll(admin, enrollment.Filtros{IncludeDeleted: true}, 0, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, enrollment.Filtros{IncludeDeleted: true}, stub.filtros, "should not touch the filters")
+		_, err = s.Update(admin, "e2", nil, enrollment.IfMatch{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("should scope the stream filter", func(t *testing.T) {
+		filtro, err := enrollment.ScopeStreamFilter(student, enrollment.NewStreamFilter("c1", ""))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"u1"}, filtro.UserIDs)
+		filtro, err = enrollment.ScopeStreamFilter(instructor, enrollment.StreamFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"c1"}, filtro.CourseIDs)
+		_, err = enrollment.ScopeStreamFilter(instructor, enrollment.NewStreamFilter("c2", ""))
+		assert.ErrorAs(t, err, &enrollment.ErrForbidden{})
+	})
+}
@@ -0,0 +1,136 @@
+package enrollment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Publisher publica los eventos de la outbox hacia afuera (broker, archivo, otro proceso, etc)
+// Si devuelve error el Relay lo reintenta, asi que Publish puede recibir el mismo evento mas de una vez
+type Publisher interface {
+	Publish(ctx context.Context, evento Event) error
+}
+
+// InProcessPublisher deja los eventos en memoria y avisa a los suscriptores del mismo proceso (sirve para tests)
+type InProcessPublisher struct {
+	mu           sync.Mutex
+	eventos      []Event
+	suscriptores map[int]func(Event)
+	siguiente    int
+}
+
+func NewInProcessPublisher() *InProcessPublisher {
+	return &InProcessPublisher{suscriptores: make(map[int]func(Event))}
+}
+
+func (p *InProcessPublisher) Publish(ctx context.Context, evento Event) error {
+	p.mu.Lock()
+	p.eventos = append(p.eventos, evento)
+	suscriptores := make([]func(Event), 0, len(p.suscriptores))
+	for _, fn := range p.suscriptores {
+		suscriptores = append(suscriptores, fn)
+	}
+	p.mu.Unlock()
+
+	//Los suscriptores se llaman fuera del mutex, asi pueden llamar a Events sin bloquearse
+	for _, fn := range suscriptores {
+		fn(evento)
+	}
+	return nil
+}
+
+// Events devuelve una copia de los eventos publicados hasta ahora, en orden
+func (p *InProcessPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.eventos...)
+}
+
+// Subscribe registra fn para cada evento que se publique desde ahora, devuelve la funcion para desuscribirse
+func (p *InProcessPublisher) Subscribe(fn func(Event)) func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := p.siguiente
+	p.siguiente++
+	p.suscriptores[id] = fn
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.suscriptores, id)
+	}
+}
+
+// NDJSONPublisher escribe cada evento como una linea de JSON (newline-delimited JSON) en w, ej: stdout o un archivo
+type NDJSONPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewNDJSONPublisher(w io.Writer) *NDJSONPublisher {
+	return &NDJSONPublisher{w: w}
+}
+
+func (p *NDJSONPublisher) Publish(ctx context.Context, evento Event) error {
+	linea, err := json.Marshal(evento)
+	if err != nil {
+		return err
+	}
+	linea = append(linea, '\n')
+
+	//Un solo Write por evento (con el mutex) para que las lineas no se mezclen
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.w.Write(linea)
+	return err
+}
+
+// MultiPublisher publica cada evento en todos los publishers (ej: el archivo NDJSON y los webhooks)
+// Si uno falla igual se llama a los demas, y se recuerda por Event.ID cuales ya lo publicaron:
+// cuando el Relay reintenta el evento solo se vuelve a llamar a los que fallaron.
+// Lo entregado se guarda en memoria, si el proceso se reinicia entre reintentos el evento se repite en todos (at-least-once)
+type MultiPublisher struct {
+	pubs []Publisher
+
+	mu         sync.Mutex
+	entregados map[string]map[int]bool //Event.ID -> indice de los publishers que ya lo publicaron
+}
+
+func NewMultiPublisher(pubs ...Publisher) *MultiPublisher {
+	return &MultiPublisher{pubs: pubs, entregados: make(map[string]map[int]bool)}
+}
+
+func (m *MultiPublisher) Publish(ctx context.Context, evento Event) error {
+	//Copia para no tocar el map guardado fuera del mutex
+	m.mu.Lock()
+	entregados := make(map[int]bool, len(m.pubs))
+	for i := range m.entregados[evento.ID] {
+		entregados[i] = true
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for i, pub := range m.pubs {
+		if entregados[i] {
+			continue
+		}
+		if err := pub.Publish(ctx, evento); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		entregados[i] = true
+	}
+
+	//Si todos lo publicaron ya no hace falta recordarlo, el Relay lo marca publicado y no lo vuelve a pedir
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(errs) == 0 {
+		delete(m.entregados, evento.ID)
+		return nil
+	}
+	m.entregados[evento.ID] = entregados
+	return errors.Join(errs...)
+}
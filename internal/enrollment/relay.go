@@ -0,0 +1,127 @@
+package enrollment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// RelayConfig define cada cuanto el Relay revisa la outbox y cuantos eventos publica por vuelta
+// MaxAttempts es cuantas veces se intenta publicar un evento antes de darlo por muerto y seguir con los siguientes
+type RelayConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int
+}
+
+var DefaultRelayConfig = RelayConfig{
+	PollInterval: time.Second,
+	BatchSize:    100,
+	MaxAttempts:  20,
+}
+
+// Relay lee los eventos pendientes de la outbox y los publica con el Publisher
+// La entrega es at-least-once: si se cae entre el Publish y el MarkEventPublished el evento se vuelve a publicar,
+// y lo mismo si hay mas de una replica corriendo el relay. Los consumidores deben descartar duplicados por Event.ID
+type Relay struct {
+	log   *log.Logger
+	store OutboxStore
+	pub   Publisher
+	cfg   RelayConfig
+}
+
+func NewRelay(l *log.Logger, store OutboxStore, pub Publisher, cfg RelayConfig) *Relay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultRelayConfig.PollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultRelayConfig.BatchSize
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultRelayConfig.MaxAttempts
+	}
+	return &Relay{log: l, store: store, pub: pub, cfg: cfg}
+}
+
+// Run publica los pendientes cada PollInterval hasta que se cancele el ctx
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		//Si la vuelta salio completa puede que queden mas, seguimos sin esperar al ticker
+		publicados, err := r.Flush(ctx)
+		if err != nil {
+			r.log.Println("outbox relay:", err)
+		}
+		if err == nil && publicados == r.cfg.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publica una tanda de eventos pendientes en orden y devuelve cuantos publico
+// Si falla un Publish se deja de publicar en esa vuelta, asi los eventos de un mismo enrollment no salen desordenados
+// (con un MultiPublisher el reintento solo le llega a los publishers que fallaron)
+// Cuando un evento llega a MaxAttempts se marca muerto y se sigue con el resto, para que uno malo no tranque la outbox
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	mensajes, err := r.store.PendingEvents(ctx, r.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	publicados := 0
+	for _, mensaje := range mensajes {
+		var evento Event
+		if err := json.Unmarshal([]byte(mensaje.Payload), &evento); err != nil {
+			//Un payload que no se puede leer nunca se va a poder publicar, lo matamos de una sin reintentar
+			if err := r.matarEvento(ctx, mensaje, fmt.Errorf("invalid payload: %w", err)); err != nil {
+				return publicados, err
+			}
+			continue
+		}
+
+		if err := r.pub.Publish(ctx, evento); err != nil {
+			if mensaje.Attempts+1 >= r.cfg.MaxAttempts {
+				if errMark := r.matarEvento(ctx, mensaje, err); errMark != nil {
+					return publicados, errMark
+				}
+				continue
+			}
+			if errMark := r.store.MarkEventFailed(ctx, mensaje.ID, err); errMark != nil {
+				r.log.Println(errMark)
+			}
+			return publicados, err
+		}
+		if err := r.store.MarkEventPublished(ctx, mensaje.ID); err != nil {
+			return publicados, err
+		}
+		publicados++
+	}
+	return publicados, nil
+}
+
+// matarEvento marca el evento como muerto (no se reintenta mas) y loguea cuantos muertos hay en total,
+// los muertos quedan en la outbox con failed_at y last_error para revisarlos y republicarlos a mano
+func (r *Relay) matarEvento(ctx context.Context, mensaje OutboxMessage, cause error) error {
+	if err := r.store.MarkEventDead(ctx, mensaje.ID, cause); err != nil {
+		return err
+	}
+	muertos, err := r.store.CountDeadEvents(ctx)
+	if err != nil {
+		r.log.Println(err)
+	}
+	r.log.Printf("outbox relay: event %s dead after %d attempts (%d dead events in the outbox): %v\n", mensaje.EventID, mensaje.Attempts+1, muertos, cause)
+	return nil
+}
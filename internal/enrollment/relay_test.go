@@ -0,0 +1,277 @@
+package enrollment_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+// publisherFallido falla las primeras veces que se llama y despues publica en el InProcessPublisher
+type publisherFallido struct {
+	mu      sync.Mutex
+	fallas  int
+	destino *enrollment.InProcessPublisher
+}
+
+func (p *publisherFallido) Publish(ctx context.Context, evento enrollment.Event) error {
+	p.mu.Lock()
+	if p.fallas > 0 {
+		p.fallas--
+		p.mu.Unlock()
+		return errors.New("broker down")
+	}
+	p.mu.Unlock()
+	return p.destino.Publish(ctx, evento)
+}
+
+// outboxRoto tiene un evento con un payload que no es json y uno bueno, y anota los que se marcan muertos
+type outboxRoto struct {
+	muertos    []uint
+	publicados []uint
+}
+
+func (o *outboxRoto) PendingEvents(ctx context.Context, limit int) ([]enrollment.OutboxMessage, error) {
+	return []enrollment.OutboxMessage{
+		{ID: 1, EventID: "ev1", Payload: "{roto"},
+		{ID: 2, EventID: "ev2", Payload: `{"id":"ev2"}`},
+	}, nil
+}
+
+func (o *outboxRoto) MarkEventPublished(ctx context.Context, id uint) error {
+	o.publicados = append(o.publicados, id)
+	return nil
+}
+
+func (o *outboxRoto) MarkEventFailed(ctx context.Context, id uint, cause error) error {
+	return nil
+}
+
+func (o *outboxRoto) MarkEventDead(ctx context.Context, id uint, cause error) error {
+	o.muertos = append(o.muertos, id)
+	return nil
+}
+
+func (o *outboxRoto) CountDeadEvents(ctx context.Context) (int64, error) {
+	return int64(len(o.muertos)), nil
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	l := log.New(io.Discard, "", 0)
+
+	crear := func(t *testing.T, repo enrollment.Repository, cantidad int) {
+		for i := 0; i < cantidad; i++ {
+			e := &domain.Enrollment{UserID: "u" + string(rune('a'+i)), CourseID: "c1", Status: domain.Pending}
+			assert.NoError(t, repo.Create(ctx, e))
+		}
+	}
+
+	t.Run("should publish the pending events in order and only once", func(t *testing.T) {
+		repo := enrollment.NewMemoryRepo(l)
+		crear(t, repo, 3)
+		pub := enrollment.NewInProcessPublisher()
+		relay := enrollment.NewRelay(l, repo.(enrollment.OutboxStore), pub, enrollment.RelayConfig{BatchSize: 2})
+
+		publicados, err := relay.Flush(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, publicados)
+		publicados, err = relay.Flush(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, publicados)
+		publicados, err = relay.Flush(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, publicados)
+
+		eventos := pub.Events()
+		assert.Len(t, eventos, 3)
+		assert.Equal(t, []string{"ua", "ub", "uc"}, []string{eventos[0].UserID, eventos[1].UserID, eventos[2].UserID})
+	})
+
+	t.Run("should stop at the first failure and retry it on the next flush", func(t *testing.T) {
+		repo := enrollment.NewMemoryRepo(l)
+		crear(t, repo, 2)
+		store := repo.(enrollment.OutboxStore)
+		destino := enrollment.NewInProcessPublisher()
+		relay := enrollment.NewRelay(l, store, &publisherFallido{fallas: 1, destino: destino}, enrollment.DefaultRelayConfig)
+
+		publicados, err := relay.Flush(ctx)
+		assert.Error(t, err)
+		assert.Equal(t, 0, publicados)
+		pendientes, _ := store.PendingEvents(ctx, 10)
+		assert.Len(t, pendientes, 2)
+		assert.Equal(t, 1, pendientes[0].Attempts)
+		assert.Equal(t, "broker down", pendientes[0].LastError)
+
+		publicados, err = relay.Flush(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, publicados)
+		assert.Len(t, destino.Events(), 2)
+	})
+
+	t.Run("should give up on an event after MaxAttempts and publish the next ones", func(t *testing.T) {
+		repo := enrollment.NewMemoryRepo(l)
+		crear(t, repo, 2)
+		store := repo.(enrollment.OutboxStore)
+		var logs bytes.Buffer
+		destino := enrollment.NewInProcessPublisher()
+		relay := enrollment.NewRelay(log.New(&logs, "", 0), store, &publisherFallido{fallas: 3, destino: destino}, enrollment.RelayConfig{MaxAttempts: 3})
+
+		for i := 0; i < 2; i++ {
+			publicados, err := relay.Flush(ctx)
+			assert.Error(t, err)
+			assert.Equal(t, 0, publicados)
+		}
+		publicados, err := relay.Flush(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, publicados)
+
+		eventos := destino.Events()
+		if assert.Len(t, eventos, 1) {
+			assert.Equal(t, "ub", eventos[0].UserID)
+		}
+		pendientes, _ := store.PendingEvents(ctx, 10)
+		assert.Empty(t, pendientes)
+		muertos, err := store.CountDeadEvents(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), muertos)
+		assert.Contains(t, logs.String(), "dead after 3 attempts (1 dead events in the outbox)")
+	})
+
+	t.Run("should give up at once on an event that cannot be read", func(t *testing.T) {
+		store := &outboxRoto{}
+		pub := enrollment.NewInProcessPublisher()
+		relay := enrollment.NewRelay(l, store, pub, enrollment.DefaultRelayConfig)
+
+		publicados, err := relay.Flush(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, publicados)
+		assert.Len(t, pub.Events(), 1)
+		assert.Equal(t, []uint{1}, store.muertos)
+		assert.Equal(t, []uint{2}, store.publicados)
+	})
+
+	t.Run("should keep publishing in background until the context is cancelled", func(t *testing.T) {
+		repo := enrollment.NewMemoryRepo(l)
+		pub := enrollment.NewInProcessPublisher()
+		relay := enrollment.NewRelay(l, repo.(enrollment.OutboxStore), pub, enrollment.RelayConfig{PollInterval: 10 * time.Millisecond})
+
+		runCtx, cancel := context.WithCancel(ctx)
+		terminado := make(chan struct{})
+		go func() {
+			relay.Run(runCtx)
+			close(terminado)
+		}()
+
+		crear(t, repo, 1)
+		assert.Eventually(t, func() bool { return len(pub.Events()) == 1 }, time.Second, 10*time.Millisecond)
+		cancel()
+		select {
+		case <-terminado:
+		case <-time.After(time.Second):
+			t.Fatal("relay did not stop after cancel")
+		}
+	})
+}
+
+// publisherCaido siempre falla y cuenta cuantas veces lo llamaron
+type publisherCaido struct {
+	mu      sync.Mutex
+	llamado int
+}
+
+func (p *publisherCaido) Publish(ctx context.Context, evento enrollment.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.llamado++
+	return errors.New("partner down")
+}
+
+func TestMultiPublisher(t *testing.T) {
+	ctx := context.Background()
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should publish only once in the healthy publishers while another one keeps failing", func(t *testing.T) {
+		repo := enrollment.NewMemoryRepo(l)
+		assert.NoError(t, repo.Create(ctx, &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending}))
+		store := repo.(enrollment.OutboxStore)
+		antes := enrollment.NewInProcessPublisher()
+		despues := enrollment.NewInProcessPublisher()
+		caido := &publisherCaido{}
+		relay := enrollment.NewRelay(l, store, enrollment.NewMultiPublisher(antes, caido, despues), enrollment.DefaultRelayConfig)
+
+		for i := 0; i < 3; i++ {
+			publicados, err := relay.Flush(ctx)
+			assert.ErrorContains(t, err, "partner down")
+			assert.Equal(t, 0, publicados)
+		}
+
+		assert.Len(t, antes.Events(), 1)
+		assert.Len(t, despues.Events(), 1)
+		assert.Equal(t, 3, caido.llamado)
+		pendientes, _ := store.PendingEvents(ctx, 10)
+		assert.Len(t, pendientes, 1)
+		assert.Equal(t, 3, pendientes[0].Attempts)
+	})
+
+	t.Run("should retry only the failed publisher and then forget the event", func(t *testing.T) {
+		sano := enrollment.NewInProcessPublisher()
+		destino := enrollment.NewInProcessPublisher()
+		multi := enrollment.NewMultiPublisher(sano, &publisherFallido{fallas: 1, destino: destino})
+		evento := enrollment.Event{ID: "ev1", Type: enrollment.EventEnrollmentCreated}
+
+		assert.Error(t, multi.Publish(ctx, evento))
+		assert.NoError(t, multi.Publish(ctx, evento))
+		assert.Len(t, sano.Events(), 1)
+		assert.Len(t, destino.Events(), 1)
+
+		//Ya se entrego en todos, si llega de nuevo (ej: otra replica) se publica de nuevo en todos
+		assert.NoError(t, multi.Publish(ctx, evento))
+		assert.Len(t, sano.Events(), 2)
+		assert.Len(t, destino.Events(), 2)
+	})
+}
+
+func TestPublishers(t *testing.T) {
+	ctx := context.Background()
+	evento := enrollment.Event{ID: "ev1", Type: enrollment.EventEnrollmentCreated, EnrollmentID: "e1", Status: domain.Pending}
+
+	t.Run("should notify in-process subscribers until they unsubscribe", func(t *testing.T) {
+		pub := enrollment.NewInProcessPublisher()
+		var recibidos []string
+		unsubscribe := pub.Subscribe(func(e enrollment.Event) { recibidos = append(recibidos, e.ID) })
+
+		assert.NoError(t, pub.Publish(ctx, evento))
+		unsubscribe()
+		assert.NoError(t, pub.Publish(ctx, enrollment.Event{ID: "ev2"}))
+
+		assert.Equal(t, []string{"ev1"}, recibidos)
+		assert.Len(t, pub.Events(), 2)
+	})
+
+	t.Run("should write one json line per event", func(t *testing.T) {
+		var buf bytes.Buffer
+		pub := enrollment.NewNDJSONPublisher(&buf)
+		assert.NoError(t, pub.Publish(ctx, evento))
+		assert.NoError(t, pub.Publish(ctx, evento))
+
+		lineas := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		assert.Len(t, lineas, 2)
+		var leido enrollment.Event
+		assert.NoError(t, json.Unmarshal([]byte(lineas[0]), &leido))
+		assert.Equal(t, evento.ID, leido.ID)
+		assert.Equal(t, evento.Type, leido.Type)
+		assert.NotContains(t, lineas[0], "old_status")
+	})
+}
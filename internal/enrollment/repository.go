@@ -2,7 +2,9 @@ package enrollment
 
 import (
 	"context"
+	"errors"
 	"log"
+	"time"
 
 	"github.com/IgnacioBO/gomicro_domain/domain"
 	"gorm.io/gorm"
@@ -10,9 +12,19 @@ import (
 
 type Repository interface {
 	Create(ctx context.Context, e *domain.Enrollment) error
+	CreateBulk(ctx context.Context, enrollments []*domain.Enrollment) error
+	Get(ctx context.Context, id string) (*domain.Enrollment, error)
+	GetVersioned(ctx context.Context, id string) (*domain.Enrollment, int, error)
 	GetAll(ctx context.Context, filtros Filtros, offset, limit int) ([]domain.Enrollment, error) //Le agregamos que getAll reciba filtros
 	Count(ctx context.Context, filtros Filtros) (int, error)
-	Update(ctx context.Context, id string, status *string) error
+	Update(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error
+	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) error
+	Reactivate(ctx context.Context, id string) (*domain.Enrollment, error)
+	GetCapacity(ctx context.Context, courseID string) (*CourseCapacity, error)
+	SetCapacity(ctx context.Context, capacity *CourseCapacity) error
+	WaitlistPosition(ctx context.Context, e *domain.Enrollment) (int, error)
+	History(ctx context.Context, id string) ([]StatusHistory, error)
 }
 
 type repo struct {
@@ -31,14 +43,72 @@ func NewRepo(log *log.Logger, db *gorm.DB) Repository {
 func (r *repo) Create(ctx context.Context, enrollment *domain.Enrollment) error {
 	r.log.Println("repository Create:", enrollment)
 
-	result := r.db.WithContext(ctx).Create(enrollment)
+	//Usamos una transaccion para que el conteo de cupos y el insert sean atomicos (ver crearConCupo)
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return crearConCupo(tx, enrollment)
+	})
 
+	if err != nil {
+		r.log.Println(err)
+		//El unique index (user_id, course_id) no deja duplicar el enrollment
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrAlreadyEnrolled{UserID: enrollment.UserID, CourseID: enrollment.CourseID}
+		}
+		return err
+	}
+	r.log.Printf("enrollment created with id: %s, status: %s\n", enrollment.ID, enrollment.Status)
+	return nil
+}
+
+// CreateBulk inserta todos los enrollments en una misma transaccion, si uno falla no se inserta ninguno
+func (r *repo) CreateBulk(ctx context.Context, enrollments []*domain.Enrollment) error {
+	r.log.Println("repository CreateBulk:", len(enrollments))
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, enrollment := range enrollments {
+			if err := crearConCupo(tx, enrollment); err != nil {
+				if errors.Is(err, gorm.ErrDuplicatedKey) {
+					return ErrAlreadyEnrolled{UserID: enrollment.UserID, CourseID: enrollment.CourseID}
+				}
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		r.log.Println(err)
+		return err
+	}
+	r.log.Printf("enrollments created in bulk: %d\n", len(enrollments))
+	return nil
+}
+
+func (r *repo) Get(ctx context.Context, id string) (*domain.Enrollment, error) {
+	enroll, _, err := r.GetVersioned(ctx, id)
+	return enroll, err
+}
+
+// enrollmentVersionado sirve para leer la columna version junto con el enrollment (domain.Enrollment es de otro repo y no la tiene)
+type enrollmentVersionado struct {
+	domain.Enrollment
+	Version int
+}
+
+// GetVersioned es el Get pero devolviendo tambien la version (en la misma query, asi el ETag corresponde al enrollment leido)
+func (r *repo) GetVersioned(ctx context.Context, id string) (*domain.Enrollment, int, error) {
+	r.log.Println("repository Get by id:", id)
+
+	var fila enrollmentVersionado
+	result := r.db.WithContext(ctx).Table("enrollments").Where("id = ? AND deleted_at IS NULL", id).Limit(1).Find(&fila)
 	if result.Error != nil {
 		r.log.Println(result.Error)
-		return result.Error
+		return nil, 0, result.Error
 	}
-	r.log.Printf("enrollment created with id: %s, rows affected: %d\n", enrollment.ID, result.RowsAffected)
-	return nil
+	if result.RowsAffected == 0 {
+		return nil, 0, ErrEnrollNotFound{id}
+	}
+	r.log.Printf("enrollment retrieved with id: %s\n", id)
+	return &fila.Enrollment, fila.Version, nil
 }
 
 func (r *repo) GetAll(ctx context.Context, filtros Filtros, offset, limit int) ([]domain.Enrollment, error) {
@@ -48,8 +118,24 @@ func (r *repo) GetAll(ctx context.Context, filtros Filtros, offset, limit int) (
 
 	tx := r.db.WithContext(ctx).Model(&allEnroll)
 	tx = aplicarFiltros(tx, filtros)
+
+	//El orden siempre termina en id para que sea estable entre paginas (ver ordenCompleto)
+	orden := ordenCompleto(filtros.Sort)
+	//Con cursor traemos lo que viene despues del ultimo de la pagina anterior en el mismo orden
+	if filtros.Cursor != nil {
+		condicion, args := condicionCursor(orden, filtros.Cursor)
+		tx = tx.Where(condicion, args...)
+	}
+	//Las columnas vienen de la whitelist de sort.go, por eso se pueden concatenar en el ORDER BY
+	for _, campo := range orden {
+		if campo.Desc {
+			tx = tx.Order(campo.Column + " desc")
+		} else {
+			tx = tx.Order(campo.Column + " asc")
+		}
+	}
 	tx = tx.Limit(limit).Offset(offset)
-	result := tx.Order("created_at desc").Find(&allEnroll)
+	result := tx.Find(&allEnroll)
 	if result.Error != nil {
 		r.log.Println(result.Error)
 		return nil, result.Error
@@ -67,6 +153,41 @@ func aplicarFiltros(tx *gorm.DB, filtros Filtros) *gorm.DB {
 	if filtros.UserID != "" {
 		tx = tx.Where("user_id = ?", filtros.UserID)
 	}
+
+	if len(filtros.CourseIDs) > 0 {
+		tx = tx.Where("course_id IN ?", filtros.CourseIDs)
+	}
+
+	if len(filtros.UserIDs) > 0 {
+		tx = tx.Where("user_id IN ?", filtros.UserIDs)
+	}
+
+	if len(filtros.Statuses) > 0 {
+		tx = tx.Where("status IN ?", filtros.Statuses)
+	}
+
+	if len(filtros.ExcludeStatuses) > 0 {
+		tx = tx.Where("status NOT IN ?", filtros.ExcludeStatuses)
+	}
+
+	//Los rangos de fecha son inclusivos en ambos extremos
+	if filtros.CreatedFrom != nil {
+		tx = tx.Where("created_at >= ?", *filtros.CreatedFrom)
+	}
+	if filtros.CreatedTo != nil {
+		tx = tx.Where("created_at <= ?", *filtros.CreatedTo)
+	}
+	if filtros.UpdatedFrom != nil {
+		tx = tx.Where("updated_at >= ?", *filtros.UpdatedFrom)
+	}
+	if filtros.UpdatedTo != nil {
+		tx = tx.Where("updated_at <= ?", *filtros.UpdatedTo)
+	}
+
+	//Los borrados (soft delete) no se muestran salvo que lo pidan explicitamente
+	if !filtros.IncludeDeleted {
+		tx = tx.Where("deleted_at IS NULL")
+	}
 	return tx
 }
 
@@ -83,7 +204,8 @@ func (r *repo) Count(ctx context.Context, filtros Filtros) (int, error) {
 	return int(cantidad), nil
 }
 
-func (r *repo) Update(ctx context.Context, id string, status *string) error {
+// Update solo actualiza si el enrollment sigue en currentStatus (y en version, si es mayor a 0), si no devuelve ErrStatusConflict
+func (r *repo) Update(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
 	r.log.Println("repository Update")
 	//Usaremos un MAP, porque si usamos el struct, NO ACTUALIZA VALORES CERO (osea "", 0, false)
 	//Al usar un map es [string]intareface{}, se usa interface en el valor porque peude ser numerico, string, bool
@@ -92,19 +214,215 @@ func (r *repo) Update(ctx context.Context, id string, status *string) error {
 	if status != nil {
 		valores["status"] = *status
 	}
+	valores["version"] = gorm.Expr("version + 1")
 
-	result := r.db.WithContext(ctx).Model(domain.Enrollment{}).Where("id = ?", id).Updates(valores)
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		q := tx.Model(domain.Enrollment{}).Where("id = ? AND status = ? AND deleted_at IS NULL", id, currentStatus)
+		if version > 0 {
+			q = q.Where("version = ?", version)
+		}
+		result := q.Updates(valores)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			//No se actualizo nada, puede ser que no exista o que otro request lo cambio
+			var cantidad int64
+			if err := tx.Model(domain.Enrollment{}).Where("id = ? AND deleted_at IS NULL", id).Count(&cantidad).Error; err != nil {
+				return err
+			}
+			if cantidad == 0 {
+				return ErrEnrollNotFound{id}
+			}
+			return ErrStatusConflict{EnrollmentID: id, Status: currentStatus}
+		}
 
-	if result.Error != nil {
+		if status == nil {
+			return nil
+		}
+
+		//Leemos el enrollment ya actualizado para el evento (y el course_id para la lista de espera)
+		var enroll domain.Enrollment
+		if err := tx.Where("id = ?", id).First(&enroll).Error; err != nil {
+			return err
+		}
+		actor := ActorFromContext(ctx)
+		if err := registrarHistorial(tx, id, currentStatus, enroll.Status, actor); err != nil {
+			return err
+		}
+		if err := registrarEvento(tx, EventEnrollmentStatusChanged, enroll, currentStatus, actor); err != nil {
+			return err
+		}
+
+		//Si dejo libre un cupo (paso a Inactive) se promueve al primero de la lista de espera
+		if enroll.Status == domain.Inactive && ocupaCupo(currentStatus) {
+			return promoverWaitlist(tx, enroll.CourseID)
+		}
+		return nil
+	})
+
+	if err != nil {
 		//Tambien imprimieros los errores en esta capa, ya no imprimiermos en la capa servicio
-		r.log.Println(result.Error)
-		return result.Error
+		r.log.Println(err)
+		return err
 	}
-	if result.RowsAffected == 0 {
-		r.log.Printf("enrollment with id: %s not found, rows affected: %d\n", id, result.RowsAffected)
-		return ErrEnrollNotFound{id}
+	r.log.Printf("enrollment updated with id: %s\n", id)
+
+	return nil
+}
+
+// Delete hace un soft delete: solo marca deleted_at, la fila sigue en la bbdd para poder restaurarla
+func (r *repo) Delete(ctx context.Context, id string) error {
+	r.log.Println("repository Delete")
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var enroll domain.Enrollment
+		result := tx.Where("id = ? AND deleted_at IS NULL", id).Limit(1).Find(&enroll)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrEnrollNotFound{id}
+		}
+
+		//El deleted_at IS NULL del update hace que con dos DELETE concurrentes solo uno borre (y promueva la lista de espera)
+		borrado := tx.Model(domain.Enrollment{}).Where("id = ? AND deleted_at IS NULL", id).Updates(map[string]interface{}{"deleted_at": time.Now(), "version": gorm.Expr("version + 1")})
+		if borrado.Error != nil {
+			return borrado.Error
+		}
+		if borrado.RowsAffected != 1 {
+			return ErrEnrollNotFound{id}
+		}
+		if err := registrarEvento(tx, EventEnrollmentDeleted, enroll, "", ActorFromContext(ctx)); err != nil {
+			return err
+		}
+
+		//Si el borrado ocupaba un cupo, se promueve al primero de la lista de espera
+		if ocupaCupo(enroll.Status) {
+			return promoverWaitlist(tx, enroll.CourseID)
+		}
+		return nil
+	})
+
+	if err != nil {
+		r.log.Println(err)
+		return err
 	}
-	r.log.Printf("enrollment updated with id: %s, rows affected: %d\n", id, result.RowsAffected)
+	r.log.Printf("enrollment deleted with id: %s\n", id)
+	return nil
+}
+
+// Reactivate vuelve un enrollment Inactive a Pending tomando el cupo igual que un Create (con la fila de cupos bloqueada),
+// si el curso esta lleno queda Waitlisted. Es una inscripcion nueva, asi que created_at pasa a ahora y en la lista de
+// espera queda al final. Si ya no esta Inactive devuelve ErrStatusConflict
+func (r *repo) Reactivate(ctx context.Context, id string) (*domain.Enrollment, error) {
+	r.log.Println("repository Reactivate")
+
+	var enroll domain.Enrollment
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND deleted_at IS NULL", id).Limit(1).Find(&enroll)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrEnrollNotFound{id}
+		}
+		if enroll.Status != domain.Inactive {
+			return ErrStatusConflict{EnrollmentID: id, Status: domain.Inactive}
+		}
+
+		nuevo := domain.Pending
+		lleno, err := cursoLleno(tx, enroll.CourseID)
+		if err != nil {
+			return err
+		}
+		if lleno {
+			nuevo = Waitlisted
+		}
+
+		ahora := time.Now()
+		actualizado := tx.Model(domain.Enrollment{}).Where("id = ? AND status = ? AND deleted_at IS NULL", id, domain.Inactive).
+			Updates(map[string]interface{}{"status": nuevo, "created_at": ahora, "version": gorm.Expr("version + 1")})
+		if actualizado.Error != nil {
+			return actualizado.Error
+		}
+		if actualizado.RowsAffected == 0 {
+			return ErrStatusConflict{EnrollmentID: id, Status: domain.Inactive}
+		}
+
+		enroll.Status = nuevo
+		enroll.CreatedAt = &ahora
+		actor := ActorFromContext(ctx)
+		if err := registrarHistorial(tx, id, domain.Inactive, nuevo, actor); err != nil {
+			return err
+		}
+		return registrarEvento(tx, EventEnrollmentStatusChanged, enroll, domain.Inactive, actor)
+	})
+
+	if err != nil {
+		r.log.Println(err)
+		return nil, err
+	}
+	r.log.Printf("enrollment reactivated with id: %s, status: %s\n", id, enroll.Status)
+	return &enroll, nil
+}
+
+// Restore deshace el soft delete (deja deleted_at en NULL)
+// Si el enrollment ocupaba un cupo y el curso ya se lleno, vuelve a la lista de espera
+func (r *repo) Restore(ctx context.Context, id string) error {
+	r.log.Println("repository Restore")
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var enroll domain.Enrollment
+		result := tx.Where("id = ? AND deleted_at IS NOT NULL", id).Limit(1).Find(&enroll)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrEnrollNotFound{id}
+		}
 
+		valores := map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")}
+		lleno := false
+		if ocupaCupo(enroll.Status) {
+			var err error
+			if lleno, err = cursoLleno(tx, enroll.CourseID); err != nil {
+				return err
+			}
+			if lleno {
+				valores["status"] = Waitlisted
+			}
+		}
+
+		//El deleted_at IS NOT NULL del update hace que con dos restore concurrentes solo uno restaure (y escriba historial y evento)
+		restaurado := tx.Model(domain.Enrollment{}).Where("id = ? AND deleted_at IS NOT NULL", id).Updates(valores)
+		//Despues de borrarlo el user se pudo volver a inscribir en el curso (choca con el unique index de las filas vivas)
+		if errors.Is(restaurado.Error, gorm.ErrDuplicatedKey) {
+			return ErrAlreadyEnrolled{UserID: enroll.UserID, CourseID: enroll.CourseID}
+		}
+		if restaurado.Error != nil {
+			return restaurado.Error
+		}
+		if restaurado.RowsAffected != 1 {
+			return ErrEnrollNotFound{id}
+		}
+
+		if lleno {
+			actor := ActorFromContext(ctx)
+			if err := registrarHistorial(tx, id, enroll.Status, Waitlisted, actor); err != nil {
+				return err
+			}
+			anterior := enroll.Status
+			enroll.Status = Waitlisted
+			return registrarEvento(tx, EventEnrollmentStatusChanged, enroll, anterior, actor)
+		}
+		return nil
+	})
+
+	if err != nil {
+		r.log.Println(err)
+		return err
+	}
+	r.log.Printf("enrollment restored with id: %s\n", id)
 	return nil
 }
@@ -0,0 +1,373 @@
+package enrollment_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/bootstrap"
+)
+
+// Los mismos casos corren contra el repo en memoria y contra el de gorm con sqlite en memoria (no hace falta docker)
+func TestRepository(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("memory", func(t *testing.T) {
+		probarRepositorio(t, func(t *testing.T) enrollment.Repository {
+			return enrollment.NewMemoryRepo(l)
+		})
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		probarRepositorio(t, func(t *testing.T) enrollment.Repository {
+			db, err := bootstrap.Open(bootstrap.DBConfig{Driver: bootstrap.DriverSQLite, Name: ":memory:", Migrate: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				if sqlDB, err := db.DB(); err == nil {
+					sqlDB.Close()
+				}
+			})
+			return enrollment.NewRepo(l, db)
+		})
+	})
+}
+
+// probarRepositorio corre los casos con un repositorio nuevo (vacio) en cada uno
+func probarRepositorio(t *testing.T, nuevoRepo func(t *testing.T) enrollment.Repository) {
+	ctx := context.Background()
+
+	t.Run("should create, get and reject a duplicated enrollment", func(t *testing.T) {
+		repo := nuevoRepo(t)
+
+		e := &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending}
+		assert.NoError(t, repo.Create(ctx, e))
+		assert.NotEmpty(t, e.ID)
+
+		got, err := repo.Get(ctx, e.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "u1", got.UserID)
+
+		_, err = repo.Get(ctx, "no-existe")
+		assert.ErrorAs(t, err, &enrollment.ErrEnrollNotFound{})
+
+		err = repo.Create(ctx, &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending})
+		assert.ErrorAs(t, err, &enrollment.ErrAlreadyEnrolled{})
+	})
+
+	t.Run("should filter, sort and page by cursor", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		for _, u := range []string{"u1", "u2", "u3", "u4"} {
+			assert.NoError(t, repo.Create(ctx, &domain.Enrollment{UserID: u, CourseID: "c1", Status: domain.Pending}))
+		}
+
+		filtros := enrollment.Filtros{UserIDs: []string{"u1", "u2", "u3"}, Sort: []enrollment.SortField{{Column: "user_id"}}}
+		cantidad, err := repo.Count(ctx, filtros)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, cantidad)
+
+		pagina, err := repo.GetAll(ctx, filtros, 0, 2)
+		assert.NoError(t, err)
+		assert.Len(t, pagina, 2)
+		assert.Equal(t, "u1", pagina[0].UserID)
+		assert.Equal(t, "u2", pagina[1].UserID)
+
+		cursor, err := enrollment.DecodeCursor(enrollment.EncodeCursor(pagina[1], filtros.Sort), filtros.Sort)
+		assert.NoError(t, err)
+		filtros.Cursor = cursor
+		pagina, err = repo.GetAll(ctx, filtros, 0, 2)
+		assert.NoError(t, err)
+		assert.Len(t, pagina, 1)
+		assert.Equal(t, "u3", pagina[0].UserID)
+	})
+
+	t.Run("should apply compare-and-set on update", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		e := &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending}
+		assert.NoError(t, repo.Create(ctx, e))
+
+		activo := string(domain.Active)
+		assert.NoError(t, repo.Update(ctx, e.ID, domain.Pending, 0, &activo))
+
+		err := repo.Update(ctx, e.ID, domain.Pending, 0, &activo)
+		assert.ErrorAs(t, err, &enrollment.ErrStatusConflict{})
+	})
+
+	t.Run("should increment the version on every write", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		e := &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending}
+		assert.NoError(t, repo.Create(ctx, e))
+
+		_, version, err := repo.GetVersioned(ctx, e.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, version)
+
+		activo := string(domain.Active)
+		assert.NoError(t, repo.Update(ctx, e.ID, domain.Pending, 1, &activo))
+		_, version, err = repo.GetVersioned(ctx, e.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, version)
+
+		//Con una version vieja no actualiza aunque el status coincida
+		studying := string(domain.Studying)
+		err = repo.Update(ctx, e.ID, domain.Active, 1, &studying)
+		assert.ErrorAs(t, err, &enrollment.ErrStatusConflict{})
+
+		assert.NoError(t, repo.Delete(ctx, e.ID))
+		assert.NoError(t, repo.Restore(ctx, e.ID))
+		_, version, err = repo.GetVersioned(ctx, e.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, version)
+	})
+
+	t.Run("should waitlist when the course is full and promote when a seat is freed", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		assert.NoError(t, repo.SetCapacity(ctx, &enrollment.CourseCapacity{CourseID: "c1", Capacity: 1}))
+
+		primero := &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending}
+		segundo := &domain.Enrollment{UserID: "u2", CourseID: "c1", Status: domain.Pending}
+		assert.NoError(t, repo.Create(ctx, primero))
+		assert.NoError(t, repo.Create(ctx, segundo))
+		assert.Equal(t, enrollment.Waitlisted, segundo.Status)
+
+		posicion, err := repo.WaitlistPosition(ctx, segundo)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, posicion)
+
+		assert.NoError(t, repo.Delete(ctx, primero.ID))
+		got, err := repo.Get(ctx, segundo.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.Pending, got.Status)
+
+		historial, err := repo.History(ctx, segundo.ID)
+		assert.NoError(t, err)
+		assert.Len(t, historial, 2)
+	})
+
+	t.Run("should reactivate to the waitlist when the course is full", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		inactivo := &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending}
+		assert.NoError(t, repo.Create(ctx, inactivo))
+		for _, status := range []domain.EnrollStatus{domain.Active, domain.Inactive} {
+			anterior, _ := repo.Get(ctx, inactivo.ID)
+			nuevo := string(status)
+			assert.NoError(t, repo.Update(ctx, inactivo.ID, anterior.Status, 0, &nuevo))
+		}
+		assert.NoError(t, repo.SetCapacity(ctx, &enrollment.CourseCapacity{CourseID: "c1", Capacity: 1}))
+		assert.NoError(t, repo.Create(ctx, &domain.Enrollment{UserID: "u2", CourseID: "c1", Status: domain.Pending}))
+		enEspera := &domain.Enrollment{UserID: "u3", CourseID: "c1", Status: domain.Pending}
+		assert.NoError(t, repo.Create(ctx, enEspera))
+
+		reactivado, err := repo.Reactivate(ctx, inactivo.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, enrollment.Waitlisted, reactivado.Status, "should not take a seat over the capacity")
+		posicion, err := repo.WaitlistPosition(ctx, reactivado)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, posicion, "should go after the ones already waiting")
+
+		_, err = repo.Reactivate(ctx, inactivo.ID)
+		assert.ErrorAs(t, err, &enrollment.ErrStatusConflict{})
+	})
+
+	t.Run("should soft delete and restore an enrollment", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		e := &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending}
+		assert.NoError(t, repo.Create(ctx, e))
+
+		assert.NoError(t, repo.Delete(ctx, e.ID))
+		_, err := repo.Get(ctx, e.ID)
+		assert.ErrorAs(t, err, &enrollment.ErrEnrollNotFound{})
+
+		cantidad, err := repo.Count(ctx, enrollment.Filtros{IncludeDeleted: true})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, cantidad)
+
+		assert.NoError(t, repo.Restore(ctx, e.ID))
+		_, err = repo.Get(ctx, e.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should delete only once with concurrent deletes", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		assert.NoError(t, repo.SetCapacity(ctx, &enrollment.CourseCapacity{CourseID: "c1", Capacity: 1}))
+		primero := &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending}
+		assert.NoError(t, repo.Create(ctx, primero))
+		for _, u := range []string{"u2", "u3"} {
+			assert.NoError(t, repo.Create(ctx, &domain.Enrollment{UserID: u, CourseID: "c1", Status: domain.Pending}))
+		}
+
+		var wg sync.WaitGroup
+		errores := make([]error, 2)
+		for i := range errores {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errores[i] = repo.Delete(ctx, primero.ID)
+			}(i)
+		}
+		wg.Wait()
+		borrados := 0
+		for _, err := range errores {
+			if err == nil {
+				borrados++
+			} else {
+				assert.ErrorAs(t, err, &enrollment.ErrEnrollNotFound{})
+			}
+		}
+		assert.Equal(t, 1, borrados)
+
+		pendientes, err := repo.Count(ctx, enrollment.Filtros{CourseID: "c1", Statuses: []domain.EnrollStatus{domain.Pending}})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, pendientes, "should promote only one from the waitlist")
+	})
+
+	t.Run("should restore only once with concurrent restores", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		assert.NoError(t, repo.SetCapacity(ctx, &enrollment.CourseCapacity{CourseID: "c1", Capacity: 1}))
+		primero := &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending}
+		assert.NoError(t, repo.Create(ctx, primero))
+		assert.NoError(t, repo.Delete(ctx, primero.ID))
+		//Con el curso lleno el restore lo pasa a Waitlisted, asi escribe historial y evento
+		assert.NoError(t, repo.Create(ctx, &domain.Enrollment{UserID: "u2", CourseID: "c1", Status: domain.Pending}))
+
+		var wg sync.WaitGroup
+		errores := make([]error, 2)
+		for i := range errores {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errores[i] = repo.Restore(ctx, primero.ID)
+			}(i)
+		}
+		wg.Wait()
+		restaurados := 0
+		for _, err := range errores {
+			if err == nil {
+				restaurados++
+			} else {
+				assert.ErrorAs(t, err, &enrollment.ErrEnrollNotFound{})
+			}
+		}
+		assert.Equal(t, 1, restaurados)
+
+		historial, err := repo.History(ctx, primero.ID)
+		assert.NoError(t, err)
+		aWaitlist := 0
+		for _, h := range historial {
+			if h.NewStatus == enrollment.Waitlisted {
+				aWaitlist++
+			}
+		}
+		assert.Equal(t, 1, aWaitlist, "should write the history only once")
+
+		pendientes, err := repo.(enrollment.OutboxStore).PendingEvents(ctx, 100)
+		assert.NoError(t, err)
+		cambios := 0
+		for _, mensaje := range pendientes {
+			if mensaje.EnrollmentID == primero.ID && mensaje.EventType == enrollment.EventEnrollmentStatusChanged {
+				cambios++
+			}
+		}
+		assert.Equal(t, 1, cambios, "should write the outbox event only once")
+	})
+
+	t.Run("should enroll again after a delete", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		primero := &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending}
+		assert.NoError(t, repo.Create(ctx, primero))
+		assert.NoError(t, repo.Delete(ctx, primero.ID))
+
+		segundo := &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending}
+		assert.NoError(t, repo.Create(ctx, segundo), "should not count the deleted enrollment")
+		assert.NotEqual(t, primero.ID, segundo.ID)
+
+		err := repo.Create(ctx, &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending})
+		assert.ErrorAs(t, err, &enrollment.ErrAlreadyEnrolled{}, "should still reject two live enrollments")
+
+		err = repo.Restore(ctx, primero.ID)
+		assert.ErrorAs(t, err, &enrollment.ErrAlreadyEnrolled{}, "should not restore over the new enrollment")
+	})
+
+	t.Run("should not create any enrollment when one of the bulk fails", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		err := repo.CreateBulk(ctx, []*domain.Enrollment{
+			{UserID: "u1", CourseID: "c1", Status: domain.Pending},
+			{UserID: "u1", CourseID: "c1", Status: domain.Pending},
+		})
+		assert.ErrorAs(t, err, &enrollment.ErrAlreadyEnrolled{})
+
+		cantidad, err := repo.Count(ctx, enrollment.Filtros{IncludeDeleted: true})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, cantidad)
+
+		pendientes, err := repo.(enrollment.OutboxStore).PendingEvents(ctx, 100)
+		assert.NoError(t, err)
+		assert.Empty(t, pendientes)
+	})
+
+	t.Run("should write an outbox event with every change", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		store := repo.(enrollment.OutboxStore)
+		assert.NoError(t, repo.SetCapacity(ctx, &enrollment.CourseCapacity{CourseID: "c1", Capacity: 1}))
+
+		primero := &domain.Enrollment{UserID: "u1", CourseID: "c1", Status: domain.Pending}
+		segundo := &domain.Enrollment{UserID: "u2", CourseID: "c1", Status: domain.Pending}
+		assert.NoError(t, repo.Create(ctx, primero))
+		assert.NoError(t, repo.Create(ctx, segundo))
+		inactivo := string(domain.Inactive)
+		assert.NoError(t, repo.Update(ctx, primero.ID, domain.Pending, 0, &inactivo))
+		assert.NoError(t, repo.Delete(ctx, primero.ID))
+
+		pendientes, err := store.PendingEvents(ctx, 100)
+		assert.NoError(t, err)
+		eventos := make([]enrollment.Event, 0, len(pendientes))
+		for _, mensaje := range pendientes {
+			var evento enrollment.Event
+			assert.NoError(t, json.Unmarshal([]byte(mensaje.Payload), &evento))
+			assert.Equal(t, mensaje.EventID, evento.ID)
+			eventos = append(eventos, evento)
+		}
+		if !assert.Len(t, eventos, 5) {
+			return
+		}
+		assert.Equal(t, enrollment.EventEnrollmentCreated, eventos[0].Type)
+		assert.Equal(t, enrollment.EventEnrollmentCreated, eventos[1].Type)
+		assert.Equal(t, enrollment.Waitlisted, eventos[1].Status)
+		//El Inactive del primero libera el cupo y el sistema promueve al segundo, en ese orden
+		assert.Equal(t, enrollment.EventEnrollmentStatusChanged, eventos[2].Type)
+		assert.Equal(t, primero.ID, eventos[2].EnrollmentID)
+		assert.Equal(t, domain.Pending, eventos[2].OldStatus)
+		assert.Equal(t, domain.Inactive, eventos[2].Status)
+		assert.Equal(t, enrollment.EventEnrollmentStatusChanged, eventos[3].Type)
+		assert.Equal(t, segundo.ID, eventos[3].EnrollmentID)
+		assert.Equal(t, "u2", eventos[3].UserID)
+		assert.Equal(t, enrollment.ActorSystem, eventos[3].Actor)
+		assert.Equal(t, enrollment.EventEnrollmentDeleted, eventos[4].Type)
+
+		assert.NoError(t, store.MarkEventFailed(ctx, pendientes[0].ID, errors.New("broker down")))
+		assert.NoError(t, store.MarkEventPublished(ctx, pendientes[0].ID))
+		pendientes, err = store.PendingEvents(ctx, 2)
+		assert.NoError(t, err)
+		assert.Len(t, pendientes, 2)
+		assert.Equal(t, eventos[1].ID, pendientes[0].EventID)
+
+		//Un evento muerto ya no sale en los pendientes pero se cuenta
+		assert.NoError(t, store.MarkEventDead(ctx, pendientes[0].ID, errors.New("partner down")))
+		pendientes, err = store.PendingEvents(ctx, 100)
+		assert.NoError(t, err)
+		assert.Len(t, pendientes, 3)
+		assert.Equal(t, eventos[2].ID, pendientes[0].EventID)
+		muertos, err := store.CountDeadEvents(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), muertos)
+	})
+}
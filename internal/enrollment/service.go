@@ -2,7 +2,10 @@ package enrollment
 
 import (
 	"context"
+	"errors"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/IgnacioBO/gomicro_domain/domain"
 
@@ -12,32 +15,86 @@ import (
 
 type Service interface {
 	Create(ctx context.Context, userID, courseID string) (*domain.Enrollment, error)
+	BulkCreate(ctx context.Context, items []CreateRequest, mode string) ([]BulkResult, error)
+	Get(ctx context.Context, id string, expand Expand) (*domain.Enrollment, int, error)
 	GetAll(ctx context.Context, filtros Filtros, offset, limit int) ([]domain.Enrollment, error) //Le agregamos que getAll reciba filtros
 	Count(ctx context.Context, Filtros Filtros) (int, error)
-	Update(ctx context.Context, id string, status *string) error
+	Update(ctx context.Context, id string, status *string, ifMatch IfMatch) (int, error)
+	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) error
+	GetCapacity(ctx context.Context, courseID string) (*CourseCapacity, error)
+	SetCapacity(ctx context.Context, courseID string, capacity int) (*CourseCapacity, error)
+	WaitlistPosition(ctx context.Context, e *domain.Enrollment) (int, error)
+	History(ctx context.Context, id string) ([]StatusHistory, error)
 }
 
 type (
 	Filtros struct {
-		UserID   string
-		CourseID string
+		UserID          string
+		CourseID        string
+		UserIDs         []string //user_id=a,b,c
+		CourseIDs       []string //course_id=a,b,c
+		Statuses        []domain.EnrollStatus
+		ExcludeStatuses []domain.EnrollStatus
+		CreatedFrom     *time.Time
+		CreatedTo       *time.Time
+		UpdatedFrom     *time.Time
+		UpdatedTo       *time.Time
+		IncludeDeleted  bool
+		Sort            []SortField //Solo lo usa GetAll, vacio es DefaultSort
+		Cursor          *Cursor     //Solo lo usa GetAll (pagina por keyset)
+	}
+
+	//Expand indica que relaciones (que viven en otros microservicios) hay que traer junto al enrollment
+	Expand struct {
+		User   bool
+		Course bool
 	}
 )
 
 type service struct {
-	log         *log.Logger
-	userTrans   userSdk.Transport
-	courseTrans courseSdk.Transport
-	repo        Repository
+	log             *log.Logger
+	users           upstreamUsers
+	courses         upstreamCourses
+	upstreamCfg     UpstreamConfig
+	repo            Repository
+	transitions     Transitions
+	reactivate      bool
+	bulkConcurrency int
+}
+
+// ServiceOption permite configurar cosas opcionales del service sin cambiar la firma de NewService
+type ServiceOption func(*service)
+
+// WithTransitions sobreescribe las DefaultTransitions (por ejemplo con las de una variable de entorno)
+func WithTransitions(t Transitions) ServiceOption {
+	return func(s *service) {
+		s.transitions = t
+	}
+}
+
+// WithReactivate hace que al crear un enrollment que ya existe y esta Inactive, se vuelva a Pending en vez de devolver ErrAlreadyEnrolled
+func WithReactivate(reactivate bool) ServiceOption {
+	return func(s *service) {
+		s.reactivate = reactivate
+	}
 }
 
-func NewService(log *log.Logger, userTrans userSdk.Transport, courseTrans courseSdk.Transport, repo Repository) Service {
-	return &service{
-		log:         log,
-		userTrans:   userTrans,
-		courseTrans: courseTrans,
-		repo:        repo,
+func NewService(log *log.Logger, userTrans userSdk.Transport, courseTrans courseSdk.Transport, repo Repository, opts ...ServiceOption) Service {
+	s := &service{
+		log:             log,
+		upstreamCfg:     DefaultUpstreamConfig,
+		repo:            repo,
+		transitions:     DefaultTransitions,
+		bulkConcurrency: defaultBulkConcurrency,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	//Los sdk se envuelven despues de las opciones para que usen la UpstreamConfig final
+	s.users = upstreamUsers{trans: userTrans, cfg: s.upstreamCfg}
+	s.courses = upstreamCourses{trans: courseTrans, cfg: s.upstreamCfg}
+	return s
 }
 
 func (s service) Create(ctx context.Context, userID, courseID string) (*domain.Enrollment, error) {
@@ -49,23 +106,132 @@ func (s service) Create(ctx context.Context, userID, courseID string) (*domain.E
 		Status:   domain.Pending,
 	}
 
-	//Haremos los get de user y course, si da error devolvemos el error
-	_, err := s.userTrans.Get(userID)
+	//Haremos los get de user y course en paralelo, si da error devolvemos el error
+	if err := s.validarUserYCourse(ctx, userID, courseID); err != nil {
+		return nil, err
+	}
+	//Le pasamo al repo el domain.Course (del domain.go) a la capa repo a la funcion Create (que recibe puntero)
+	err := s.repo.Create(ctx, enrollmentNuevo)
+	//Si ya estaba inscrito y esta activado el modo reactivate, intentamos pasar el enrollment Inactive a Pending
+	if errors.As(err, &ErrAlreadyEnrolled{}) && s.reactivate {
+		return s.reactivateEnrollment(ctx, userID, courseID, err)
+	}
+	//Si hay un error (por ejemplo al insertar, se devuelve el error y la capa endpoitn lo maneja con un status code y todo)
 	if err != nil {
 		return nil, err
 	}
+	s.log.Printf("service - enrollment created with id: %s, status: %s\n", enrollmentNuevo.ID, enrollmentNuevo.Status)
+	return enrollmentNuevo, nil
+}
+
+// validarUserYCourse busca el user y el course al mismo tiempo
+// Si uno falla porque el microservicio no responde se cancela el otro (el create va a fallar igual)
+// Un not found NO cancela el otro, asi si faltan los dos el cliente se entera de ambos en la misma respuesta
+func (s service) validarUserYCourse(ctx context.Context, userID, courseID string) error {
+	lookupCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var errUser, errCourse error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, errUser = s.users.Get(lookupCtx, userID)
+		if errUser != nil && !errors.As(errUser, &userSdk.ErrNotFound{}) {
+			cancel()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		_, errCourse = s.courses.Get(lookupCtx, courseID)
+		if errCourse != nil && !errors.As(errCourse, &courseSdk.ErrNotFound{}) {
+			cancel()
+		}
+	}()
+	wg.Wait()
+
+	var errs []error
+	for _, err := range []error{errUser, errCourse} {
+		if err == nil {
+			continue
+		}
+		//Si lo cancelamos nosotros porque fallo el otro no lo reportamos, el error que importa es el del otro
+		if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+			continue
+		}
+		errs = append(errs, err)
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return ErrLookupFailed{Errs: errs}
+	}
+}
+
+// Get devuelve el enrollment y su version (para el ETag)
+func (s service) Get(ctx context.Context, id string, expand Expand) (*domain.Enrollment, int, error) {
+	s.log.Println("Get enrollment service")
+
+	enroll, version, err := s.repo.GetVersioned(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	//Si pidieron expand, completamos el user y/o course usando los sdk (son otros microservicios)
+	//Si el user o el course ya no existen el enrollment igual existe, se devuelve sin expandir (el 404 seria del enrollment)
+	if expand.User {
+		user, err := s.users.Get(ctx, enroll.UserID)
+		if err != nil && !errors.As(err, &userSdk.ErrNotFound{}) {
+			return nil, 0, err
+		}
+		if err != nil {
+			s.log.Printf("service - user %s of enrollment %s not found, not expanded\n", enroll.UserID, enroll.ID)
+		}
+		enroll.User = user
+	}
+
+	if expand.Course {
+		course, err := s.courses.Get(ctx, enroll.CourseID)
+		if err != nil && !errors.As(err, &courseSdk.ErrNotFound{}) {
+			return nil, 0, err
+		}
+		if err != nil {
+			s.log.Printf("service - course %s of enrollment %s not found, not expanded\n", enroll.CourseID, enroll.ID)
+		}
+		enroll.Course = course
+	}
+
+	s.log.Printf("service - enrollment retrieved with id: %s\n", enroll.ID)
+	return enroll, version, nil
+}
 
-	if _, err := s.courseTrans.Get(courseID); err != nil {
+// reactivateEnrollment busca el enrollment existente del user en el curso y si esta Inactive lo vuelve a Pending
+// (o a la lista de espera si el curso esta lleno, el repo toma el cupo igual que en el Create)
+// Si no esta Inactive se devuelve el error original (ErrAlreadyEnrolled)
+func (s service) reactivateEnrollment(ctx context.Context, userID, courseID string, errDuplicado error) (*domain.Enrollment, error) {
+	existentes, err := s.repo.GetAll(ctx, Filtros{UserID: userID, CourseID: courseID}, 0, 1)
+	if err != nil {
 		return nil, err
 	}
-	//Le pasamo al repo el domain.Course (del domain.go) a la capa repo a la funcion Create (que recibe puntero)
-	err = s.repo.Create(ctx, enrollmentNuevo)
-	//Si hay un error (por ejemplo al insertar, se devuelve el error y la capa endpoitn lo maneja con un status code y todo)
+	if len(existentes) == 0 || existentes[0].Status != domain.Inactive {
+		return nil, errDuplicado
+	}
+
+	//Aqui no validamos las transitions, el modo reactivate permite explicitamente volver de Inactive a Pending
+	enroll, err := s.repo.Reactivate(ctx, existentes[0].ID)
 	if err != nil {
+		//Otro request lo reactivo primero, para este es un duplicado
+		if errors.As(err, &ErrStatusConflict{}) {
+			return nil, errDuplicado
+		}
 		return nil, err
 	}
-	s.log.Printf("service - enrollment created with id: %s\n", enrollmentNuevo.ID)
-	return enrollmentNuevo, nil
+	s.log.Printf("service - enrollment reactivated with id: %s, status: %s\n", enroll.ID, enroll.Status)
+	return enroll, nil
 }
 
 func (s service) GetAll(ctx context.Context, filtros Filtros, offset, limit int) ([]domain.Enrollment, error) {
@@ -84,17 +250,58 @@ func (s service) Count(ctx context.Context, filtros Filtros) (int, error) {
 	return s.repo.Count(ctx, filtros)
 }
 
-func (s service) Update(ctx context.Context, id string, status *string) error {
+// Update cambia el status y devuelve la nueva version del enrollment (para el ETag)
+// Si viene If-Match y la version actual no coincide devuelve ErrPreconditionFailed
+func (s service) Update(ctx context.Context, id string, status *string, ifMatch IfMatch) (int, error) {
 	s.log.Println("Update user service")
 
-	if status != nil { //validamos que no venga nill (pq viene como puntero 'status *string)
-		switch domain.EnrollStatus(*status) { //Aqui transforamos el status en domain.EnrollStatus
-		case domain.Pending, domain.Active, domain.Studying, domain.Inactive:
-		default:
-			return ErrInvalidStatus{*status}
+	if status == nil {
+		return 0, nil
+	}
+	nuevoStatus := domain.EnrollStatus(*status) //Aqui transforamos el status en domain.EnrollStatus
+	if !validStatus(nuevoStatus) {
+		return 0, ErrInvalidStatus{*status}
+	}
+
+	//Buscamos el status actual para validar que el cambio este permitido
+	enroll, version, err := s.repo.GetVersioned(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if !ifMatch.Matches(version) {
+		return 0, ErrPreconditionFailed{EnrollmentID: id, Version: version}
+	}
+	//Si ya tiene ese status no hay nada que hacer
+	if enroll.Status == nuevoStatus {
+		return version, nil
+	}
+	if !s.transitions.Allowed(enroll.Status, nuevoStatus) {
+		return 0, ErrInvalidTransition{From: enroll.Status, To: nuevoStatus}
+	}
+
+	s.log.Printf("service - updating enrollment with id: %s, status: %s -> %s\n", id, enroll.Status, nuevoStatus)
+	//Le pasamos el status y la version actual al repo para que solo actualice si nadie lo cambio entremedio
+	if err := s.repo.Update(ctx, id, enroll.Status, version, status); err != nil {
+		//Si el cliente mando If-Match, que otro lo haya cambiado entremedio es que su version ya no es la actual
+		if ifMatch.Present && errors.As(err, &ErrStatusConflict{}) {
+			_, actual, errGet := s.repo.GetVersioned(ctx, id)
+			if errGet != nil {
+				return 0, errGet
+			}
+			return 0, ErrPreconditionFailed{EnrollmentID: id, Version: actual}
 		}
+		return 0, err
 	}
-	s.log.Printf("service - updating enrollment with id: %s, status: %s\n", id, *status)
-	err := s.repo.Update(ctx, id, status)
-	return err
+	//Cada escritura sube la version en 1 y el compare-and-set asegura que partimos de version
+	return version + 1, nil
+}
+
+func (s service) Delete(ctx context.Context, id string) error {
+	s.log.Println("Delete enrollment service")
+	return s.repo.Delete(ctx, id)
+}
+
+func (s service) Restore(ctx context.Context, id string) error {
+	s.log.Println("Restore enrollment service")
+	return s.repo.Restore(ctx, id)
 }
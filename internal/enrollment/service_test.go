@@ -5,10 +5,15 @@ import (
 	"errors"
 	"io"
 	"log"
+	"net/http"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/IgnacioBO/go_lib_response/response"
+
 	courseSdk "github.com/IgnacioBO/go_micro_sdk/course"
 	userSdk "github.com/IgnacioBO/go_micro_sdk/user"
 
@@ -109,14 +114,14 @@ func TestService_Update(t *testing.T) {
 		var expectedError error = enrollment.ErrInvalidStatus{status}
 
 		repo := &mockRepository{
-			UpdateMock: func(ctx context.Context, id string, status *string) error {
+			UpdateMock: func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
 				return nil
 			},
 		}
 
 		svc := enrollment.NewService(l, nil, nil, repo)
 
-		err := svc.Update(context.Background(), "1", &status)
+		_, err := svc.Update(context.Background(), "1", &status, enrollment.IfMatch{})
 		assert.ErrorIs(t, err, expectedError, "expected error to be %v but got %v", expectedError, err)
 	})
 
@@ -126,29 +131,33 @@ func TestService_Update(t *testing.T) {
 		var expectedError error = enrollment.ErrEnrollNotFound{id}
 
 		repo := &mockRepository{
-			UpdateMock: func(ctx context.Context, id string, status *string) error {
-				return enrollment.ErrEnrollNotFound{id}
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return nil, enrollment.ErrEnrollNotFound{id}
 			},
 		}
 
 		svc := enrollment.NewService(l, nil, nil, repo)
 
-		err := svc.Update(context.Background(), "1", &status)
+		_, err := svc.Update(context.Background(), "1", &status, enrollment.IfMatch{})
 		assert.ErrorIs(t, err, expectedError, "expected error to be %v but got %v", expectedError, err)
 	})
 
 	//Aca un test que no deberia devolver error, porque el mock devuelve nil
 	t.Run("should return nil error", func(t *testing.T) {
-		wantStatus := "P"
+		wantStatus := "A"
 		wantId := "1"
 		var wantCounter int = 1
 		var counter int = 0
 
 		repo := &mockRepository{
-			UpdateMock: func(ctx context.Context, id string, status *string) error {
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return &domain.Enrollment{ID: id, Status: domain.Pending}, nil
+			},
+			UpdateMock: func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
 				counter++
 				//Validamos que los datos enviados por parametro sean los correctos
 				assert.Equal(t, wantId, id, "expected id to be '%s' but got '%s'", wantId, id)
+				assert.Equal(t, domain.Pending, currentStatus, "expected current status to be '%s' but got '%s'", domain.Pending, currentStatus)
 				assert.Equal(t, wantStatus, *status, "expected status to be '%s' but got '%s'", wantStatus, *status)
 				return nil
 			},
@@ -156,13 +165,128 @@ func TestService_Update(t *testing.T) {
 
 		svc := enrollment.NewService(l, nil, nil, repo)
 
-		status := "P"
+		status := "A"
 		id := "1"
-		err := svc.Update(context.Background(), id, &status)
+		_, err := svc.Update(context.Background(), id, &status, enrollment.IfMatch{})
 		assert.NoError(t, err, "expected no error but got %v", err)
 		assert.Equal(t, wantCounter, counter, "expected counter to be %d but got %d", wantCounter, counter)
 	})
 
+	t.Run("should not call repo update if status is the same", func(t *testing.T) {
+		repo := &mockRepository{
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return &domain.Enrollment{ID: id, Status: domain.Active}, nil
+			},
+			UpdateMock: func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
+				t.Fatal("update should not be called")
+				return nil
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repo)
+
+		status := "A"
+		_, err := svc.Update(context.Background(), "1", &status, enrollment.IfMatch{})
+		assert.NoError(t, err, "expected no error but got %v", err)
+	})
+
+	t.Run("should use custom transitions", func(t *testing.T) {
+		//Con estas transitions se permite volver de Inactive a Pending (no permitido por defecto)
+		transitions, err := enrollment.ParseTransitions("P:A,I:P")
+		assert.NoError(t, err, "expected no error but got %v", err)
+
+		repo := &mockRepository{
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return &domain.Enrollment{ID: id, Status: domain.Inactive}, nil
+			},
+			UpdateMock: func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
+				return nil
+			},
+		}
+
+		status := "P"
+		svcDefault := enrollment.NewService(l, nil, nil, repo)
+		_, err = svcDefault.Update(context.Background(), "1", &status, enrollment.IfMatch{})
+		assert.ErrorIs(t, err, enrollment.ErrInvalidTransition{From: domain.Inactive, To: domain.Pending}, "expected invalid transition error but got %v", err)
+
+		svc := enrollment.NewService(l, nil, nil, repo, enrollment.WithTransitions(transitions))
+		_, err = svc.Update(context.Background(), "1", &status, enrollment.IfMatch{})
+		assert.NoError(t, err, "expected no error but got %v", err)
+	})
+
+	t.Run("should return precondition failed if the version does not match", func(t *testing.T) {
+		repo := &mockRepository{
+			GetVersionedMock: func(ctx context.Context, id string) (*domain.Enrollment, int, error) {
+				return &domain.Enrollment{ID: id, Status: domain.Pending}, 3, nil
+			},
+			UpdateMock: func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
+				t.Fatal("update should not be called")
+				return nil
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repo)
+
+		status := "A"
+		_, err := svc.Update(context.Background(), "1", &status, enrollment.ParseIfMatch(`"2"`))
+		assert.ErrorIs(t, err, enrollment.ErrPreconditionFailed{EnrollmentID: "1", Version: 3})
+	})
+
+	t.Run("should update with the matching version and return the next one", func(t *testing.T) {
+		repo := &mockRepository{
+			GetVersionedMock: func(ctx context.Context, id string) (*domain.Enrollment, int, error) {
+				return &domain.Enrollment{ID: id, Status: domain.Pending}, 3, nil
+			},
+			UpdateMock: func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
+				//El compare-and-set se hace con la version leida
+				assert.Equal(t, 3, version)
+				return nil
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repo)
+
+		status := "A"
+		version, err := svc.Update(context.Background(), "1", &status, enrollment.ParseIfMatch(`"3"`))
+		assert.NoError(t, err)
+		assert.Equal(t, 4, version)
+	})
+
+	t.Run("should return precondition failed if someone else updated it in between", func(t *testing.T) {
+		lecturas := 0
+		repo := &mockRepository{
+			GetVersionedMock: func(ctx context.Context, id string) (*domain.Enrollment, int, error) {
+				lecturas++
+				return &domain.Enrollment{ID: id, Status: domain.Pending}, 2 + lecturas, nil
+			},
+			UpdateMock: func(ctx context.Context, id string, currentStatus domain.EnrollStatus, version int, status *string) error {
+				return enrollment.ErrStatusConflict{EnrollmentID: id, Status: currentStatus}
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repo)
+
+		status := "A"
+		_, err := svc.Update(context.Background(), "1", &status, enrollment.ParseIfMatch(`"3"`))
+		assert.ErrorIs(t, err, enrollment.ErrPreconditionFailed{EnrollmentID: "1", Version: 4})
+
+		//Sin If-Match sigue siendo un 409 como antes
+		_, err = svc.Update(context.Background(), "1", &status, enrollment.IfMatch{})
+		assert.ErrorAs(t, err, &enrollment.ErrStatusConflict{})
+	})
+
+}
+
+func TestParseIfMatch(t *testing.T) {
+	assert.False(t, enrollment.ParseIfMatch("").Present)
+	assert.True(t, enrollment.ParseIfMatch("").Matches(7))
+	assert.True(t, enrollment.ParseIfMatch("*").Matches(7))
+	assert.True(t, enrollment.ParseIfMatch(`"6", "7"`).Matches(7))
+	assert.False(t, enrollment.ParseIfMatch(`"6"`).Matches(7))
+	//If-Match compara en forma fuerte, un ETag debil nunca coincide
+	assert.False(t, enrollment.ParseIfMatch(`W/"7"`).Matches(7))
+	assert.False(t, enrollment.ParseIfMatch(`7`).Matches(7))
+	assert.Equal(t, `"7"`, enrollment.ETag(7))
 }
 
 func TestService_Count(t *testing.T) {
@@ -215,12 +339,12 @@ func TestService_Create(t *testing.T) {
 		//Aca podemos crear un erro de cero o en este caso usamos un error de un sdk que ya tenemos
 		var wantError error = userSdk.ErrNotFound{Message: "User not found"}
 
-		var wantCounter int = 1
-		var counter int = 0
+		var wantCounter int32 = 1
+		var counter int32 = 0 //int32 + atomic porque el user y el course se buscan en paralelo
 
 		userSdk := &UserSdkMock{
 			GetMock: func(id string) (*domain.User, error) {
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return nil, userSdk.ErrNotFound{Message: "User not found"}
 			},
 		}
@@ -228,12 +352,19 @@ func TestService_Create(t *testing.T) {
 		//Realmente no es necesario el mock de repository, porque por flujo no se va a llamar al repo si el user no se encuentra
 		repo := &mockRepository{
 			CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return nil
 			},
 		}
 
-		svc := enrollment.NewService(l, userSdk, nil, repo)
+		//El course se busca al mismo tiempo que el user, asi que tambien hay que mockearlo
+		courseSdk := &CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return &domain.Course{}, nil
+			},
+		}
+
+		svc := enrollment.NewService(l, userSdk, courseSdk, repo)
 
 		userid := "1"
 		courseid := "5"
@@ -248,18 +379,18 @@ func TestService_Create(t *testing.T) {
 	t.Run("should return course not found error", func(t *testing.T) {
 		var wantError error = courseSdk.ErrNotFound{Message: "Course not found"}
 
-		var wantCounter int = 2
-		var counter int = 0
+		var wantCounter int32 = 2
+		var counter int32 = 0 //int32 + atomic porque el user y el course se buscan en paralelo
 		userSdk := &UserSdkMock{
 			GetMock: func(id string) (*domain.User, error) {
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return &domain.User{}, nil
 			},
 		}
 
 		courseSdk := &CourseSdkMock{
 			GetMock: func(id string) (*domain.Course, error) {
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return nil, courseSdk.ErrNotFound{Message: "Course not found"}
 			},
 		}
@@ -279,26 +410,26 @@ func TestService_Create(t *testing.T) {
 	t.Run("should return repo error", func(t *testing.T) {
 		var wantError error = errors.New("repo error")
 
-		var wantCounter int = 3
-		var counter int = 0
+		var wantCounter int32 = 3
+		var counter int32 = 0 //int32 + atomic porque el user y el course se buscan en paralelo
 
 		userSdk := &UserSdkMock{
 			GetMock: func(id string) (*domain.User, error) {
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return &domain.User{}, nil
 			},
 		}
 
 		courseSdk := &CourseSdkMock{
 			GetMock: func(id string) (*domain.Course, error) {
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return &domain.Course{}, nil
 			},
 		}
 
 		repo := &mockRepository{
 			CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return errors.New("repo error")
 			},
 		}
@@ -329,14 +460,14 @@ func TestService_Create(t *testing.T) {
 			Status:   wantStatus,
 		}
 
-		var wantCounter int = 3
-		var counter int = 0
+		var wantCounter int32 = 3
+		var counter int32 = 0 //int32 + atomic porque el user y el course se buscan en paralelo
 
 		//Aqui para variar usaremos el mock desde userSdk y courseSdk en vez de lso creados en este proyecto
 		userSdk := &userSdkMock.UserSdkMock{
 			GetMock: func(id string) (*domain.User, error) {
 				assert.Equal(t, wantUserId, id, "expected user ID to be '%s' but got '%s'", wantUserId, id)
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return &domain.User{}, nil
 			},
 		}
@@ -344,7 +475,7 @@ func TestService_Create(t *testing.T) {
 		courseSdk := &courseSdkMock.CourseSdkMock{
 			GetMock: func(id string) (*domain.Course, error) {
 				assert.Equal(t, wantCourseId, id, "expected course ID to be '%s' but got '%s'", wantCourseId, id)
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return &domain.Course{}, nil
 			},
 		}
@@ -352,7 +483,7 @@ func TestService_Create(t *testing.T) {
 		repo := &mockRepository{
 			CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
 				e.ID = "123" // Simulamos que el repo asigna un ID al enrollment
-				counter++
+				atomic.AddInt32(&counter, 1)
 				return nil
 			},
 		}
@@ -373,3 +504,319 @@ func TestService_Create(t *testing.T) {
 		assert.Equal(t, wantEnrollments, enrollments, "expected enrollment to be %v but got %v", wantEnrollments, enrollments)
 	})
 }
+
+func TestService_Get(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should return not found error", func(t *testing.T) {
+		id := "1"
+		var wantError error = enrollment.ErrEnrollNotFound{id}
+
+		repo := &mockRepository{
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return nil, enrollment.ErrEnrollNotFound{id}
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repo)
+		enroll, _, err := svc.Get(context.Background(), id, enrollment.Expand{})
+
+		assert.ErrorIs(t, err, wantError, "expected error to be %v but got %v", wantError, err)
+		assert.Nil(t, enroll, "expected enrollment to be nil but got a value")
+	})
+
+	t.Run("should return enrollment without expand", func(t *testing.T) {
+		wantEnrollment := &domain.Enrollment{ID: "1", UserID: "user1", CourseID: "course1", Status: domain.Pending}
+
+		repo := &mockRepository{
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return &domain.Enrollment{ID: "1", UserID: "user1", CourseID: "course1", Status: domain.Pending}, nil
+			},
+		}
+
+		//Le pasamos los sdk en nil, si se llamaran el test fallaria
+		svc := enrollment.NewService(l, nil, nil, repo)
+		enroll, _, err := svc.Get(context.Background(), "1", enrollment.Expand{})
+
+		assert.NoError(t, err, "expected no error but got %v", err)
+		assert.Equal(t, wantEnrollment, enroll, "expected enrollment to be %v but got %v", wantEnrollment, enroll)
+	})
+
+	t.Run("should return enrollment with user and course expanded", func(t *testing.T) {
+		wantUser := &domain.User{ID: "user1", FirstName: "Nacho"}
+		wantCourse := &domain.Course{ID: "course1", Name: "Go"}
+
+		repo := &mockRepository{
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return &domain.Enrollment{ID: "1", UserID: "user1", CourseID: "course1", Status: domain.Pending}, nil
+			},
+		}
+		userSdk := &userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				assert.Equal(t, "user1", id, "expected user ID to be '%s' but got '%s'", "user1", id)
+				return &domain.User{ID: "user1", FirstName: "Nacho"}, nil
+			},
+		}
+		courseSdk := &courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				assert.Equal(t, "course1", id, "expected course ID to be '%s' but got '%s'", "course1", id)
+				return &domain.Course{ID: "course1", Name: "Go"}, nil
+			},
+		}
+
+		svc := enrollment.NewService(l, userSdk, courseSdk, repo)
+		enroll, _, err := svc.Get(context.Background(), "1", enrollment.Expand{User: true, Course: true})
+
+		assert.NoError(t, err, "expected no error but got %v", err)
+		assert.Equal(t, wantUser, enroll.User, "expected user to be %v but got %v", wantUser, enroll.User)
+		assert.Equal(t, wantCourse, enroll.Course, "expected course to be %v but got %v", wantCourse, enroll.Course)
+	})
+
+	t.Run("should return the enrollment without the user or course that no longer exist", func(t *testing.T) {
+		repo := &mockRepository{
+			GetMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				return &domain.Enrollment{ID: "1", UserID: "user1", CourseID: "course1", Status: domain.Pending}, nil
+			},
+		}
+		users := &userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				return nil, userSdk.ErrNotFound{Message: "user not found"}
+			},
+		}
+		courses := &courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return nil, courseSdk.ErrNotFound{Message: "course not found"}
+			},
+		}
+
+		svc := enrollment.NewService(l, users, courses, repo)
+		enroll, _, err := svc.Get(context.Background(), "1", enrollment.Expand{User: true, Course: true})
+
+		assert.NoError(t, err, "should not turn the missing user or course into a not found of the enrollment")
+		if assert.NotNil(t, enroll) {
+			assert.Equal(t, "1", enroll.ID)
+			assert.Nil(t, enroll.User)
+			assert.Nil(t, enroll.Course)
+		}
+	})
+}
+
+func TestParseTransitions(t *testing.T) {
+
+	t.Run("should parse transitions", func(t *testing.T) {
+		want := enrollment.Transitions{
+			domain.Pending: {domain.Active},
+			domain.Active:  {domain.Studying, domain.Inactive},
+		}
+
+		transitions, err := enrollment.ParseTransitions("P:A, A:S,A:I")
+		assert.NoError(t, err, "expected no error but got %v", err)
+		assert.Equal(t, want, transitions, "expected transitions to be %v but got %v", want, transitions)
+	})
+
+	t.Run("should return error on bad format", func(t *testing.T) {
+		_, err := enrollment.ParseTransitions("P-A")
+		assert.Error(t, err, "expected an error but got nil")
+	})
+
+	t.Run("should return error on unknown status", func(t *testing.T) {
+		_, err := enrollment.ParseTransitions("P:X")
+		assert.ErrorIs(t, err, enrollment.ErrInvalidStatus{Status: "X"}, "expected invalid status error but got %v", err)
+	})
+}
+
+func TestService_CreateDuplicated(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	userSdk := &userSdkMock.UserSdkMock{
+		GetMock: func(id string) (*domain.User, error) {
+			return &domain.User{}, nil
+		},
+	}
+	courseSdk := &courseSdkMock.CourseSdkMock{
+		GetMock: func(id string) (*domain.Course, error) {
+			return &domain.Course{}, nil
+		},
+	}
+
+	t.Run("should return already enrolled error", func(t *testing.T) {
+		var wantError error = enrollment.ErrAlreadyEnrolled{UserID: "user1", CourseID: "course1"}
+
+		repo := &mockRepository{
+			CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
+				return enrollment.ErrAlreadyEnrolled{UserID: e.UserID, CourseID: e.CourseID}
+			},
+		}
+
+		svc := enrollment.NewService(l, userSdk, courseSdk, repo)
+		enroll, err := svc.Create(context.Background(), "user1", "course1")
+
+		assert.ErrorIs(t, err, wantError, "expected error to be %v but got %v", wantError, err)
+		assert.Nil(t, enroll, "expected enrollment to be nil but got a value")
+	})
+
+	t.Run("should reactivate inactive enrollment", func(t *testing.T) {
+		var counter int = 0
+
+		repo := &mockRepository{
+			CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
+				return enrollment.ErrAlreadyEnrolled{UserID: e.UserID, CourseID: e.CourseID}
+			},
+			GetAllMock: func(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error) {
+				assert.Equal(t, enrollment.Filtros{UserID: "user1", CourseID: "course1"}, filtros, "expected filters to be user1 and course1 but got %v", filtros)
+				return []domain.Enrollment{{ID: "123", UserID: "user1", CourseID: "course1", Status: domain.Inactive}}, nil
+			},
+			ReactivateMock: func(ctx context.Context, id string) (*domain.Enrollment, error) {
+				counter++
+				assert.Equal(t, "123", id)
+				return &domain.Enrollment{ID: id, UserID: "user1", CourseID: "course1", Status: domain.Pending}, nil
+			},
+		}
+
+		svc := enrollment.NewService(l, userSdk, courseSdk, repo, enrollment.WithReactivate(true))
+		enroll, err := svc.Create(context.Background(), "user1", "course1")
+
+		assert.NoError(t, err, "expected no error but got %v", err)
+		assert.Equal(t, 1, counter, "expected counter to be %d but got %d", 1, counter)
+		assert.Equal(t, "123", enroll.ID, "expected enrollment ID to be '%s' but got '%s'", "123", enroll.ID)
+		assert.Equal(t, domain.Pending, enroll.Status, "expected enrollment Status to be '%s' but got '%s'", domain.Pending, enroll.Status)
+	})
+
+	t.Run("should not reactivate enrollment that is not inactive", func(t *testing.T) {
+		var wantError error = enrollment.ErrAlreadyEnrolled{UserID: "user1", CourseID: "course1"}
+
+		repo := &mockRepository{
+			CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
+				return enrollment.ErrAlreadyEnrolled{UserID: e.UserID, CourseID: e.CourseID}
+			},
+			GetAllMock: func(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error) {
+				return []domain.Enrollment{{ID: "123", UserID: "user1", CourseID: "course1", Status: domain.Active}}, nil
+			},
+		}
+
+		svc := enrollment.NewService(l, userSdk, courseSdk, repo, enrollment.WithReactivate(true))
+		enroll, err := svc.Create(context.Background(), "user1", "course1")
+
+		assert.ErrorIs(t, err, wantError, "expected error to be %v but got %v", wantError, err)
+		assert.Nil(t, enroll, "expected enrollment to be nil but got a value")
+	})
+}
+
+func TestService_Delete(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should return error from repo", func(t *testing.T) {
+		var wantError error = enrollment.ErrEnrollNotFound{"1"}
+
+		repo := &mockRepository{
+			DeleteMock: func(ctx context.Context, id string) error {
+				return enrollment.ErrEnrollNotFound{id}
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repo)
+		err := svc.Delete(context.Background(), "1")
+		assert.ErrorIs(t, err, wantError, "expected error to be %v but got %v", wantError, err)
+	})
+
+	t.Run("should restore enrollment", func(t *testing.T) {
+		var counter int = 0
+
+		repo := &mockRepository{
+			RestoreMock: func(ctx context.Context, id string) error {
+				counter++
+				assert.Equal(t, "1", id, "expected id to be '%s' but got '%s'", "1", id)
+				return nil
+			},
+		}
+
+		svc := enrollment.NewService(l, nil, nil, repo)
+		err := svc.Restore(context.Background(), "1")
+		assert.NoError(t, err, "expected no error but got %v", err)
+		assert.Equal(t, 1, counter, "expected counter to be %d but got %d", 1, counter)
+	})
+}
+
+func TestService_CreateConcurrentLookup(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should return both errors when user and course are missing", func(t *testing.T) {
+		user := &UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				return nil, userSdk.ErrNotFound{Message: "User not found"}
+			},
+		}
+		course := &CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return nil, courseSdk.ErrNotFound{Message: "Course not found"}
+			},
+		}
+
+		svc := enrollment.NewService(l, user, course, nil)
+		enroll, err := svc.Create(context.Background(), "1", "5")
+
+		assert.Nil(t, enroll)
+		assert.ErrorAs(t, err, &enrollment.ErrLookupFailed{})
+		assert.ErrorIs(t, err, userSdk.ErrNotFound{Message: "User not found"})
+		assert.ErrorIs(t, err, courseSdk.ErrNotFound{Message: "Course not found"})
+		assert.EqualError(t, err, "User not found; Course not found")
+
+		//El endpoint responde 404 con los dos mensajes
+		endpoints := enrollment.MakeEndpoints(svc, enrollment.Config{})
+		_, err = endpoints.Create(context.Background(), enrollment.CreateRequest{UserID: "1", CourseID: "5"})
+		assert.Equal(t, http.StatusNotFound, err.(response.Response).StatusCode())
+		assert.EqualError(t, err, "User not found; Course not found")
+	})
+
+	t.Run("should cancel the course lookup when the user service fails", func(t *testing.T) {
+		user := &UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				return nil, errors.New("connection refused")
+			},
+		}
+		course := &CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				time.Sleep(time.Second)
+				return &domain.Course{}, nil
+			},
+		}
+
+		svc := enrollment.NewService(l, user, course, nil, enrollment.WithUpstreamConfig(enrollment.UpstreamConfig{Timeout: 5 * time.Second}))
+		inicio := time.Now()
+		_, err := svc.Create(context.Background(), "1", "5")
+
+		//Solo se reporta el error del user, el course cancelado no es un error para el cliente
+		var upstreamErr enrollment.ErrUpstreamUnavailable
+		assert.ErrorAs(t, err, &upstreamErr)
+		assert.Equal(t, "user", upstreamErr.Service)
+		assert.NotErrorIs(t, err, context.Canceled)
+		assert.Less(t, time.Since(inicio), 500*time.Millisecond)
+	})
+
+	t.Run("should look up user and course at the same time", func(t *testing.T) {
+		user := &UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				time.Sleep(100 * time.Millisecond)
+				return &domain.User{}, nil
+			},
+		}
+		course := &CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				time.Sleep(100 * time.Millisecond)
+				return &domain.Course{}, nil
+			},
+		}
+		repo := &mockRepository{
+			CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
+				return nil
+			},
+		}
+
+		svc := enrollment.NewService(l, user, course, repo)
+		inicio := time.Now()
+		_, err := svc.Create(context.Background(), "1", "5")
+
+		assert.NoError(t, err)
+		assert.Less(t, time.Since(inicio), 180*time.Millisecond)
+	})
+}
@@ -0,0 +1,71 @@
+package enrollment
+
+import (
+	"strings"
+)
+
+// SortField es una columna del orden del listado, Desc es cuando viene con "-" adelante (ej: -updated_at)
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// columnasOrdenables es la whitelist de columnas por las que se puede ordenar
+// El nombre que manda el cliente va directo al ORDER BY, asi que nunca se puede aceptar algo fuera de esta lista
+var columnasOrdenables = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"status":     true,
+	"user_id":    true,
+	"course_id":  true,
+	"id":         true,
+}
+
+// DefaultSort es el orden de siempre: los mas nuevos primero
+var DefaultSort = []SortField{{Column: "created_at", Desc: true}}
+
+// ParseSort lee el parametro sort, ej: "-updated_at,status"
+func ParseSort(valor string) ([]SortField, error) {
+	var orden []SortField
+	vistas := make(map[string]bool)
+	for _, campo := range dividirLista(valor) {
+		desc := strings.HasPrefix(campo, "-")
+		columna := strings.TrimPrefix(campo, "-")
+		if !columnasOrdenables[columna] || vistas[columna] {
+			return nil, ErrInvalidSort{Field: campo}
+		}
+		vistas[columna] = true
+		orden = append(orden, SortField{Column: columna, Desc: desc})
+	}
+	return orden, nil
+}
+
+// ordenCompleto agrega el desempate por id (en la misma direccion que la ultima columna) para que el orden sea estable
+// Sin orden usa DefaultSort
+func ordenCompleto(orden []SortField) []SortField {
+	if len(orden) == 0 {
+		orden = DefaultSort
+	}
+	completo := make([]SortField, 0, len(orden)+1)
+	for _, campo := range orden {
+		completo = append(completo, campo)
+		if campo.Column == "id" {
+			//Despues del id no hace falta nada mas, es unico
+			return completo
+		}
+	}
+	return append(completo, SortField{Column: "id", Desc: orden[len(orden)-1].Desc})
+}
+
+// sortString es el orden completo en el formato del parametro, se guarda en el cursor para validar que la siguiente pagina use el mismo orden
+func sortString(orden []SortField) string {
+	campos := make([]string, 0, len(orden))
+	for _, campo := range ordenCompleto(orden) {
+		if campo.Desc {
+			campos = append(campos, "-"+campo.Column)
+		} else {
+			campos = append(campos, campo.Column)
+		}
+	}
+	return strings.Join(campos, ",")
+}
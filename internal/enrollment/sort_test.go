@@ -0,0 +1,91 @@
+package enrollment_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+func TestParseSort(t *testing.T) {
+	t.Run("should parse columns and directions", func(t *testing.T) {
+		orden, err := enrollment.ParseSort("-updated_at, status")
+		assert.NoError(t, err)
+		assert.Equal(t, []enrollment.SortField{
+			{Column: "updated_at", Desc: true},
+			{Column: "status", Desc: false},
+		}, orden)
+	})
+
+	t.Run("should return nil on empty sort", func(t *testing.T) {
+		orden, err := enrollment.ParseSort("")
+		assert.NoError(t, err)
+		assert.Nil(t, orden)
+	})
+
+	t.Run("should reject columns outside the whitelist", func(t *testing.T) {
+		for _, valor := range []string{"name", "status;drop table enrollments", "-deleted_at", "status,-status", "--status"} {
+			_, err := enrollment.ParseSort(valor)
+			assert.ErrorAs(t, err, &enrollment.ErrInvalidSort{}, valor)
+		}
+	})
+}
+
+func TestEndpoint_GetAllSort(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should pass the sort to getall", func(t *testing.T) {
+		repo := &mockRepository{
+			CountMock: func(ctx context.Context, filtros enrollment.Filtros) (int, error) {
+				return 0, nil
+			},
+			GetAllMock: func(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error) {
+				assert.Equal(t, []enrollment.SortField{{Column: "updated_at", Desc: true}, {Column: "status"}}, filtros.Sort)
+				return []domain.Enrollment{}, nil
+			},
+		}
+		svc := enrollment.NewService(l, nil, nil, repo)
+		endpoints := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+
+		_, err := endpoints.GetAll(context.Background(), enrollment.GetAllRequest{Sort: "-updated_at,status"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("should return 400 on invalid sort", func(t *testing.T) {
+		svc := enrollment.NewService(l, nil, nil, &mockRepository{})
+		endpoints := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+
+		_, err := endpoints.GetAll(context.Background(), enrollment.GetAllRequest{Sort: "password"})
+		assert.EqualError(t, err, enrollment.ErrInvalidSort{Field: "password"}.Error())
+		assert.Equal(t, http.StatusBadRequest, err.(response.Response).StatusCode())
+	})
+
+	t.Run("should return 400 when the cursor was built with another sort", func(t *testing.T) {
+		svc := enrollment.NewService(l, nil, nil, &mockRepository{})
+		endpoints := enrollment.MakeEndpoints(svc, enrollment.Config{LimitPageDefault: "10"})
+
+		porStatus, _ := enrollment.ParseSort("status")
+		cursor := enrollment.EncodeCursor(domain.Enrollment{ID: "1", Status: domain.Active}, porStatus)
+
+		_, err := endpoints.GetAll(context.Background(), enrollment.GetAllRequest{Sort: "-updated_at", Cursor: cursor})
+		assert.Equal(t, http.StatusBadRequest, err.(response.Response).StatusCode())
+
+		//Con el mismo sort el cursor sirve
+		repo := &mockRepository{
+			GetAllMock: func(ctx context.Context, filtros enrollment.Filtros, offset, limit int) ([]domain.Enrollment, error) {
+				assert.Equal(t, "A", filtros.Cursor.Status)
+				return []domain.Enrollment{}, nil
+			},
+		}
+		endpoints = enrollment.MakeEndpoints(enrollment.NewService(l, nil, nil, repo), enrollment.Config{LimitPageDefault: "10"})
+		_, err = endpoints.GetAll(context.Background(), enrollment.GetAllRequest{Sort: "status", Cursor: cursor, SkipCount: true})
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,172 @@
+package enrollment
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StreamConfig define cuantos eventos se guardan para retomar con Last-Event-ID y cada cuanto se manda el heartbeat
+// SubscriberBuffer son los eventos que puede tener pendientes un cliente lento antes de que se le corte la conexion
+type StreamConfig struct {
+	BufferSize        int
+	HeartbeatInterval time.Duration
+	SubscriberBuffer  int
+}
+
+var DefaultStreamConfig = StreamConfig{
+	BufferSize:        1000,
+	HeartbeatInterval: 15 * time.Second,
+	SubscriberBuffer:  100,
+}
+
+// StreamEvent es un evento con el id que se manda en el stream (el que el cliente devuelve en Last-Event-ID)
+type StreamEvent struct {
+	ID    uint64
+	Event Event
+}
+
+// StreamFilter filtra los eventos del stream por curso y por usuario (vacio es todos)
+type StreamFilter struct {
+	CourseIDs []string
+	UserIDs   []string
+}
+
+// NewStreamFilter arma el filtro desde los query params course_id y user_id (aceptan varios separados por coma)
+func NewStreamFilter(courseID, userID string) StreamFilter {
+	return StreamFilter{CourseIDs: dividirLista(courseID), UserIDs: dividirLista(userID)}
+}
+
+func (f StreamFilter) matches(evento Event) bool {
+	if len(f.CourseIDs) > 0 && !contiene(f.CourseIDs, evento.CourseID) {
+		return false
+	}
+	if len(f.UserIDs) > 0 && !contiene(f.UserIDs, evento.UserID) {
+		return false
+	}
+	return true
+}
+
+// StreamBroker es el Publisher del stream de enrollments (SSE): guarda los ultimos eventos en un buffer acotado
+// y se los pasa a los clientes conectados. Lo alimenta el relay de la outbox, asi que con varias replicas
+// cada una solo ve los eventos que publico su propio relay
+type StreamBroker struct {
+	cfg StreamConfig
+
+	mu           sync.Mutex
+	ultimoID     uint64
+	buffer       []StreamEvent
+	suscriptores map[*StreamSubscription]struct{}
+}
+
+// NewStreamBroker parte los ids desde la hora actual (en microsegundos), asi despues de un reinicio los ids siguen
+// subiendo y un Last-Event-ID de antes del reinicio se detecta como fuera del buffer
+func NewStreamBroker(cfg StreamConfig) *StreamBroker {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultStreamConfig.BufferSize
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = DefaultStreamConfig.HeartbeatInterval
+	}
+	if cfg.SubscriberBuffer <= 0 {
+		cfg.SubscriberBuffer = DefaultStreamConfig.SubscriberBuffer
+	}
+	return &StreamBroker{
+		cfg:          cfg,
+		ultimoID:     uint64(time.Now().UnixMicro()),
+		suscriptores: make(map[*StreamSubscription]struct{}),
+	}
+}
+
+// HeartbeatInterval es cada cuanto el handler manda un comentario para que los proxies no corten la conexion
+func (b *StreamBroker) HeartbeatInterval() time.Duration {
+	return b.cfg.HeartbeatInterval
+}
+
+func (b *StreamBroker) Publish(ctx context.Context, evento Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.ultimoID++
+	se := StreamEvent{ID: b.ultimoID, Event: evento}
+	b.buffer = append(b.buffer, se)
+	if len(b.buffer) > b.cfg.BufferSize {
+		b.buffer = append([]StreamEvent(nil), b.buffer[len(b.buffer)-b.cfg.BufferSize:]...)
+	}
+
+	for sub := range b.suscriptores {
+		if !sub.filtro.matches(evento) {
+			continue
+		}
+		select {
+		case sub.ch <- se:
+		default:
+			//Cliente lento: se le corta el stream y al reconectar retoma desde el buffer con Last-Event-ID
+			b.cerrar(sub)
+		}
+	}
+	return nil
+}
+
+// Subscribe registra al cliente y devuelve, en la misma operacion, los eventos del buffer que vienen despues de lastEventID
+// (asi no se pierde nada entre el replay y los eventos nuevos). Sin lastEventID no hay replay
+// reset es true cuando lastEventID ya no esta en el buffer (o no es valido): el cliente perdio eventos y debe recargar
+func (b *StreamBroker) Subscribe(filtro StreamFilter, lastEventID string) (sub *StreamSubscription, replay []StreamEvent, reset bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastEventID != "" {
+		desde, err := strconv.ParseUint(lastEventID, 10, 64)
+		switch {
+		case err != nil, desde > b.ultimoID:
+			reset = true
+		case len(b.buffer) > 0 && desde < b.buffer[0].ID-1:
+			//Los eventos entre desde y el primero del buffer ya se descartaron
+			reset = true
+		}
+		if reset {
+			desde = 0
+		}
+		for _, se := range b.buffer {
+			if se.ID > desde && filtro.matches(se.Event) {
+				replay = append(replay, se)
+			}
+		}
+	}
+
+	sub = &StreamSubscription{
+		broker: b,
+		filtro: filtro,
+		ch:     make(chan StreamEvent, b.cfg.SubscriberBuffer),
+	}
+	b.suscriptores[sub] = struct{}{}
+	return sub, replay, reset
+}
+
+// cerrar saca al suscriptor y cierra su canal, se llama con el mutex tomado
+func (b *StreamBroker) cerrar(sub *StreamSubscription) {
+	if _, ok := b.suscriptores[sub]; ok {
+		delete(b.suscriptores, sub)
+		close(sub.ch)
+	}
+}
+
+// StreamSubscription es un cliente conectado al stream
+type StreamSubscription struct {
+	broker *StreamBroker
+	filtro StreamFilter
+	ch     chan StreamEvent
+}
+
+// Events entrega los eventos nuevos, se cierra si el broker corta al cliente por lento
+func (s *StreamSubscription) Events() <-chan StreamEvent {
+	return s.ch
+}
+
+// Close desuscribe al cliente (se puede llamar mas de una vez)
+func (s *StreamSubscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.cerrar(s)
+}
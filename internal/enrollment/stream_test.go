@@ -0,0 +1,103 @@
+package enrollment_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+func TestStreamBroker(t *testing.T) {
+	ctx := context.Background()
+	evento := func(id, courseID, userID string) enrollment.Event {
+		return enrollment.Event{ID: id, Type: enrollment.EventEnrollmentCreated, CourseID: courseID, UserID: userID}
+	}
+	ids := func(eventos []enrollment.StreamEvent) []string {
+		var lista []string
+		for _, se := range eventos {
+			lista = append(lista, se.Event.ID)
+		}
+		return lista
+	}
+
+	t.Run("should send the new events that match the filter", func(t *testing.T) {
+		broker := enrollment.NewStreamBroker(enrollment.StreamConfig{})
+		sub, replay, reset := broker.Subscribe(enrollment.NewStreamFilter("c1, c2", "u1"), "")
+		defer sub.Close()
+		assert.Empty(t, replay, "should not replay without Last-Event-ID")
+		assert.False(t, reset)
+
+		assert.NoError(t, broker.Publish(ctx, evento("ev1", "c1", "u1")))
+		assert.NoError(t, broker.Publish(ctx, evento("ev2", "c3", "u1")))
+		assert.NoError(t, broker.Publish(ctx, evento("ev3", "c2", "u2")))
+		assert.NoError(t, broker.Publish(ctx, evento("ev4", "c2", "u1")))
+
+		primero := <-sub.Events()
+		segundo := <-sub.Events()
+		assert.Equal(t, "ev1", primero.Event.ID)
+		assert.Equal(t, "ev4", segundo.Event.ID)
+		assert.Greater(t, segundo.ID, primero.ID, "should use increasing ids")
+		assert.Empty(t, sub.Events())
+	})
+
+	t.Run("should resume after the Last-Event-ID", func(t *testing.T) {
+		broker := enrollment.NewStreamBroker(enrollment.StreamConfig{})
+		sub, _, _ := broker.Subscribe(enrollment.StreamFilter{}, "")
+		for _, id := range []string{"ev1", "ev2", "ev3"} {
+			assert.NoError(t, broker.Publish(ctx, evento(id, "c1", "u1")))
+		}
+		primero := <-sub.Events()
+		sub.Close()
+		sub.Close()
+
+		sub, replay, reset := broker.Subscribe(enrollment.StreamFilter{}, strconv.FormatUint(primero.ID, 10))
+		defer sub.Close()
+		assert.False(t, reset)
+		assert.Equal(t, []string{"ev2", "ev3"}, ids(replay))
+	})
+
+	t.Run("should ask for a reset when the Last-Event-ID is no longer in the buffer", func(t *testing.T) {
+		broker := enrollment.NewStreamBroker(enrollment.StreamConfig{BufferSize: 2})
+		sub, _, _ := broker.Subscribe(enrollment.StreamFilter{}, "")
+		for _, id := range []string{"ev1", "ev2", "ev3"} {
+			assert.NoError(t, broker.Publish(ctx, evento(id, "c1", "u1")))
+		}
+		primero := <-sub.Events()
+		sub.Close()
+
+		sub, replay, reset := broker.Subscribe(enrollment.StreamFilter{}, strconv.FormatUint(primero.ID-1, 10))
+		sub.Close()
+		assert.True(t, reset)
+		assert.Equal(t, []string{"ev2", "ev3"}, ids(replay), "should replay the whole buffer")
+
+		//El evento siguiente al ultimo descartado todavia se puede retomar
+		sub, replay, reset = broker.Subscribe(enrollment.StreamFilter{}, strconv.FormatUint(primero.ID, 10))
+		sub.Close()
+		assert.False(t, reset)
+		assert.Equal(t, []string{"ev2", "ev3"}, ids(replay))
+
+		for _, lastID := range []string{"abc", strconv.FormatUint(primero.ID+100, 10)} {
+			sub, _, reset = broker.Subscribe(enrollment.StreamFilter{}, lastID)
+			sub.Close()
+			assert.True(t, reset, "should reset with %s", lastID)
+		}
+	})
+
+	t.Run("should drop a slow subscriber", func(t *testing.T) {
+		broker := enrollment.NewStreamBroker(enrollment.StreamConfig{SubscriberBuffer: 1})
+		sub, _, _ := broker.Subscribe(enrollment.StreamFilter{}, "")
+		defer sub.Close()
+
+		assert.NoError(t, broker.Publish(ctx, evento("ev1", "c1", "u1")))
+		assert.NoError(t, broker.Publish(ctx, evento("ev2", "c1", "u1")))
+
+		se, ok := <-sub.Events()
+		assert.True(t, ok)
+		assert.Equal(t, "ev1", se.Event.ID)
+		_, ok = <-sub.Events()
+		assert.False(t, ok, "should close the channel")
+	})
+}
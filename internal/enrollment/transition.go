@@ -0,0 +1,61 @@
+package enrollment
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+)
+
+// Transitions es el grafo de cambios de status permitidos: desde un status (key) a cuales se puede pasar (value)
+type Transitions map[domain.EnrollStatus][]domain.EnrollStatus
+
+// DefaultTransitions es el flujo normal de un enrollment: Pending -> Active -> Studying -> Inactive (y Active -> Inactive si abandona antes)
+// De Waitlisted solo se puede salir de la lista (Inactive), el paso a Pending lo hace el repo al liberarse un cupo
+var DefaultTransitions = Transitions{
+	domain.Pending:  {domain.Active},
+	domain.Active:   {domain.Studying, domain.Inactive},
+	domain.Studying: {domain.Inactive},
+	Waitlisted:      {domain.Inactive},
+}
+
+// Allowed dice si se puede pasar del status from al status to
+func (t Transitions) Allowed(from, to domain.EnrollStatus) bool {
+	for _, s := range t[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTransitions arma las Transitions desde un string tipo "P:A,A:S,S:I,A:I" (para poder sobreescribirlas por variable de entorno en cada deploy)
+func ParseTransitions(value string) (Transitions, error) {
+	t := Transitions{}
+	for _, par := range strings.Split(value, ",") {
+		par = strings.TrimSpace(par)
+		if par == "" {
+			continue
+		}
+		desdeHasta := strings.Split(par, ":")
+		if len(desdeHasta) != 2 {
+			return nil, fmt.Errorf("invalid transition: %s, format must be FROM:TO", par)
+		}
+		from, to := domain.EnrollStatus(desdeHasta[0]), domain.EnrollStatus(desdeHasta[1])
+		for _, s := range []domain.EnrollStatus{from, to} {
+			if !validStatus(s) {
+				return nil, ErrInvalidStatus{string(s)}
+			}
+		}
+		t[from] = append(t[from], to)
+	}
+	return t, nil
+}
+
+func validStatus(s domain.EnrollStatus) bool {
+	switch s {
+	case domain.Pending, domain.Active, domain.Studying, domain.Inactive, Waitlisted:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package enrollment
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+
+	courseSdk "github.com/IgnacioBO/go_micro_sdk/course"
+	userSdk "github.com/IgnacioBO/go_micro_sdk/user"
+)
+
+// UpstreamConfig configura como llamamos a los microservicios de users y courses
+// Timeout es por cada intento, MaxRetries son los reintentos ademas del primer intento
+// y Budget es el tope de toda la llamada con sus reintentos (0 es sin tope, solo el deadline del ctx)
+type UpstreamConfig struct {
+	Timeout     time.Duration
+	MaxRetries  int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	Budget      time.Duration
+}
+
+// DefaultUpstreamConfig deja margen para responder antes del WriteTimeout (5s) del servidor:
+// el Get con expand=user,course llama a los dos uno despues del otro, asi que son 2 * Budget = 4s en el peor caso
+var DefaultUpstreamConfig = UpstreamConfig{
+	Timeout:     800 * time.Millisecond,
+	MaxRetries:  2,
+	BaseBackoff: 100 * time.Millisecond,
+	MaxBackoff:  400 * time.Millisecond,
+	Budget:      2 * time.Second,
+}
+
+// MaxDuration es lo maximo que puede tardar una llamada con esta config (todos los intentos con timeout y el backoff maximo)
+func (c UpstreamConfig) MaxDuration() time.Duration {
+	total := time.Duration(c.MaxRetries+1) * c.Timeout
+	for intento := 1; intento <= c.MaxRetries; intento++ {
+		total += backoffMaximo(c, intento)
+	}
+	if c.Budget > 0 && c.Budget < total {
+		return c.Budget
+	}
+	return total
+}
+
+// WithUpstreamConfig cambia los timeouts y reintentos de las llamadas a users y courses
+func WithUpstreamConfig(cfg UpstreamConfig) ServiceOption {
+	return func(s *service) {
+		s.upstreamCfg = cfg
+	}
+}
+
+// upstreamUsers adapta el userSdk.Transport (que no recibe contexto) para que respete el ctx del request
+type upstreamUsers struct {
+	trans userSdk.Transport
+	cfg   UpstreamConfig
+}
+
+func (u upstreamUsers) Get(ctx context.Context, id string) (*domain.User, error) {
+	return callUpstream(ctx, u.cfg, "user", func() (*domain.User, error) {
+		return u.trans.Get(id)
+	})
+}
+
+// upstreamCourses es lo mismo que upstreamUsers pero para el courseSdk.Transport
+type upstreamCourses struct {
+	trans courseSdk.Transport
+	cfg   UpstreamConfig
+}
+
+func (c upstreamCourses) Get(ctx context.Context, id string) (*domain.Course, error) {
+	return callUpstream(ctx, c.cfg, "course", func() (*domain.Course, error) {
+		return c.trans.Get(id)
+	})
+}
+
+// callUpstream ejecuta un GET (idempotente) con deadline por intento y reintentos con backoff exponencial + jitter
+// Los not found no se reintentan (son una respuesta valida), el resto de errores terminan en ErrUpstreamUnavailable
+// No se reintenta si el intento no alcanza a terminar antes del Budget o del deadline del request
+func callUpstream[T any](ctx context.Context, cfg UpstreamConfig, servicio string, fn func() (T, error)) (T, error) {
+	var vacio T
+	var ultimoErr error
+
+	if cfg.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Budget)
+		defer cancel()
+	}
+
+	for intento := 0; intento <= cfg.MaxRetries; intento++ {
+		if intento > 0 {
+			espera := backoff(cfg, intento)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < espera+cfg.Timeout {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return vacio, ErrUpstreamUnavailable{Service: servicio, Err: ctx.Err()}
+			case <-time.After(espera):
+			}
+		}
+
+		resultado, err := callWithDeadline(ctx, cfg.Timeout, fn)
+		if err == nil {
+			return resultado, nil
+		}
+		if errors.As(err, &userSdk.ErrNotFound{}) || errors.As(err, &courseSdk.ErrNotFound{}) {
+			return vacio, err
+		}
+		//Con el circuito abierto no tiene sentido reintentar, fallamos altiro
+		if errors.As(err, &ErrCircuitOpen{}) {
+			return vacio, ErrUpstreamUnavailable{Service: servicio, Err: err}
+		}
+		ultimoErr = err
+
+		//Si el request ya se cancelo no tiene sentido reintentar
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return vacio, ErrUpstreamUnavailable{Service: servicio, Err: ultimoErr}
+}
+
+// callWithDeadline corta la espera cuando vence el timeout o el ctx, como el sdk no recibe contexto
+// la goroutine sigue hasta que el http client del sdk termine, pero el request ya no la espera
+func callWithDeadline[T any](ctx context.Context, timeout time.Duration, fn func() (T, error)) (T, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type resultado struct {
+		valor T
+		err   error
+	}
+	ch := make(chan resultado, 1) //Con buffer para que la goroutine no quede bloqueada si ya nadie la espera
+	go func() {
+		v, err := fn()
+		ch <- resultado{v, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.valor, r.err
+	case <-ctx.Done():
+		var vacio T
+		return vacio, ctx.Err()
+	}
+}
+
+// backoff calcula la espera antes del reintento: base * 2^(intento-1) con tope MaxBackoff y full jitter
+func backoff(cfg UpstreamConfig, intento int) time.Duration {
+	espera := backoffMaximo(cfg, intento)
+	if espera <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(espera)))
+}
+
+// backoffMaximo es la espera sin jitter
+func backoffMaximo(cfg UpstreamConfig, intento int) time.Duration {
+	espera := cfg.BaseBackoff << (intento - 1)
+	if cfg.MaxBackoff > 0 && (espera > cfg.MaxBackoff || espera <= 0) {
+		espera = cfg.MaxBackoff
+	}
+	if espera < 0 {
+		return 0
+	}
+	return espera
+}
@@ -0,0 +1,176 @@
+package enrollment_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	userSdk "github.com/IgnacioBO/go_micro_sdk/user"
+
+	courseSdkMock "github.com/IgnacioBO/go_micro_sdk/course/mock"
+	userSdkMock "github.com/IgnacioBO/go_micro_sdk/user/mock"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+func TestService_CreateUpstream(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	//Config rapida para que los tests no esperen los backoff reales
+	cfg := enrollment.UpstreamConfig{
+		Timeout:     50 * time.Millisecond,
+		MaxRetries:  2,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+	}
+
+	repo := &mockRepository{
+		CreateMock: func(ctx context.Context, e *domain.Enrollment) error {
+			e.ID = "10"
+			return nil
+		},
+	}
+	course := &courseSdkMock.CourseSdkMock{
+		GetMock: func(id string) (*domain.Course, error) {
+			return &domain.Course{ID: id}, nil
+		},
+	}
+
+	t.Run("should retry and succeed after a transient error", func(t *testing.T) {
+		intentos := 0
+		user := &userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				intentos++
+				if intentos < 3 {
+					return nil, errors.New("connection refused")
+				}
+				return &domain.User{ID: id}, nil
+			},
+		}
+		svc := enrollment.NewService(l, user, course, repo, enrollment.WithUpstreamConfig(cfg))
+		enroll, err := svc.Create(context.Background(), "1", "2")
+		assert.NoError(t, err)
+		assert.NotNil(t, enroll)
+		assert.Equal(t, 3, intentos)
+	})
+
+	t.Run("should return ErrUpstreamUnavailable when retries are exhausted", func(t *testing.T) {
+		intentos := 0
+		user := &userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				intentos++
+				return nil, errors.New("connection refused")
+			},
+		}
+		svc := enrollment.NewService(l, user, course, repo, enrollment.WithUpstreamConfig(cfg))
+		_, err := svc.Create(context.Background(), "1", "2")
+		assert.ErrorAs(t, err, &enrollment.ErrUpstreamUnavailable{})
+		assert.Equal(t, cfg.MaxRetries+1, intentos)
+	})
+
+	t.Run("should not retry not found", func(t *testing.T) {
+		intentos := 0
+		user := &userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				intentos++
+				return nil, userSdk.ErrNotFound{Message: "user not found"}
+			},
+		}
+		svc := enrollment.NewService(l, user, course, repo, enrollment.WithUpstreamConfig(cfg))
+		_, err := svc.Create(context.Background(), "1", "2")
+		assert.ErrorAs(t, err, &userSdk.ErrNotFound{})
+		assert.Equal(t, 1, intentos)
+	})
+
+	t.Run("should answer 503 when one lookup is unavailable and the other is not found", func(t *testing.T) {
+		user := &userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				return nil, userSdk.ErrNotFound{Message: "user not found"}
+			},
+		}
+		caido := &courseSdkMock.CourseSdkMock{
+			GetMock: func(id string) (*domain.Course, error) {
+				return nil, errors.New("connection refused")
+			},
+		}
+		svc := enrollment.NewService(l, user, caido, repo, enrollment.WithUpstreamConfig(cfg))
+		_, err := svc.Create(context.Background(), "1", "2")
+		assert.ErrorAs(t, err, &userSdk.ErrNotFound{})
+		assert.ErrorAs(t, err, &enrollment.ErrUpstreamUnavailable{})
+
+		endpoints := enrollment.MakeEndpoints(svc, enrollment.Config{})
+		_, err = endpoints.Create(context.Background(), enrollment.CreateRequest{UserID: "1", CourseID: "2"})
+		resp := err.(response.Response)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+	})
+
+	t.Run("should cut a slow upstream with the per-call deadline", func(t *testing.T) {
+		user := &userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				time.Sleep(time.Second)
+				return &domain.User{ID: id}, nil
+			},
+		}
+		svc := enrollment.NewService(l, user, course, repo, enrollment.WithUpstreamConfig(enrollment.UpstreamConfig{Timeout: 20 * time.Millisecond}))
+		inicio := time.Now()
+		_, err := svc.Create(context.Background(), "1", "2")
+		assert.ErrorAs(t, err, &enrollment.ErrUpstreamUnavailable{})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(inicio), 500*time.Millisecond)
+	})
+
+	t.Run("should not start a retry that cannot finish within the budget", func(t *testing.T) {
+		var mu sync.Mutex
+		llamadas := 0
+		user := &userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				mu.Lock()
+				llamadas++
+				mu.Unlock()
+				time.Sleep(time.Second)
+				return &domain.User{ID: id}, nil
+			},
+		}
+		svc := enrollment.NewService(l, user, course, repo, enrollment.WithUpstreamConfig(enrollment.UpstreamConfig{
+			Timeout: 100 * time.Millisecond, MaxRetries: 10, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Budget: 250 * time.Millisecond,
+		}))
+		inicio := time.Now()
+		_, err := svc.Create(context.Background(), "1", "2")
+		assert.ErrorAs(t, err, &enrollment.ErrUpstreamUnavailable{})
+		assert.Less(t, time.Since(inicio), 250*time.Millisecond)
+		mu.Lock()
+		assert.Equal(t, 2, llamadas, "should stop after the attempts that fit in the budget")
+		mu.Unlock()
+	})
+
+	t.Run("should keep the default config below the server write timeout", func(t *testing.T) {
+		cfg := enrollment.DefaultUpstreamConfig
+		//El Get con expand llama a users y courses uno despues del otro
+		assert.Less(t, 2*cfg.MaxDuration(), 5*time.Second)
+		assert.Equal(t, cfg.Budget, cfg.MaxDuration())
+		assert.Equal(t, 3*time.Second, enrollment.UpstreamConfig{Timeout: time.Second, MaxRetries: 2}.MaxDuration())
+	})
+
+	t.Run("should stop when the request context is cancelled", func(t *testing.T) {
+		user := &userSdkMock.UserSdkMock{
+			GetMock: func(id string) (*domain.User, error) {
+				time.Sleep(time.Second)
+				return &domain.User{ID: id}, nil
+			},
+		}
+		svc := enrollment.NewService(l, user, course, repo, enrollment.WithUpstreamConfig(enrollment.UpstreamConfig{Timeout: time.Second, MaxRetries: 3}))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := svc.Create(ctx, "1", "2")
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
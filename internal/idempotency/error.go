@@ -0,0 +1,21 @@
+package idempotency
+
+import "fmt"
+
+// ErrKeyReused es cuando la misma Idempotency-Key llega con otro body (422)
+type ErrKeyReused struct {
+	Key string
+}
+
+func (e ErrKeyReused) Error() string {
+	return fmt.Sprintf("idempotency key %s was already used with a different request", e.Key)
+}
+
+// ErrRequestInProgress es cuando llega el reintento y el request original todavia no termina (409)
+type ErrRequestInProgress struct {
+	Key string
+}
+
+func (e ErrRequestInProgress) Error() string {
+	return fmt.Sprintf("a request with idempotency key %s is still in progress", e.Key)
+}
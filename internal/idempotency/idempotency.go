@@ -0,0 +1,233 @@
+// Package idempotency guarda las respuestas de los POST que vienen con Idempotency-Key, asi un cliente que reintenta
+// (ej: la app movil con mala senal) recibe la misma respuesta en vez de crear el enrollment dos veces
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Config define cuanto se guarda la respuesta (TTL), cuanto dura la reserva de un request en curso
+// (si la instancia se cae a mitad de request, pasado LockTimeout se puede reintentar), cada cuanto se borran los vencidos
+// y cada cuanto se reintenta guardar en el repo lo que quedo en memoria porque el repo fallo
+type Config struct {
+	TTL           time.Duration
+	LockTimeout   time.Duration
+	PurgeInterval time.Duration
+	RetryInterval time.Duration
+}
+
+var DefaultConfig = Config{
+	TTL:           24 * time.Hour,
+	LockTimeout:   time.Minute,
+	PurgeInterval: time.Hour,
+	RetryInterval: 10 * time.Second,
+}
+
+// Record es la llave de un request y, cuando termina, su respuesta. La llave es por actor y ruta
+// (dos usuarios pueden mandar la misma Idempotency-Key sin pisarse)
+type Record struct {
+	Actor       string
+	Path        string
+	Key         string
+	RequestHash string
+	StatusCode  int //0 mientras el request original sigue en curso
+	Headers     http.Header
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// Completed dice si ya esta la respuesta (si no, el request original todavia se esta procesando)
+func (r *Record) Completed() bool {
+	return r.StatusCode != 0
+}
+
+// HashRequest es el hash con el que se detecta que la misma llave vino con otro body
+func HashRequest(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// Store aplica las reglas de la Idempotency-Key sobre el Repository
+// Si el repo falla al guardar la respuesta (o al liberar la reserva) el record queda en pendientes: los reintentos que
+// llegan a esta instancia se responden desde memoria y Run lo sigue intentando guardar. Las otras replicas no lo ven
+// hasta que se guarde, mientras tanto les llega el 409 de la reserva en curso (hasta LockTimeout)
+type Store struct {
+	log  *log.Logger
+	repo Repository
+	cfg  Config
+
+	mu         sync.Mutex
+	pendientes map[llave]Record //StatusCode 0 es una reserva que falta liberar
+}
+
+func NewStore(l *log.Logger, repo Repository, cfg Config) *Store {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultConfig.TTL
+	}
+	if cfg.LockTimeout <= 0 {
+		cfg.LockTimeout = DefaultConfig.LockTimeout
+	}
+	if cfg.PurgeInterval <= 0 {
+		cfg.PurgeInterval = DefaultConfig.PurgeInterval
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultConfig.RetryInterval
+	}
+	return &Store{log: l, repo: repo, cfg: cfg, pendientes: make(map[llave]Record)}
+}
+
+// Begin reserva la llave para este request. Si el Record devuelto ya esta completo es un reintento y hay que responder
+// lo guardado, si no es la reserva de este request y hay que cerrarla con Complete (o Release si no se guarda)
+// Devuelve ErrKeyReused si la llave ya se uso con otro body y ErrRequestInProgress si el original no ha terminado
+func (s *Store) Begin(ctx context.Context, actor, path, key string, body []byte) (*Record, error) {
+	ahora := time.Now().UTC()
+	reserva := &Record{
+		Actor:       actor,
+		Path:        path,
+		Key:         key,
+		RequestHash: HashRequest(body),
+		CreatedAt:   ahora,
+		ExpiresAt:   ahora.Add(s.cfg.LockTimeout),
+	}
+
+	if pendiente, ok := s.pendiente(llaveDe(reserva), ahora); ok {
+		if pendiente.Completed() {
+			if pendiente.RequestHash != reserva.RequestHash {
+				return nil, ErrKeyReused{Key: key}
+			}
+			return &pendiente, nil
+		}
+		//La reserva no se pudo liberar, se borra ahora antes de reservar de nuevo
+		if err := s.repo.Delete(ctx, &pendiente); err != nil {
+			return nil, err
+		}
+		s.olvidar(llaveDe(reserva))
+	}
+
+	existente, err := s.repo.Reserve(ctx, reserva, ahora)
+	if err != nil {
+		return nil, err
+	}
+	if existente == nil {
+		return reserva, nil
+	}
+	if existente.RequestHash != reserva.RequestHash {
+		return nil, ErrKeyReused{Key: key}
+	}
+	if !existente.Completed() {
+		return nil, ErrRequestInProgress{Key: key}
+	}
+	return existente, nil
+}
+
+// Complete guarda la respuesta de la reserva por el TTL
+// Si el repo falla la respuesta queda en memoria (se repite igual en esta instancia) y se devuelve el error para loguearlo
+func (s *Store) Complete(ctx context.Context, r *Record, statusCode int, headers http.Header, body []byte) error {
+	r.StatusCode = statusCode
+	r.Headers = headers
+	r.Body = body
+	r.ExpiresAt = time.Now().UTC().Add(s.cfg.TTL)
+	if err := s.repo.Complete(ctx, r); err != nil {
+		s.guardarPendiente(r)
+		return fmt.Errorf("idempotency key %s: response kept in memory until it can be stored: %w", r.Key, err)
+	}
+	return nil
+}
+
+// Release borra la reserva sin respuesta (ej: un 500), asi el reintento se vuelve a procesar
+// Si el repo falla se recuerda en memoria y se vuelve a borrar en el proximo Begin de la llave o en Run
+func (s *Store) Release(ctx context.Context, r *Record) error {
+	if err := s.repo.Delete(ctx, r); err != nil {
+		s.guardarPendiente(r)
+		return fmt.Errorf("idempotency key %s: reservation kept until it can be released: %w", r.Key, err)
+	}
+	return nil
+}
+
+// Run borra las llaves vencidas cada PurgeInterval y reintenta guardar los pendientes cada RetryInterval
+// hasta que se cancele el ctx
+func (s *Store) Run(ctx context.Context) {
+	purga := time.NewTicker(s.cfg.PurgeInterval)
+	defer purga.Stop()
+	reintento := time.NewTicker(s.cfg.RetryInterval)
+	defer reintento.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-purga.C:
+			if borradas, err := s.repo.DeleteExpired(ctx, time.Now().UTC()); err != nil {
+				s.log.Println(err)
+			} else if borradas > 0 {
+				s.log.Printf("idempotency: %d expired keys deleted", borradas)
+			}
+		case <-reintento.C:
+			s.guardarPendientes(ctx)
+		}
+	}
+}
+
+// guardarPendientes intenta pasar al repo lo que quedo en memoria, lo que vuelve a fallar queda para la proxima vuelta
+func (s *Store) guardarPendientes(ctx context.Context) {
+	s.mu.Lock()
+	pendientes := make([]Record, 0, len(s.pendientes))
+	for _, r := range s.pendientes {
+		pendientes = append(pendientes, r)
+	}
+	s.mu.Unlock()
+
+	ahora := time.Now().UTC()
+	for _, r := range pendientes {
+		if !r.ExpiresAt.After(ahora) {
+			s.olvidar(llaveDe(&r))
+			continue
+		}
+		var err error
+		if r.Completed() {
+			err = s.repo.Complete(ctx, &r)
+		} else {
+			err = s.repo.Delete(ctx, &r)
+		}
+		if err != nil {
+			s.log.Printf("idempotency: key %s still pending: %v", r.Key, err)
+			continue
+		}
+		s.olvidar(llaveDe(&r))
+	}
+}
+
+// pendiente devuelve el record que quedo en memoria para la llave si sigue vigente
+func (s *Store) pendiente(k llave, ahora time.Time) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.pendientes[k]
+	if !ok {
+		return Record{}, false
+	}
+	if !r.ExpiresAt.After(ahora) {
+		delete(s.pendientes, k)
+		return Record{}, false
+	}
+	return copiar(r), true
+}
+
+func (s *Store) guardarPendiente(r *Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pendientes[llaveDe(r)] = copiar(*r)
+}
+
+func (s *Store) olvidar(k llave) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pendientes, k)
+}
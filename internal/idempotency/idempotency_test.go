@@ -0,0 +1,207 @@
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/gomicro_enrollment/internal/idempotency"
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/bootstrap"
+)
+
+// Los mismos casos corren contra el repo en memoria y contra el de gorm con sqlite
+func TestStore(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("memory", func(t *testing.T) {
+		probarStore(t, func(t *testing.T) idempotency.Repository {
+			return idempotency.NewMemoryRepo(l)
+		})
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		probarStore(t, func(t *testing.T) idempotency.Repository {
+			db, err := bootstrap.Open(bootstrap.DBConfig{Driver: bootstrap.DriverSQLite, Name: ":memory:", Migrate: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				if sqlDB, err := db.DB(); err == nil {
+					sqlDB.Close()
+				}
+			})
+			return idempotency.NewRepo(l, db)
+		})
+	})
+}
+
+// repoCaido envuelve al repo y hace fallar Complete y Delete mientras caido sea true
+type repoCaido struct {
+	idempotency.Repository
+	mu    sync.Mutex
+	caido bool
+}
+
+func (r *repoCaido) setCaido(caido bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.caido = caido
+}
+
+func (r *repoCaido) error() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.caido {
+		return errors.New("database is down")
+	}
+	return nil
+}
+
+func (r *repoCaido) Complete(ctx context.Context, rec *idempotency.Record) error {
+	if err := r.error(); err != nil {
+		return err
+	}
+	return r.Repository.Complete(ctx, rec)
+}
+
+func (r *repoCaido) Delete(ctx context.Context, rec *idempotency.Record) error {
+	if err := r.error(); err != nil {
+		return err
+	}
+	return r.Repository.Delete(ctx, rec)
+}
+
+func TestStoreRepoFailures(t *testing.T) {
+	ctx := context.Background()
+	l := log.New(io.Discard, "", 0)
+	body := []byte(`{"user_id":"u1","course_id":"c1"}`)
+
+	t.Run("should replay from memory when complete fails and store it once the repo is back", func(t *testing.T) {
+		memoria := idempotency.NewMemoryRepo(l)
+		repo := &repoCaido{Repository: memoria, caido: true}
+		store := idempotency.NewStore(l, repo, idempotency.Config{RetryInterval: 5 * time.Millisecond})
+
+		rec, err := store.Begin(ctx, "u1", "/enrollments", "k1", body)
+		assert.NoError(t, err)
+		assert.ErrorContains(t, store.Complete(ctx, rec, http.StatusCreated, nil, []byte(`{"status":201}`)), "database is down")
+
+		guardado, err := store.Begin(ctx, "u1", "/enrollments", "k1", body)
+		assert.NoError(t, err)
+		assert.True(t, guardado.Completed(), "should replay the response kept in memory")
+		assert.Equal(t, `{"status":201}`, string(guardado.Body))
+		_, err = store.Begin(ctx, "u1", "/enrollments", "k1", []byte(`{}`))
+		assert.ErrorAs(t, err, &idempotency.ErrKeyReused{})
+
+		repo.setCaido(false)
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go store.Run(runCtx)
+
+		//Otro Store con el mismo repo (otra replica) ve la respuesta cuando se guarda
+		otro := idempotency.NewStore(l, memoria, idempotency.Config{})
+		assert.Eventually(t, func() bool {
+			guardado, err := otro.Begin(ctx, "u1", "/enrollments", "k1", body)
+			return err == nil && guardado.Completed() && string(guardado.Body) == `{"status":201}`
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("should release the reservation on the next begin when release fails", func(t *testing.T) {
+		repo := &repoCaido{Repository: idempotency.NewMemoryRepo(l), caido: true}
+		store := idempotency.NewStore(l, repo, idempotency.Config{})
+
+		rec, err := store.Begin(ctx, "u1", "/enrollments", "k1", body)
+		assert.NoError(t, err)
+		assert.Error(t, store.Release(ctx, rec))
+
+		repo.setCaido(false)
+		rec, err = store.Begin(ctx, "u1", "/enrollments", "k1", body)
+		assert.NoError(t, err, "should not answer 409 for the released request")
+		assert.False(t, rec.Completed())
+	})
+}
+
+func probarStore(t *testing.T, nuevoRepo func(t *testing.T) idempotency.Repository) {
+	ctx := context.Background()
+	l := log.New(io.Discard, "", 0)
+	body := []byte(`{"user_id":"u1","course_id":"c1"}`)
+
+	t.Run("should replay the stored response for the same body", func(t *testing.T) {
+		store := idempotency.NewStore(l, nuevoRepo(t), idempotency.Config{})
+
+		rec, err := store.Begin(ctx, "u1", "/enrollments", "k1", body)
+		assert.NoError(t, err)
+		assert.False(t, rec.Completed(), "should reserve the key")
+
+		_, err = store.Begin(ctx, "u1", "/enrollments", "k1", body)
+		assert.ErrorAs(t, err, &idempotency.ErrRequestInProgress{})
+
+		headers := http.Header{"Content-Type": []string{"application/json"}}
+		assert.NoError(t, store.Complete(ctx, rec, http.StatusCreated, headers, []byte(`{"status":201}`)))
+
+		guardado, err := store.Begin(ctx, "u1", "/enrollments", "k1", body)
+		assert.NoError(t, err)
+		assert.True(t, guardado.Completed())
+		assert.Equal(t, http.StatusCreated, guardado.StatusCode)
+		assert.Equal(t, headers, guardado.Headers)
+		assert.Equal(t, `{"status":201}`, string(guardado.Body))
+	})
+
+	t.Run("should reject the same key with a different body", func(t *testing.T) {
+		store := idempotency.NewStore(l, nuevoRepo(t), idempotency.Config{})
+
+		rec, err := store.Begin(ctx, "u1", "/enrollments", "k1", body)
+		assert.NoError(t, err)
+		assert.NoError(t, store.Complete(ctx, rec, http.StatusCreated, nil, nil))
+
+		_, err = store.Begin(ctx, "u1", "/enrollments", "k1", []byte(`{"user_id":"u2","course_id":"c1"}`))
+		assert.ErrorAs(t, err, &idempotency.ErrKeyReused{})
+	})
+
+	t.Run("should scope the keys by actor and path", func(t *testing.T) {
+		store := idempotency.NewStore(l, nuevoRepo(t), idempotency.Config{})
+
+		_, err := store.Begin(ctx, "u1", "/enrollments", "k1", body)
+		assert.NoError(t, err)
+		for _, otro := range [][2]string{{"u2", "/enrollments"}, {"u1", "/enrollments/bulk"}} {
+			rec, err := store.Begin(ctx, otro[0], otro[1], "k1", []byte(`{}`))
+			assert.NoError(t, err)
+			assert.False(t, rec.Completed())
+		}
+	})
+
+	t.Run("should let the retry run again after a release", func(t *testing.T) {
+		store := idempotency.NewStore(l, nuevoRepo(t), idempotency.Config{})
+
+		rec, err := store.Begin(ctx, "u1", "/enrollments", "k1", body)
+		assert.NoError(t, err)
+		assert.NoError(t, store.Release(ctx, rec))
+
+		_, err = store.Begin(ctx, "u1", "/enrollments", "k1", []byte(`{}`))
+		assert.NoError(t, err, "should not compare with the released request")
+	})
+
+	t.Run("should forget the key after the ttl", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		store := idempotency.NewStore(l, repo, idempotency.Config{TTL: time.Millisecond})
+
+		rec, err := store.Begin(ctx, "u1", "/enrollments", "k1", body)
+		assert.NoError(t, err)
+		assert.NoError(t, store.Complete(ctx, rec, http.StatusCreated, nil, nil))
+		time.Sleep(5 * time.Millisecond)
+
+		rec, err = store.Begin(ctx, "u1", "/enrollments", "k1", []byte(`{}`))
+		assert.NoError(t, err)
+		assert.False(t, rec.Completed(), "should reserve the expired key again")
+
+		borradas, err := repo.DeleteExpired(ctx, time.Now().UTC().Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), borradas)
+	})
+}
@@ -0,0 +1,87 @@
+package idempotency
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// llave es la primary key de un record (actor, path, idempotency_key)
+type llave struct {
+	actor string
+	path  string
+	key   string
+}
+
+func llaveDe(r *Record) llave {
+	return llave{actor: r.Actor, path: r.Path, key: r.Key}
+}
+
+// memoryRepo es el Repository en memoria (DB_DRIVER=memory), imita al de gorm
+type memoryRepo struct {
+	log *log.Logger
+
+	mu      sync.Mutex
+	records map[llave]Record
+}
+
+func NewMemoryRepo(log *log.Logger) Repository {
+	return &memoryRepo{
+		log:     log,
+		records: make(map[llave]Record),
+	}
+}
+
+func (r *memoryRepo) Reserve(ctx context.Context, rec *Record, now time.Time) (*Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existente, ok := r.records[llaveDe(rec)]; ok && existente.ExpiresAt.After(now) {
+		existente = copiar(existente)
+		return &existente, nil
+	}
+	r.records[llaveDe(rec)] = copiar(*rec)
+	return nil, nil
+}
+
+func (r *memoryRepo) Complete(ctx context.Context, rec *Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.records[llaveDe(rec)]; ok {
+		r.records[llaveDe(rec)] = copiar(*rec)
+	}
+	return nil
+}
+
+func (r *memoryRepo) Delete(ctx context.Context, rec *Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.records, llaveDe(rec))
+	return nil
+}
+
+func (r *memoryRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var borradas int64
+	for k, rec := range r.records {
+		if !rec.ExpiresAt.After(now) {
+			delete(r.records, k)
+			borradas++
+		}
+	}
+	return borradas, nil
+}
+
+// copiar evita que el que llama modifique los headers o el body guardados
+func copiar(r Record) Record {
+	if r.Headers != nil {
+		r.Headers = r.Headers.Clone()
+	}
+	r.Body = append([]byte(nil), r.Body...)
+	return r
+}
@@ -0,0 +1,160 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	// Reserve inserta el record si no hay uno vigente con la misma llave, si lo hay lo devuelve (y no inserta)
+	Reserve(ctx context.Context, r *Record, now time.Time) (*Record, error)
+	Complete(ctx context.Context, r *Record) error
+	Delete(ctx context.Context, r *Record) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type repo struct {
+	log *log.Logger
+	db  *gorm.DB
+}
+
+func NewRepo(log *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: log,
+		db:  db,
+	}
+}
+
+// recordRow es la fila de idempotency_keys, los headers de la respuesta se guardan en json
+type recordRow struct {
+	Actor           string `gorm:"primaryKey"`
+	Path            string `gorm:"primaryKey"`
+	IdempotencyKey  string `gorm:"primaryKey"`
+	RequestHash     string
+	StatusCode      int
+	ResponseHeaders string
+	ResponseBody    string
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+}
+
+func (recordRow) TableName() string {
+	return "idempotency_keys"
+}
+
+func filaDe(r *Record) (recordRow, error) {
+	headers := ""
+	if r.Headers != nil {
+		b, err := json.Marshal(r.Headers)
+		if err != nil {
+			return recordRow{}, err
+		}
+		headers = string(b)
+	}
+	return recordRow{
+		Actor:           r.Actor,
+		Path:            r.Path,
+		IdempotencyKey:  r.Key,
+		RequestHash:     r.RequestHash,
+		StatusCode:      r.StatusCode,
+		ResponseHeaders: headers,
+		ResponseBody:    string(r.Body),
+		CreatedAt:       r.CreatedAt,
+		ExpiresAt:       r.ExpiresAt,
+	}, nil
+}
+
+func (f recordRow) record() (*Record, error) {
+	r := &Record{
+		Actor:       f.Actor,
+		Path:        f.Path,
+		Key:         f.IdempotencyKey,
+		RequestHash: f.RequestHash,
+		StatusCode:  f.StatusCode,
+		Body:        []byte(f.ResponseBody),
+		CreatedAt:   f.CreatedAt,
+		ExpiresAt:   f.ExpiresAt,
+	}
+	if f.ResponseHeaders != "" {
+		if err := json.Unmarshal([]byte(f.ResponseHeaders), &r.Headers); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// mismaLlave filtra por la primary key (actor, path, idempotency_key)
+func mismaLlave(tx *gorm.DB, r *Record) *gorm.DB {
+	return tx.Where("actor = ? AND path = ? AND idempotency_key = ?", r.Actor, r.Path, r.Key)
+}
+
+// Reserve primero borra la llave si esta vencida y despues inserta con ON CONFLICT DO NOTHING, asi con dos requests
+// concurrentes solo uno inserta (y en postgres un duplicado no aborta la transaccion)
+func (r *repo) Reserve(ctx context.Context, rec *Record, now time.Time) (*Record, error) {
+	fila, err := filaDe(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	db := r.db.WithContext(ctx)
+	if err := mismaLlave(db, rec).Where("expires_at <= ?", now).Delete(&recordRow{}).Error; err != nil {
+		r.log.Println(err)
+		return nil, err
+	}
+
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&fila)
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil, nil
+	}
+
+	var existente recordRow
+	if err := mismaLlave(db, rec).Take(&existente).Error; err != nil {
+		r.log.Println(err)
+		return nil, err
+	}
+	return existente.record()
+}
+
+func (r *repo) Complete(ctx context.Context, rec *Record) error {
+	fila, err := filaDe(rec)
+	if err != nil {
+		return err
+	}
+	err = mismaLlave(r.db.WithContext(ctx).Model(&recordRow{}), rec).Updates(map[string]interface{}{
+		"status_code":      fila.StatusCode,
+		"response_headers": fila.ResponseHeaders,
+		"response_body":    fila.ResponseBody,
+		"expires_at":       fila.ExpiresAt,
+	}).Error
+	if err != nil {
+		r.log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (r *repo) Delete(ctx context.Context, rec *Record) error {
+	if err := mismaLlave(r.db.WithContext(ctx), rec).Delete(&recordRow{}).Error; err != nil {
+		r.log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (r *repo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&recordRow{})
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,286 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DelivererConfig define cada cuanto se revisan las entregas pendientes y como se reintenta
+// Despues de un intento fallido se espera BaseBackoff, y se duplica en cada intento hasta MaxBackoff
+// Al llegar a MaxAttempts la entrega queda en dead (dead-letter) y solo se reenvia con un replay
+// AllowPrivateNetworks deja enviar a IPs privadas y loopback (solo para local o partners en la misma red)
+type DelivererConfig struct {
+	PollInterval         time.Duration
+	BatchSize            int
+	Timeout              time.Duration //Timeout de cada request al receptor
+	MaxAttempts          int
+	BaseBackoff          time.Duration
+	MaxBackoff           time.Duration
+	AllowPrivateNetworks bool
+}
+
+var DefaultDelivererConfig = DelivererConfig{
+	PollInterval: time.Second,
+	BatchSize:    50,
+	Timeout:      10 * time.Second,
+	MaxAttempts:  8,
+	BaseBackoff:  30 * time.Second,
+	MaxBackoff:   time.Hour,
+}
+
+// Deliverer envia las entregas pendientes a la URL de su suscripcion
+// Igual que el relay es at-least-once: si se cae despues de enviar y antes de guardar el resultado se vuelve a enviar,
+// por eso el receptor debe descartar duplicados con el header X-Webhook-Delivery (o el id del evento)
+// Con varias replicas cada entrega la envia una sola, la que la toma con ClaimDelivery (por 2*Timeout)
+type Deliverer struct {
+	log    *log.Logger
+	repo   Repository
+	client *http.Client
+	cfg    DelivererConfig
+}
+
+// NewDeliverer con client nil usa NewHTTPClient(cfg.AllowPrivateNetworks)
+func NewDeliverer(l *log.Logger, repo Repository, client *http.Client, cfg DelivererConfig) *Deliverer {
+	def := DefaultDelivererConfig
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = def.PollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = def.BatchSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = def.Timeout
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = def.MaxAttempts
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = def.BaseBackoff
+	}
+	if cfg.MaxBackoff < cfg.BaseBackoff {
+		cfg.MaxBackoff = cfg.BaseBackoff
+	}
+	if client == nil {
+		client = NewHTTPClient(cfg.AllowPrivateNetworks)
+	}
+	return &Deliverer{log: l, repo: repo, client: client, cfg: cfg}
+}
+
+// NewHTTPClient es el client con el que se envian los webhooks. No sigue redirects (un 3xx cuenta como fallo) y
+// sin allowPrivate no se conecta a IPs privadas, loopback, link-local ni multicast. El chequeo es al conectar, con la IP
+// ya resuelta, asi un host publico que despues resuelve a una IP interna tampoco pasa. Sin allowPrivate no usa proxy
+func NewHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !ipPublica(ip) {
+				return ErrForbiddenAddress{Address: host}
+			}
+			return nil
+		}
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func ipPublica(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// Run envia las entregas pendientes cada PollInterval hasta que se cancele el ctx
+func (d *Deliverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		intentadas, err := d.Flush(ctx)
+		if err != nil {
+			d.log.Println("webhook deliverer:", err)
+		}
+		//Si la vuelta salio completa puede que queden mas, seguimos sin esperar al ticker
+		if err == nil && intentadas == d.cfg.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush hace un intento de cada entrega que ya le toca y devuelve cuantas intento
+// Cada suscripcion se envia en su propia goroutine (en orden dentro de la suscripcion), asi un partner lento no atrasa
+// a los demas. Antes de enviar cada entrega se toma con ClaimDelivery, las que tomo otra replica se saltan
+func (d *Deliverer) Flush(ctx context.Context) (int, error) {
+	deliveries, err := d.repo.DueDeliveries(ctx, time.Now().UTC(), d.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var orden []string
+	porSuscripcion := make(map[string][]Delivery)
+	for _, delivery := range deliveries {
+		if _, ok := porSuscripcion[delivery.SubscriptionID]; !ok {
+			orden = append(orden, delivery.SubscriptionID)
+		}
+		porSuscripcion[delivery.SubscriptionID] = append(porSuscripcion[delivery.SubscriptionID], delivery)
+	}
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		intentadas int
+		errs       []error
+	)
+	for _, id := range orden {
+		wg.Add(1)
+		go func(pendientes []Delivery) {
+			defer wg.Done()
+			cantidad, err := d.enviarSuscripcion(ctx, pendientes)
+			mu.Lock()
+			defer mu.Unlock()
+			intentadas += cantidad
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}(porSuscripcion[id])
+	}
+	wg.Wait()
+	return intentadas, errors.Join(errs...)
+}
+
+// enviarSuscripcion intenta las entregas de una misma suscripcion una por una, se corta en el primer error del repo
+func (d *Deliverer) enviarSuscripcion(ctx context.Context, deliveries []Delivery) (int, error) {
+	s, errSub := d.repo.GetSubscription(ctx, deliveries[0].SubscriptionID)
+	if errSub != nil && !errors.As(errSub, &ErrSubscriptionNotFound{}) {
+		return 0, errSub
+	}
+
+	intentadas := 0
+	for i := range deliveries {
+		delivery := &deliveries[i]
+
+		//El lease cubre el request y el guardado del resultado, si la replica se cae la entrega se libera sola
+		ahora := time.Now().UTC()
+		tomada, err := d.repo.ClaimDelivery(ctx, delivery.ID, ahora, ahora.Add(2*d.cfg.Timeout))
+		if err != nil {
+			return intentadas, err
+		}
+		if !tomada {
+			continue
+		}
+
+		switch {
+		case s == nil:
+			//La suscripcion se borro, la entrega ya no tiene a donde ir
+			delivery.Status = DeliveryDead
+			delivery.LastError = errSub.Error()
+		case !s.Active:
+			//Pausada, queda en dead y se puede reenviar con un replay cuando la vuelvan a activar
+			delivery.Status = DeliveryDead
+			delivery.LastError = "webhook subscription is not active"
+		default:
+			d.intentar(ctx, *s, delivery)
+		}
+
+		if err := d.repo.UpdateDelivery(ctx, delivery); err != nil {
+			return intentadas, err
+		}
+		intentadas++
+	}
+	return intentadas, nil
+}
+
+// intentar envia la entrega y deja en delivery el resultado (delivered, pending con el siguiente intento o dead)
+func (d *Deliverer) intentar(ctx context.Context, s Subscription, delivery *Delivery) {
+	statusCode, err := d.enviar(ctx, s, *delivery)
+	ahora := time.Now().UTC()
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+
+	if err == nil {
+		delivery.Status = DeliveryDelivered
+		delivery.DeliveredAt = &ahora
+		delivery.LastError = ""
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.cfg.MaxAttempts {
+		d.log.Printf("webhook deliverer: delivery %d is dead after %d attempts: %v\n", delivery.ID, delivery.Attempts, err)
+		delivery.Status = DeliveryDead
+		return
+	}
+	delivery.NextAttemptAt = ahora.Add(d.backoff(delivery.Attempts))
+}
+
+// backoff es la espera antes del siguiente intento: BaseBackoff * 2^(intentos-1), con tope MaxBackoff
+func (d *Deliverer) backoff(intentos int) time.Duration {
+	espera := d.cfg.BaseBackoff
+	for i := 1; i < intentos; i++ {
+		espera *= 2
+		if espera >= d.cfg.MaxBackoff {
+			return d.cfg.MaxBackoff
+		}
+	}
+	return espera
+}
+
+// enviar hace el POST firmado, cualquier respuesta que no sea 2xx cuenta como fallo
+func (d *Deliverer) enviar(ctx context.Context, s Subscription, delivery Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(s.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	//Leemos (con limite) el body para que la conexion se pueda reutilizar
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, ErrUnexpectedStatus{resp.StatusCode}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,243 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/webhook"
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/bootstrap"
+)
+
+func nuevaDB(t *testing.T) *gorm.DB {
+	db, err := bootstrap.Open(bootstrap.DBConfig{Driver: bootstrap.DriverSQLite, Name: ":memory:", Migrate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// receptor es un partner de prueba: guarda lo que recibe y responde con los status que le digan (despues 200)
+type receptor struct {
+	mu        sync.Mutex
+	respuesta []int
+	recibidos []*http.Request
+	bodies    [][]byte
+}
+
+func (r *receptor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.recibidos = append(r.recibidos, req)
+	r.bodies = append(r.bodies, body)
+	status := http.StatusOK
+	if len(r.respuesta) > 0 {
+		status = r.respuesta[0]
+		r.respuesta = r.respuesta[1:]
+	}
+	r.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func (r *receptor) cantidad() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.recibidos)
+}
+
+func TestDeliverer(t *testing.T) {
+	ctx := context.Background()
+	l := log.New(io.Discard, "", 0)
+	evento := enrollment.Event{ID: "ev1", Type: enrollment.EventEnrollmentCreated, EnrollmentID: "e1", UserID: "u1", CourseID: "c1", Status: domain.Pending}
+
+	//preparar crea la suscripcion al receptor y encola el evento con el Dispatcher
+	preparar := func(t *testing.T, rec *receptor) (webhook.Repository, *webhook.Subscription) {
+		srv := httptest.NewServer(rec)
+		t.Cleanup(srv.Close)
+
+		repo := webhook.NewMemoryRepo(l)
+		s := &webhook.Subscription{URL: srv.URL, Secret: "s3cr3t", Active: true}
+		assert.NoError(t, repo.CreateSubscription(ctx, s))
+		assert.NoError(t, webhook.NewDispatcher(l, repo).Publish(ctx, evento))
+		return repo, s
+	}
+	//Los receptores de prueba estan en 127.0.0.1
+	cfg := webhook.DelivererConfig{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, AllowPrivateNetworks: true}
+
+	t.Run("should send a signed delivery", func(t *testing.T) {
+		rec := &receptor{}
+		repo, s := preparar(t, rec)
+
+		intentadas, err := webhook.NewDeliverer(l, repo, nil, cfg).Flush(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, intentadas)
+		if !assert.Equal(t, 1, rec.cantidad()) {
+			return
+		}
+
+		req := rec.recibidos[0]
+		assert.Equal(t, enrollment.EventEnrollmentCreated, req.Header.Get(webhook.HeaderEvent))
+		assert.NotEmpty(t, req.Header.Get(webhook.HeaderDelivery))
+		assert.True(t, webhook.VerifySignature(s.Secret, req.Header.Get(webhook.HeaderTimestamp), rec.bodies[0], req.Header.Get(webhook.HeaderSignature)))
+		assert.False(t, webhook.VerifySignature("otro", req.Header.Get(webhook.HeaderTimestamp), rec.bodies[0], req.Header.Get(webhook.HeaderSignature)))
+		assert.Contains(t, string(rec.bodies[0]), `"id":"ev1"`)
+
+		entregas, _ := repo.ListDeliveries(ctx, webhook.Filtros{}, 0, 10)
+		assert.Equal(t, webhook.DeliveryDelivered, entregas[0].Status)
+		assert.Equal(t, http.StatusOK, entregas[0].LastStatusCode)
+		assert.NotNil(t, entregas[0].DeliveredAt)
+	})
+
+	t.Run("should retry with backoff until it is delivered", func(t *testing.T) {
+		rec := &receptor{respuesta: []int{http.StatusInternalServerError}}
+		repo, _ := preparar(t, rec)
+		deliverer := webhook.NewDeliverer(l, repo, nil, cfg)
+
+		_, err := deliverer.Flush(ctx)
+		assert.NoError(t, err)
+		entregas, _ := repo.ListDeliveries(ctx, webhook.Filtros{}, 0, 10)
+		assert.Equal(t, webhook.DeliveryPending, entregas[0].Status)
+		assert.Equal(t, 1, entregas[0].Attempts)
+		assert.Equal(t, http.StatusInternalServerError, entregas[0].LastStatusCode)
+		assert.NotEmpty(t, entregas[0].LastError)
+		assert.True(t, entregas[0].NextAttemptAt.After(time.Now().UTC().Add(-time.Second)))
+
+		assert.Eventually(t, func() bool {
+			_, _ = deliverer.Flush(ctx)
+			entregas, _ := repo.ListDeliveries(ctx, webhook.Filtros{}, 0, 10)
+			return entregas[0].Status == webhook.DeliveryDelivered
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, 2, rec.cantidad())
+	})
+
+	t.Run("should move the delivery to dead after the last attempt and replay it", func(t *testing.T) {
+		rec := &receptor{respuesta: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}}
+		repo, _ := preparar(t, rec)
+		deliverer := webhook.NewDeliverer(l, repo, nil, cfg)
+
+		assert.Eventually(t, func() bool {
+			_, _ = deliverer.Flush(ctx)
+			cantidad, _ := repo.CountDeliveries(ctx, webhook.Filtros{Status: webhook.DeliveryDead})
+			return cantidad == 1
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, 3, rec.cantidad())
+
+		entregas, _ := repo.ListDeliveries(ctx, webhook.Filtros{}, 0, 10)
+		replay, err := webhook.NewService(l, repo).ReplayDelivery(ctx, entregas[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, webhook.DeliveryPending, replay.Status)
+		assert.Equal(t, 0, replay.Attempts)
+
+		_, err = deliverer.Flush(ctx)
+		assert.NoError(t, err)
+		got, _ := repo.GetDelivery(ctx, entregas[0].ID)
+		assert.Equal(t, webhook.DeliveryDelivered, got.Status)
+		assert.Equal(t, 4, rec.cantidad())
+	})
+
+	t.Run("should send each delivery once with two deliverers on the same repo", func(t *testing.T) {
+		rec := &receptor{}
+		repo, _ := preparar(t, rec)
+		for i := 2; i <= 5; i++ {
+			assert.NoError(t, webhook.NewDispatcher(l, repo).Publish(ctx, enrollment.Event{ID: "ev" + strconv.Itoa(i), Type: enrollment.EventEnrollmentCreated}))
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := webhook.NewDeliverer(l, repo, nil, cfg).Flush(ctx)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 5, rec.cantidad())
+		cantidad, _ := repo.CountDeliveries(ctx, webhook.Filtros{Status: webhook.DeliveryDelivered})
+		assert.Equal(t, 5, cantidad)
+	})
+
+	t.Run("should not wait for a slow partner to send to the others", func(t *testing.T) {
+		lento := make(chan struct{})
+		srvLento := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-lento
+		}))
+		t.Cleanup(srvLento.Close)
+		t.Cleanup(func() { close(lento) })
+
+		rec := &receptor{}
+		repo := webhook.NewMemoryRepo(l)
+		srv := httptest.NewServer(rec)
+		t.Cleanup(srv.Close)
+		assert.NoError(t, repo.CreateSubscription(ctx, &webhook.Subscription{URL: srvLento.URL, Secret: "s3cr3t", Active: true}))
+		assert.NoError(t, repo.CreateSubscription(ctx, &webhook.Subscription{URL: srv.URL, Secret: "s3cr3t", Active: true}))
+		assert.NoError(t, webhook.NewDispatcher(l, repo).Publish(ctx, evento))
+
+		terminado := make(chan struct{})
+		go func() {
+			_, _ = webhook.NewDeliverer(l, repo, nil, webhook.DelivererConfig{Timeout: time.Second, MaxAttempts: 3, AllowPrivateNetworks: true}).Flush(ctx)
+			close(terminado)
+		}()
+		assert.Eventually(t, func() bool { return rec.cantidad() == 1 }, 500*time.Millisecond, 5*time.Millisecond)
+		<-terminado
+	})
+
+	t.Run("should not send to a loopback address by default", func(t *testing.T) {
+		rec := &receptor{}
+		repo, _ := preparar(t, rec)
+
+		_, err := webhook.NewDeliverer(l, repo, nil, webhook.DelivererConfig{MaxAttempts: 3}).Flush(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, rec.cantidad())
+		entregas, _ := repo.ListDeliveries(ctx, webhook.Filtros{}, 0, 10)
+		assert.Equal(t, webhook.DeliveryPending, entregas[0].Status)
+		assert.Contains(t, entregas[0].LastError, "is not allowed")
+	})
+
+	t.Run("should not follow redirects", func(t *testing.T) {
+		rec := &receptor{}
+		destino := httptest.NewServer(rec)
+		t.Cleanup(destino.Close)
+		redirect := httptest.NewServer(http.RedirectHandler(destino.URL, http.StatusTemporaryRedirect))
+		t.Cleanup(redirect.Close)
+
+		repo := webhook.NewMemoryRepo(l)
+		assert.NoError(t, repo.CreateSubscription(ctx, &webhook.Subscription{URL: redirect.URL, Secret: "s3cr3t", Active: true}))
+		assert.NoError(t, webhook.NewDispatcher(l, repo).Publish(ctx, evento))
+
+		_, err := webhook.NewDeliverer(l, repo, nil, cfg).Flush(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, rec.cantidad())
+		entregas, _ := repo.ListDeliveries(ctx, webhook.Filtros{}, 0, 10)
+		assert.Equal(t, http.StatusTemporaryRedirect, entregas[0].LastStatusCode)
+	})
+
+	t.Run("should kill the deliveries of a deleted subscription", func(t *testing.T) {
+		rec := &receptor{}
+		repo, s := preparar(t, rec)
+		assert.NoError(t, repo.DeleteSubscription(ctx, s.ID))
+
+		_, err := webhook.NewDeliverer(l, repo, nil, cfg).Flush(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, rec.cantidad())
+		cantidad, _ := repo.CountDeliveries(ctx, webhook.Filtros{Status: webhook.DeliveryDead})
+		assert.Equal(t, 1, cantidad)
+	})
+}
@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+// Dispatcher es el enrollment.Publisher de los webhooks: por cada evento crea una Delivery pendiente
+// para cada suscripcion que lo acepta. El envio lo hace el Deliverer, asi un receptor lento no frena al relay
+type Dispatcher struct {
+	log  *log.Logger
+	repo Repository
+}
+
+func NewDispatcher(l *log.Logger, repo Repository) *Dispatcher {
+	return &Dispatcher{log: l, repo: repo}
+}
+
+func (d *Dispatcher) Publish(ctx context.Context, evento enrollment.Event) error {
+	subscriptions, err := d.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []Delivery
+	var payload []byte
+	for _, s := range subscriptions {
+		if !s.Matches(evento) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(evento); err != nil {
+				return err
+			}
+		}
+		deliveries = append(deliveries, Delivery{
+			SubscriptionID: s.ID,
+			EventID:        evento.ID,
+			EventType:      evento.Type,
+			Payload:        string(payload),
+			Status:         DeliveryPending,
+			NextAttemptAt:  time.Now().UTC(),
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	d.log.Printf("webhook dispatcher: event %s queued for %d subscriptions\n", evento.ID, len(deliveries))
+	return d.repo.CreateDeliveries(ctx, deliveries)
+}
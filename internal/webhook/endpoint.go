@@ -0,0 +1,251 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_meta/meta"
+)
+
+type (
+	Controller func(ctx context.Context, request interface{}) (interface{}, error)
+	Endpoints  struct {
+		Create Controller
+		Get    Controller
+		GetAll Controller
+		Update Controller
+		Delete Controller
+
+		GetDeliveries  Controller
+		GetDelivery    Controller
+		ReplayDelivery Controller
+	}
+
+	CreateRequest struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+		CourseID   string   `json:"course_id"`
+		Secret     string   `json:"secret"` //Si no viene se genera uno
+		Active     *bool    `json:"active"` //Por defecto true
+	}
+
+	//Los campos que no vienen (nil) no se cambian
+	UpdateRequest struct {
+		ID         string    `json:"-"`
+		URL        *string   `json:"url"`
+		EventTypes *[]string `json:"event_types"`
+		CourseID   *string   `json:"course_id"`
+		Secret     *string   `json:"secret"`
+		Active     *bool     `json:"active"`
+	}
+
+	GetRequest struct {
+		ID string
+	}
+
+	DeleteRequest struct {
+		ID string
+	}
+
+	GetDeliveriesRequest struct {
+		SubscriptionID string
+		EventID        string
+		Status         string
+		Limit          int
+		Page           int
+	}
+
+	//El id de la entrega viene como texto desde el path
+	GetDeliveryRequest struct {
+		ID string
+	}
+
+	ReplayDeliveryRequest struct {
+		ID string
+	}
+
+	Config struct {
+		LimitPageDefault string
+	}
+)
+
+func MakeEndpoints(s Service, c Config) Endpoints {
+	return Endpoints{
+		Create: makeCreateEndpoint(s),
+		Get:    makeGetEndpoint(s),
+		GetAll: makeGetAllEndpoint(s),
+		Update: makeUpdateEndpoint(s),
+		Delete: makeDeleteEndpoint(s),
+
+		GetDeliveries:  makeGetDeliveriesEndpoint(s, c),
+		GetDelivery:    makeGetDeliveryEndpoint(s),
+		ReplayDelivery: makeReplayDeliveryEndpoint(s),
+	}
+}
+
+func makeCreateEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		fmt.Println("create webhook subscription")
+
+		reqStruct := request.(CreateRequest)
+		if reqStruct.URL == "" {
+			return nil, response.BadRequest(ErrURLRequired.Error())
+		}
+
+		subscription, err := s.CreateSubscription(ctx, reqStruct)
+		if err != nil {
+			return nil, errorResponse(err)
+		}
+		return response.Created("success", subscription, nil), nil
+	}
+}
+
+func makeGetEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		reqStruct := request.(GetRequest)
+		if reqStruct.ID == "" {
+			return nil, response.BadRequest(ErrIDRequired.Error())
+		}
+
+		subscription, err := s.GetSubscription(ctx, reqStruct.ID)
+		if err != nil {
+			return nil, errorResponse(err)
+		}
+		return response.OK("success", subscription, nil), nil
+	}
+}
+
+func makeGetAllEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		subscriptions, err := s.ListSubscriptions(ctx)
+		if err != nil {
+			return nil, errorResponse(err)
+		}
+		return response.OK("success", subscriptions, nil), nil
+	}
+}
+
+func makeUpdateEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		fmt.Println("update webhook subscription")
+
+		reqStruct := request.(UpdateRequest)
+		if reqStruct.ID == "" {
+			return nil, response.BadRequest(ErrIDRequired.Error())
+		}
+
+		subscription, err := s.UpdateSubscription(ctx, reqStruct)
+		if err != nil {
+			return nil, errorResponse(err)
+		}
+		return response.OK("success", subscription, nil), nil
+	}
+}
+
+func makeDeleteEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		fmt.Println("delete webhook subscription")
+
+		reqStruct := request.(DeleteRequest)
+		if reqStruct.ID == "" {
+			return nil, response.BadRequest(ErrIDRequired.Error())
+		}
+
+		if err := s.DeleteSubscription(ctx, reqStruct.ID); err != nil {
+			return nil, errorResponse(err)
+		}
+		return response.OK("success", nil, nil), nil
+	}
+}
+
+func makeGetDeliveriesEndpoint(s Service, config Config) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		reqStruct := request.(GetDeliveriesRequest)
+
+		filtros := Filtros{
+			SubscriptionID: reqStruct.SubscriptionID,
+			EventID:        reqStruct.EventID,
+			Status:         DeliveryStatus(reqStruct.Status),
+		}
+		switch filtros.Status {
+		case "", DeliveryPending, DeliveryDelivered, DeliveryDead:
+		default:
+			return nil, response.BadRequest(ErrInvalidDeliveryStatus{reqStruct.Status}.Error())
+		}
+
+		cantidad, err := s.CountDeliveries(ctx, filtros)
+		if err != nil {
+			return nil, response.InternalServerError(err.Error())
+		}
+		meta, err := meta.New(reqStruct.Page, reqStruct.Limit, cantidad, config.LimitPageDefault)
+		if err != nil {
+			return nil, response.InternalServerError(err.Error())
+		}
+		deliveries, err := s.ListDeliveries(ctx, filtros, meta.Offset(), meta.Limit())
+		if err != nil {
+			return nil, response.InternalServerError(err.Error())
+		}
+		return response.OK("success", deliveries, meta), nil
+	}
+}
+
+func makeGetDeliveryEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		reqStruct := request.(GetDeliveryRequest)
+		id, err := deliveryID(reqStruct.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		delivery, err := s.GetDelivery(ctx, id)
+		if err != nil {
+			return nil, errorResponse(err)
+		}
+		return response.OK("success", delivery, nil), nil
+	}
+}
+
+func makeReplayDeliveryEndpoint(s Service) Controller {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		fmt.Println("replay webhook delivery")
+
+		reqStruct := request.(ReplayDeliveryRequest)
+		id, err := deliveryID(reqStruct.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		delivery, err := s.ReplayDelivery(ctx, id)
+		if err != nil {
+			return nil, errorResponse(err)
+		}
+		//202 porque el envio lo hace el Deliverer despues
+		return response.Accepted("success", delivery, nil), nil
+	}
+}
+
+// deliveryID pasa el id del path a numero, un id que no es numero es un 404 (esa entrega no existe)
+func deliveryID(raw string) (uint, error) {
+	if raw == "" {
+		return 0, response.BadRequest(ErrIDRequired.Error())
+	}
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil || id == 0 {
+		return 0, response.NotFound(ErrDeliveryNotFound{raw}.Error())
+	}
+	return uint(id), nil
+}
+
+// errorResponse transforma los errores del service en un response con su status code
+func errorResponse(err error) response.Response {
+	switch {
+	case errors.As(err, &ErrSubscriptionNotFound{}), errors.As(err, &ErrDeliveryNotFound{}):
+		return response.NotFound(err.Error())
+	case errors.Is(err, ErrURLRequired), errors.Is(err, ErrInvalidURL), errors.As(err, &ErrInvalidEventType{}):
+		return response.BadRequest(err.Error())
+	}
+	return response.InternalServerError(err.Error())
+}
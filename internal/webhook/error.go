@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrIDRequired = errors.New("id is required")
+var ErrURLRequired = errors.New("url is required")
+
+var ErrInvalidURL = errors.New("url must be an absolute http or https url")
+
+// ErrForbiddenAddress es cuando la URL del webhook resuelve a una IP privada o loopback (y no se permiten)
+type ErrForbiddenAddress struct {
+	Address string
+}
+
+func (e ErrForbiddenAddress) Error() string {
+	return fmt.Sprintf("webhook address %s is not allowed, it is a private or loopback address", e.Address)
+}
+
+type ErrSubscriptionNotFound struct {
+	SubscriptionID string
+}
+
+func (e ErrSubscriptionNotFound) Error() string {
+	return fmt.Sprintf("webhook subscription with id: %s not found", e.SubscriptionID)
+}
+
+type ErrDeliveryNotFound struct {
+	DeliveryID string
+}
+
+func (e ErrDeliveryNotFound) Error() string {
+	return fmt.Sprintf("webhook delivery with id: %s not found", e.DeliveryID)
+}
+
+type ErrInvalidEventType struct {
+	EventType string
+}
+
+func (e ErrInvalidEventType) Error() string {
+	return fmt.Sprintf("invalid event type: %s, allowed values are %s", e.EventType, eventTypesPermitidos())
+}
+
+type ErrInvalidDeliveryStatus struct {
+	Status string
+}
+
+func (e ErrInvalidDeliveryStatus) Error() string {
+	return fmt.Sprintf("invalid delivery status: %s, allowed values are %s, %s and %s", e.Status, DeliveryPending, DeliveryDelivered, DeliveryDead)
+}
+
+// ErrUnexpectedStatus es cuando el receptor responde, pero con un status que no es 2xx
+type ErrUnexpectedStatus struct {
+	StatusCode int
+}
+
+func (e ErrUnexpectedStatus) Error() string {
+	return fmt.Sprintf("receiver responded with status code %d", e.StatusCode)
+}
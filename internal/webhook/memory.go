@@ -0,0 +1,236 @@
+package webhook
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryRepo es el Repository en memoria (DB_DRIVER=memory), imita al de gorm
+type memoryRepo struct {
+	log *log.Logger
+
+	mu            sync.RWMutex
+	subscriptions map[string]Subscription
+	deliveries    []Delivery
+}
+
+func NewMemoryRepo(log *log.Logger) Repository {
+	return &memoryRepo{
+		log:           log,
+		subscriptions: make(map[string]Subscription),
+	}
+}
+
+func (r *memoryRepo) CreateSubscription(ctx context.Context, s *Subscription) error {
+	r.log.Println("memory repository CreateSubscription:", s.URL)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	ahora := time.Now()
+	s.CreatedAt = &ahora
+	s.UpdatedAt = &ahora
+	r.subscriptions[s.ID] = copiar(*s)
+	return nil
+}
+
+func (r *memoryRepo) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.subscriptions[id]
+	if !ok {
+		return nil, ErrSubscriptionNotFound{id}
+	}
+	s = copiar(s)
+	return &s, nil
+}
+
+func (r *memoryRepo) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subscriptions := make([]Subscription, 0, len(r.subscriptions))
+	for _, s := range r.subscriptions {
+		subscriptions = append(subscriptions, copiar(s))
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if !subscriptions[i].CreatedAt.Equal(*subscriptions[j].CreatedAt) {
+			return subscriptions[i].CreatedAt.Before(*subscriptions[j].CreatedAt)
+		}
+		return subscriptions[i].ID < subscriptions[j].ID
+	})
+	return subscriptions, nil
+}
+
+func (r *memoryRepo) UpdateSubscription(ctx context.Context, s *Subscription) error {
+	r.log.Println("memory repository UpdateSubscription:", s.ID)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existente, ok := r.subscriptions[s.ID]
+	if !ok {
+		return ErrSubscriptionNotFound{s.ID}
+	}
+	ahora := time.Now()
+	s.CreatedAt = existente.CreatedAt
+	s.UpdatedAt = &ahora
+	r.subscriptions[s.ID] = copiar(*s)
+	return nil
+}
+
+func (r *memoryRepo) DeleteSubscription(ctx context.Context, id string) error {
+	r.log.Println("memory repository DeleteSubscription:", id)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.subscriptions[id]; !ok {
+		return ErrSubscriptionNotFound{id}
+	}
+	delete(r.subscriptions, id)
+	return nil
+}
+
+// CreateDeliveries igual que el unique index (subscription_id, event_id) no duplica la entrega de un mismo evento
+func (r *memoryRepo) CreateDeliveries(ctx context.Context, deliveries []Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range deliveries {
+		duplicada := false
+		for _, existente := range r.deliveries {
+			if existente.SubscriptionID == d.SubscriptionID && existente.EventID == d.EventID {
+				duplicada = true
+				break
+			}
+		}
+		if duplicada {
+			continue
+		}
+		ahora := time.Now()
+		d.ID = uint(len(r.deliveries) + 1)
+		d.CreatedAt = ahora
+		d.UpdatedAt = ahora
+		r.deliveries = append(r.deliveries, d)
+	}
+	return nil
+}
+
+func (r *memoryRepo) GetDelivery(ctx context.Context, id uint) (*Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if id == 0 || int(id) > len(r.deliveries) {
+		return nil, ErrDeliveryNotFound{strconv.FormatUint(uint64(id), 10)}
+	}
+	d := r.deliveries[id-1]
+	return &d, nil
+}
+
+func (r *memoryRepo) ListDeliveries(ctx context.Context, filtros Filtros, offset, limit int) ([]Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	//Las mas nuevas primero, igual que el repo de gorm
+	deliveries := []Delivery{}
+	for i := len(r.deliveries) - 1; i >= 0; i-- {
+		if cumpleFiltros(r.deliveries[i], filtros) {
+			deliveries = append(deliveries, r.deliveries[i])
+		}
+	}
+	if offset >= len(deliveries) {
+		return []Delivery{}, nil
+	}
+	deliveries = deliveries[offset:]
+	if limit >= 0 && limit < len(deliveries) {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (r *memoryRepo) CountDeliveries(ctx context.Context, filtros Filtros) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cantidad := 0
+	for _, d := range r.deliveries {
+		if cumpleFiltros(d, filtros) {
+			cantidad++
+		}
+	}
+	return cantidad, nil
+}
+
+func (r *memoryRepo) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var deliveries []Delivery
+	for _, d := range r.deliveries {
+		if d.Status == DeliveryPending && !d.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+	})
+	if limit >= 0 && limit < len(deliveries) {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (r *memoryRepo) ClaimDelivery(ctx context.Context, id uint, now, until time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id == 0 || int(id) > len(r.deliveries) {
+		return false, ErrDeliveryNotFound{strconv.FormatUint(uint64(id), 10)}
+	}
+	d := &r.deliveries[id-1]
+	if d.Status != DeliveryPending || d.NextAttemptAt.After(now) {
+		return false, nil
+	}
+	d.NextAttemptAt = until
+	d.UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (r *memoryRepo) UpdateDelivery(ctx context.Context, d *Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if d.ID == 0 || int(d.ID) > len(r.deliveries) {
+		return ErrDeliveryNotFound{strconv.FormatUint(uint64(d.ID), 10)}
+	}
+	d.UpdatedAt = time.Now()
+	r.deliveries[d.ID-1] = *d
+	return nil
+}
+
+// copiar evita que quien recibe la suscripcion modifique el slice de event types guardado
+func copiar(s Subscription) Subscription {
+	s.EventTypes = append([]string{}, s.EventTypes...)
+	return s
+}
+
+func cumpleFiltros(d Delivery, filtros Filtros) bool {
+	switch {
+	case filtros.SubscriptionID != "" && d.SubscriptionID != filtros.SubscriptionID,
+		filtros.EventID != "" && d.EventID != filtros.EventID,
+		filtros.Status != "" && d.Status != filtros.Status:
+		return false
+	}
+	return true
+}
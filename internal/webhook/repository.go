@@ -0,0 +1,281 @@
+package webhook
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	CreateSubscription(ctx context.Context, s *Subscription) error
+	GetSubscription(ctx context.Context, id string) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]Subscription, error)
+	UpdateSubscription(ctx context.Context, s *Subscription) error
+	DeleteSubscription(ctx context.Context, id string) error
+
+	CreateDeliveries(ctx context.Context, deliveries []Delivery) error
+	GetDelivery(ctx context.Context, id uint) (*Delivery, error)
+	ListDeliveries(ctx context.Context, filtros Filtros, offset, limit int) ([]Delivery, error)
+	CountDeliveries(ctx context.Context, filtros Filtros) (int, error)
+	DueDeliveries(ctx context.Context, now time.Time, limit int) ([]Delivery, error)
+	// ClaimDelivery toma la entrega hasta until si sigue pendiente y ya le toca (false si otra replica la tomo antes)
+	ClaimDelivery(ctx context.Context, id uint, now, until time.Time) (bool, error)
+	UpdateDelivery(ctx context.Context, d *Delivery) error
+}
+
+type repo struct {
+	log *log.Logger
+	db  *gorm.DB
+}
+
+func NewRepo(log *log.Logger, db *gorm.DB) Repository {
+	return &repo{
+		log: log,
+		db:  db,
+	}
+}
+
+// subscriptionRow es la fila de webhook_subscriptions, los event types se guardan separados por coma
+type subscriptionRow struct {
+	ID         string `gorm:"primaryKey"`
+	URL        string
+	EventTypes string
+	CourseID   string
+	Secret     string
+	Active     bool
+	CreatedAt  *time.Time
+	UpdatedAt  *time.Time
+}
+
+func (subscriptionRow) TableName() string {
+	return "webhook_subscriptions"
+}
+
+func filaDe(s *Subscription) subscriptionRow {
+	return subscriptionRow{
+		ID:         s.ID,
+		URL:        s.URL,
+		EventTypes: strings.Join(s.EventTypes, ","),
+		CourseID:   s.CourseID,
+		Secret:     s.Secret,
+		Active:     s.Active,
+		CreatedAt:  s.CreatedAt,
+		UpdatedAt:  s.UpdatedAt,
+	}
+}
+
+func (f subscriptionRow) subscription() Subscription {
+	eventTypes := []string{}
+	if f.EventTypes != "" {
+		eventTypes = strings.Split(f.EventTypes, ",")
+	}
+	return Subscription{
+		ID:         f.ID,
+		URL:        f.URL,
+		EventTypes: eventTypes,
+		CourseID:   f.CourseID,
+		Secret:     f.Secret,
+		Active:     f.Active,
+		CreatedAt:  f.CreatedAt,
+		UpdatedAt:  f.UpdatedAt,
+	}
+}
+
+func (r *repo) CreateSubscription(ctx context.Context, s *Subscription) error {
+	r.log.Println("repository CreateSubscription:", s.URL)
+
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	fila := filaDe(s)
+	if err := r.db.WithContext(ctx).Create(&fila).Error; err != nil {
+		r.log.Println(err)
+		return err
+	}
+	*s = fila.subscription()
+	return nil
+}
+
+func (r *repo) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	var fila subscriptionRow
+	result := r.db.WithContext(ctx).Where("id = ?", id).Limit(1).Find(&fila)
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrSubscriptionNotFound{id}
+	}
+	s := fila.subscription()
+	return &s, nil
+}
+
+func (r *repo) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	var filas []subscriptionRow
+	if err := r.db.WithContext(ctx).Order("created_at asc, id asc").Find(&filas).Error; err != nil {
+		r.log.Println(err)
+		return nil, err
+	}
+	subscriptions := make([]Subscription, 0, len(filas))
+	for _, fila := range filas {
+		subscriptions = append(subscriptions, fila.subscription())
+	}
+	return subscriptions, nil
+}
+
+func (r *repo) UpdateSubscription(ctx context.Context, s *Subscription) error {
+	r.log.Println("repository UpdateSubscription:", s.ID)
+
+	fila := filaDe(s)
+	//Con un map para que tambien se guarden los valores cero (active false, course_id vacio)
+	result := r.db.WithContext(ctx).Model(&subscriptionRow{}).Where("id = ?", s.ID).Updates(map[string]interface{}{
+		"url":         fila.URL,
+		"event_types": fila.EventTypes,
+		"course_id":   fila.CourseID,
+		"secret":      fila.Secret,
+		"active":      fila.Active,
+		"updated_at":  time.Now(),
+	})
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSubscriptionNotFound{s.ID}
+	}
+	return nil
+}
+
+// DeleteSubscription borra la suscripcion, sus entregas quedan en el log (las pendientes el Deliverer las deja en dead)
+func (r *repo) DeleteSubscription(ctx context.Context, id string) error {
+	r.log.Println("repository DeleteSubscription:", id)
+
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&subscriptionRow{})
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSubscriptionNotFound{id}
+	}
+	return nil
+}
+
+// CreateDeliveries inserta las entregas, si ya existe la del mismo evento y suscripcion no se duplica
+// (el relay de la outbox es at-least-once, el mismo evento puede llegar dos veces)
+func (r *repo) CreateDeliveries(ctx context.Context, deliveries []Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subscription_id"}, {Name: "event_id"}},
+		DoNothing: true,
+	}).Create(&deliveries).Error
+	if err != nil {
+		r.log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (r *repo) GetDelivery(ctx context.Context, id uint) (*Delivery, error) {
+	var d Delivery
+	result := r.db.WithContext(ctx).Where("id = ?", id).Limit(1).Find(&d)
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrDeliveryNotFound{strconv.FormatUint(uint64(id), 10)}
+	}
+	return &d, nil
+}
+
+func (r *repo) ListDeliveries(ctx context.Context, filtros Filtros, offset, limit int) ([]Delivery, error) {
+	var deliveries []Delivery
+	tx := aplicarFiltros(r.db.WithContext(ctx).Model(&Delivery{}), filtros)
+	//Las mas nuevas primero, es lo que se revisa cuando algo falla
+	result := tx.Order("id desc").Limit(limit).Offset(offset).Find(&deliveries)
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		return nil, result.Error
+	}
+	return deliveries, nil
+}
+
+func (r *repo) CountDeliveries(ctx context.Context, filtros Filtros) (int, error) {
+	var cantidad int64
+	tx := aplicarFiltros(r.db.WithContext(ctx).Model(&Delivery{}), filtros)
+	if err := tx.Count(&cantidad).Error; err != nil {
+		r.log.Println(err)
+		return 0, err
+	}
+	return int(cantidad), nil
+}
+
+func aplicarFiltros(tx *gorm.DB, filtros Filtros) *gorm.DB {
+	if filtros.SubscriptionID != "" {
+		tx = tx.Where("subscription_id = ?", filtros.SubscriptionID)
+	}
+	if filtros.EventID != "" {
+		tx = tx.Where("event_id = ?", filtros.EventID)
+	}
+	if filtros.Status != "" {
+		tx = tx.Where("status = ?", filtros.Status)
+	}
+	return tx
+}
+
+// DueDeliveries devuelve las entregas pendientes a las que ya les toca el intento, las mas antiguas primero
+func (r *repo) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]Delivery, error) {
+	var deliveries []Delivery
+	result := r.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("next_attempt_at asc, id asc").Limit(limit).Find(&deliveries)
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		return nil, result.Error
+	}
+	return deliveries, nil
+}
+
+// ClaimDelivery corre next_attempt_at a until con un UPDATE condicional, asi de las replicas que leyeron la misma
+// entrega solo una la envia. Si la replica se cae la entrega vuelve a estar disponible pasado until
+func (r *repo) ClaimDelivery(ctx context.Context, id uint, now, until time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&Delivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", id, DeliveryPending, now).
+		Update("next_attempt_at", until)
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UpdateDelivery guarda el resultado de un intento (o el reset de un replay)
+func (r *repo) UpdateDelivery(ctx context.Context, d *Delivery) error {
+	d.UpdatedAt = time.Now()
+	result := r.db.WithContext(ctx).Model(&Delivery{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+		"status":           d.Status,
+		"attempts":         d.Attempts,
+		"next_attempt_at":  d.NextAttemptAt,
+		"last_status_code": d.LastStatusCode,
+		"last_error":       d.LastError,
+		"delivered_at":     d.DeliveredAt,
+		"updated_at":       d.UpdatedAt,
+	})
+	if result.Error != nil {
+		r.log.Println(result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeliveryNotFound{strconv.FormatUint(uint64(d.ID), 10)}
+	}
+	return nil
+}
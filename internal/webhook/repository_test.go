@@ -0,0 +1,165 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/gomicro_enrollment/internal/webhook"
+)
+
+// Igual que en enrollment, los mismos casos corren contra el repo en memoria y contra el de gorm con sqlite
+func TestRepository(t *testing.T) {
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("memory", func(t *testing.T) {
+		probarRepositorio(t, func(t *testing.T) webhook.Repository {
+			return webhook.NewMemoryRepo(l)
+		})
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		probarRepositorio(t, func(t *testing.T) webhook.Repository {
+			return webhook.NewRepo(l, nuevaDB(t))
+		})
+	})
+}
+
+func probarRepositorio(t *testing.T, nuevoRepo func(t *testing.T) webhook.Repository) {
+	ctx := context.Background()
+
+	t.Run("should create, get, update, list and delete a subscription", func(t *testing.T) {
+		repo := nuevoRepo(t)
+
+		s := &webhook.Subscription{URL: "https://partner.test/hook", EventTypes: []string{"EnrollmentCreated"}, CourseID: "c1", Secret: "s3cr3t", Active: true}
+		assert.NoError(t, repo.CreateSubscription(ctx, s))
+		assert.NotEmpty(t, s.ID)
+
+		got, err := repo.GetSubscription(ctx, s.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"EnrollmentCreated"}, got.EventTypes)
+		assert.Equal(t, "s3cr3t", got.Secret)
+
+		got.EventTypes = []string{}
+		got.CourseID = ""
+		got.Active = false
+		assert.NoError(t, repo.UpdateSubscription(ctx, got))
+		got, err = repo.GetSubscription(ctx, s.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, got.EventTypes)
+		assert.Empty(t, got.CourseID)
+		assert.False(t, got.Active)
+
+		lista, err := repo.ListSubscriptions(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, lista, 1)
+
+		assert.NoError(t, repo.DeleteSubscription(ctx, s.ID))
+		_, err = repo.GetSubscription(ctx, s.ID)
+		assert.ErrorAs(t, err, &webhook.ErrSubscriptionNotFound{})
+		assert.ErrorAs(t, repo.DeleteSubscription(ctx, s.ID), &webhook.ErrSubscriptionNotFound{})
+		assert.ErrorAs(t, repo.UpdateSubscription(ctx, s), &webhook.ErrSubscriptionNotFound{})
+	})
+
+	t.Run("should not duplicate the delivery of the same event", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		ahora := time.Now().UTC()
+		d := webhook.Delivery{SubscriptionID: "s1", EventID: "ev1", EventType: "EnrollmentCreated", Payload: "{}", Status: webhook.DeliveryPending, NextAttemptAt: ahora}
+
+		assert.NoError(t, repo.CreateDeliveries(ctx, []webhook.Delivery{d}))
+		assert.NoError(t, repo.CreateDeliveries(ctx, []webhook.Delivery{d}))
+		cantidad, err := repo.CountDeliveries(ctx, webhook.Filtros{})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, cantidad)
+	})
+
+	t.Run("should return only the due deliveries and filter the log", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		ahora := time.Now().UTC()
+		assert.NoError(t, repo.CreateDeliveries(ctx, []webhook.Delivery{
+			{SubscriptionID: "s1", EventID: "ev1", EventType: "EnrollmentCreated", Payload: "{}", Status: webhook.DeliveryPending, NextAttemptAt: ahora.Add(-time.Minute)},
+			{SubscriptionID: "s1", EventID: "ev2", EventType: "EnrollmentCreated", Payload: "{}", Status: webhook.DeliveryPending, NextAttemptAt: ahora.Add(time.Hour)},
+			{SubscriptionID: "s2", EventID: "ev1", EventType: "EnrollmentCreated", Payload: "{}", Status: webhook.DeliveryDead, NextAttemptAt: ahora.Add(-time.Minute)},
+		}))
+
+		pendientes, err := repo.DueDeliveries(ctx, ahora, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, pendientes, 1) {
+			assert.Equal(t, "ev1", pendientes[0].EventID)
+			assert.Equal(t, "s1", pendientes[0].SubscriptionID)
+		}
+
+		entregas, err := repo.ListDeliveries(ctx, webhook.Filtros{SubscriptionID: "s1"}, 0, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, entregas, 2) {
+			assert.Equal(t, "ev2", entregas[0].EventID, "should list the newest first")
+		}
+		cantidad, err := repo.CountDeliveries(ctx, webhook.Filtros{Status: webhook.DeliveryDead})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, cantidad)
+		cantidad, err = repo.CountDeliveries(ctx, webhook.Filtros{EventID: "ev1"})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, cantidad)
+	})
+
+	t.Run("should claim a due delivery only once", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		ahora := time.Now().UTC()
+		assert.NoError(t, repo.CreateDeliveries(ctx, []webhook.Delivery{
+			{SubscriptionID: "s1", EventID: "ev1", EventType: "EnrollmentCreated", Payload: "{}", Status: webhook.DeliveryPending, NextAttemptAt: ahora.Add(-time.Minute)},
+		}))
+		pendientes, err := repo.DueDeliveries(ctx, ahora, 10)
+		if !assert.NoError(t, err) || !assert.Len(t, pendientes, 1) {
+			return
+		}
+
+		id := pendientes[0].ID
+		tomada, err := repo.ClaimDelivery(ctx, id, ahora, ahora.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.True(t, tomada)
+		tomada, err = repo.ClaimDelivery(ctx, id, ahora, ahora.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.False(t, tomada, "should not claim a delivery that is already claimed")
+
+		pendientes, err = repo.DueDeliveries(ctx, ahora, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, pendientes)
+		tomada, err = repo.ClaimDelivery(ctx, id, ahora.Add(2*time.Minute), ahora.Add(3*time.Minute))
+		assert.NoError(t, err)
+		assert.True(t, tomada, "should claim it again after the lease")
+	})
+
+	t.Run("should save the result of an attempt", func(t *testing.T) {
+		repo := nuevoRepo(t)
+		ahora := time.Now().UTC()
+		assert.NoError(t, repo.CreateDeliveries(ctx, []webhook.Delivery{
+			{SubscriptionID: "s1", EventID: "ev1", EventType: "EnrollmentCreated", Payload: "{}", Status: webhook.DeliveryPending, NextAttemptAt: ahora},
+		}))
+		pendientes, err := repo.DueDeliveries(ctx, ahora, 10)
+		assert.NoError(t, err)
+		if !assert.Len(t, pendientes, 1) {
+			return
+		}
+
+		d := pendientes[0]
+		d.Status = webhook.DeliveryDelivered
+		d.Attempts = 2
+		d.LastStatusCode = 204
+		d.DeliveredAt = &ahora
+		assert.NoError(t, repo.UpdateDelivery(ctx, &d))
+
+		got, err := repo.GetDelivery(ctx, d.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, webhook.DeliveryDelivered, got.Status)
+		assert.Equal(t, 2, got.Attempts)
+		assert.Equal(t, 204, got.LastStatusCode)
+		assert.NotNil(t, got.DeliveredAt)
+
+		_, err = repo.GetDelivery(ctx, 999)
+		assert.ErrorAs(t, err, &webhook.ErrDeliveryNotFound{})
+	})
+}
@@ -0,0 +1,204 @@
+package webhook
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Service interface {
+	CreateSubscription(ctx context.Context, req CreateRequest) (*Subscription, error)
+	GetSubscription(ctx context.Context, id string) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]Subscription, error)
+	UpdateSubscription(ctx context.Context, req UpdateRequest) (*Subscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	GetDelivery(ctx context.Context, id uint) (*Delivery, error)
+	ListDeliveries(ctx context.Context, filtros Filtros, offset, limit int) ([]Delivery, error)
+	CountDeliveries(ctx context.Context, filtros Filtros) (int, error)
+	ReplayDelivery(ctx context.Context, id uint) (*Delivery, error)
+}
+
+type service struct {
+	log  *log.Logger
+	repo Repository
+}
+
+func NewService(l *log.Logger, repo Repository) Service {
+	return &service{log: l, repo: repo}
+}
+
+func (s service) CreateSubscription(ctx context.Context, req CreateRequest) (*Subscription, error) {
+	s.log.Println("CreateSubscription webhook service")
+
+	if err := validarURL(req.URL); err != nil {
+		return nil, err
+	}
+	eventTypes, err := validarEventTypes(req.EventTypes)
+	if err != nil {
+		return nil, err
+	}
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = nuevoSecret(); err != nil {
+			return nil, err
+		}
+	}
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+
+	subscription := &Subscription{
+		URL:        req.URL,
+		EventTypes: eventTypes,
+		CourseID:   req.CourseID,
+		Secret:     secret,
+		Active:     active,
+	}
+	if err := s.repo.CreateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	//El secret se devuelve solo al crearla, despues no se muestra mas
+	return subscription, nil
+}
+
+func (s service) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	subscription, err := s.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	subscription.Secret = ""
+	return subscription, nil
+}
+
+func (s service) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	subscriptions, err := s.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return subscriptions, nil
+}
+
+// UpdateSubscription cambia solo los campos que vienen, si cambian el secret se devuelve el nuevo
+func (s service) UpdateSubscription(ctx context.Context, req UpdateRequest) (*Subscription, error) {
+	s.log.Println("UpdateSubscription webhook service")
+
+	subscription, err := s.repo.GetSubscription(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL != nil {
+		if err := validarURL(*req.URL); err != nil {
+			return nil, err
+		}
+		subscription.URL = *req.URL
+	}
+	if req.EventTypes != nil {
+		if subscription.EventTypes, err = validarEventTypes(*req.EventTypes); err != nil {
+			return nil, err
+		}
+	}
+	if req.CourseID != nil {
+		subscription.CourseID = *req.CourseID
+	}
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+	if req.Secret != nil && *req.Secret != "" {
+		subscription.Secret = *req.Secret
+	}
+
+	if err := s.repo.UpdateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	if req.Secret == nil || *req.Secret == "" {
+		subscription.Secret = ""
+	}
+	return subscription, nil
+}
+
+func (s service) DeleteSubscription(ctx context.Context, id string) error {
+	s.log.Println("DeleteSubscription webhook service")
+	return s.repo.DeleteSubscription(ctx, id)
+}
+
+func (s service) GetDelivery(ctx context.Context, id uint) (*Delivery, error) {
+	return s.repo.GetDelivery(ctx, id)
+}
+
+func (s service) ListDeliveries(ctx context.Context, filtros Filtros, offset, limit int) ([]Delivery, error) {
+	return s.repo.ListDeliveries(ctx, filtros, offset, limit)
+}
+
+func (s service) CountDeliveries(ctx context.Context, filtros Filtros) (int, error) {
+	return s.repo.CountDeliveries(ctx, filtros)
+}
+
+// ReplayDelivery deja la entrega pendiente de nuevo (con todos sus intentos), el Deliverer la envia en la siguiente vuelta
+// Sirve para las que quedaron en dead y tambien para reenviar una que ya se entrego
+func (s service) ReplayDelivery(ctx context.Context, id uint) (*Delivery, error) {
+	s.log.Println("ReplayDelivery webhook service")
+
+	delivery, err := s.repo.GetDelivery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetSubscription(ctx, delivery.SubscriptionID); err != nil {
+		return nil, err
+	}
+
+	delivery.Status = DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now().UTC()
+	delivery.DeliveredAt = nil
+	if err := s.repo.UpdateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// validarURL solo revisa la forma, las IPs privadas se rechazan al enviar (NewHTTPClient) porque el DNS puede cambiar
+func validarURL(raw string) error {
+	if raw == "" {
+		return ErrURLRequired
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// validarEventTypes revisa que sean eventos conocidos y saca los repetidos (vacio es todos los eventos)
+func validarEventTypes(eventTypes []string) ([]string, error) {
+	validos := []string{}
+	for _, tipo := range eventTypes {
+		tipo = strings.TrimSpace(tipo)
+		permitido := false
+		for _, conocido := range EventTypes {
+			if tipo == conocido {
+				permitido = true
+				break
+			}
+		}
+		if !permitido {
+			return nil, ErrInvalidEventType{tipo}
+		}
+		repetido := false
+		for _, v := range validos {
+			if v == tipo {
+				repetido = true
+				break
+			}
+		}
+		if !repetido {
+			validos = append(validos, tipo)
+		}
+	}
+	return validos, nil
+}
@@ -0,0 +1,108 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/webhook"
+)
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should validate the url and the event types", func(t *testing.T) {
+		svc := webhook.NewService(l, webhook.NewMemoryRepo(l))
+
+		_, err := svc.CreateSubscription(ctx, webhook.CreateRequest{})
+		assert.ErrorIs(t, err, webhook.ErrURLRequired)
+		_, err = svc.CreateSubscription(ctx, webhook.CreateRequest{URL: "ftp://partner.test"})
+		assert.ErrorIs(t, err, webhook.ErrInvalidURL)
+		_, err = svc.CreateSubscription(ctx, webhook.CreateRequest{URL: "/hook"})
+		assert.ErrorIs(t, err, webhook.ErrInvalidURL)
+		_, err = svc.CreateSubscription(ctx, webhook.CreateRequest{URL: "https://partner.test", EventTypes: []string{"EnrollmentExploded"}})
+		assert.ErrorAs(t, err, &webhook.ErrInvalidEventType{})
+	})
+
+	t.Run("should generate a secret and show it only on create", func(t *testing.T) {
+		svc := webhook.NewService(l, webhook.NewMemoryRepo(l))
+
+		s, err := svc.CreateSubscription(ctx, webhook.CreateRequest{
+			URL:        "https://partner.test/hook",
+			EventTypes: []string{enrollment.EventEnrollmentCreated, enrollment.EventEnrollmentCreated},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, s.Secret, 64)
+		assert.True(t, s.Active)
+		assert.Equal(t, []string{enrollment.EventEnrollmentCreated}, s.EventTypes, "should remove repeated event types")
+
+		got, err := svc.GetSubscription(ctx, s.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, got.Secret)
+		lista, err := svc.ListSubscriptions(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, lista[0].Secret)
+
+		inactiva := false
+		got, err = svc.UpdateSubscription(ctx, webhook.UpdateRequest{ID: s.ID, Active: &inactiva})
+		assert.NoError(t, err)
+		assert.False(t, got.Active)
+		assert.Empty(t, got.Secret)
+		assert.Equal(t, "https://partner.test/hook", got.URL, "should keep the fields that are not sent")
+
+		nuevo := "rotado"
+		got, err = svc.UpdateSubscription(ctx, webhook.UpdateRequest{ID: s.ID, Secret: &nuevo})
+		assert.NoError(t, err)
+		assert.Equal(t, "rotado", got.Secret)
+	})
+
+	t.Run("should return not found for unknown subscriptions and deliveries", func(t *testing.T) {
+		svc := webhook.NewService(l, webhook.NewMemoryRepo(l))
+
+		_, err := svc.GetSubscription(ctx, "no-existe")
+		assert.ErrorAs(t, err, &webhook.ErrSubscriptionNotFound{})
+		_, err = svc.UpdateSubscription(ctx, webhook.UpdateRequest{ID: "no-existe"})
+		assert.ErrorAs(t, err, &webhook.ErrSubscriptionNotFound{})
+		_, err = svc.ReplayDelivery(ctx, 1)
+		assert.ErrorAs(t, err, &webhook.ErrDeliveryNotFound{})
+	})
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+	l := log.New(io.Discard, "", 0)
+
+	t.Run("should queue a delivery only for the subscriptions that match", func(t *testing.T) {
+		repo := webhook.NewMemoryRepo(l)
+		todos := &webhook.Subscription{URL: "https://a.test", Active: true}
+		deUnCurso := &webhook.Subscription{URL: "https://b.test", CourseID: "c2", Active: true}
+		soloBorrados := &webhook.Subscription{URL: "https://c.test", EventTypes: []string{enrollment.EventEnrollmentDeleted}, Active: true}
+		pausada := &webhook.Subscription{URL: "https://d.test", Active: false}
+		for _, s := range []*webhook.Subscription{todos, deUnCurso, soloBorrados, pausada} {
+			assert.NoError(t, repo.CreateSubscription(ctx, s))
+		}
+
+		dispatcher := webhook.NewDispatcher(l, repo)
+		evento := enrollment.Event{ID: "ev1", Type: enrollment.EventEnrollmentCreated, CourseID: "c1"}
+		assert.NoError(t, dispatcher.Publish(ctx, evento))
+		//El relay es at-least-once, el mismo evento no debe encolarse dos veces
+		assert.NoError(t, dispatcher.Publish(ctx, evento))
+
+		entregas, err := repo.ListDeliveries(ctx, webhook.Filtros{}, 0, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, entregas, 1) {
+			assert.Equal(t, todos.ID, entregas[0].SubscriptionID)
+			assert.Equal(t, webhook.DeliveryPending, entregas[0].Status)
+		}
+
+		assert.NoError(t, dispatcher.Publish(ctx, enrollment.Event{ID: "ev2", Type: enrollment.EventEnrollmentDeleted, CourseID: "c2"}))
+		cantidad, err := repo.CountDeliveries(ctx, webhook.Filtros{EventID: "ev2"})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, cantidad)
+	})
+}
@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Headers que van en cada entrega. La firma es HMAC-SHA256 con el secret de la suscripcion sobre "<timestamp>.<body>",
+// asi el receptor puede validar que viene de nosotros y rechazar entregas viejas (replay) mirando el timestamp
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+)
+
+const prefijoFirma = "sha256="
+
+// Sign devuelve el valor del header X-Webhook-Signature ("sha256=<hex>") para el timestamp (unix) y el body
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return prefijoFirma + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature es lo que tiene que hacer el receptor: recalcular la firma y compararla en tiempo constante
+func VerifySignature(secret, timestamp string, body []byte, signature string) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
+
+// nuevoSecret genera un secret aleatorio (32 bytes en hex) cuando no lo mandan al crear la suscripcion
+func nuevoSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,90 @@
+// Package webhook avisa a sistemas externos (partners) de los eventos de enrollments con callbacks HTTP
+// Los eventos llegan desde el relay de la outbox (el Dispatcher es un enrollment.Publisher), se guarda una Delivery por
+// cada suscripcion que le interesa y el Deliverer las envia firmadas, con reintentos y dead-letter
+package webhook
+
+import (
+	"strings"
+	"time"
+
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+// DeliveryStatus es el estado de una entrega: pending (por enviar o reintentar), delivered o dead (se acabaron los intentos)
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+// EventTypes son los eventos a los que se puede suscribir un webhook
+var EventTypes = []string{
+	enrollment.EventEnrollmentCreated,
+	enrollment.EventEnrollmentStatusChanged,
+	enrollment.EventEnrollmentDeleted,
+}
+
+// Subscription es un webhook de un partner: a que URL se envia, que eventos y de que curso
+type Subscription struct {
+	ID         string     `json:"id"`
+	URL        string     `json:"url"`
+	EventTypes []string   `json:"event_types"`         //Vacio es todos los eventos
+	CourseID   string     `json:"course_id,omitempty"` //Vacio es todos los cursos
+	Secret     string     `json:"secret,omitempty"`    //Solo se muestra al crearla (o al cambiarlo), con el se firman las entregas
+	Active     bool       `json:"active"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// Matches dice si a la suscripcion le interesa el evento (por tipo y por curso)
+func (s Subscription) Matches(evento enrollment.Event) bool {
+	if !s.Active {
+		return false
+	}
+	if s.CourseID != "" && s.CourseID != evento.CourseID {
+		return false
+	}
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, tipo := range s.EventTypes {
+		if tipo == evento.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery es cada envio de un evento a una suscripcion, es el log de entregas que se puede consultar y reenviar
+type Delivery struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	SubscriptionID string         `json:"subscription_id"`
+	EventID        string         `json:"event_id"`
+	EventType      string         `json:"event_type"`
+	Payload        string         `json:"payload"` //El body que se envia (el evento en json)
+	Status         DeliveryStatus `json:"status"`
+	Attempts       int            `json:"attempts"`
+	NextAttemptAt  time.Time      `json:"next_attempt_at"`
+	LastStatusCode int            `json:"last_status_code,omitempty"`
+	LastError      string         `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time     `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// Filtros del log de entregas
+type Filtros struct {
+	SubscriptionID string
+	EventID        string
+	Status         DeliveryStatus
+}
+
+func eventTypesPermitidos() string {
+	return strings.Join(EventTypes, ", ")
+}
@@ -1,12 +1,18 @@
 package bootstrap
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 
-	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/idempotency"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/webhook"
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/migrations"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -17,37 +23,151 @@ func InitLogger() *log.Logger {
 	return log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
 }
 
+// Drivers que se pueden elegir con DB_DRIVER
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite" //Embebida en un archivo (o :memory:), para single-node y para correr los test sin docker
+	DriverMemory   = "memory" //Sin bbdd, usa enrollment.NewMemoryRepo (desarrollo local y tests)
+)
+
+// DBConfig son los datos para conectarse a la bbdd, cada driver usa los que necesita
+type DBConfig struct {
+	Driver  string
+	User    string
+	Pass    string
+	Host    string
+	Port    string
+	Name    string //Con sqlite es la ruta del archivo (o :memory:)
+	SSLMode string //Solo postgres, por defecto disable
+	Debug   bool
+	Migrate bool
+}
+
+// DBConfigFromEnv arma el DBConfig con las variables de entorno DB_*
+func DBConfigFromEnv() DBConfig {
+	return DBConfig{
+		Driver:  DBDriver(),
+		User:    os.Getenv("DB_USER"),
+		Pass:    os.Getenv("DB_PASS"),
+		Host:    os.Getenv("DB_HOST"),
+		Port:    os.Getenv("DB_PORT"),
+		Name:    os.Getenv("DB_NAME"),
+		SSLMode: os.Getenv("DB_SSLMODE"),
+		Debug:   os.Getenv("DB_DEBUG") == "true",
+		Migrate: os.Getenv("DB_MIGRATE") == "true",
+	}
+}
+
+// MySQLDSN arma el DSN de mysql (user:pass@(host:port)/bbdd?...)
+func MySQLDSN(c DBConfig) string {
+	return fmt.Sprintf("%s:%s@(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local",
+		c.User, c.Pass, c.Host, c.Port, c.Name)
+}
+
+// PostgresDSN arma el DSN de postgres en formato key=value
+func PostgresDSN(c DBConfig) string {
+	sslMode := c.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s TimeZone=UTC",
+		c.Host, c.Port, c.User, c.Pass, c.Name, sslMode)
+}
+
+// SQLiteDSN arma el DSN de sqlite, el busy_timeout es para que espere en vez de fallar con "database is locked"
+func SQLiteDSN(c DBConfig) string {
+	return fmt.Sprintf("file:%s?_busy_timeout=5000&_foreign_keys=on", c.Name)
+}
+
+// dialector devuelve el driver de gorm con su DSN segun c.Driver
+func dialector(c DBConfig) (gorm.Dialector, error) {
+	switch c.Driver {
+	case DriverMySQL:
+		return mysql.Open(MySQLDSN(c)), nil
+	case DriverPostgres:
+		return postgres.Open(PostgresDSN(c)), nil
+	case DriverSQLite:
+		return sqlite.Open(SQLiteDSN(c)), nil
+	}
+	return nil, fmt.Errorf("unsupported DB_DRIVER '%s' for a database connection", c.Driver)
+}
+
+// DBDriver devuelve el driver de DB_DRIVER, si no viene es mysql como siempre
+func DBDriver() string {
+	if driver := os.Getenv("DB_DRIVER"); driver != "" {
+		return driver
+	}
+	return DriverMySQL
+}
+
+// Repositories arma los repositorios de enrollments, webhooks e idempotency keys segun DB_DRIVER (sobre la misma conexion),
+// con memory no se conecta a ninguna bbdd
+func Repositories(l *log.Logger) (enrollment.Repository, webhook.Repository, idempotency.Repository, error) {
+	if DBDriver() == DriverMemory {
+		return enrollment.NewMemoryRepo(l), webhook.NewMemoryRepo(l), idempotency.NewMemoryRepo(l), nil
+	}
+	db, err := DBConnection()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return enrollment.NewRepo(l, db), webhook.NewRepo(l, db), idempotency.NewRepo(l, db), nil
+}
+
+// DBConnection se conecta con la config de las variables de entorno (DB_DRIVER, DB_USER, etc)
 func DBConnection() (*gorm.DB, error) {
+	return Open(DBConfigFromEnv())
+}
+
+// Open se conecta a la bbdd del driver de la config y si c.Migrate crea las tablas
+func Open(c DBConfig) (*gorm.DB, error) {
 	//DSN (Data Source Name) es una cadena de conexion de BBDD (tipo, servidor, nombre bbdd, user, pass)
-	//Estos valores no los tendremos hard codeados si no con variables de entorno usando godotenv
-	dsn := fmt.Sprintf("%s:%s@(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local",
-		os.Getenv("DB_USER"), //user
-		os.Getenv("DB_PASS"), //pass
-		os.Getenv("DB_HOST"), //sv
-		os.Getenv("DB_PORT"), //port
-		os.Getenv("DB_NAME")) //bbdd
-	fmt.Println(dsn)
-
-	//Usaremos gorm.Open(mysql.Open(stringConexion), configuracionGorn{vacia}) usando las libreria gorm y mysql
+	//Cada driver tiene su propio formato de DSN (ver MySQLDSN, PostgresDSN y SQLiteDSN)
+	dial, err := dialector(c)
+	if err != nil {
+		return nil, err
+	}
+
+	//Usaremos gorm.Open(dialector, configuracionGorn{vacia}) usando las libreria gorm y el driver que corresponda
 	//Nos devuelve la base de datos y un error
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{}) //dentro de gorm.Config pueden configurarse x ejemplo sin logs Logger: logger.Default.LogMode(logger.Silent)
+	//TranslateError hace que gorm traduzca los errores del driver a errores de gorm (ej: gorm.ErrDuplicatedKey al romper un unique index)
+	db, err := gorm.Open(dial, &gorm.Config{TranslateError: true}) //dentro de gorm.Config pueden configurarse x ejemplo sin logs Logger: logger.Default.LogMode(logger.Silent)
 	if err != nil {
 		return nil, err
 	} //Con solo esto ya nos conectamos
 
+	//sqlite solo deja escribir a una conexion a la vez (y con :memory: cada conexion seria una bbdd distinta)
+	//asi que usamos una sola conexion
+	if c.Driver == DriverSQLite {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+
 	//Setereamos la base de datos en modo debug para ver lina por linea pero solo si esta en true la vriabel de entorn DB_DEBUG
-	if os.Getenv("DB_DEBUG") == "true" {
+	if c.Debug {
 		db = db.Debug()
 	}
 
-	//Ahora especificaremos que queremos CREAR la TABLA usando GORN (en base al struct user/domain.go del otro proyecto)
-	//Usando automigrate y un struct (en este caso un puntero del struct) me creara la tabla automaticamente
-	if os.Getenv("DB_MIGRATE") == "true" {
-		err = db.AutoMigrate(&domain.Enrollment{})
-		if err != nil {
+	//Con DB_MIGRATE=true se aplican las migraciones pendientes al arrancar (ver pkg/migrations)
+	//Tambien se pueden correr a mano con el subcomando: go run cmd/main.go migrate up|down|status
+	if c.Migrate {
+		if err := Migrate(db); err != nil {
 			return nil, err
 		}
 	}
 
 	return db, nil
 }
+
+// Migrate aplica las migraciones SQL pendientes del driver de db
+func Migrate(db *gorm.DB) error {
+	m, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	_, err = m.Up(context.Background())
+	return err
+}
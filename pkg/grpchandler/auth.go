@@ -0,0 +1,27 @@
+package grpchandler
+
+import (
+	"context"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// AuthInterceptor es el handler.Authenticate del gRPC: el token viene en la metadata authorization ("Bearer <token>")
+func AuthInterceptor(verifier *auth.Verifier) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var token string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if valores := md.Get("authorization"); len(valores) > 0 {
+				token = auth.BearerToken(valores[0])
+			}
+		}
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			return nil, encodeError(ctx, response.Unauthorized(err.Error()))
+		}
+		return handler(auth.WithClaims(ctx, claims), req)
+	}
+}
@@ -0,0 +1,302 @@
+// Package grpchandler es el transporte gRPC de enrollments, usa los mismos endpoints de go-kit que pkg/handler (HTTP)
+package grpchandler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/pb"
+	"github.com/IgnacioBO/gomicro_meta/meta"
+	"github.com/go-kit/kit/endpoint"
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type enrollmentServer struct {
+	pb.UnimplementedEnrollmentServiceServer
+	create kitgrpc.Handler
+	getAll kitgrpc.Handler
+	get    kitgrpc.Handler
+	update kitgrpc.Handler
+}
+
+// NewEnrollmentGRPCServer es el equivalente de handler.NewUserHTTPServer, se registra con pb.RegisterEnrollmentServiceServer
+func NewEnrollmentGRPCServer(_ context.Context, endpoints enrollment.Endpoints) pb.EnrollmentServiceServer {
+	opciones := []kitgrpc.ServerOption{
+		kitgrpc.ServerBefore(actorToContext),
+	}
+
+	return &enrollmentServer{
+		create: kitgrpc.NewServer(endpoint.Endpoint(endpoints.Create), decodeCreateEnrollment, encodeCreateEnrollment, opciones...),
+		getAll: kitgrpc.NewServer(endpoint.Endpoint(endpoints.GetAll), decodeGetAllEnrollment, encodeGetAllEnrollment, opciones...),
+		get:    kitgrpc.NewServer(endpoint.Endpoint(endpoints.Get), decodeGetEnrollment, encodeGetEnrollment, opciones...),
+		update: kitgrpc.NewServer(endpoint.Endpoint(endpoints.Update), decodeUpdateEnrollment, encodeUpdateEnrollment, opciones...),
+	}
+}
+
+func (s *enrollmentServer) Create(ctx context.Context, req *pb.CreateRequest) (*pb.CreateResponse, error) {
+	_, resp, err := s.create.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, encodeError(ctx, err)
+	}
+	return resp.(*pb.CreateResponse), nil
+}
+
+func (s *enrollmentServer) GetAll(ctx context.Context, req *pb.GetAllRequest) (*pb.GetAllResponse, error) {
+	_, resp, err := s.getAll.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, encodeError(ctx, err)
+	}
+	return resp.(*pb.GetAllResponse), nil
+}
+
+func (s *enrollmentServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	_, resp, err := s.get.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, encodeError(ctx, err)
+	}
+	return resp.(*pb.GetResponse), nil
+}
+
+func (s *enrollmentServer) Update(ctx context.Context, req *pb.UpdateRequest) (*pb.UpdateResponse, error) {
+	_, resp, err := s.update.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, encodeError(ctx, err)
+	}
+	return resp.(*pb.UpdateResponse), nil
+}
+
+// actorToContext es igual que en HTTP: el subject del token y si no hay auth la metadata x-actor
+func actorToContext(ctx context.Context, md metadata.MD) context.Context {
+	if claims, ok := auth.ClaimsFromContext(ctx); ok && claims.Subject != "" {
+		return enrollment.WithActor(ctx, claims.Subject)
+	}
+	if actores := md.Get("x-actor"); len(actores) > 0 {
+		return enrollment.WithActor(ctx, actores[0])
+	}
+	return enrollment.WithActor(ctx, "")
+}
+
+// *** DECODE REQUEST ***
+func decodeCreateEnrollment(_ context.Context, req interface{}) (interface{}, error) {
+	r := req.(*pb.CreateRequest)
+	return enrollment.CreateRequest{UserID: r.GetUserId(), CourseID: r.GetCourseId()}, nil
+}
+
+func decodeGetAllEnrollment(_ context.Context, req interface{}) (interface{}, error) {
+	r := req.(*pb.GetAllRequest)
+	return enrollment.GetAllRequest{
+		UserID:         r.GetUserId(),
+		CourseID:       r.GetCourseId(),
+		Status:         r.GetStatus(),
+		ExcludeStatus:  r.GetExcludeStatus(),
+		CreatedFrom:    r.GetCreatedFrom(),
+		CreatedTo:      r.GetCreatedTo(),
+		UpdatedFrom:    r.GetUpdatedFrom(),
+		UpdatedTo:      r.GetUpdatedTo(),
+		IncludeDeleted: r.GetIncludeDeleted(),
+		Limit:          int(r.GetLimit()),
+		Page:           int(r.GetPage()),
+		Sort:           r.GetSort(),
+		Cursor:         r.GetCursor(),
+		SkipCount:      r.GetSkipCount(),
+	}, nil
+}
+
+func decodeGetEnrollment(_ context.Context, req interface{}) (interface{}, error) {
+	r := req.(*pb.GetRequest)
+	return enrollment.GetRequest{ID: r.GetId(), Expand: r.GetExpand()}, nil
+}
+
+func decodeUpdateEnrollment(_ context.Context, req interface{}) (interface{}, error) {
+	r := req.(*pb.UpdateRequest)
+	reqStruct := enrollment.UpdateRequest{ID: r.GetId(), IfMatch: r.GetIfMatch()}
+	//En proto3 no hay nil, un status vacio es que no vino (el endpoint responde status required)
+	if r.GetStatus() != "" {
+		st := r.GetStatus()
+		reqStruct.Status = &st
+	}
+	return reqStruct, nil
+}
+
+// *** ENCODE RESPONSE ***
+func encodeCreateEnrollment(_ context.Context, resp interface{}) (interface{}, error) {
+	enroll, err := toPBEnrollment(resp.(response.Response).GetData())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateResponse{Enrollment: enroll}, nil
+}
+
+func encodeGetAllEnrollment(_ context.Context, resp interface{}) (interface{}, error) {
+	r := resp.(response.Response)
+	enrolls, ok := r.GetData().([]domain.Enrollment)
+	if !ok {
+		return nil, response.InternalServerError(fmt.Sprintf("unexpected response data %T", r.GetData()))
+	}
+
+	respuesta := &pb.GetAllResponse{Enrollments: make([]*pb.Enrollment, len(enrolls))}
+	for i := range enrolls {
+		respuesta.Enrollments[i] = enrollmentToPB(&enrolls[i])
+	}
+
+	//El listado normal trae el meta de gomicro_meta, con cursor o sin count viene un ListMeta
+	switch m := r.(type) {
+	case *response.SuccessResponse:
+		respuesta.Meta = metaToPB(m.Meta)
+	case interface{ GetListMeta() enrollment.ListMeta }:
+		respuesta.Meta = listMetaToPB(m.GetListMeta())
+	}
+	return respuesta, nil
+}
+
+func encodeGetEnrollment(_ context.Context, resp interface{}) (interface{}, error) {
+	enroll, err := toPBEnrollment(resp.(response.Response).GetData())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetResponse{Enrollment: enroll, Etag: header(resp, "ETag")}, nil
+}
+
+func encodeUpdateEnrollment(_ context.Context, resp interface{}) (interface{}, error) {
+	r := resp.(response.Response)
+	actualizado, ok := r.GetData().(enrollment.UpdateRequest)
+	if !ok {
+		return nil, response.InternalServerError(fmt.Sprintf("unexpected response data %T", r.GetData()))
+	}
+	respuesta := &pb.UpdateResponse{Id: actualizado.ID, Etag: header(resp, "ETag")}
+	if actualizado.Status != nil {
+		respuesta.Status = *actualizado.Status
+	}
+	return respuesta, nil
+}
+
+// *** ENCODE ERROR ***
+// encodeError pasa el status code del response.Response a un codigo gRPC, los headers (ej: Retry-After) van en el trailer
+func encodeError(ctx context.Context, err error) error {
+	resp, ok := err.(response.Response)
+	if !ok {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if headerer, ok := err.(interface{ Headers() http.Header }); ok {
+		md := metadata.MD{}
+		for key, values := range headerer.Headers() {
+			md.Append(strings.ToLower(key), values...)
+		}
+		_ = grpc.SetTrailer(ctx, md)
+	}
+	return status.Error(codeFromStatus(resp.StatusCode()), resp.Error())
+}
+
+// codeFromStatus es el mapeo inverso del que usa grpc-gateway (HTTPStatusFromCode)
+func codeFromStatus(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if statusCode < http.StatusBadRequest {
+		return codes.OK
+	}
+	if statusCode < http.StatusInternalServerError {
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
+
+// header saca un header de las respuestas que lo traen (ej: ETag), igual que el encodeResponse de HTTP
+func header(resp interface{}, key string) string {
+	if headerer, ok := resp.(interface{ Headers() http.Header }); ok {
+		return headerer.Headers().Get(key)
+	}
+	return ""
+}
+
+// toPBEnrollment acepta lo que ponen en Data el Create y el Get: el enrollment o el enrollment en lista de espera con su posicion
+func toPBEnrollment(data interface{}) (*pb.Enrollment, error) {
+	switch e := data.(type) {
+	case *domain.Enrollment:
+		return enrollmentToPB(e), nil
+	case enrollment.WaitlistedEnrollment:
+		enroll := enrollmentToPB(e.Enrollment)
+		enroll.WaitlistPosition = int32(e.WaitlistPosition)
+		return enroll, nil
+	}
+	return nil, response.InternalServerError(fmt.Sprintf("unexpected response data %T", data))
+}
+
+func enrollmentToPB(e *domain.Enrollment) *pb.Enrollment {
+	enroll := &pb.Enrollment{
+		Id:       e.ID,
+		UserId:   e.UserID,
+		CourseId: e.CourseID,
+		Status:   string(e.Status),
+	}
+	if e.User != nil {
+		enroll.User = &pb.User{
+			Id:        e.User.ID,
+			FirstName: e.User.FirstName,
+			LastName:  e.User.LastName,
+			Email:     e.User.Email,
+			Phone:     e.User.Phone,
+		}
+	}
+	if e.Course != nil {
+		enroll.Course = &pb.Course{
+			Id:        e.Course.ID,
+			Name:      e.Course.Name,
+			StartDate: timestamppb.New(e.Course.StartDate),
+			EndDate:   timestamppb.New(e.Course.EndDate),
+		}
+	}
+	return enroll
+}
+
+func metaToPB(m *meta.Meta) *pb.Meta {
+	if m == nil {
+		return nil
+	}
+	total := int32(m.TotalCount)
+	paginas := int32(m.PageCount)
+	return &pb.Meta{TotalCount: &total, Page: int32(m.Page), PerPage: int32(m.PerPage), PageCount: &paginas}
+}
+
+func listMetaToPB(m enrollment.ListMeta) *pb.Meta {
+	respuesta := &pb.Meta{Page: int32(m.Page), PerPage: int32(m.PerPage), NextCursor: m.NextCursor}
+	if m.TotalCount != nil {
+		total := int32(*m.TotalCount)
+		respuesta.TotalCount = &total
+	}
+	if m.PageCount != nil {
+		paginas := int32(*m.PageCount)
+		respuesta.PageCount = &paginas
+	}
+	return respuesta
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
+)
+
+// streamPath es el unico lugar donde se acepta el token en el query (?access_token=), porque EventSource no deja poner headers
+const streamPath = "/enrollments/stream"
+
+// Authenticate valida el Bearer JWT de cada request y deja los claims en el contexto, si no es valido responde 401
+// publicPaths son las rutas que no piden token (ej: /health)
+func Authenticate(verifier *auth.Verifier, next http.Handler, publicPaths ...string) http.Handler {
+	publicas := make(map[string]bool, len(publicPaths))
+	for _, p := range publicPaths {
+		publicas[p] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicas[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := auth.BearerToken(r.Header.Get("Authorization"))
+		if token == "" && r.URL.Path == streamPath {
+			token = r.URL.Query().Get("access_token")
+		}
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			encodeError(r.Context(), response.Unauthorized(err.Error()), w)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+	})
+}
+
+// RequireRole responde 403 si el token no tiene el rol, va despues de Authenticate (que deja los claims en el contexto)
+func RequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.ClaimsFromContext(r.Context())
+		if !ok || !claims.HasRole(role) {
+			encodeError(r.Context(), response.Forbidden("role "+role+" required"), w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -8,8 +8,10 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
 	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
 	"github.com/go-kit/kit/endpoint"
 	httptransport "github.com/go-kit/kit/transport/http"
@@ -23,6 +25,7 @@ func NewUserHTTPServer(ctx context.Context, endpoints enrollment.Endpoints) http
 	//Esta se guarad en opciones y se pone al final en Handle
 	opciones := []httptransport.ServerOption{
 		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(actorToContext),
 	}
 
 	//Ahora usaremos Handle, poreque a este se le puede pasar un server (httptranpsort)
@@ -33,6 +36,13 @@ func NewUserHTTPServer(ctx context.Context, endpoints enrollment.Endpoints) http
 		opciones...,
 	)).Methods("POST")
 
+	router.Handle("/enrollments/bulk", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.BulkCreate),
+		decodeBulkCreateEnrollment,
+		encodeResponse,
+		opciones...,
+	)).Methods("POST")
+
 	router.Handle("/enrollments", httptransport.NewServer(
 		endpoint.Endpoint(endpoints.GetAll),
 		decodeGetAllEnrollment,
@@ -40,6 +50,13 @@ func NewUserHTTPServer(ctx context.Context, endpoints enrollment.Endpoints) http
 		opciones...,
 	)).Methods("GET")
 
+	router.Handle("/enrollments/{id}", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.Get),
+		decodeGetEnrollment,
+		encodeResponse,
+		opciones...,
+	)).Methods("GET")
+
 	router.Handle("/enrollments/{id}", httptransport.NewServer(
 		endpoint.Endpoint(endpoints.Update),
 		decodeUpdateEnrollment,
@@ -47,9 +64,60 @@ func NewUserHTTPServer(ctx context.Context, endpoints enrollment.Endpoints) http
 		opciones...,
 	)).Methods("PATCH")
 
+	router.Handle("/enrollments/{id}", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.Delete),
+		decodeDeleteEnrollment,
+		encodeResponse,
+		opciones...,
+	)).Methods("DELETE")
+
+	router.Handle("/enrollments/{id}/history", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.History),
+		decodeHistoryEnrollment,
+		encodeResponse,
+		opciones...,
+	)).Methods("GET")
+
+	router.Handle("/enrollments/{id}/restore", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.Restore),
+		decodeRestoreEnrollment,
+		encodeResponse,
+		opciones...,
+	)).Methods("POST")
+
+	router.Handle("/courses/{course_id}/capacity", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.GetCapacity),
+		decodeGetCapacity,
+		encodeResponse,
+		opciones...,
+	)).Methods("GET")
+
+	router.Handle("/courses/{course_id}/capacity", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.SetCapacity),
+		decodeSetCapacity,
+		encodeResponse,
+		opciones...,
+	)).Methods("PUT")
+
+	router.Handle("/health", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.Health),
+		decodeHealth,
+		encodeResponse,
+		opciones...,
+	)).Methods("GET")
+
 	return router
 }
 
+// actorToContext pone en el contexto quien hace el request, para guardarlo en el historial de status
+// Con JWT es el subject del token (asi no se puede falsear), sin auth se usa el header X-Actor
+func actorToContext(ctx context.Context, r *http.Request) context.Context {
+	if claims, ok := auth.ClaimsFromContext(ctx); ok && claims.Subject != "" {
+		return enrollment.WithActor(ctx, claims.Subject)
+	}
+	return enrollment.WithActor(ctx, r.Header.Get("X-Actor"))
+}
+
 // *** MIDDLEWARE REQUEST ***
 func decodeCreateEnrollment(_ context.Context, r *http.Request) (interface{}, error) {
 	var reqStruct enrollment.CreateRequest
@@ -63,10 +131,29 @@ func decodeCreateEnrollment(_ context.Context, r *http.Request) (interface{}, er
 	return reqStruct, nil
 }
 
+func decodeBulkCreateEnrollment(_ context.Context, r *http.Request) (interface{}, error) {
+	var reqStruct enrollment.BulkCreateRequest
+
+	err := json.NewDecoder(r.Body).Decode(&reqStruct)
+	if err != nil {
+		return nil, response.BadRequest(fmt.Sprintf("invalid request format: '%v'", err.Error()))
+	}
+
+	return reqStruct, nil
+}
+
 // *** MIDDLEWARE RESPONSE ***
 func encodeResponse(ctx context.Context, w http.ResponseWriter, resp interface{}) error {
 	rInterface := resp.(response.Response)                            //Transformamos el resp a response.Respone (al interface) -> YA QUE LE ENAIREMOS SIEMPRE UN objeto RESPONSE (CREADO POR NOSOTROS, q tiene el code, mensage, meta, etc, todo el json)
 	w.Header().Add("Content-Type", "application/json; charset=utf-8") //Linea miea para que se determine que respondera un json
+	//Igual que en los errores, algunas respuestas traen headers propios (ej: ETag)
+	if headerer, ok := resp.(httptransport.Headerer); ok {
+		for key, values := range headerer.Headers() {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+	}
 	w.WriteHeader(rInterface.StatusCode())
 	return json.NewEncoder(w).Encode(rInterface) //resp tendra el user.User del domain y otroas datos si es necesario para ocnveritse en json
 
@@ -75,7 +162,15 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, resp interface{}
 // *** MIDDLEWARE RESPONSE DE ERROR ***
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Add("Content-Type", "application/json; charset=utf-8") //Linea miea para que se determine que respondera un json
-	respInterface := err.(response.Response)                          //Tranfosrmamos el error recibido a la interfac response.Response que craemos
+	//Algunos errores traen headers propios (ej: Retry-After en un 503 con el circuit breaker abierto)
+	if headerer, ok := err.(httptransport.Headerer); ok {
+		for key, values := range headerer.Headers() {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+	}
+	respInterface := err.(response.Response) //Tranfosrmamos el error recibido a la interfac response.Response que craemos
 	//¿Porque funciona esta conversion de tipo error al de nosotros?, porque la interfaz 'error' de go pide que haya un metodo Error() string [QUE CREAMOS EN nuestro respon.RESPONSE!]
 	//Entonces como implementamos el metodo Error() string funcinoa, ademas tenemos al ventaja que vamos apoder obtener MAS DATOS porque repsonse.Response tiene mas metodos como (StatusCode())
 	//Entonces podemos transofrmar un error a una interfac propia con MAS METODOS Y MAS DATOS UE UN ERROR NORMAL!
@@ -91,16 +186,49 @@ func decodeGetAllEnrollment(_ context.Context, r *http.Request) (interface{}, er
 	limit, _ := strconv.Atoi(variablesURL.Get("limit"))
 	page, _ := strconv.Atoi(variablesURL.Get("page"))
 
+	//include_deleted=true es para que los admin puedan ver tambien los borrados
+	includeDeleted, _ := strconv.ParseBool(variablesURL.Get("include_deleted"))
+
+	//count=false es para saltarse el Count, si no viene (o viene mal) se cuenta como siempre
+	count, err := strconv.ParseBool(variablesURL.Get("count"))
+	if err != nil {
+		count = true
+	}
+
 	getReqAll := enrollment.GetAllRequest{
-		UserID:   variablesURL.Get("user_id"),
-		CourseID: variablesURL.Get("course_id"),
-		Limit:    limit,
-		Page:     page,
+		UserID:         variablesURL.Get("user_id"),
+		CourseID:       variablesURL.Get("course_id"),
+		Status:         variablesURL.Get("status"),
+		ExcludeStatus:  variablesURL.Get("exclude_status"),
+		CreatedFrom:    variablesURL.Get("created_from"),
+		CreatedTo:      variablesURL.Get("created_to"),
+		UpdatedFrom:    variablesURL.Get("updated_from"),
+		UpdatedTo:      variablesURL.Get("updated_to"),
+		IncludeDeleted: includeDeleted,
+		Limit:          limit,
+		Page:           page,
+		Sort:           variablesURL.Get("sort"),
+		Cursor:         variablesURL.Get("cursor"),
+		SkipCount:      !count,
 	}
 
 	return getReqAll, nil
 }
 
+func decodeGetEnrollment(_ context.Context, r *http.Request) (interface{}, error) {
+	variablesPath := mux.Vars(r)
+	reqStruct := enrollment.GetRequest{
+		ID: variablesPath["id"],
+	}
+
+	//expand viene como lista separada por coma, ej: ?expand=user,course
+	if expand := r.URL.Query().Get("expand"); expand != "" {
+		reqStruct.Expand = strings.Split(expand, ",")
+	}
+
+	return reqStruct, nil
+}
+
 func decodeUpdateEnrollment(_ context.Context, r *http.Request) (interface{}, error) {
 	var reqStruct enrollment.UpdateRequest
 
@@ -111,7 +239,47 @@ func decodeUpdateEnrollment(_ context.Context, r *http.Request) (interface{}, er
 
 	variablesPath := mux.Vars(r)
 	reqStruct.ID = variablesPath["id"]
+	//If-Match puede venir repetido, se junta como si fuera una lista separada por coma
+	reqStruct.IfMatch = strings.Join(r.Header.Values("If-Match"), ",")
 
 	return reqStruct, nil
 
 }
+
+func decodeDeleteEnrollment(_ context.Context, r *http.Request) (interface{}, error) {
+	variablesPath := mux.Vars(r)
+	return enrollment.DeleteRequest{ID: variablesPath["id"]}, nil
+}
+
+func decodeRestoreEnrollment(_ context.Context, r *http.Request) (interface{}, error) {
+	variablesPath := mux.Vars(r)
+	return enrollment.RestoreRequest{ID: variablesPath["id"]}, nil
+}
+
+func decodeGetCapacity(_ context.Context, r *http.Request) (interface{}, error) {
+	variablesPath := mux.Vars(r)
+	return enrollment.GetCapacityRequest{CourseID: variablesPath["course_id"]}, nil
+}
+
+func decodeSetCapacity(_ context.Context, r *http.Request) (interface{}, error) {
+	var reqStruct enrollment.SetCapacityRequest
+
+	err := json.NewDecoder(r.Body).Decode(&reqStruct)
+	if err != nil {
+		return nil, response.BadRequest(fmt.Sprintf("invalid request format: '%v'", err.Error()))
+	}
+
+	variablesPath := mux.Vars(r)
+	reqStruct.CourseID = variablesPath["course_id"]
+
+	return reqStruct, nil
+}
+
+func decodeHistoryEnrollment(_ context.Context, r *http.Request) (interface{}, error) {
+	variablesPath := mux.Vars(r)
+	return enrollment.HistoryRequest{ID: variablesPath["id"]}, nil
+}
+
+func decodeHealth(_ context.Context, r *http.Request) (interface{}, error) {
+	return nil, nil
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/idempotency"
+)
+
+const (
+	// IdempotencyKeyHeader es el header con el que el cliente marca que un POST es el reintento de otro
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader va en true cuando la respuesta es la guardada del request original
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKey = 255
+)
+
+// Idempotent guarda la respuesta de los POST de paths que traen Idempotency-Key y la repite en los reintentos con el
+// mismo body, si la llave llega con otro body responde 422. Sin el header el request pasa igual que siempre
+// Va despues de Authenticate, las llaves son por usuario (el subject del token o X-Actor sin auth). Sin usuario la llave
+// se rechaza con 400, si no todos los clientes anonimos compartirian las llaves y uno recibiria la respuesta de otro
+// Si no se puede guardar la respuesta se loguea, el Store la repite desde memoria y la sigue intentando guardar
+func Idempotent(l *log.Logger, store *idempotency.Store, next http.Handler, paths ...string) http.Handler {
+	rutas := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		rutas[p] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if r.Method != http.MethodPost || !rutas[r.URL.Path] || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			encodeError(r.Context(), response.BadRequest(fmt.Sprintf("%s must have at most %d characters", IdempotencyKeyHeader, maxIdempotencyKey)), w)
+			return
+		}
+
+		actor := idempotencyActor(r)
+		if actor == "" {
+			encodeError(r.Context(), response.BadRequest(fmt.Sprintf("%s requires an authenticated user or the X-Actor header", IdempotencyKeyHeader)), w)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			encodeError(r.Context(), response.BadRequest(err.Error()), w)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		//El registro tiene que quedar aunque el cliente corte la conexion, si no el reintento se procesaria de nuevo
+		ctx := context.WithoutCancel(r.Context())
+		rec, err := store.Begin(ctx, actor, r.URL.Path, key, body)
+		if err != nil {
+			encodeError(r.Context(), idempotencyErrorResponse(err), w)
+			return
+		}
+		if rec.Completed() {
+			for k, values := range rec.Headers {
+				w.Header()[k] = values
+			}
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(rec.StatusCode)
+			_, _ = w.Write(rec.Body)
+			return
+		}
+
+		grabador := &respuestaGrabada{ResponseWriter: w}
+		next.ServeHTTP(grabador, r)
+
+		//Los 5xx no se guardan, el reintento tiene que volver a intentarlo
+		if grabador.status == 0 || grabador.status >= http.StatusInternalServerError {
+			if err := store.Release(ctx, rec); err != nil {
+				l.Println(err)
+			}
+			return
+		}
+		if err := store.Complete(ctx, rec, grabador.status, headersGuardados(w.Header()), grabador.body.Bytes()); err != nil {
+			l.Println(err)
+		}
+	})
+}
+
+func idempotencyActor(r *http.Request) string {
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.Subject != "" {
+		return claims.Subject
+	}
+	return r.Header.Get("X-Actor")
+}
+
+func idempotencyErrorResponse(err error) response.Response {
+	if errors.As(err, &idempotency.ErrKeyReused{}) {
+		return &response.ErrorResponse{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+	}
+	if errors.As(err, &idempotency.ErrRequestInProgress{}) {
+		return &response.ErrorResponse{Status: http.StatusConflict, Message: err.Error()}
+	}
+	return response.InternalServerError(err.Error())
+}
+
+// headersGuardados son los headers de la respuesta que se repiten, los de CORS los pone accessControl en cada request
+func headersGuardados(h http.Header) http.Header {
+	guardados := http.Header{}
+	for k, values := range h {
+		if strings.HasPrefix(k, "Access-Control-") {
+			continue
+		}
+		guardados[k] = values
+	}
+	return guardados
+}
+
+// respuestaGrabada escribe la respuesta al cliente y a la vez la guarda para el store
+type respuestaGrabada struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (g *respuestaGrabada) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *respuestaGrabada) Write(b []byte) (int, error) {
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	g.body.Write(b)
+	return g.ResponseWriter.Write(b)
+}
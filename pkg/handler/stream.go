@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+)
+
+// streamRetry es cada cuanto (en ms) le pedimos al EventSource del browser que reconecte si se corta
+const streamRetry = 3000
+
+// NewStreamHandler es el GET /enrollments/stream (Server-Sent Events). No pasa por go-kit porque la respuesta no es un
+// json unico sino un stream que queda abierto hasta que el cliente se desconecta
+func NewStreamHandler(broker *enrollment.StreamBroker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			encodeError(r.Context(), response.InternalServerError("streaming not supported"), w)
+			return
+		}
+
+		//El browser manda Last-Event-ID al reconectar, el query param es para el primer request (EventSource no deja poner headers)
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("last_event_id")
+		}
+		filtro := enrollment.NewStreamFilter(r.URL.Query().Get("course_id"), r.URL.Query().Get("user_id"))
+		//Con auth el stream se acota igual que el listado (el student solo ve lo suyo y el instructor sus cursos)
+		if _, ok := auth.ClaimsFromContext(r.Context()); ok {
+			var err error
+			if filtro, err = enrollment.ScopeStreamFilter(r.Context(), filtro); err != nil {
+				encodeError(r.Context(), response.Forbidden(err.Error()), w)
+				return
+			}
+		}
+		sub, replay, reset := broker.Subscribe(filtro, lastEventID)
+		defer sub.Close()
+
+		//El WriteTimeout del server cortaria el stream, asi que lo sacamos solo para esta respuesta
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no") //Para que nginx no lo guarde en buffer
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+
+		//reset avisa que el Last-Event-ID ya no esta en el buffer: se perdieron eventos y el cliente debe recargar con GET /enrollments
+		if reset {
+			fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		}
+		for _, se := range replay {
+			if err := writeStreamEvent(w, se); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(broker.HeartbeatInterval())
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case se, ok := <-sub.Events():
+				//Canal cerrado es que el broker nos corto por lentos, el cliente reconecta con Last-Event-ID
+				if !ok {
+					return
+				}
+				if err := writeStreamEvent(w, se); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				//Las lineas que empiezan con ":" son comentarios, el cliente las ignora pero mantienen viva la conexion
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	})
+}
+
+func writeStreamEvent(w http.ResponseWriter, se enrollment.StreamEvent) error {
+	data, err := json.Marshal(se.Event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", se.ID, se.Event.Type, data)
+	return err
+}
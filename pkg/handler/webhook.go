@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/webhook"
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+// NewWebhookHTTPServer tiene las rutas de las suscripciones de webhooks y su log de entregas (todo bajo /webhooks)
+func NewWebhookHTTPServer(ctx context.Context, endpoints webhook.Endpoints) http.Handler {
+	router := mux.NewRouter()
+
+	opciones := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(actorToContext),
+	}
+
+	//Las rutas de deliveries van antes que /webhooks/{id}, si no "deliveries" se tomaria como un id
+	router.Handle("/webhooks/deliveries", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.GetDeliveries),
+		decodeGetWebhookDeliveries,
+		encodeResponse,
+		opciones...,
+	)).Methods("GET")
+
+	router.Handle("/webhooks/deliveries/{id}", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.GetDelivery),
+		decodeGetWebhookDelivery,
+		encodeResponse,
+		opciones...,
+	)).Methods("GET")
+
+	router.Handle("/webhooks/deliveries/{id}/replay", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.ReplayDelivery),
+		decodeReplayWebhookDelivery,
+		encodeResponse,
+		opciones...,
+	)).Methods("POST")
+
+	router.Handle("/webhooks", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.Create),
+		decodeCreateWebhook,
+		encodeResponse,
+		opciones...,
+	)).Methods("POST")
+
+	router.Handle("/webhooks", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.GetAll),
+		decodeGetAllWebhooks,
+		encodeResponse,
+		opciones...,
+	)).Methods("GET")
+
+	router.Handle("/webhooks/{id}", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.Get),
+		decodeGetWebhook,
+		encodeResponse,
+		opciones...,
+	)).Methods("GET")
+
+	router.Handle("/webhooks/{id}", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.Update),
+		decodeUpdateWebhook,
+		encodeResponse,
+		opciones...,
+	)).Methods("PATCH")
+
+	router.Handle("/webhooks/{id}", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.Delete),
+		decodeDeleteWebhook,
+		encodeResponse,
+		opciones...,
+	)).Methods("DELETE")
+
+	//Las entregas de una suscripcion es el mismo log filtrado por subscription_id
+	router.Handle("/webhooks/{id}/deliveries", httptransport.NewServer(
+		endpoint.Endpoint(endpoints.GetDeliveries),
+		decodeGetWebhookDeliveries,
+		encodeResponse,
+		opciones...,
+	)).Methods("GET")
+
+	return router
+}
+
+// *** MIDDLEWARE REQUEST ***
+func decodeCreateWebhook(_ context.Context, r *http.Request) (interface{}, error) {
+	var reqStruct webhook.CreateRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqStruct); err != nil {
+		return nil, response.BadRequest(fmt.Sprintf("invalid request format: '%v'", err.Error()))
+	}
+	return reqStruct, nil
+}
+
+func decodeGetAllWebhooks(_ context.Context, r *http.Request) (interface{}, error) {
+	return nil, nil
+}
+
+func decodeGetWebhook(_ context.Context, r *http.Request) (interface{}, error) {
+	return webhook.GetRequest{ID: mux.Vars(r)["id"]}, nil
+}
+
+func decodeUpdateWebhook(_ context.Context, r *http.Request) (interface{}, error) {
+	var reqStruct webhook.UpdateRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&reqStruct); err != nil {
+		return nil, response.BadRequest(fmt.Sprintf("invalid request format: '%v'", err.Error()))
+	}
+	reqStruct.ID = mux.Vars(r)["id"]
+	return reqStruct, nil
+}
+
+func decodeDeleteWebhook(_ context.Context, r *http.Request) (interface{}, error) {
+	return webhook.DeleteRequest{ID: mux.Vars(r)["id"]}, nil
+}
+
+func decodeGetWebhookDeliveries(_ context.Context, r *http.Request) (interface{}, error) {
+	variablesURL := r.URL.Query()
+	limit, _ := strconv.Atoi(variablesURL.Get("limit"))
+	page, _ := strconv.Atoi(variablesURL.Get("page"))
+
+	reqStruct := webhook.GetDeliveriesRequest{
+		SubscriptionID: variablesURL.Get("subscription_id"),
+		EventID:        variablesURL.Get("event_id"),
+		Status:         variablesURL.Get("status"),
+		Limit:          limit,
+		Page:           page,
+	}
+	//En /webhooks/{id}/deliveries la suscripcion viene en el path
+	if id, ok := mux.Vars(r)["id"]; ok {
+		reqStruct.SubscriptionID = id
+	}
+	return reqStruct, nil
+}
+
+func decodeGetWebhookDelivery(_ context.Context, r *http.Request) (interface{}, error) {
+	return webhook.GetDeliveryRequest{ID: mux.Vars(r)["id"]}, nil
+}
+
+func decodeReplayWebhookDelivery(_ context.Context, r *http.Request) (interface{}, error) {
+	return webhook.ReplayDeliveryRequest{ID: mux.Vars(r)["id"]}, nil
+}
@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Usage es la ayuda del subcomando migrate
+const Usage = "usage: migrate up | down [steps] | status"
+
+// Run ejecuta el subcomando migrate (up, down [steps] o status) y escribe el resultado en out
+// down sin steps revierte solo la ultima migracion
+func Run(ctx context.Context, m *Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(Usage)
+	}
+
+	switch args[0] {
+	case "up":
+		aplicadas, err := m.Up(ctx)
+		for _, mig := range aplicadas {
+			fmt.Fprintf(out, "applied %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(aplicadas) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid steps '%s', must be a positive number", args[1])
+			}
+			steps = n
+		}
+		revertidas, err := m.Down(ctx, steps)
+		for _, mig := range revertidas {
+			fmt.Fprintf(out, "reverted %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(revertidas) == 0 {
+			fmt.Fprintln(out, "no applied migrations")
+		}
+		return nil
+
+	case "status":
+		estados, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, estado := range estados {
+			aplicada := "pending"
+			if estado.AppliedAt != nil {
+				aplicada = "applied at " + estado.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", estado.Version, estado.Name, aplicada)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command '%s', %s", args[0], Usage)
+}
@@ -0,0 +1,337 @@
+// Package migrations aplica los cambios de esquema de la bbdd con archivos SQL versionados (reemplaza al AutoMigrate)
+// Los archivos van en sql/<driver>/NNNN_nombre.up.sql y NNNN_nombre.down.sql y quedan embebidos en el binario
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sql
+var archivos embed.FS
+
+// Nombre del lock que toman mysql y postgres para que una sola replica migre a la vez
+const (
+	lockName = "gomicro_enrollment_schema_migrations"
+	lockID   = 746835
+)
+
+// LockTimeout es cuanto espera mysql por el lock antes de rendirse
+var LockTimeout = 60 * time.Second
+
+var ErrLockNotAcquired = errors.New("could not acquire the migrations lock, another replica is migrating")
+
+// Migration es una version del esquema con su SQL de subida y de bajada
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status es el estado de una migracion en la bbdd (AppliedAt nil si esta pendiente)
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// appliedMigration es la fila de schema_migrations
+type appliedMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (appliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator aplica y revierte las migraciones del driver de la bbdd
+type Migrator struct {
+	db          *gorm.DB
+	driver      string
+	migraciones []Migration
+}
+
+// New carga las migraciones embebidas del driver de db (mysql, postgres o sqlite)
+func New(db *gorm.DB) (*Migrator, error) {
+	driver := db.Dialector.Name()
+	migraciones, err := cargar(archivos, path.Join("sql", driver))
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, driver: driver, migraciones: migraciones}, nil
+}
+
+// Migrations devuelve las migraciones ordenadas por version
+func (m *Migrator) Migrations() []Migration {
+	return m.migraciones
+}
+
+// Up aplica en orden todas las migraciones pendientes y devuelve las que aplico
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var aplicadas []Migration
+	err := m.conLock(ctx, func(conn *gorm.DB) error {
+		versiones, err := m.versionesAplicadas(conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migraciones {
+			if _, ok := versiones[mig.Version]; ok {
+				continue
+			}
+			//En mysql los DDL hacen commit solos, asi que si falla a la mitad hay que arreglarlo a mano
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if paso, ok := pasos[mig.Version]; ok {
+					if err := paso(tx, m.driver); err != nil {
+						return err
+					}
+				}
+				if err := ejecutar(tx, mig.Up); err != nil {
+					return err
+				}
+				return tx.Create(&appliedMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now().UTC()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s up: %w", mig.Version, mig.Name, err)
+			}
+			aplicadas = append(aplicadas, mig)
+		}
+		return nil
+	})
+	return aplicadas, err
+}
+
+// Down revierte las ultimas steps migraciones aplicadas (de la mas nueva a la mas vieja) y devuelve las que revirtio
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var revertidas []Migration
+	err := m.conLock(ctx, func(conn *gorm.DB) error {
+		versiones, err := m.versionesAplicadas(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migraciones) - 1; i >= 0 && len(revertidas) < steps; i-- {
+			mig := m.migraciones[i]
+			if _, ok := versiones[mig.Version]; !ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := ejecutar(tx, mig.Down); err != nil {
+					return err
+				}
+				return tx.Delete(&appliedMigration{}, mig.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s down: %w", mig.Version, mig.Name, err)
+			}
+			revertidas = append(revertidas, mig)
+		}
+		return nil
+	})
+	return revertidas, err
+}
+
+// Status devuelve todas las migraciones con su fecha de aplicacion
+// Si en la bbdd hay versiones que no tienen archivo (ej: se aplicaron con un binario mas nuevo) tambien se devuelven
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn := m.db.WithContext(ctx)
+	if err := m.crearTabla(conn); err != nil {
+		return nil, err
+	}
+	var filas []appliedMigration
+	if err := conn.Order("version asc").Find(&filas).Error; err != nil {
+		return nil, err
+	}
+	aplicadas := make(map[int]appliedMigration, len(filas))
+	for _, fila := range filas {
+		aplicadas[fila.Version] = fila
+	}
+
+	estados := make([]Status, 0, len(m.migraciones))
+	for _, mig := range m.migraciones {
+		estado := Status{Version: mig.Version, Name: mig.Name}
+		if fila, ok := aplicadas[mig.Version]; ok {
+			estado.AppliedAt = &fila.AppliedAt
+			delete(aplicadas, mig.Version)
+		}
+		estados = append(estados, estado)
+	}
+	for _, fila := range filas {
+		if _, ok := aplicadas[fila.Version]; ok {
+			estados = append(estados, Status{Version: fila.Version, Name: fila.Name, AppliedAt: &fila.AppliedAt})
+		}
+	}
+	sort.Slice(estados, func(i, j int) bool { return estados[i].Version < estados[j].Version })
+	return estados, nil
+}
+
+// conLock ejecuta fn con una sola conexion que tiene tomado el lock de migraciones
+// El lock de mysql y postgres es por sesion, por eso el lock, las migraciones y el unlock van en la misma conexion
+// sqlite no tiene lock entre procesos (es single-node) y el propio sqlite serializa las escrituras
+func (m *Migrator) conLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		switch m.driver {
+		case "mysql":
+			//GET_LOCK devuelve 1 si lo tomo, 0 si se acabo el timeout y NULL si hubo error
+			var ok sql.NullInt64
+			if err := conn.Raw("SELECT GET_LOCK(?, ?)", lockName, int(LockTimeout.Seconds())).Scan(&ok).Error; err != nil {
+				return err
+			}
+			if !ok.Valid || ok.Int64 != 1 {
+				return ErrLockNotAcquired
+			}
+			defer conn.Exec("SELECT RELEASE_LOCK(?)", lockName)
+		case "postgres":
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", lockID).Error; err != nil {
+				return err
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", lockID)
+		}
+
+		if err := m.crearTabla(conn); err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+// crearTabla crea schema_migrations si todavia no existe
+func (m *Migrator) crearTabla(conn *gorm.DB) error {
+	if conn.Migrator().HasTable(&appliedMigration{}) {
+		return nil
+	}
+	return conn.Migrator().CreateTable(&appliedMigration{})
+}
+
+func (m *Migrator) versionesAplicadas(conn *gorm.DB) (map[int]struct{}, error) {
+	var versiones []int
+	if err := conn.Model(&appliedMigration{}).Pluck("version", &versiones).Error; err != nil {
+		return nil, err
+	}
+	aplicadas := make(map[int]struct{}, len(versiones))
+	for _, v := range versiones {
+		aplicadas[v] = struct{}{}
+	}
+	return aplicadas, nil
+}
+
+// pasos son partes de una migracion que no se pueden escribir en SQL para todos los drivers
+// (sqlite no tiene ADD COLUMN IF NOT EXISTS). Corren en la transaccion de la migracion, antes de su .up.sql
+var pasos = map[int]func(tx *gorm.DB, driver string) error{
+	8: agregarDeletedAt,
+}
+
+// agregarDeletedAt agrega enrollments.deleted_at a las bbdd que se crearon con el AutoMigrate de la primera version
+func agregarDeletedAt(tx *gorm.DB, driver string) error {
+	if tx.Migrator().HasColumn("enrollments", "deleted_at") {
+		return nil
+	}
+	tipo := "datetime"
+	switch driver {
+	case "mysql":
+		tipo = "datetime(3)"
+	case "postgres":
+		tipo = "timestamptz"
+	}
+	return tx.Exec(fmt.Sprintf("ALTER TABLE enrollments ADD COLUMN deleted_at %s NULL", tipo)).Error
+}
+
+// ejecutar corre cada sentencia del archivo por separado (el driver de mysql no acepta varias sentencias en un Exec)
+func ejecutar(tx *gorm.DB, contenido string) error {
+	for _, sentencia := range sentencias(contenido) {
+		if err := tx.Exec(sentencia).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sentencias quita los comentarios de linea (--) y separa por ";"
+// Por eso los archivos no pueden tener ";" dentro de strings
+func sentencias(contenido string) []string {
+	var lineas []string
+	for _, linea := range strings.Split(contenido, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(linea), "--") {
+			continue
+		}
+		lineas = append(lineas, linea)
+	}
+
+	var res []string
+	for _, sentencia := range strings.Split(strings.Join(lineas, "\n"), ";") {
+		if sentencia = strings.TrimSpace(sentencia); sentencia != "" {
+			res = append(res, sentencia)
+		}
+	}
+	return res
+}
+
+// cargar lee los NNNN_nombre.up.sql / .down.sql del directorio, cada version tiene que tener los dos
+func cargar(fsys fs.FS, dir string) ([]Migration, error) {
+	entradas, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver '%s': %w", path.Base(dir), err)
+	}
+
+	porVersion := make(map[int]*Migration)
+	for _, entrada := range entradas {
+		nombre := entrada.Name()
+		var direccion string
+		switch {
+		case strings.HasSuffix(nombre, ".up.sql"):
+			direccion = "up"
+		case strings.HasSuffix(nombre, ".down.sql"):
+			direccion = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(nombre, "."+direccion+".sql")
+		numero, resto, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(numero)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name '%s', expected NNNN_name.up.sql or NNNN_name.down.sql", nombre)
+		}
+
+		contenido, err := fs.ReadFile(fsys, path.Join(dir, nombre))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := porVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: resto}
+			porVersion[version] = mig
+		}
+		if mig.Name != resto {
+			return nil, fmt.Errorf("migration version %04d is used by '%s' and '%s'", version, mig.Name, resto)
+		}
+		if direccion == "up" {
+			mig.Up = string(contenido)
+		} else {
+			mig.Down = string(contenido)
+		}
+	}
+
+	migraciones := make([]Migration, 0, len(porVersion))
+	for _, mig := range porVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", mig.Version, mig.Name)
+		}
+		migraciones = append(migraciones, *mig)
+	}
+	sort.Slice(migraciones, func(i, j int) bool { return migraciones[i].Version < migraciones[j].Version })
+	return migraciones, nil
+}
@@ -0,0 +1,190 @@
+package migrations_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/bootstrap"
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/migrations"
+)
+
+func nuevaDB(t *testing.T) *gorm.DB {
+	db, err := bootstrap.Open(bootstrap.DBConfig{Driver: bootstrap.DriverSQLite, Name: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should apply the pending migrations only once", func(t *testing.T) {
+		db := nuevaDB(t)
+		m, err := migrations.New(db)
+		assert.NoError(t, err)
+
+		aplicadas, err := m.Up(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, aplicadas, len(m.Migrations()))
+		assert.True(t, db.Migrator().HasTable("enrollments"))
+		assert.True(t, db.Migrator().HasTable("schema_migrations"))
+
+		aplicadas, err = m.Up(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, aplicadas)
+
+		estados, err := m.Status(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, estados, len(m.Migrations()))
+		for _, estado := range estados {
+			assert.NotNil(t, estado.AppliedAt, estado.Name)
+		}
+	})
+
+	t.Run("should revert the last migration and apply it again", func(t *testing.T) {
+		db := nuevaDB(t)
+		m, err := migrations.New(db)
+		assert.NoError(t, err)
+		_, err = m.Up(ctx)
+		assert.NoError(t, err)
+
+		ultima := m.Migrations()[len(m.Migrations())-1]
+		revertidas, err := m.Down(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []migrations.Migration{ultima}, revertidas)
+
+		estados, err := m.Status(ctx)
+		assert.NoError(t, err)
+		assert.Nil(t, estados[len(estados)-1].AppliedAt)
+
+		aplicadas, err := m.Up(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []migrations.Migration{ultima}, aplicadas)
+	})
+
+	t.Run("should revert everything with enough steps", func(t *testing.T) {
+		db := nuevaDB(t)
+		m, err := migrations.New(db)
+		assert.NoError(t, err)
+		_, err = m.Up(ctx)
+		assert.NoError(t, err)
+
+		revertidas, err := m.Down(ctx, 100)
+		assert.NoError(t, err)
+		assert.Len(t, revertidas, len(m.Migrations()))
+		assert.False(t, db.Migrator().HasTable("enrollments"))
+	})
+}
+
+// La 0009 tiene que poder correr sobre una bbdd que ya tiene enrollments duplicados (los de antes del unique index)
+func TestDeduplicateEnrollments(t *testing.T) {
+	ctx := context.Background()
+	db := nuevaDB(t)
+	m, err := migrations.New(db)
+	assert.NoError(t, err)
+	_, err = m.Up(ctx)
+	assert.NoError(t, err)
+
+	//Volvemos a antes del indice para poder sembrar los duplicados
+	pasos := 0
+	for i := len(m.Migrations()) - 1; i >= 0 && m.Migrations()[i].Name != "unique_active_enrollments"; i-- {
+		pasos++
+	}
+	_, err = m.Down(ctx, pasos+1)
+	assert.NoError(t, err)
+
+	filas := []struct {
+		id, user, course, status, createdAt string
+	}{
+		{"e1", "u1", "c1", "A", "2024-01-01 10:00:00"},
+		{"e2", "u1", "c1", "P", "2024-01-02 10:00:00"}, //El mas nuevo que no esta Inactive
+		{"e3", "u1", "c1", "I", "2024-01-03 10:00:00"},
+		{"e4", "u2", "c1", "I", "2024-01-01 10:00:00"}, //Todos Inactive: queda el mas nuevo
+		{"e5", "u2", "c1", "I", "2024-01-02 10:00:00"},
+		{"e6", "u3", "c1", "A", "2024-01-01 10:00:00"}, //Sin duplicados no se toca
+	}
+	for _, f := range filas {
+		err := db.Exec("INSERT INTO enrollments (id, user_id, course_id, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+			f.id, f.user, f.course, f.status, f.createdAt, f.createdAt).Error
+		assert.NoError(t, err)
+	}
+
+	_, err = m.Up(ctx)
+	if !assert.NoError(t, err, "should deduplicate before creating the index") {
+		return
+	}
+
+	var vivos []string
+	assert.NoError(t, db.Raw("SELECT id FROM enrollments WHERE deleted_at IS NULL ORDER BY id").Scan(&vivos).Error)
+	assert.Equal(t, []string{"e2", "e5", "e6"}, vivos)
+	var borrados int64
+	assert.NoError(t, db.Raw("SELECT COUNT(*) FROM enrollments WHERE deleted_at IS NOT NULL").Scan(&borrados).Error)
+	assert.Equal(t, int64(3), borrados, "should soft delete the duplicates")
+
+	err = db.Exec("INSERT INTO enrollments (id, user_id, course_id, status) VALUES ('e7', 'u1', 'c1', 'P')").Error
+	assert.Error(t, err, "should reject a new live duplicate")
+}
+
+// Las bbdd de antes de las migraciones se crearon con AutoMigrate(&domain.Enrollment{}): sin deleted_at, version ni
+// las otras tablas. Tienen que poder subir hasta la ultima migracion sin perder los enrollments
+func TestUpgradeAutoMigrateSchema(t *testing.T) {
+	ctx := context.Background()
+	db := nuevaDB(t)
+	assert.NoError(t, db.AutoMigrate(&domain.Enrollment{}))
+	assert.False(t, db.Migrator().HasColumn("enrollments", "deleted_at"))
+	assert.NoError(t, db.Exec("INSERT INTO enrollments (id, user_id, course_id, status) VALUES ('e1', 'u1', 'c1', 'P')").Error)
+
+	m, err := migrations.New(db)
+	assert.NoError(t, err)
+	aplicadas, err := m.Up(ctx)
+	if !assert.NoError(t, err, "should upgrade the automigrate schema") {
+		return
+	}
+	assert.Len(t, aplicadas, len(m.Migrations()))
+	assert.True(t, db.Migrator().HasColumn("enrollments", "deleted_at"))
+	assert.True(t, db.Migrator().HasColumn("enrollments", "version"))
+
+	var vivos []string
+	assert.NoError(t, db.Raw("SELECT id FROM enrollments WHERE deleted_at IS NULL").Scan(&vivos).Error)
+	assert.Equal(t, []string{"e1"}, vivos)
+	err = db.Exec("INSERT INTO enrollments (id, user_id, course_id, status) VALUES ('e2', 'u1', 'c1', 'P')").Error
+	assert.Error(t, err, "should create the unique index")
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	m, err := migrations.New(nuevaDB(t))
+	assert.NoError(t, err)
+
+	t.Run("should run up, status and down", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, migrations.Run(ctx, m, []string{"up"}, &out))
+		assert.Contains(t, out.String(), "applied 0001_create_enrollments")
+
+		out.Reset()
+		assert.NoError(t, migrations.Run(ctx, m, []string{"status"}, &out))
+		assert.NotContains(t, out.String(), "pending")
+
+		out.Reset()
+		assert.NoError(t, migrations.Run(ctx, m, []string{"down"}, &out))
+		assert.Contains(t, out.String(), "reverted")
+	})
+
+	t.Run("should reject unknown commands and invalid steps", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.Error(t, migrations.Run(ctx, m, nil, &out))
+		assert.Error(t, migrations.Run(ctx, m, []string{"sideways"}, &out))
+		assert.Error(t, migrations.Run(ctx, m, []string{"down", "-1"}, &out))
+	})
+}
@@ -0,0 +1,11 @@
+-- IF NOT EXISTS para que las bbdd que ya se crearon con AutoMigrate queden registradas sin tocarlas
+CREATE TABLE IF NOT EXISTS enrollments (
+    id char(36) NOT NULL,
+    user_id char(36),
+    course_id char(36),
+    status char(2),
+    created_at datetime(3) NULL,
+    updated_at datetime(3) NULL,
+    deleted_at datetime(3) NULL,
+    PRIMARY KEY (id)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS course_capacities (
+    course_id char(36) NOT NULL,
+    capacity bigint NOT NULL,
+    created_at datetime(3) NULL,
+    updated_at datetime(3) NULL,
+    PRIMARY KEY (course_id)
+);
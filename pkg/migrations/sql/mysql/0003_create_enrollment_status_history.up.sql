@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS enrollment_status_history (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    enrollment_id char(36) NOT NULL,
+    old_status char(2),
+    new_status char(2) NOT NULL,
+    actor varchar(100) NOT NULL,
+    created_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_enrollment_status_history_enrollment_id (enrollment_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE enrollments DROP COLUMN version;
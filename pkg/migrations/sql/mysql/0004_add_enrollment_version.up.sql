@@ -0,0 +1,2 @@
+-- version se incrementa en cada escritura del enrollment (ETag / If-Match del PATCH)
+ALTER TABLE enrollments ADD COLUMN version bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,15 @@
+-- Outbox transaccional: los eventos se insertan en la misma transaccion que el cambio y el relay los publica despues
+CREATE TABLE IF NOT EXISTS outbox (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    event_id char(36) NOT NULL,
+    event_type varchar(50) NOT NULL,
+    enrollment_id char(36) NOT NULL,
+    payload text NOT NULL,
+    created_at datetime(3) NULL,
+    published_at datetime(3) NULL,
+    attempts int NOT NULL DEFAULT 0,
+    last_error text NULL,
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_outbox_event_id (event_id),
+    INDEX idx_outbox_published_at (published_at)
+);
@@ -0,0 +1,30 @@
+-- Suscripciones de webhooks (event_types separados por coma, vacio es todos) y el log de entregas
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id char(36) NOT NULL,
+    url varchar(2048) NOT NULL,
+    event_types varchar(255) NOT NULL DEFAULT '',
+    course_id char(36) NOT NULL DEFAULT '',
+    secret varchar(255) NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    created_at datetime(3) NULL,
+    updated_at datetime(3) NULL,
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    subscription_id char(36) NOT NULL,
+    event_id char(36) NOT NULL,
+    event_type varchar(50) NOT NULL,
+    payload text NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at datetime(3) NOT NULL,
+    last_status_code int NOT NULL DEFAULT 0,
+    last_error text NULL,
+    delivered_at datetime(3) NULL,
+    created_at datetime(3) NULL,
+    updated_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_webhook_deliveries_subscription_event (subscription_id, event_id),
+    INDEX idx_webhook_deliveries_status_next_attempt (status, next_attempt_at)
+);
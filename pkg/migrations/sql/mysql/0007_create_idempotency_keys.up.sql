@@ -0,0 +1,14 @@
+-- Respuestas guardadas por Idempotency-Key (por actor y ruta), status_code 0 es que el request original sigue en curso
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    actor varchar(100) NOT NULL,
+    path varchar(100) NOT NULL,
+    idempotency_key varchar(255) NOT NULL,
+    request_hash char(64) NOT NULL,
+    status_code int NOT NULL DEFAULT 0,
+    response_headers text NULL,
+    response_body mediumtext NULL,
+    created_at datetime(3) NOT NULL,
+    expires_at datetime(3) NOT NULL,
+    PRIMARY KEY (actor, path, idempotency_key),
+    INDEX idx_idempotency_keys_expires_at (expires_at)
+);
@@ -0,0 +1,3 @@
+-- Las bbdd creadas con el AutoMigrate de antes de las migraciones quedan registradas por el IF NOT EXISTS de la 0001
+-- sin tocarlas, y la tabla enrollments de la primera version no tiene deleted_at (la 0009 y el soft delete la usan)
+-- La columna se agrega en Go antes de este archivo (pasos en migrations.go) porque solo se puede si no existe
@@ -0,0 +1,3 @@
+-- No se vuelve al indice (user_id, course_id) sin filtrar: con los borrados de la subida puede haber filas repetidas
+DROP INDEX idx_enrollments_user_course_active ON enrollments;
+ALTER TABLE enrollments DROP COLUMN active_key;
@@ -0,0 +1,23 @@
+-- El user solo puede tener un enrollment vivo por curso, los borrados (soft delete) no cuentan
+-- mysql no tiene indices parciales: active_key es 1 en las filas vivas y NULL en las borradas (los NULL no chocan en un unique)
+-- El indice viejo (user_id, course_id) solo existe si la bbdd se creo con una version anterior de la 0001
+SET @existe := (SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'enrollments' AND index_name = 'idx_enrollments_user_course');
+SET @sentencia := IF(@existe > 0, 'DROP INDEX idx_enrollments_user_course ON enrollments', 'DO 0');
+PREPARE borrar_indice FROM @sentencia;
+EXECUTE borrar_indice;
+DEALLOCATE PREPARE borrar_indice;
+-- Antes del indice se sacan los duplicados que ya hay en la bbdd (si no el CREATE INDEX falla y el servicio no arranca):
+-- por cada (user_id, course_id) queda vivo el mas nuevo que no este Inactive y los demas se borran con soft delete
+-- (siguen en la tabla y se pueden ver con include_deleted). No se escribe historial ni eventos de estos borrados
+UPDATE enrollments e JOIN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (
+            PARTITION BY user_id, course_id
+            ORDER BY CASE WHEN status = 'I' THEN 1 ELSE 0 END, CASE WHEN created_at IS NULL THEN 1 ELSE 0 END, created_at DESC, id DESC
+        ) AS fila
+        FROM enrollments WHERE deleted_at IS NULL
+    ) duplicados WHERE fila > 1
+) perdedores ON perdedores.id = e.id
+SET e.deleted_at = CURRENT_TIMESTAMP(3), e.version = e.version + 1;
+ALTER TABLE enrollments ADD COLUMN active_key tinyint GENERATED ALWAYS AS (IF(deleted_at IS NULL, 1, NULL)) VIRTUAL;
+CREATE UNIQUE INDEX idx_enrollments_user_course_active ON enrollments (user_id, course_id, active_key);
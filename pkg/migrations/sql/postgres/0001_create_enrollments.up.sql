@@ -0,0 +1,10 @@
+-- varchar en vez de char: en postgres los char(n) se devuelven rellenos con espacios ("P" vuelve como "P ")
+CREATE TABLE IF NOT EXISTS enrollments (
+    id varchar(36) NOT NULL PRIMARY KEY,
+    user_id varchar(36),
+    course_id varchar(36),
+    status varchar(2),
+    created_at timestamptz NULL,
+    updated_at timestamptz NULL,
+    deleted_at timestamptz NULL
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS course_capacities (
+    course_id varchar(36) NOT NULL PRIMARY KEY,
+    capacity bigint NOT NULL,
+    created_at timestamptz NULL,
+    updated_at timestamptz NULL
+);
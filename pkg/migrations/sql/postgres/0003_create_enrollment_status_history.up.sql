@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS enrollment_status_history (
+    id bigserial PRIMARY KEY,
+    enrollment_id varchar(36) NOT NULL,
+    old_status varchar(2),
+    new_status varchar(2) NOT NULL,
+    actor varchar(100) NOT NULL,
+    created_at timestamptz NULL
+);
+CREATE INDEX IF NOT EXISTS idx_enrollment_status_history_enrollment_id ON enrollment_status_history (enrollment_id);
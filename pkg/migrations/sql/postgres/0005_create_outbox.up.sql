@@ -0,0 +1,14 @@
+-- Outbox transaccional: los eventos se insertan en la misma transaccion que el cambio y el relay los publica despues
+CREATE TABLE IF NOT EXISTS outbox (
+    id bigserial PRIMARY KEY,
+    event_id varchar(36) NOT NULL,
+    event_type varchar(50) NOT NULL,
+    enrollment_id varchar(36) NOT NULL,
+    payload text NOT NULL,
+    created_at timestamptz NULL,
+    published_at timestamptz NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_event_id ON outbox (event_id);
+CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox (published_at);
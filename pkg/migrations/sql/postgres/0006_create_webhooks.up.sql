@@ -0,0 +1,28 @@
+-- Suscripciones de webhooks (event_types separados por coma, vacio es todos) y el log de entregas
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id varchar(36) PRIMARY KEY,
+    url varchar(2048) NOT NULL,
+    event_types varchar(255) NOT NULL DEFAULT '',
+    course_id varchar(36) NOT NULL DEFAULT '',
+    secret varchar(255) NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamptz NULL,
+    updated_at timestamptz NULL
+);
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    subscription_id varchar(36) NOT NULL,
+    event_id varchar(36) NOT NULL,
+    event_type varchar(50) NOT NULL,
+    payload text NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL,
+    last_status_code integer NOT NULL DEFAULT 0,
+    last_error text NULL,
+    delivered_at timestamptz NULL,
+    created_at timestamptz NULL,
+    updated_at timestamptz NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription_event ON webhook_deliveries (subscription_id, event_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_next_attempt ON webhook_deliveries (status, next_attempt_at);
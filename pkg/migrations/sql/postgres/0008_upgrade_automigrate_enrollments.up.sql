@@ -0,0 +1,7 @@
+-- Las bbdd creadas con el AutoMigrate de antes de las migraciones quedan registradas por el IF NOT EXISTS de la 0001
+-- sin tocarlas, y la tabla enrollments de la primera version no tiene deleted_at (la 0009 y el soft delete la usan)
+-- La columna se agrega en Go antes de este archivo (pasos en migrations.go) porque solo se puede si no existe
+-- El AutoMigrate dejaba los ids y status en char(n), que postgres devuelve rellenos con espacios ("P" vuelve como "P ")
+ALTER TABLE enrollments ALTER COLUMN user_id TYPE varchar(36), ALTER COLUMN course_id TYPE varchar(36), ALTER COLUMN status TYPE varchar(2);
+ALTER TABLE course_capacities ALTER COLUMN course_id TYPE varchar(36);
+ALTER TABLE enrollment_status_history ALTER COLUMN enrollment_id TYPE varchar(36), ALTER COLUMN old_status TYPE varchar(2), ALTER COLUMN new_status TYPE varchar(2);
@@ -0,0 +1,2 @@
+-- failed_at marca los eventos que el relay dejo de reintentar (superaron OUTBOX_MAX_ATTEMPTS o el payload no se puede leer)
+ALTER TABLE outbox ADD COLUMN failed_at timestamptz NULL;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS enrollments (
+    id char(36) NOT NULL PRIMARY KEY,
+    user_id char(36),
+    course_id char(36),
+    status char(2),
+    created_at datetime NULL,
+    updated_at datetime NULL,
+    deleted_at datetime NULL
+);
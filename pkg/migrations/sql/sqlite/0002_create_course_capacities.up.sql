@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS course_capacities (
+    course_id char(36) NOT NULL PRIMARY KEY,
+    capacity integer NOT NULL,
+    created_at datetime NULL,
+    updated_at datetime NULL
+);
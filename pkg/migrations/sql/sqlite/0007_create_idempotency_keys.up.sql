@@ -0,0 +1,14 @@
+-- Respuestas guardadas por Idempotency-Key (por actor y ruta), status_code 0 es que el request original sigue en curso
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    actor varchar(100) NOT NULL,
+    path varchar(100) NOT NULL,
+    idempotency_key varchar(255) NOT NULL,
+    request_hash char(64) NOT NULL,
+    status_code integer NOT NULL DEFAULT 0,
+    response_headers text NULL,
+    response_body text NULL,
+    created_at datetime NOT NULL,
+    expires_at datetime NOT NULL,
+    PRIMARY KEY (actor, path, idempotency_key)
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
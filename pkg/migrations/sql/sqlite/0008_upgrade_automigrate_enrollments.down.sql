@@ -0,0 +1 @@
+-- No se revierte: deleted_at es parte de la tabla de la 0001, sacarla dejaria mal las bbdd creadas con las migraciones
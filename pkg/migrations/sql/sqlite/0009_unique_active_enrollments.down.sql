@@ -0,0 +1,2 @@
+-- No se vuelve al indice (user_id, course_id) sin filtrar: con los borrados de la subida puede haber filas repetidas
+DROP INDEX IF EXISTS idx_enrollments_user_course_active;
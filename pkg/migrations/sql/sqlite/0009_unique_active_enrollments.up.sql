@@ -0,0 +1,17 @@
+-- El user solo puede tener un enrollment vivo por curso, los borrados (soft delete) no cuentan (indice parcial)
+-- El indice viejo (user_id, course_id) solo existe si la bbdd se creo con una version anterior de la 0001
+DROP INDEX IF EXISTS idx_enrollments_user_course;
+-- Antes del indice se sacan los duplicados que ya hay en la bbdd (si no el CREATE INDEX falla y el servicio no arranca):
+-- por cada (user_id, course_id) queda vivo el mas nuevo que no este Inactive y los demas se borran con soft delete
+-- (siguen en la tabla y se pueden ver con include_deleted). No se escribe historial ni eventos de estos borrados
+UPDATE enrollments SET deleted_at = CURRENT_TIMESTAMP, version = version + 1
+WHERE deleted_at IS NULL AND id IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (
+            PARTITION BY user_id, course_id
+            ORDER BY CASE WHEN status = 'I' THEN 1 ELSE 0 END, CASE WHEN created_at IS NULL THEN 1 ELSE 0 END, created_at DESC, id DESC
+        ) AS fila
+        FROM enrollments WHERE deleted_at IS NULL
+    ) duplicados WHERE fila > 1
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_enrollments_user_course_active ON enrollments (user_id, course_id) WHERE deleted_at IS NULL;
@@ -0,0 +1,105 @@
+// Test funcionales de la auth con JWT (HTTP y gRPC)
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/pb"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// getConToken hace un GET con ese Authorization (vacio es sin header)
+func getConToken(t *testing.T, path, authorization string) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, urlBase+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestAuth(t *testing.T) {
+	vencido := firmarToken(jwt.SigningMethodHS256, auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "user_test",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+	}})
+	otroSecret, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "user_test",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}).SignedString([]byte("otro-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should reject requests without a valid token with a 401", func(t *testing.T) {
+		casos := map[string]string{
+			"without token":   "",
+			"another scheme":  "Basic dXNlcjpwYXNz",
+			"expired token":   "Bearer " + vencido,
+			"another secret":  "Bearer " + otroSecret,
+			"malformed token": "Bearer abc.def.ghi",
+		}
+		for nombre, authorization := range casos {
+			resp := getConToken(t, "/enrollments", authorization)
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "should return status code 401 (%s)", nombre)
+			assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "Bearer", nombre)
+
+			body := response.ErrorResponse{}
+			assert.Nil(t, json.NewDecoder(resp.Body).Decode(&body), nombre)
+			assert.Equal(t, http.StatusUnauthorized, body.Status, nombre)
+			assert.NotEmpty(t, body.Message, nombre)
+		}
+	})
+
+	t.Run("should accept HS256 and RS256 tokens", func(t *testing.T) {
+		resp := getConToken(t, "/enrollments", "Bearer "+token)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+
+		rs256 := firmarToken(jwt.SigningMethodRS256, auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user_rsa"}, Roles: []string{auth.RoleStudent}})
+		resp = getConToken(t, "/enrollments", "Bearer "+rs256)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+	})
+
+	t.Run("should keep the health check public", func(t *testing.T) {
+		resp := getConToken(t, "/health", "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+	})
+
+	t.Run("should accept the token in the query only for the stream", func(t *testing.T) {
+		resp := getConToken(t, "/enrollments?access_token="+token, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "should return status code 401")
+
+		resp = getConToken(t, "/enrollments/stream?access_token="+token, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("should reject gRPC calls without a token", func(t *testing.T) {
+		conn, err := grpc.NewClient(grpcAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		_, err = pb.NewEnrollmentServiceClient(conn).GetAll(context.Background(), &pb.GetAllRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "should map 401 to Unauthenticated")
+	})
+}
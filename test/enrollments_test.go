@@ -71,6 +71,26 @@ func TestEnrollment(t *testing.T) {
 		assert.Equal(t, dataCreated.UserID, dataGetAll[0].UserID, "should return the same user id")
 		assert.Equal(t, dataCreated.CourseID, dataGetAll[0].CourseID, "should return the same course id")
 		assert.Equal(t, dataCreated.Status, dataGetAll[0].Status, "should return status active")
+
+		//Ahora un **get** por id
+		resp = cli.Get("/enrollments/" + dataCreated.ID)
+		assert.Nil(t, resp.Err, "should not return an error")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+
+		dataGet := domain.Enrollment{}
+		dataRespGet := response.SuccessResponse{Data: &dataGet}
+		err = resp.FillUp(&dataRespGet)
+		assert.Nil(t, err, "should not return an error")
+
+		assert.Equal(t, dataCreated.ID, dataGet.ID, "should return the same enrollment id")
+		assert.Equal(t, dataCreated.UserID, dataGet.UserID, "should return the same user id")
+		assert.Equal(t, dataCreated.CourseID, dataGet.CourseID, "should return the same course id")
+	})
+
+	t.Run("should return not found on get with unknown id", func(t *testing.T) {
+		resp := cli.Get("/enrollments/unknown_id_test")
+		assert.Nil(t, resp.Err, "should not return an error")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "should return status code 404")
 	})
 
 	t.Run("should update an enrollment", func(t *testing.T) {
@@ -130,5 +150,285 @@ func TestEnrollment(t *testing.T) {
 		assert.Equal(t, dataUpdated.ID, dataGetAll[0].ID, "should return the same enrollment id")
 		assert.Equal(t, dataUpdated.Status, dataGetAll[0].Status, "should return status active")
 
+		//Ahora el **historial**, debe tener la creacion (P) y el cambio a A
+		resp = cli.Get("/enrollments/" + dataCreated.ID + "/history")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+
+		dataHistory := []enrollment.StatusHistory{}
+		err = resp.FillUp(&response.SuccessResponse{Data: &dataHistory})
+		assert.Nil(t, err, "should not return an error")
+		assert.Len(t, dataHistory, 2, "should return 2 status changes")
+		assert.Equal(t, domain.Pending, dataHistory[0].NewStatus, "first change should be to pending")
+		assert.Equal(t, domain.Pending, dataHistory[1].OldStatus, "second change should be from pending")
+		assert.Equal(t, domain.Active, dataHistory[1].NewStatus, "second change should be to active")
+
+	})
+
+	t.Run("should not allow an invalid status transition", func(t *testing.T) {
+		bodyRequest := enrollment.CreateRequest{
+			UserID:   "user3_test",
+			CourseID: "course3_test",
+		}
+
+		resp := cli.Post("/enrollments", bodyRequest)
+		assert.Nil(t, resp.Err, "should not return an error")
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+
+		dataCreated := domain.Enrollment{}
+		dataRespCreated := response.SuccessResponse{Data: &dataCreated}
+		err := resp.FillUp(&dataRespCreated)
+		assert.Nil(t, err, "should not return an error")
+
+		//De Pending no se puede pasar directo a Studying
+		status := "S"
+		resp = cli.Patch("/enrollments/"+dataCreated.ID, enrollment.UpdateRequest{Status: &status})
+		assert.Nil(t, resp.Err, "should not return an error")
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "should return status code 409")
+	})
+
+	t.Run("should reject a stale If-Match with 412", func(t *testing.T) {
+		resp := cli.Post("/enrollments", enrollment.CreateRequest{UserID: "user_etag_test", CourseID: "course_etag_test"})
+		assert.Nil(t, resp.Err, "should not return an error")
+		dataCreated := domain.Enrollment{}
+		err := resp.FillUp(&response.SuccessResponse{Data: &dataCreated})
+		assert.Nil(t, err, "should not return an error")
+
+		//El GET devuelve la version como ETag
+		getResp, err := doRequest(http.MethodGet, "/enrollments/"+dataCreated.ID, nil)
+		assert.Nil(t, err, "should not return an error")
+		getResp.Body.Close()
+		etag := getResp.Header.Get("ETag")
+		assert.Equal(t, `"1"`, etag, "should return the version as ETag")
+
+		//Con el ETag que leimos se actualiza y devuelve el nuevo
+		status := "A"
+		patchResp, err := doRequestWithHeaders(http.MethodPatch, "/enrollments/"+dataCreated.ID, enrollment.UpdateRequest{Status: &status}, map[string]string{"If-Match": etag})
+		assert.Nil(t, err, "should not return an error")
+		patchResp.Body.Close()
+		assert.Equal(t, http.StatusOK, patchResp.StatusCode, "should return status code 200")
+		assert.Equal(t, `"2"`, patchResp.Header.Get("ETag"), "should return the new version as ETag")
+
+		//Otro PATCH con el ETag viejo ya no corresponde
+		status = "S"
+		patchResp, err = doRequestWithHeaders(http.MethodPatch, "/enrollments/"+dataCreated.ID, enrollment.UpdateRequest{Status: &status}, map[string]string{"If-Match": etag})
+		assert.Nil(t, err, "should not return an error")
+		patchResp.Body.Close()
+		assert.Equal(t, http.StatusPreconditionFailed, patchResp.StatusCode, "should return status code 412")
+	})
+
+	t.Run("should not allow a duplicated enrollment", func(t *testing.T) {
+		bodyRequest := enrollment.CreateRequest{
+			UserID:   "user4_test",
+			CourseID: "course4_test",
+		}
+
+		resp := cli.Post("/enrollments", bodyRequest)
+		assert.Nil(t, resp.Err, "should not return an error")
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+
+		//El mismo user en el mismo curso debe dar conflicto
+		resp = cli.Post("/enrollments", bodyRequest)
+		assert.Nil(t, resp.Err, "should not return an error")
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "should return status code 409")
+	})
+
+	t.Run("should publish the outbox events of a new enrollment", func(t *testing.T) {
+		resp := cli.Post("/enrollments", enrollment.CreateRequest{UserID: "user_outbox_test", CourseID: "course_outbox_test"})
+		assert.Nil(t, resp.Err, "should not return an error")
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+		dataCreated := domain.Enrollment{}
+		assert.Nil(t, resp.FillUp(&response.SuccessResponse{Data: &dataCreated}))
+
+		publicarOutbox(t)
+
+		var tipos []string
+		for _, evento := range eventos.Events() {
+			if evento.EnrollmentID == dataCreated.ID {
+				tipos = append(tipos, evento.Type)
+			}
+		}
+		assert.Equal(t, []string{enrollment.EventEnrollmentCreated}, tipos, "should publish the created event once")
+	})
+
+	t.Run("should soft delete and restore an enrollment", func(t *testing.T) {
+		bodyRequest := enrollment.CreateRequest{
+			UserID:   "user5_test",
+			CourseID: "course5_test",
+		}
+
+		resp := cli.Post("/enrollments", bodyRequest)
+		assert.Nil(t, resp.Err, "should not return an error")
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+
+		dataCreated := domain.Enrollment{}
+		dataRespCreated := response.SuccessResponse{Data: &dataCreated}
+		err := resp.FillUp(&dataRespCreated)
+		assert.Nil(t, err, "should not return an error")
+
+		//El DELETE lo hacemos directo con net/http
+		deleteResp, err := doRequest(http.MethodDelete, "/enrollments/"+dataCreated.ID, nil)
+		assert.Nil(t, err, "should not return an error")
+		deleteResp.Body.Close()
+		assert.Equal(t, http.StatusOK, deleteResp.StatusCode, "should return status code 200")
+
+		//Ya no se debe encontrar por id ni en el getall
+		resp = cli.Get("/enrollments/" + dataCreated.ID)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "should return status code 404")
+
+		resp = cli.Get("/enrollments?user_id=" + dataCreated.UserID)
+		dataGetAll := []domain.Enrollment{}
+		err = resp.FillUp(&response.SuccessResponse{Data: &dataGetAll})
+		assert.Nil(t, err, "should not return an error")
+		assert.Empty(t, dataGetAll, "should not return deleted enrollments")
+
+		//Con include_deleted si aparece
+		resp = cli.Get("/enrollments?include_deleted=true&user_id=" + dataCreated.UserID)
+		dataGetAll = []domain.Enrollment{}
+		err = resp.FillUp(&response.SuccessResponse{Data: &dataGetAll})
+		assert.Nil(t, err, "should not return an error")
+		assert.Len(t, dataGetAll, 1, "should return the deleted enrollment")
+
+		//Restauramos y se vuelve a encontrar
+		resp = cli.Post("/enrollments/"+dataCreated.ID+"/restore", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+
+		resp = cli.Get("/enrollments/" + dataCreated.ID)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+	})
+
+	t.Run("should waitlist when the course is full and promote when a seat is freed", func(t *testing.T) {
+		courseid := "course6_test"
+
+		//El curso tiene 1 solo cupo
+		capResp, err := doRequest(http.MethodPut, "/courses/"+courseid+"/capacity", map[string]int{"capacity": 1})
+		assert.Nil(t, err, "should not return an error")
+		capResp.Body.Close()
+		assert.Equal(t, http.StatusOK, capResp.StatusCode, "should return status code 200")
+
+		resp := cli.Post("/enrollments", enrollment.CreateRequest{UserID: "user6a_test", CourseID: courseid})
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+		primero := domain.Enrollment{}
+		err = resp.FillUp(&response.SuccessResponse{Data: &primero})
+		assert.Nil(t, err, "should not return an error")
+
+		//El segundo queda en lista de espera
+		resp = cli.Post("/enrollments", enrollment.CreateRequest{UserID: "user6b_test", CourseID: courseid})
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode, "should return status code 202")
+		segundo := enrollment.WaitlistedEnrollment{Enrollment: &domain.Enrollment{}}
+		err = resp.FillUp(&response.SuccessResponse{Data: &segundo})
+		assert.Nil(t, err, "should not return an error")
+		assert.Equal(t, enrollment.Waitlisted, segundo.Status, "should return status waitlisted")
+		assert.Equal(t, 1, segundo.WaitlistPosition, "should be first in the waitlist")
+
+		//Al borrar el primero, el segundo pasa a Pending
+		deleteResp, err := doRequest(http.MethodDelete, "/enrollments/"+primero.ID, nil)
+		assert.Nil(t, err, "should not return an error")
+		deleteResp.Body.Close()
+
+		resp = cli.Get("/enrollments/" + segundo.ID)
+		promovido := domain.Enrollment{}
+		err = resp.FillUp(&response.SuccessResponse{Data: &promovido})
+		assert.Nil(t, err, "should not return an error")
+		assert.Equal(t, domain.Pending, promovido.Status, "should be promoted to pending")
+	})
+
+	t.Run("should page with cursor without repeating enrollments", func(t *testing.T) {
+		courseid := "course7_test"
+		for _, userid := range []string{"user7a_test", "user7b_test", "user7c_test"} {
+			resp := cli.Post("/enrollments", enrollment.CreateRequest{UserID: userid, CourseID: courseid})
+			assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+		}
+
+		vistos := map[string]bool{}
+		path := "/enrollments?course_id=" + courseid + "&limit=2&count=false"
+		for pagina := 0; pagina < 3; pagina++ {
+			resp := cli.Get(path)
+			assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+
+			enrolls := []domain.Enrollment{}
+			dataResp := struct {
+				Data *[]domain.Enrollment `json:"data"`
+				Meta enrollment.ListMeta  `json:"meta"`
+			}{Data: &enrolls}
+			err := resp.FillUp(&dataResp)
+			assert.Nil(t, err, "should not return an error")
+			assert.Nil(t, dataResp.Meta.TotalCount, "should not count with count=false")
+			assert.Nil(t, dataResp.Meta.PageCount, "should not know the pages with count=false")
+
+			for _, e := range enrolls {
+				assert.False(t, vistos[e.ID], "should not repeat enrollments between pages")
+				vistos[e.ID] = true
+			}
+			if dataResp.Meta.NextCursor == "" {
+				break
+			}
+			path = "/enrollments?course_id=" + courseid + "&limit=2&count=false&cursor=" + dataResp.Meta.NextCursor
+		}
+		assert.Len(t, vistos, 3, "should return all the enrollments")
+
+		dataResp := struct {
+			Meta enrollment.ListMeta `json:"meta"`
+		}{}
+		resp := cli.Get("/enrollments?course_id=" + courseid + "&limit=2")
+		assert.Nil(t, resp.FillUp(&dataResp), "should not return an error")
+		if assert.NotNil(t, dataResp.Meta.TotalCount) && assert.NotNil(t, dataResp.Meta.PageCount) {
+			assert.Equal(t, 3, *dataResp.Meta.TotalCount)
+			assert.Equal(t, 2, *dataResp.Meta.PageCount, "should return the page count with the total")
+		}
+	})
+
+	t.Run("should filter by several users and statuses", func(t *testing.T) {
+		courseid := "course8_test"
+		var activo domain.Enrollment
+		for _, userid := range []string{"user8a_test", "user8b_test", "user8c_test"} {
+			resp := cli.Post("/enrollments", enrollment.CreateRequest{UserID: userid, CourseID: courseid})
+			assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+			if userid == "user8a_test" {
+				err := resp.FillUp(&response.SuccessResponse{Data: &activo})
+				assert.Nil(t, err, "should not return an error")
+			}
+		}
+		status := "A"
+		resp := cli.Patch("/enrollments/"+activo.ID, enrollment.UpdateRequest{Status: &status})
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+
+		resp = cli.Get("/enrollments?course_id=" + courseid + "&user_id=user8a_test,user8b_test&status=P,A")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+		enrolls := []domain.Enrollment{}
+		err := resp.FillUp(&response.SuccessResponse{Data: &enrolls})
+		assert.Nil(t, err, "should not return an error")
+		assert.Len(t, enrolls, 2, "should only return the listed users")
+
+		resp = cli.Get("/enrollments?course_id=" + courseid + "&exclude_status=P")
+		enrolls = []domain.Enrollment{}
+		err = resp.FillUp(&response.SuccessResponse{Data: &enrolls})
+		assert.Nil(t, err, "should not return an error")
+		assert.Len(t, enrolls, 1, "should exclude pending enrollments")
+		assert.Equal(t, activo.ID, enrolls[0].ID, "should return the active enrollment")
+
+		resp = cli.Get("/enrollments?status=X")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "should return status code 400")
+		resp = cli.Get("/enrollments?created_from=yesterday")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "should return status code 400")
+	})
+
+	t.Run("should sort by the requested columns", func(t *testing.T) {
+		courseid := "course9_test"
+		for _, userid := range []string{"user9b_test", "user9c_test", "user9a_test"} {
+			resp := cli.Post("/enrollments", enrollment.CreateRequest{UserID: userid, CourseID: courseid})
+			assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+		}
+
+		resp := cli.Get("/enrollments?course_id=" + courseid + "&sort=user_id")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+		enrolls := []domain.Enrollment{}
+		err := resp.FillUp(&response.SuccessResponse{Data: &enrolls})
+		assert.Nil(t, err, "should not return an error")
+		assert.Len(t, enrolls, 3, "should return all the enrollments")
+		assert.Equal(t, "user9a_test", enrolls[0].UserID, "should sort by user_id")
+		assert.Equal(t, "user9c_test", enrolls[2].UserID, "should sort by user_id")
+
+		resp = cli.Get("/enrollments?sort=password")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "should return status code 400")
 	})
 }
@@ -0,0 +1,81 @@
+// Test funcionales del transporte gRPC (mismos endpoints que el HTTP)
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPC(t *testing.T) {
+	ctx := context.Background()
+	courseid := "course_grpc_test"
+	var creado *pb.Enrollment
+
+	t.Run("should create and get an enrollment", func(t *testing.T) {
+		resp, err := grpcCli.Create(ctx, &pb.CreateRequest{UserId: "user_grpc_test", CourseId: courseid})
+		if !assert.Nil(t, err, "should not return an error") {
+			return
+		}
+		creado = resp.GetEnrollment()
+		assert.NotEmpty(t, creado.GetId())
+		assert.Equal(t, "P", creado.GetStatus())
+
+		got, err := grpcCli.Get(ctx, &pb.GetRequest{Id: creado.GetId()})
+		assert.Nil(t, err, "should not return an error")
+		assert.Equal(t, creado.GetId(), got.GetEnrollment().GetId())
+		assert.Equal(t, courseid, got.GetEnrollment().GetCourseId())
+		assert.NotEmpty(t, got.GetEtag(), "should return the etag")
+	})
+
+	t.Run("should update with if_match and list by course", func(t *testing.T) {
+		if creado == nil {
+			t.Skip("the enrollment was not created")
+		}
+		got, err := grpcCli.Get(ctx, &pb.GetRequest{Id: creado.GetId()})
+		assert.Nil(t, err, "should not return an error")
+
+		actualizado, err := grpcCli.Update(ctx, &pb.UpdateRequest{Id: creado.GetId(), Status: "A", IfMatch: got.GetEtag()})
+		assert.Nil(t, err, "should not return an error")
+		assert.Equal(t, "A", actualizado.GetStatus())
+		assert.NotEqual(t, got.GetEtag(), actualizado.GetEtag(), "should return the new etag")
+
+		_, err = grpcCli.Update(ctx, &pb.UpdateRequest{Id: creado.GetId(), Status: "S", IfMatch: got.GetEtag()})
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "should map 412 to FailedPrecondition")
+
+		lista, err := grpcCli.GetAll(ctx, &pb.GetAllRequest{CourseId: courseid})
+		assert.Nil(t, err, "should not return an error")
+		if assert.Len(t, lista.GetEnrollments(), 1) {
+			assert.Equal(t, "A", lista.GetEnrollments()[0].GetStatus())
+		}
+		assert.Equal(t, int32(1), lista.GetMeta().GetTotalCount())
+		assert.Equal(t, int32(1), lista.GetMeta().GetPageCount())
+
+		lista, err = grpcCli.GetAll(ctx, &pb.GetAllRequest{CourseId: courseid, SkipCount: true})
+		assert.Nil(t, err, "should not return an error")
+		assert.Len(t, lista.GetEnrollments(), 1)
+		assert.Nil(t, lista.GetMeta().TotalCount, "should not count with skip_count")
+		assert.Nil(t, lista.GetMeta().PageCount)
+	})
+
+	t.Run("should map the error status codes", func(t *testing.T) {
+		_, err := grpcCli.Create(ctx, &pb.CreateRequest{CourseId: courseid})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "should map 400 to InvalidArgument")
+
+		_, err = grpcCli.Create(ctx, &pb.CreateRequest{UserId: "user_grpc_test", CourseId: courseid})
+		assert.Equal(t, codes.Aborted, status.Code(err), "should map 409 to Aborted")
+
+		_, err = grpcCli.Get(ctx, &pb.GetRequest{Id: "no-existe"})
+		assert.Equal(t, codes.NotFound, status.Code(err), "should map 404 to NotFound")
+
+		_, err = grpcCli.Update(ctx, &pb.UpdateRequest{Id: "no-existe"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "should require the status")
+
+		_, err = grpcCli.GetAll(ctx, &pb.GetAllRequest{Status: "X"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
@@ -0,0 +1,111 @@
+// Test funcionales del Idempotency-Key en POST /enrollments y /enrollments/bulk
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/idempotency"
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+// postIdempotente hace el POST con esa Idempotency-Key y devuelve la respuesta con el body ya leido
+func postIdempotente(t *testing.T, path, key string, body interface{}) (*http.Response, []byte) {
+	resp, err := doRequestWithHeaders(http.MethodPost, path, body, map[string]string{"Idempotency-Key": key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, b
+}
+
+func TestIdempotency(t *testing.T) {
+	courseid := "course_idempotency_test"
+
+	t.Run("should replay the create for a retry with the same body", func(t *testing.T) {
+		req := enrollment.CreateRequest{UserID: "user_idempotency_test", CourseID: courseid}
+		primera, body := postIdempotente(t, "/enrollments", "create-1", req)
+		assert.Equal(t, http.StatusCreated, primera.StatusCode, "should return status code 201")
+		assert.Empty(t, primera.Header.Get("Idempotent-Replayed"))
+
+		reintento, bodyReintento := postIdempotente(t, "/enrollments", "create-1", req)
+		assert.Equal(t, http.StatusCreated, reintento.StatusCode, "should replay the status code 201")
+		assert.Equal(t, "true", reintento.Header.Get("Idempotent-Replayed"))
+		assert.Equal(t, primera.Header.Get("Content-Type"), reintento.Header.Get("Content-Type"))
+		assert.JSONEq(t, string(body), string(bodyReintento))
+
+		lista := []domain.Enrollment{}
+		resp := cli.Get("/enrollments?course_id=" + courseid)
+		assert.Nil(t, resp.FillUp(&response.SuccessResponse{Data: &lista}))
+		assert.Len(t, lista, 1, "should not create a duplicate")
+	})
+
+	t.Run("should return 422 when the key comes with a different body", func(t *testing.T) {
+		resp, body := postIdempotente(t, "/enrollments", "create-1", enrollment.CreateRequest{UserID: "user_idempotency_other", CourseID: courseid})
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, "should return status code 422")
+		errResp := response.ErrorResponse{}
+		assert.Nil(t, json.Unmarshal(body, &errResp))
+		assert.Equal(t, http.StatusUnprocessableEntity, errResp.Status)
+	})
+
+	t.Run("should replay the bulk create", func(t *testing.T) {
+		req := enrollment.BulkCreateRequest{Items: []enrollment.CreateRequest{
+			{UserID: "user_idempotency_bulk_1", CourseID: courseid},
+			{UserID: "user_idempotency_bulk_2", CourseID: courseid},
+		}}
+		primera, body := postIdempotente(t, "/enrollments/bulk", "bulk-1", req)
+		assert.Equal(t, http.StatusOK, primera.StatusCode, "should return status code 200")
+
+		reintento, bodyReintento := postIdempotente(t, "/enrollments/bulk", "bulk-1", req)
+		assert.Equal(t, "true", reintento.Header.Get("Idempotent-Replayed"))
+		assert.JSONEq(t, string(body), string(bodyReintento), "should not answer 409 for the already created items")
+	})
+
+	t.Run("should store the client errors but not process them again", func(t *testing.T) {
+		req := enrollment.CreateRequest{CourseID: courseid}
+		resp, _ := postIdempotente(t, "/enrollments", "create-invalid", req)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "should return status code 400")
+		resp, _ = postIdempotente(t, "/enrollments", "create-invalid", req)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "should replay the status code 400")
+		assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+	})
+
+	t.Run("should reject the key without an actor when auth is disabled", func(t *testing.T) {
+		l := log.New(io.Discard, "", 0)
+		procesados := 0
+		h := handler.Idempotent(l, idempotency.NewStore(l, idempotency.NewMemoryRepo(l), idempotency.DefaultConfig),
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				procesados++
+				w.WriteHeader(http.StatusCreated)
+			}), "/enrollments")
+
+		post := func(headers map[string]string) int {
+			req := httptest.NewRequest(http.MethodPost, "/enrollments", strings.NewReader(`{"user_id":"u1","course_id":"c1"}`))
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		assert.Equal(t, http.StatusBadRequest, post(map[string]string{"Idempotency-Key": "k1"}), "should return status code 400")
+		assert.Equal(t, 0, procesados)
+		assert.Equal(t, http.StatusCreated, post(map[string]string{"Idempotency-Key": "k1", "X-Actor": "u1"}))
+		assert.Equal(t, http.StatusCreated, post(nil), "should pass without the header")
+		assert.Equal(t, 2, procesados)
+	})
+}
@@ -2,21 +2,36 @@
 package test
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
 	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/idempotency"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/webhook"
 
 	"github.com/IgnacioBO/gomicro_enrollment/pkg/bootstrap"
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/grpchandler"
 	"github.com/IgnacioBO/gomicro_enrollment/pkg/handler" //Manejar ruteo facilmente (paths y metodos)
+	"github.com/IgnacioBO/gomicro_enrollment/pkg/pb"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/gorm"
 
 	courseSdkMock "github.com/IgnacioBO/go_micro_sdk/course/mock"
 	userSdkMock "github.com/IgnacioBO/go_micro_sdk/user/mock"
@@ -29,6 +44,36 @@ import (
 // Usaremos el client que craemo en el paquete httpclient
 var cli client.Transport
 
+// grpcCli es el cliente del servidor gRPC, que corre al lado del HTTP con los mismos endpoints
+var grpcCli pb.EnrollmentServiceClient
+
+// grpcAddress es donde escucha el gRPC, para los test que se conectan sin token
+var grpcAddress string
+
+// El server de test valida tokens HS256 con testSecret y RS256 con la llave testRSAKey (kid testRSAKeyID)
+// token es el que usan cli, doRequest y grpcCli en todos los test
+const (
+	testSecret   = "test-secret"
+	testRSAKeyID = "test-rsa"
+)
+
+var (
+	testRSAKey *rsa.PrivateKey
+	token      string
+)
+
+// urlBase la usamos para los request que hacemos directo con net/http (ej: DELETE)
+var urlBase string
+
+// relay publica los eventos de la outbox en eventos (in-process), en los webhooks y en el stream, los test llaman relay.Flush
+// y deliverer.Flush para no depender del polling
+var (
+	relay     *enrollment.Relay
+	eventos   *enrollment.InProcessPublisher
+	deliverer *webhook.Deliverer
+	stream    *enrollment.StreamBroker
+)
+
 // Primero copiearmoes el codigo (main dentro de TestMain y las otras funcioens aprte) de cmd/main.go  y lo copieamores debajo de TestMain por ahora.
 func TestMain(m *testing.M) {
 
@@ -47,16 +92,30 @@ func TestMain(m *testing.M) {
 	}
 	enrollmentConfig := enrollment.Config{LimitPageDefault: pageLimDef}
 
-	db, err := bootstrap.DBConnection()
-	if err != nil {
-		log.Fatal(err)
-	}
+	//Con DB_DRIVER=memory los test corren sin bbdd (no hace falta levantar el docker-compose)
+	var enrollmentRepo enrollment.Repository
+	var webhookRepo webhook.Repository
+	var idempotencyRepo idempotency.Repository
+	var tx *gorm.DB
+	if bootstrap.DBDriver() == bootstrap.DriverMemory {
+		enrollmentRepo = enrollment.NewMemoryRepo(l)
+		webhookRepo = webhook.NewMemoryRepo(l)
+		idempotencyRepo = idempotency.NewMemoryRepo(l)
+	} else {
+		db, err := bootstrap.DBConnection()
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	//********Para eviar tocar la bbdd que usamos normalmente,
-	//EN vez de trabjar con la base de datos y pasarse al repo,
-	//Generaremos una transaccion, y le pasaremos esa transaccion al repo
-	//Y al finalizar LOS TEST HAREMOS UN ROLLBACK*****
-	tx := db.Begin()
+		//********Para eviar tocar la bbdd que usamos normalmente,
+		//EN vez de trabjar con la base de datos y pasarse al repo,
+		//Generaremos una transaccion, y le pasaremos esa transaccion al repo
+		//Y al finalizar LOS TEST HAREMOS UN ROLLBACK*****
+		tx = db.Begin()
+		enrollmentRepo = enrollment.NewRepo(l, tx)
+		webhookRepo = webhook.NewRepo(l, tx)
+		idempotencyRepo = idempotency.NewRepo(l, tx)
+	}
 
 	//**Aqui pasaremos los SDK mockeadsos*
 	userSdk := &userSdkMock.UserSdkMock{
@@ -72,21 +131,49 @@ func TestMain(m *testing.M) {
 		},
 	}
 
+	eventos = enrollment.NewInProcessPublisher()
+	stream = enrollment.NewStreamBroker(enrollment.StreamConfig{HeartbeatInterval: 100 * time.Millisecond})
+	publishers := enrollment.NewMultiPublisher(eventos, webhook.NewDispatcher(l, webhookRepo), stream)
+	relay = enrollment.NewRelay(l, enrollmentRepo.(enrollment.OutboxStore), publishers, enrollment.DefaultRelayConfig)
+	deliverer = webhook.NewDeliverer(l, webhookRepo, nil, webhook.DelivererConfig{MaxAttempts: 2, BaseBackoff: time.Millisecond, AllowPrivateNetworks: true})
+
 	ctx := context.Background()
-	enrollmentRepo := enrollment.NewRepo(l, tx)
-	enrollmentService := enrollment.NewService(l, userSdk, courseSdk, enrollmentRepo)
+	enrollmentService := enrollment.NewPolicyService(enrollment.NewService(l, userSdk, courseSdk, enrollmentRepo))
 	enrollmentEndpoint := enrollment.MakeEndpoints(enrollmentService, enrollmentConfig)
 	h := handler.NewUserHTTPServer(ctx, enrollmentEndpoint)
+	webhookEndpoints := webhook.MakeEndpoints(webhook.NewService(l, webhookRepo), webhook.Config{LimitPageDefault: pageLimDef})
+	webhookHandler := handler.RequireRole(auth.RoleAdmin, handler.NewWebhookHTTPServer(ctx, webhookEndpoints))
+	rutas := http.NewServeMux()
+	rutas.Handle("/webhooks", webhookHandler)
+	rutas.Handle("/webhooks/", webhookHandler)
+	rutas.Handle("GET /enrollments/stream", handler.NewStreamHandler(stream))
+	rutas.Handle("/", handler.Idempotent(l, idempotency.NewStore(l, idempotencyRepo, idempotency.DefaultConfig), h, "/enrollments", "/enrollments/bulk"))
+
+	//Auth igual que en cmd/main.go, con un secret HS256 y una llave RS256 generada para los test
+	var err error
+	if testRSAKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		log.Fatal(err)
+	}
+	verifier, err := auth.NewVerifier(auth.KeySet{
+		{Algorithm: auth.AlgHS256, Secret: []byte(testSecret)},
+		{ID: testRSAKeyID, Algorithm: auth.AlgRS256, PublicKey: &testRSAKey.PublicKey},
+	}, auth.VerifierConfig{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	//Es admin para que los test que no son de la politica de roles puedan hacer de todo
+	token = firmarToken(jwt.SigningMethodHS256, auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user_test"}, Roles: []string{auth.RoleAdmin}})
 
 	port := os.Getenv("PORT")
 	address := fmt.Sprintf("127.0.0.1:%s", port)
 
 	//**Aqui a la varaibles clin que generemos, le pasaremos el addres pero con http://**
 	//Aqui usamle el client http que creamos (que iera lpara los sdk incialmente)
-	cli = client.New(nil, "http://"+address, 0, false)
+	urlBase = "http://" + address
+	cli = client.New(http.Header{"Authorization": []string{"Bearer " + token}}, urlBase, 0, false)
 
 	srv := &http.Server{
-		Handler:      accessControl(h), //Aquie le ponemos el acces control para deifnior op permitdas + el handler que definimos
+		Handler:      accessControl(handler.Authenticate(verifier, rutas, "/health")), //Aquie le ponemos el acces control para deifnior op permitdas + el handler que definimos
 		Addr:         address,
 		ReadTimeout:  5 * time.Second, //Con estos SETEAMOS TIMEOUT DE ESCRITURA Y DE LECTURA (cuanto timepo maximo la api permite)
 		WriteTimeout: 5 * time.Second, // Read es REQUEST, WRITE es RESPONE
@@ -97,13 +184,43 @@ func TestMain(m *testing.M) {
 
 	//Aqui generamos una fncion anonimo de tipo GOROUTINE (por eso es **go func()**). Y la ejecutams altiro (por eso temrina en "()" despies de la llave "}" )
 	//Ejecutamos el listenandserve() y si hay error retornamos eror al CANAL
+	//Abrimos el puerto antes de la goroutine, asi el servidor ya acepta conexiones cuando parten los test
+	//(sin bbdd el arranque es tan rapido que el primer request podia llegar antes del ListenAndServe)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Fatal(err)
+	}
 	go func() {
 		l.Println("listen in", address)
-		errCh <- srv.ListenAndServe() //Aqui ejecutamos el ListenAndServe y VAMOS A DEVOLVER UN ERROR al CANAL
+		errCh <- srv.Serve(listener) //Aqui ejecutamos el Serve y VAMOS A DEVOLVER UN ERROR al CANAL
+	}()
+
+	//El gRPC escucha en un puerto libre cualquiera
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(grpchandler.AuthInterceptor(verifier)))
+	pb.RegisterEnrollmentServiceServer(grpcServer, grpchandler.NewEnrollmentGRPCServer(ctx, enrollmentEndpoint))
+	grpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	grpcAddress = grpcListener.Addr().String()
+	go func() {
+		errCh <- grpcServer.Serve(grpcListener)
 	}()
+	//Igual que cli, el cliente gRPC manda el token en cada llamada
+	conToken := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token), method, req, reply, cc, opts...)
+	}
+	grpcConn, err := grpc.NewClient(grpcAddress, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithUnaryInterceptor(conToken))
+	if err != nil {
+		log.Fatal(err)
+	}
+	grpcCli = pb.NewEnrollmentServiceClient(grpcConn)
 
 	r := m.Run()
 
+	grpcConn.Close()
+	grpcServer.Stop()
+
 	//**Aqui bajamos el servidor una vez trerminado las pruebas
 	//Validamos si hay error**
 	if err := srv.Shutdown(ctx); err != nil {
@@ -111,19 +228,79 @@ func TestMain(m *testing.M) {
 	}
 
 	// Y al finalizar LOS TEST HAREMOS UN ROLLBACK y eliminanos todos lso dartos de las pruebas, asi dejamos limpia la bbdd
-	tx.Rollback()
+	if tx != nil {
+		tx.Rollback()
+	}
 	os.Exit(r)
 
 }
 
+// doRequest hace un request directo con net/http, para los metodos que no usamos con el cli (ej: DELETE, PUT)
+func doRequest(method, path string, body interface{}) (*http.Response, error) {
+	return doRequestWithHeaders(method, path, body, nil)
+}
+
+// doRequestWithHeaders es doRequest pero agregando headers (ej: If-Match)
+func doRequestWithHeaders(method, path string, body interface{}, headers map[string]string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, urlBase+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// firmarToken firma los claims con testSecret (HS256) o testRSAKey (RS256), si no traen exp vencen en una hora
+func firmarToken(metodo jwt.SigningMethod, claims auth.Claims) string {
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	}
+	t := jwt.NewWithClaims(metodo, claims)
+	var llave interface{} = []byte(testSecret)
+	if metodo == jwt.SigningMethodRS256 {
+		t.Header["kid"] = testRSAKeyID
+		llave = testRSAKey
+	}
+	firmado, err := t.SignedString(llave)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return firmado
+}
+
+// publicarOutbox publica todo lo pendiente de la outbox (tambien los eventos de los test anteriores)
+func publicarOutbox(t *testing.T) {
+	for {
+		publicados, err := relay.Flush(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if publicados == 0 {
+			return
+		}
+	}
+}
+
 // Aqui definimo operaciones que PERMITIREMOS y ademas recibimso un Handler original (que sera el que creamo en el main)
 func accessControl(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		//Aqui definimos operacione spermitidas, origin con * para que puedan venir DEDE CUALQUIER CLIENTE O LADO
-		w.Header().Set("Access-Control-Allow-Origin", "*")                                //origin con * para que puedan venir DEDE CUALQUIER CLIENTE O LADO
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, OPTIONS, HEAD") //Metodos permitidos
+		w.Header().Set("Access-Control-Allow-Origin", "*")                                             //origin con * para que puedan venir DEDE CUALQUIER CLIENTE O LADO
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS, HEAD") //Metodos permitidos
 		w.Header().Set("Access-Control-Allow-Headers",
-			"Accept,Authorization,Cache-Control,Content-Type,DNT,If-Modified-Since,Keep-Alive,Origin,User-Agent,X-Requested-With") //Header permitidos
+			"Accept,Authorization,Cache-Control,Content-Type,DNT,If-Modified-Since,Keep-Alive,Origin,User-Agent,X-Requested-With,X-Actor,If-Match,Last-Event-ID,Idempotency-Key") //Header permitidos
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed") //Header que el browser deja leer al cliente
 
 		if r.Method == "OPTIONS" {
 			return
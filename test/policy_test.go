@@ -0,0 +1,91 @@
+// Test funcionales de la politica de roles (student, instructor y admin)
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/auth"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// requestComo hace el request con el token de otro usuario (el de los claims) y decodifica el body en data si no es nil
+func requestComo(t *testing.T, claims auth.Claims, method, path string, body, data interface{}) int {
+	resp, err := doRequestWithHeaders(method, path, body, map[string]string{
+		"Authorization": "Bearer " + firmarToken(jwt.SigningMethodHS256, claims),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if data != nil {
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(data))
+	}
+	return resp.StatusCode
+}
+
+func TestPolicy(t *testing.T) {
+	courseid := "course_policy_test"
+	student := auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user_policy_student"}, Roles: []string{auth.RoleStudent}}
+	instructor := auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user_policy_instructor"}, Roles: []string{auth.RoleInstructor}, Courses: []string{courseid}}
+
+	//Uno del student y otro de otro usuario en el mismo curso, creados por el admin
+	propio := domain.Enrollment{}
+	resp := cli.Post("/enrollments", enrollment.CreateRequest{UserID: student.Subject, CourseID: courseid})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+	assert.Nil(t, resp.FillUp(&response.SuccessResponse{Data: &propio}))
+	ajeno := domain.Enrollment{}
+	resp = cli.Post("/enrollments", enrollment.CreateRequest{UserID: "user_policy_other", CourseID: courseid})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+	assert.Nil(t, resp.FillUp(&response.SuccessResponse{Data: &ajeno}))
+
+	t.Run("should only let students see and create their own enrollments", func(t *testing.T) {
+		lista := []domain.Enrollment{}
+		code := requestComo(t, student, http.MethodGet, "/enrollments?course_id="+courseid, nil, &response.SuccessResponse{Data: &lista})
+		assert.Equal(t, http.StatusOK, code, "should return status code 200")
+		if assert.Len(t, lista, 1, "should force the user_id filter") {
+			assert.Equal(t, propio.ID, lista[0].ID)
+		}
+
+		assert.Equal(t, http.StatusOK, requestComo(t, student, http.MethodGet, "/enrollments/"+propio.ID, nil, nil))
+
+		errResp := response.ErrorResponse{}
+		code = requestComo(t, student, http.MethodGet, "/enrollments/"+ajeno.ID, nil, &errResp)
+		assert.Equal(t, http.StatusNotFound, code, "should return status code 404 for the enrollments of other users")
+		assert.Equal(t, http.StatusNotFound, errResp.Status)
+		assert.NotEmpty(t, errResp.Message)
+		assert.Equal(t, http.StatusNotFound, requestComo(t, student, http.MethodGet, "/enrollments/"+ajeno.ID+"/history", nil, nil))
+
+		assert.Equal(t, http.StatusForbidden, requestComo(t, student, http.MethodGet, "/enrollments?user_id=user_policy_other", nil, nil))
+		assert.Equal(t, http.StatusForbidden, requestComo(t, student, http.MethodPost, "/enrollments",
+			enrollment.CreateRequest{UserID: "user_policy_other", CourseID: "course_policy_other"}, nil))
+		assert.Equal(t, http.StatusCreated, requestComo(t, student, http.MethodPost, "/enrollments",
+			enrollment.CreateRequest{UserID: student.Subject, CourseID: "course_policy_other"}, nil))
+
+		status := "A"
+		assert.Equal(t, http.StatusForbidden, requestComo(t, student, http.MethodPatch, "/enrollments/"+propio.ID, enrollment.UpdateRequest{Status: &status}, nil))
+	})
+
+	t.Run("should let instructors list and update the courses they teach", func(t *testing.T) {
+		lista := []domain.Enrollment{}
+		code := requestComo(t, instructor, http.MethodGet, "/enrollments", nil, &response.SuccessResponse{Data: &lista})
+		assert.Equal(t, http.StatusOK, code, "should return status code 200")
+		assert.Len(t, lista, 2, "should only list the courses they teach")
+
+		assert.Equal(t, http.StatusForbidden, requestComo(t, instructor, http.MethodGet, "/enrollments?course_id=course_policy_other", nil, nil))
+
+		status := "A"
+		assert.Equal(t, http.StatusOK, requestComo(t, instructor, http.MethodPatch, "/enrollments/"+ajeno.ID, enrollment.UpdateRequest{Status: &status}, nil))
+		assert.Equal(t, http.StatusForbidden, requestComo(t, instructor, http.MethodPost, "/enrollments",
+			enrollment.CreateRequest{UserID: instructor.Subject, CourseID: courseid}, nil))
+	})
+
+	t.Run("should keep the webhooks for admins", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, requestComo(t, instructor, http.MethodGet, "/webhooks", nil, nil))
+	})
+}
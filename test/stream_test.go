@@ -0,0 +1,147 @@
+// Test funcionales del stream SSE de enrollments (GET /enrollments/stream)
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+	"github.com/stretchr/testify/assert"
+)
+
+// mensajeSSE es un mensaje del stream ya parseado (los comentarios como el heartbeat vienen con comment)
+type mensajeSSE struct {
+	id      string
+	event   string
+	data    string
+	comment string
+}
+
+// abrirStream conecta al stream y va mandando los mensajes parseados al canal hasta que se cierra la respuesta
+func abrirStream(t *testing.T, path string, headers map[string]string) <-chan mensajeSSE {
+	resp, err := doRequestWithHeaders(http.MethodGet, path, nil, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	mensajes := make(chan mensajeSSE, 100)
+	go func() {
+		defer close(mensajes)
+		scanner := bufio.NewScanner(resp.Body)
+		var m mensajeSSE
+		for scanner.Scan() {
+			linea := scanner.Text()
+			switch {
+			case linea == "":
+				if m != (mensajeSSE{}) {
+					mensajes <- m
+				}
+				m = mensajeSSE{}
+			case strings.HasPrefix(linea, ":"):
+				m.comment = strings.TrimSpace(strings.TrimPrefix(linea, ":"))
+			case strings.HasPrefix(linea, "id: "):
+				m.id = strings.TrimPrefix(linea, "id: ")
+			case strings.HasPrefix(linea, "event: "):
+				m.event = strings.TrimPrefix(linea, "event: ")
+			case strings.HasPrefix(linea, "data: "):
+				m.data = strings.TrimPrefix(linea, "data: ")
+			}
+		}
+	}()
+	return mensajes
+}
+
+// esperarEvento devuelve el primer mensaje con event (se salta el retry y los heartbeat)
+func esperarEvento(t *testing.T, mensajes <-chan mensajeSSE) mensajeSSE {
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case m, ok := <-mensajes:
+			if !ok {
+				t.Fatal("the stream was closed")
+			}
+			if m.event != "" {
+				return m
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for an event")
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	courseid := "course_stream_test"
+	//Lo que quedo de los test anteriores no debe aparecer en el stream
+	publicarOutbox(t)
+
+	var ultimo mensajeSSE
+	t.Run("should stream the events of the filtered course", func(t *testing.T) {
+		mensajes := abrirStream(t, "/enrollments/stream?course_id="+courseid, nil)
+
+		resp := cli.Post("/enrollments", enrollment.CreateRequest{UserID: "user_other_course", CourseID: "course_stream_other"})
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+		resp = cli.Post("/enrollments", enrollment.CreateRequest{UserID: "user_stream_test", CourseID: courseid})
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+		dataCreated := domain.Enrollment{}
+		assert.Nil(t, resp.FillUp(&response.SuccessResponse{Data: &dataCreated}))
+
+		status := "A"
+		httpResp, err := doRequest(http.MethodPatch, "/enrollments/"+dataCreated.ID, enrollment.UpdateRequest{Status: &status})
+		assert.Nil(t, err, "should not return an error")
+		httpResp.Body.Close()
+		assert.Equal(t, http.StatusOK, httpResp.StatusCode, "should return status code 200")
+		publicarOutbox(t)
+
+		creado := esperarEvento(t, mensajes)
+		assert.Equal(t, enrollment.EventEnrollmentCreated, creado.event)
+		assert.NotEmpty(t, creado.id)
+		evento := enrollment.Event{}
+		assert.Nil(t, json.Unmarshal([]byte(creado.data), &evento))
+		assert.Equal(t, dataCreated.ID, evento.EnrollmentID)
+		assert.Equal(t, courseid, evento.CourseID)
+
+		ultimo = esperarEvento(t, mensajes)
+		assert.Equal(t, enrollment.EventEnrollmentStatusChanged, ultimo.event)
+	})
+
+	t.Run("should resume from the Last-Event-ID and send heartbeats", func(t *testing.T) {
+		resp := cli.Post("/enrollments", enrollment.CreateRequest{UserID: "user_stream_resume", CourseID: courseid})
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+		publicarOutbox(t)
+
+		mensajes := abrirStream(t, "/enrollments/stream?course_id="+courseid, map[string]string{"Last-Event-ID": ultimo.id})
+		m := esperarEvento(t, mensajes)
+		assert.Equal(t, enrollment.EventEnrollmentCreated, m.event)
+		assert.Contains(t, m.data, "user_stream_resume")
+
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case m, ok := <-mensajes:
+				if !ok {
+					t.Fatal("the stream was closed")
+				}
+				if m.comment == "heartbeat" {
+					return
+				}
+			case <-timeout:
+				t.Fatal("timeout waiting for a heartbeat")
+			}
+		}
+	})
+
+	t.Run("should send a reset when the Last-Event-ID is unknown", func(t *testing.T) {
+		mensajes := abrirStream(t, "/enrollments/stream?user_id=nadie&last_event_id=abc", nil)
+		m := esperarEvento(t, mensajes)
+		assert.Equal(t, "reset", m.event)
+	})
+}
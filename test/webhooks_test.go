@@ -0,0 +1,134 @@
+// Test funcionales de los webhooks (suscripciones, entregas firmadas y replay)
+package test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/IgnacioBO/go_lib_response/response"
+	"github.com/IgnacioBO/gomicro_domain/domain"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/enrollment"
+	"github.com/IgnacioBO/gomicro_enrollment/internal/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhooks(t *testing.T) {
+	//El partner es un httptest.Server que guarda los headers y el body de cada entrega
+	var mu sync.Mutex
+	var headers []http.Header
+	var bodies []string
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer partner.Close()
+
+	courseid := "course_webhook_test"
+	var subscription webhook.Subscription
+
+	t.Run("should create a subscription and hide its secret afterwards", func(t *testing.T) {
+		resp := cli.Post("/webhooks", webhook.CreateRequest{
+			URL:        partner.URL,
+			EventTypes: []string{enrollment.EventEnrollmentCreated},
+			CourseID:   courseid,
+		})
+		assert.Nil(t, resp.Err, "should not return an error")
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+		assert.Nil(t, resp.FillUp(&response.SuccessResponse{Data: &subscription}))
+		assert.NotEmpty(t, subscription.Secret, "should return the generated secret")
+
+		resp = cli.Get("/webhooks/" + subscription.ID)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+		got := webhook.Subscription{}
+		assert.Nil(t, resp.FillUp(&response.SuccessResponse{Data: &got}))
+		assert.Empty(t, got.Secret, "should not return the secret")
+		assert.Equal(t, courseid, got.CourseID)
+	})
+
+	t.Run("should deliver a signed event and replay it", func(t *testing.T) {
+		resp := cli.Post("/enrollments", enrollment.CreateRequest{UserID: "user_webhook_test", CourseID: courseid})
+		assert.Equal(t, http.StatusCreated, resp.StatusCode, "should return status code 201")
+		dataCreated := domain.Enrollment{}
+		assert.Nil(t, resp.FillUp(&response.SuccessResponse{Data: &dataCreated}))
+
+		publicarOutbox(t)
+		_, err := deliverer.Flush(context.Background())
+		assert.Nil(t, err, "should not return an error")
+
+		mu.Lock()
+		if !assert.Len(t, bodies, 1, "should deliver only the matching event") {
+			mu.Unlock()
+			return
+		}
+		assert.Contains(t, bodies[0], dataCreated.ID)
+		assert.True(t, webhook.VerifySignature(subscription.Secret, headers[0].Get(webhook.HeaderTimestamp), []byte(bodies[0]), headers[0].Get(webhook.HeaderSignature)), "should sign the delivery")
+		mu.Unlock()
+
+		resp = cli.Get("/webhooks/" + subscription.ID + "/deliveries")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+		deliveries := []webhook.Delivery{}
+		assert.Nil(t, resp.FillUp(&response.SuccessResponse{Data: &deliveries}))
+		if !assert.Len(t, deliveries, 1) {
+			return
+		}
+		assert.Equal(t, webhook.DeliveryDelivered, deliveries[0].Status)
+		assert.Equal(t, http.StatusNoContent, deliveries[0].LastStatusCode)
+
+		resp = cli.Post(fmt.Sprintf("/webhooks/deliveries/%d/replay", deliveries[0].ID), nil)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode, "should return status code 202")
+		_, err = deliverer.Flush(context.Background())
+		assert.Nil(t, err, "should not return an error")
+		mu.Lock()
+		assert.Len(t, bodies, 2, "should deliver the event again")
+		mu.Unlock()
+
+		resp = cli.Get("/webhooks/deliveries?status=dead&subscription_id=" + subscription.ID)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+		deliveries = []webhook.Delivery{}
+		assert.Nil(t, resp.FillUp(&response.SuccessResponse{Data: &deliveries}))
+		assert.Empty(t, deliveries)
+	})
+
+	t.Run("should reject invalid subscriptions and unknown ids", func(t *testing.T) {
+		resp := cli.Post("/webhooks", webhook.CreateRequest{URL: "not a url"})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "should return status code 400")
+		resp = cli.Post("/webhooks", webhook.CreateRequest{URL: partner.URL, EventTypes: []string{"EnrollmentExploded"}})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "should return status code 400")
+		resp = cli.Get("/webhooks/deliveries?status=lost")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "should return status code 400")
+
+		resp = cli.Get("/webhooks/no-existe")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "should return status code 404")
+		resp = cli.Post("/webhooks/deliveries/abc/replay", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "should return status code 404")
+	})
+
+	t.Run("should update and delete a subscription", func(t *testing.T) {
+		resp, err := doRequest(http.MethodPatch, "/webhooks/"+subscription.ID, map[string]interface{}{"active": false})
+		assert.Nil(t, err, "should not return an error")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.True(t, strings.Contains(string(body), `"active":false`), "should return the updated subscription")
+
+		resp, err = doRequest(http.MethodDelete, "/webhooks/"+subscription.ID, nil)
+		assert.Nil(t, err, "should not return an error")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "should return status code 200")
+
+		resp, err = doRequest(http.MethodDelete, "/webhooks/"+subscription.ID, nil)
+		assert.Nil(t, err, "should not return an error")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "should return status code 404")
+	})
+}